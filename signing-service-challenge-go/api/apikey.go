@@ -0,0 +1,141 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+type CreateAPIKeyRequest struct {
+	// TenantId issues the key for another tenant than the caller's. It is only
+	// honored for callers with the platform scope.
+	TenantId string         `json:"tenant_id"`
+	Name     string         `json:"name"`
+	Scopes   []domain.Scope `json:"scopes"`
+}
+
+// CreateAPIKeyResponse carries the secret of a freshly issued key. It is the only
+// time the secret is revealed, the service keeps its hash only.
+type CreateAPIKeyResponse struct {
+	*domain.APIKey
+	Key string `json:"key"`
+}
+
+var apiKeyIdParameter = Parameter{
+	Name:     "key_id",
+	In:       "path",
+	Required: true,
+	Schema:   &Schema{Type: "string"},
+}
+
+var createAPIKeyOperation = &Operation{
+	OperationId: "createAPIKey",
+	Summary:     "Issues an API key acting on behalf of the caller's tenant, or of tenant_id for callers with the platform scope. The secret is only returned in this response.",
+	RequestBody: &RequestBody{Required: true, Content: jsonBody(ref("CreateAPIKeyRequest"))},
+	Responses: map[string]*ResponseObject{
+		"201": success("The issued API key including its secret.", ref("CreateAPIKeyResponse")),
+		"400": failure("The request payload is invalid."),
+		"403": failure("The platform scope is requested by a caller without it."),
+		"404": failure("The organization does not exist."),
+	},
+}
+
+var listAPIKeysOperation = &Operation{
+	OperationId: "listAPIKeys",
+	Summary:     "Lists the API keys of the caller's tenant, or of all tenants for callers with the platform scope, without their secrets.",
+	Responses: map[string]*ResponseObject{
+		"200": success("The API keys.", &Schema{Type: "array", Items: ref("APIKey")}),
+	},
+}
+
+var revokeAPIKeyOperation = &Operation{
+	OperationId: "revokeAPIKey",
+	Summary:     "Revokes an API key of the caller's tenant, or of any tenant for callers with the platform scope.",
+	Parameters:  []Parameter{apiKeyIdParameter},
+	Responses: map[string]*ResponseObject{
+		"200": success("The revoked API key.", ref("APIKey")),
+		"404": failure("The API key does not exist or belongs to another tenant."),
+	},
+}
+
+func (s *Server) CreateAPIKeyHandler(response http.ResponseWriter, request *http.Request) {
+	var createReq CreateAPIKeyRequest
+	if err := s.decode(request, &createReq); err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	// Tenant admins issue keys for their own tenant only, whatever the body says.
+	tenantId := TenantId(request)
+	if s.platform(request) && createReq.TenantId != "" {
+		if _, err := s.repo.GetOrganization(request.Context(), createReq.TenantId); err != nil {
+			s.writeError(response, request, err)
+			return
+		}
+		tenantId = createReq.TenantId
+	}
+
+	key, secret, err := domain.NewAPIKey(uuid.New().String(), createReq.Name, createReq.Scopes)
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+	key.TenantId = tenantId
+	if slices.Contains(key.Scopes, domain.ScopePlatform) {
+		if !s.platform(request) {
+			s.writeError(response, request, forbidden(domain.ScopePlatform))
+			return
+		}
+		if tenantId != "" {
+			s.writeError(response, request, fmt.Errorf("%w: %s cannot be granted to the key of a tenant", domain.ErrInvalidScope, domain.ScopePlatform))
+			return
+		}
+	}
+
+	if err := s.repo.SaveAPIKey(request.Context(), key); err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusCreated, CreateAPIKeyResponse{APIKey: key, Key: secret})
+}
+
+func (s *Server) ListAPIKeysHandler(response http.ResponseWriter, request *http.Request) {
+	keys, err := s.repo.ListAPIKeys(request.Context())
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+	if !s.platform(request) {
+		tenantId := TenantId(request)
+		keys = slices.DeleteFunc(keys, func(key *domain.APIKey) bool { return key.TenantId != tenantId })
+	}
+
+	WriteAPIResponse(response, http.StatusOK, keys)
+}
+
+func (s *Server) RevokeAPIKeyHandler(response http.ResponseWriter, request *http.Request) {
+	key, err := s.repo.GetAPIKey(request.Context(), mux.Vars(request)["key_id"])
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+	if key.TenantId != TenantId(request) && !s.platform(request) {
+		s.writeError(response, request, domain.ErrAPIKeyNotFound)
+		return
+	}
+
+	revoked := *key
+	revoked.Revoke()
+	if err := s.repo.SaveAPIKey(request.Context(), &revoked); err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, &revoked)
+}
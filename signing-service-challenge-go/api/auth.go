@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+type contextKey int
+
+const apiKeyContextKey contextKey = iota
+
+var apiKeySecurityScheme = &SecurityScheme{
+	Type:        "http",
+	Scheme:      "bearer",
+	Description: "An API key passed as bearer token or in the X-API-Key header.",
+}
+
+// Authenticate is a middleware that only admits requests carrying an active API key,
+// or a client certificate of a known ClientIdentity, that has been granted the scope.
+// API keys take precedence over client certificates. Requests for routes without a scope are always admitted.
+func (s *Server) Authenticate(scope domain.Scope, next http.Handler) http.Handler {
+	if !s.authentication || scope == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		secret := apiKeySecret(request)
+		key, ok := s.clientCertificateKey(request)
+		if secret == "" && !ok {
+			response.Header().Set("WWW-Authenticate", "Bearer")
+			s.writeError(response, request, unauthenticated())
+			return
+		}
+
+		if secret != "" {
+			var err error
+			key, err = s.repo.GetAPIKeyByHash(request.Context(), domain.HashAPIKeySecret(secret))
+			if err != nil || key.RevokedAt != nil {
+				response.Header().Set("WWW-Authenticate", "Bearer")
+				s.writeError(response, request, unauthenticated())
+				return
+			}
+		}
+
+		if !key.Allows(scope) {
+			s.writeError(response, request, forbidden(scope))
+			return
+		}
+
+		logAPIKey(request, key)
+		ctx := context.WithValue(request.Context(), apiKeyContextKey, key)
+		next.ServeHTTP(response, request.WithContext(ctx))
+	})
+}
+
+// ClientIdentity is what the clients presenting a certificate for a common name may do.
+type ClientIdentity struct {
+	TenantId string
+	Scopes   []domain.Scope
+}
+
+// clientCertificateKey maps the verified client certificate of a request to the APIKey
+// of its ClientIdentity. The key is never stored, its id names the certificate subject.
+func (s *Server) clientCertificateKey(request *http.Request) (*domain.APIKey, bool) {
+	if request.TLS == nil || len(request.TLS.VerifiedChains) == 0 || len(request.TLS.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+
+	commonName := request.TLS.VerifiedChains[0][0].Subject.CommonName
+	identity, ok := s.clientIdentities[commonName]
+	if !ok {
+		return nil, false
+	}
+
+	return &domain.APIKey{
+		Id:       "certificate:" + commonName,
+		TenantId: identity.TenantId,
+		Name:     commonName,
+		Scopes:   identity.Scopes,
+	}, true
+}
+
+// APIKeyFromContext returns the APIKey that authenticated a request, if any.
+func APIKeyFromContext(ctx context.Context) (*domain.APIKey, bool) {
+	key, ok := ctx.Value(apiKeyContextKey).(*domain.APIKey)
+	return key, ok
+}
+
+// TenantId resolves the tenant a request acts on from the API key that authenticated it.
+// Unauthenticated requests and keys without a tenant act on the default tenant.
+func TenantId(request *http.Request) string {
+	if key, ok := APIKeyFromContext(request.Context()); ok {
+		return key.TenantId
+	}
+	return ""
+}
+
+// platform reports whether a request may manage the API keys and organizations of
+// every tenant, either because its API key holds domain.ScopePlatform or because the
+// Server does not authenticate requests at all.
+func (s *Server) platform(request *http.Request) bool {
+	if !s.authentication {
+		return true
+	}
+	key, ok := APIKeyFromContext(request.Context())
+	return ok && key.Allows(domain.ScopePlatform)
+}
+
+func apiKeySecret(request *http.Request) string {
+	if secret := request.Header.Get(apiKeyHeader); secret != "" {
+		return secret
+	}
+
+	scheme, token, found := strings.Cut(request.Header.Get("Authorization"), " ")
+	if found && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
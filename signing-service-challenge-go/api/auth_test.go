@@ -0,0 +1,167 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+const adminSecret = "admin-secret"
+
+func newAuthenticatedServer(t *testing.T) (*Server, *persistence.MockRepository) {
+	mockRepo := persistence.NewMockRepository()
+	admin, err := domain.NewAPIKeyWithSecret("admin", "admin", adminSecret, []domain.Scope{domain.ScopeAdmin, domain.ScopePlatform})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockRepo.APIKeys[admin.Id] = admin
+
+	return NewServer(":8080", mockRepo, WithAuthentication()), mockRepo
+}
+
+func serve(server *Server, method, path, secret string, body interface{}) *httptest.ResponseRecorder {
+	var payload bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&payload).Encode(body)
+	}
+
+	req := httptest.NewRequest(method, apiPrefix+path, &payload)
+	if secret != "" {
+		req.Header.Set("Authorization", "Bearer "+secret)
+	}
+
+	recorder := httptest.NewRecorder()
+	server.Handler().ServeHTTP(recorder, req)
+	return recorder
+}
+
+func issueKey(t *testing.T, server *Server, scopes ...domain.Scope) CreateAPIKeyResponse {
+	recorder := serve(server, "POST", "/admin/keys", adminSecret, CreateAPIKeyRequest{Name: "test", Scopes: scopes})
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, recorder.Code, recorder.Body)
+	}
+
+	var response struct {
+		Data CreateAPIKeyResponse `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Error unmarshaling response body: %v", err)
+	}
+	return response.Data
+}
+
+func TestAuthenticateRejectsMissingKey(t *testing.T) {
+	server, _ := newAuthenticatedServer(t)
+
+	recorder := serve(server, "GET", "/devices", "", nil)
+
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, recorder.Code)
+	}
+	if recorder.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("Expected a WWW-Authenticate header")
+	}
+}
+
+func TestAuthenticateAllowsPublicRoutes(t *testing.T) {
+	server, _ := newAuthenticatedServer(t)
+
+	recorder := serve(server, "GET", "/health", "", nil)
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, recorder.Code)
+	}
+}
+
+func TestAuthenticateEnforcesScopes(t *testing.T) {
+	server, _ := newAuthenticatedServer(t)
+	reader := issueKey(t, server, domain.ScopeDevicesRead)
+
+	recorder := serve(server, "GET", "/devices", reader.Key, nil)
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, recorder.Code)
+	}
+
+	recorder = serve(server, "POST", "/devices", reader.Key, CreateSignatureDeviceRequest{Algorithm: "ECC"})
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, recorder.Code)
+	}
+}
+
+func TestRevokedKeyIsRejected(t *testing.T) {
+	server, mockRepo := newAuthenticatedServer(t)
+	reader := issueKey(t, server, domain.ScopeDevicesRead)
+
+	recorder := serve(server, "DELETE", "/admin/keys/"+reader.Id, adminSecret, nil)
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, recorder.Code)
+	}
+	if mockRepo.APIKeys[reader.Id].RevokedAt == nil {
+		t.Errorf("Expected the key to be revoked")
+	}
+
+	recorder = serve(server, "GET", "/devices", reader.Key, nil)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, recorder.Code)
+	}
+}
+
+func TestSignTransactionRecordsAPIKey(t *testing.T) {
+	server, mockRepo := newAuthenticatedServer(t)
+	signer := issueKey(t, server, domain.ScopeSign)
+
+	device, err := domain.NewSignatureDevice("device", "ECC", "Device")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockRepo.Devices[device.Id] = device
+
+	recorder := serve(server, "POST", "/transactions/sign", signer.Key, SignTransactionRequest{DeviceId: device.Id, Data: "data"})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, recorder.Code)
+	}
+
+	if len(mockRepo.Transactions) != 1 {
+		t.Fatalf("Expected %d recorded transaction, got %d", 1, len(mockRepo.Transactions))
+	}
+	if mockRepo.Transactions[0].APIKeyId != signer.Id {
+		t.Errorf("Expected API key id %s, got %s", signer.Id, mockRepo.Transactions[0].APIKeyId)
+	}
+}
+
+func TestListAPIKeysHidesSecrets(t *testing.T) {
+	server, _ := newAuthenticatedServer(t)
+	issued := issueKey(t, server, domain.ScopeAudit)
+
+	recorder := serve(server, "GET", "/admin/keys", adminSecret, nil)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, recorder.Code)
+	}
+	if bytes.Contains(recorder.Body.Bytes(), []byte(issued.Key)) {
+		t.Errorf("Listed keys must not contain secrets")
+	}
+}
+
+func TestSuspendRequiresDevicesManageScope(t *testing.T) {
+	server, mockRepo := newAuthenticatedServer(t)
+	admin := issueKey(t, server, domain.ScopeAdmin)
+	manager := issueKey(t, server, domain.ScopeDevicesManage)
+
+	device, err := domain.NewSignatureDevice("device", "ECC", "Device")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockRepo.Devices[device.Id] = device
+
+	if recorder := serve(server, "POST", "/devices/"+device.Id+"/suspend", admin.Key, nil); recorder.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, recorder.Code)
+	}
+	if recorder := serve(server, "POST", "/devices/"+device.Id+"/suspend", manager.Key, nil); recorder.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body)
+	}
+}
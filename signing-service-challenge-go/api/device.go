@@ -1,96 +1,451 @@
 package api
 
 import (
-	"encoding/json"
+	"context"
+	"encoding/base64"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"net/http"
+	"time"
 
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/audit"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/devicelock"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
 )
 
 type CreateSignatureDeviceRequest struct {
-	Algorithm string `json:"algorithm"`
-	Label     string `json:"label"`
+	Algorithm         string `json:"algorithm"`
+	Label             string `json:"label"`
+	SecuredDataFormat string `json:"secured_data_format,omitempty"`
 }
 
 type SignTransactionRequest struct {
 	DeviceId string `json:"device_id"`
 	Data     string `json:"data"`
+	// Encoding is how Data encodes the payload: utf-8 (the default), base64 or hex.
+	Encoding string `json:"encoding,omitempty"`
+	// Digest is sha256 if the payload is a precomputed SHA-256 digest of a document.
+	Digest string `json:"digest,omitempty"`
+}
+
+type PublicKeyResponse struct {
+	DeviceId  string `json:"device_id"`
+	Algorithm string `json:"algorithm"`
+	PublicKey string `json:"public_key"`
+}
+
+var deviceIdParameter = Parameter{
+	Name:     "device_id",
+	In:       "path",
+	Required: true,
+	Schema:   &Schema{Type: "string"},
+}
+
+// deviceIdQueryParameter and digestQueryParameter describe application/octet-stream
+// sign requests, whose body is the payload.
+var deviceIdQueryParameter = Parameter{
+	Name:   "device_id",
+	In:     "query",
+	Schema: &Schema{Type: "string"},
+}
+
+var digestQueryParameter = Parameter{
+	Name:   "digest",
+	In:     "query",
+	Schema: &Schema{Type: "string", Enum: []string{DigestSHA256}},
+}
+
+var createSignatureDeviceOperation = &Operation{
+	OperationId: "createSignatureDevice",
+	Summary:     "Creates a signature device with a freshly generated key pair.",
+	RequestBody: &RequestBody{Required: true, Content: jsonBody(ref("CreateSignatureDeviceRequest"))},
+	Responses: map[string]*ResponseObject{
+		"201": success("The created signature device.", ref("SignatureDevice")),
+		"400": failure("The request payload is invalid."),
+		"500": failure("The device could not be created."),
+	},
+}
+
+var signTransactionOperation = &Operation{
+	OperationId: "signTransaction",
+	Summary:     "Signs transaction data with a signature device.",
+	Parameters:  []Parameter{deviceIdQueryParameter, digestQueryParameter},
+	RequestBody: &RequestBody{Required: true, Content: map[string]MediaType{
+		"application/json":     {Schema: ref("SignTransactionRequest")},
+		octetStreamContentType: {Schema: &Schema{Type: "string", Format: "binary"}},
+	}},
+	Responses: map[string]*ResponseObject{
+		"200": success("The signature and the secured data it was created over.", ref("SignatureResponse")),
+		"400": failure("The request payload is invalid."),
+		"404": failure("The signature device does not exist."),
+		"409": failure("The signature device is suspended."),
+		"429": failure("The rate limit of the device is exhausted."),
+		"500": failure("The transaction could not be signed."),
+		"503": failure("The server is shutting down."),
+	},
+}
+
+var listSignatureDevicesOperation = &Operation{
+	OperationId: "listSignatureDevices",
+	Summary:     "Lists all signature devices of the tenant, ordered by id.",
+	Parameters:  pageParameters,
+	Responses: map[string]*ResponseObject{
+		"200": successPage("The signature devices, or a page of them if a limit is given.", ref("SignatureDevice")),
+		"400": failure("The limit or the cursor is invalid."),
+		"500": failure("The devices could not be listed."),
+	},
+}
+
+var listTransactionsOperation = &Operation{
+	OperationId: "listTransactions",
+	Summary:     "Lists the transactions signed by a signature device, including the API key that requested them.",
+	Parameters:  append([]Parameter{deviceIdParameter}, pageParameters...),
+	Responses: map[string]*ResponseObject{
+		"200": successPage("The transactions ordered by signature counter, or a page of them if a limit is given.", ref("Transaction")),
+		"400": failure("The limit or the cursor is invalid."),
+		"404": failure("The signature device does not exist."),
+	},
+}
+
+var getSignatureDeviceOperation = &Operation{
+	OperationId: "getSignatureDevice",
+	Summary:     "Retrieves a single signature device.",
+	Parameters:  []Parameter{deviceIdParameter},
+	Responses: map[string]*ResponseObject{
+		"200": success("The signature device.", ref("SignatureDevice")),
+		"400": failure("The device id is missing."),
+		"404": failure("The signature device does not exist."),
+	},
+}
+
+var getPublicKeyOperation = &Operation{
+	OperationId: "getPublicKey",
+	Summary:     "Exports the public key that verifies the signatures of a signature device.",
+	Parameters:  []Parameter{deviceIdParameter},
+	Responses: map[string]*ResponseObject{
+		"200": success("The public key.", ref("PublicKeyResponse")),
+		"404": failure("The signature device does not exist."),
+		"500": failure("The public key could not be exported."),
+	},
+}
+
+var suspendSignatureDeviceOperation = &Operation{
+	OperationId: "suspendSignatureDevice",
+	Summary:     "Suspends a signature device, which then refuses to sign transactions. Suspending is idempotent.",
+	Parameters:  []Parameter{deviceIdParameter},
+	Responses: map[string]*ResponseObject{
+		"200": success("The suspended signature device.", ref("SignatureDevice")),
+		"404": failure("The signature device does not exist."),
+		"500": failure("The device could not be suspended."),
+	},
+}
+
+var rotateSignatureDeviceOperation = &Operation{
+	OperationId: "rotateSignatureDevice",
+	Summary:     "Rotates the key of a signature device: creates its successor with a fresh key pair and suspends the device.",
+	Parameters:  []Parameter{deviceIdParameter},
+	Responses: map[string]*ResponseObject{
+		"201": success("The successor of the signature device.", ref("SignatureDevice")),
+		"404": failure("The signature device does not exist."),
+		"409": failure("The signature device is already rotated."),
+		"500": failure("The successor could not be created."),
+	},
 }
 
 func (s *Server) CreateSignatureDeviceHandler(response http.ResponseWriter, request *http.Request) {
 	var createReq CreateSignatureDeviceRequest
-	if err := json.NewDecoder(request.Body).Decode(&createReq); err != nil {
-		WriteErrorResponse(response, http.StatusBadRequest, []string{"Invalid request payload"})
+	if err := s.decode(request, &createReq); err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	format, err := domain.ParseSecuredDataFormat(createReq.SecuredDataFormat)
+	if err != nil {
+		s.writeError(response, request, err)
 		return
 	}
 
 	deviceId := uuid.New().String()
 
-	device, err := domain.NewSignatureDevice(deviceId, createReq.Algorithm, createReq.Label)
+	device, err := domain.NewSignatureDeviceWithKeys(request.Context(), deviceId, createReq.Algorithm, createReq.Label, s.keys)
 	if err != nil {
-		WriteErrorResponse(response, http.StatusInternalServerError, []string{err.Error()})
+		s.writeError(response, request, err)
 		return
 	}
+	device.TenantId = TenantId(request)
+	device.SecuredDataFormat = format
 
-	err = s.repo.SaveSignatureDevice(device)
+	event, err := newEvent(domain.EventDeviceCreated, device, device)
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+	err = s.repo.SaveSignatureDevice(request.Context(), device, event)
 	if err != nil {
-		WriteErrorResponse(response, http.StatusInternalServerError, []string{err.Error()})
+		s.writeError(response, request, err)
 		return
 	}
+	logDevice(request, device.Id)
+	s.audit(request, audit.Entry{Event: audit.EventDeviceCreated, DeviceId: device.Id, Algorithm: device.Algorithm})
 
 	WriteAPIResponse(response, http.StatusCreated, device)
 }
 
 func (s *Server) SignTransactionHandler(response http.ResponseWriter, request *http.Request) {
-	var signReq SignTransactionRequest
-	if err := json.NewDecoder(request.Body).Decode(&signReq); err != nil {
-		WriteErrorResponse(response, http.StatusBadRequest, []string{"Invalid request payload"})
+	if !s.drain.enter() {
+		s.writeError(response, request, shuttingDown())
+		return
+	}
+	defer s.drain.leave()
+
+	deviceId, payload, err := s.signRequest(request, true)
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	logDevice(request, deviceId)
+	device, err := s.repo.GetSignatureDevice(request.Context(), TenantId(request), deviceId)
+	if err != nil {
+		s.writeError(response, request, err)
 		return
 	}
 
-	device, err := s.repo.GetSignatureDevice(signReq.DeviceId)
+	if s.limiter != nil && !s.allow(response, request, s.limiter.Device(device.TenantId, device.Id)) {
+		return
+	}
+	device, lease, err := s.lockDevice(request.Context(), device)
 	if err != nil {
-		WriteErrorResponse(response, http.StatusNotFound, []string{err.Error()})
+		s.writeError(response, request, err)
 		return
 	}
+	release := s.releaser(lease)
+	defer release()
 
-	signature, signedData, err := device.SignTransaction(signReq.Data)
+	stored, err := s.storedSignature(request, device.TenantId)
 	if err != nil {
-		WriteErrorResponse(response, http.StatusInternalServerError, []string{err.Error()})
+		s.writeError(response, request, err)
+		return
+	}
+	if stored != nil {
+		response.Header().Set(idempotentReplayedHeader, "true")
+		WriteAPIResponse(response, http.StatusOK, signatureResponse(stored))
 		return
 	}
 
-	WriteAPIResponse(response, http.StatusOK, map[string]string{
-		"signature":   signature,
-		"signed_data": signedData,
+	// Once the signature is created, the transaction must be stored even if the
+	// client hangs up, so signing does not inherit the cancellation of the request.
+	ctx := context.WithoutCancel(request.Context())
+
+	transaction, err := device.SignPayload(ctx, payload, s.commit(ctx, request, lease, device))
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+	release()
+	transaction = s.signed(ctx, request, device, transaction)
+
+	WriteAPIResponse(response, http.StatusOK, signatureResponse(transaction))
+}
+
+// commit returns the domain.Commit that stores a signature of device together with
+// its event. It runs under the locks of the device, so anything that can wait
+// until they are released is left to signed. The signature is dropped if the
+// lease of the device was lost, and the counter stays where it was if it is not
+// stored.
+func (s *Server) commit(ctx context.Context, request *http.Request, lease devicelock.Lease, device *domain.SignatureDevice) domain.Commit {
+	return func(transaction *domain.Transaction, fiscal *domain.FiscalTransaction) error {
+		if key, ok := APIKeyFromContext(ctx); ok {
+			transaction.APIKeyId = key.Id
+		}
+		recordIdempotency(ctx, transaction)
+
+		event, err := newEvent(domain.EventTransactionSigned, device, transaction)
+		if err != nil {
+			return err
+		}
+		if err := held(lease); err != nil {
+			return err
+		}
+		return s.repo.SaveTransaction(ctx, fence(lease), transaction, fiscal, event)
+	}
+}
+
+// signed completes a signature of device stored by commit once the locks of the
+// device are released: it attaches a timestamp token if a timestamp authority is
+// configured and records the signature in the audit log. It returns the
+// transaction to respond with.
+func (s *Server) signed(ctx context.Context, request *http.Request, device *domain.SignatureDevice, transaction *domain.Transaction) *domain.Transaction {
+	if s.timestamper != nil {
+		transaction = s.timestamp(ctx, transaction)
+	}
+	s.audit(request, audit.Entry{
+		Event:         audit.EventSignatureIssued,
+		DeviceId:      device.Id,
+		Algorithm:     device.Algorithm,
+		Counter:       transaction.Counter,
+		TransactionId: transaction.TransactionId,
 	})
+	return transaction
+}
+
+// signatureResponse describes a signature as a SignatureResponse.
+func signatureResponse(transaction *domain.Transaction) map[string]string {
+	signature := map[string]string{
+		"signature":           transaction.Signature,
+		"signed_data":         transaction.SignedData,
+		"secured_data_format": string(transaction.SecuredDataFormat),
+		"data_encoding":       string(transaction.DataEncoding),
+		"signed_at":           transaction.CreatedAt.Format(time.RFC3339Nano),
+	}
+	if transaction.TimestampToken != nil {
+		signature["timestamp_token"] = base64.StdEncoding.EncodeToString(transaction.TimestampToken)
+		signature["timestamped_at"] = transaction.TimestampedAt.Format(time.RFC3339)
+	}
+	return signature
 }
 
 func (s *Server) ListSignatureDevicesHandler(response http.ResponseWriter, request *http.Request) {
-	devices, err := s.repo.ListSignatureDevices()
+	page, err := parsePageRequest(request)
 	if err != nil {
-		WriteErrorResponse(response, http.StatusInternalServerError, []string{err.Error()})
+		s.writeError(response, request, err)
 		return
 	}
 
-	WriteAPIResponse(response, http.StatusOK, devices)
+	devices, err := s.repo.ListSignatureDevices(request.Context(), TenantId(request))
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	devices, next := paginate(devices, page, func(device *domain.SignatureDevice) string { return device.Id })
+	WritePage(response, devices, next)
 }
 
 func (s *Server) GetSignatureDeviceHandler(response http.ResponseWriter, request *http.Request) {
 	deviceId := mux.Vars(request)["device_id"]
 
 	if deviceId == "" {
-		WriteErrorResponse(response, http.StatusBadRequest, []string{"Missing device_id parameter"})
+		s.writeError(response, request, validationFailed(ValidationError{Field: "device_id", Message: "is required"}))
 		return
 	}
 
-	device, err := s.repo.GetSignatureDevice(deviceId)
+	device, err := s.repo.GetSignatureDevice(request.Context(), TenantId(request), deviceId)
 	if err != nil {
-		WriteErrorResponse(response, http.StatusNotFound, []string{err.Error()})
+		s.writeError(response, request, err)
 		return
 	}
 
 	WriteAPIResponse(response, http.StatusOK, device)
 }
+
+func (s *Server) ListTransactionsHandler(response http.ResponseWriter, request *http.Request) {
+	page, err := parsePageRequest(request)
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	device, err := s.repo.GetSignatureDevice(request.Context(), TenantId(request), mux.Vars(request)["device_id"])
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	transactions, err := s.repo.ListTransactions(request.Context(), device.TenantId, device.Id)
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	transactions, next := paginate(transactions, page, func(transaction *domain.Transaction) string { return counterKey(transaction.Counter) })
+	WritePage(response, transactions, next)
+}
+
+func (s *Server) GetPublicKeyHandler(response http.ResponseWriter, request *http.Request) {
+	device, err := s.repo.GetSignatureDevice(request.Context(), TenantId(request), mux.Vars(request)["device_id"])
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	publicKey, err := device.PublicKey()
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+	s.audit(request, audit.Entry{Event: audit.EventKeyExported, DeviceId: device.Id, Algorithm: device.Algorithm})
+
+	WriteAPIResponse(response, http.StatusOK, PublicKeyResponse{
+		DeviceId:  device.Id,
+		Algorithm: device.Algorithm,
+		PublicKey: string(publicKey),
+	})
+}
+
+func (s *Server) SuspendSignatureDeviceHandler(response http.ResponseWriter, request *http.Request) {
+	device, err := s.repo.GetSignatureDevice(request.Context(), TenantId(request), mux.Vars(request)["device_id"])
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+	device, lease, err := s.lockDevice(request.Context(), device)
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+	defer s.release(lease)
+
+	if device.Suspend() {
+		event, err := newEvent(domain.EventDeviceStatusChanged, device, device)
+		if err != nil {
+			s.writeError(response, request, err)
+			return
+		}
+		if err := s.repo.SaveSignatureDevices(request.Context(), fence(lease), []*domain.SignatureDevice{device}, event); err != nil {
+			s.writeError(response, request, err)
+			return
+		}
+		s.audit(request, audit.Entry{Event: audit.EventDeviceSuspended, DeviceId: device.Id, Algorithm: device.Algorithm})
+	}
+
+	WriteAPIResponse(response, http.StatusOK, device)
+}
+
+func (s *Server) RotateSignatureDeviceHandler(response http.ResponseWriter, request *http.Request) {
+	device, err := s.repo.GetSignatureDevice(request.Context(), TenantId(request), mux.Vars(request)["device_id"])
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+	logDevice(request, device.Id)
+	device, lease, err := s.lockDevice(request.Context(), device)
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+	defer s.release(lease)
+
+	successor, err := device.Rotate(request.Context(), uuid.New().String(), s.keys)
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+	created, err := newEvent(domain.EventDeviceCreated, successor, successor)
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+	rotated, err := newEvent(domain.EventDeviceRotated, device, device)
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+	if err := s.repo.SaveSignatureDevices(request.Context(), fence(lease), []*domain.SignatureDevice{successor, device}, created, rotated); err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+	s.audit(request, audit.Entry{Event: audit.EventDeviceRotated, DeviceId: device.Id, Algorithm: device.Algorithm, SuccessorId: successor.Id})
+
+	WriteAPIResponse(response, http.StatusCreated, successor)
+}
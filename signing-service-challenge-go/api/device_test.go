@@ -2,11 +2,14 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gorilla/mux"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
@@ -56,6 +59,9 @@ func TestCreateSignatureDeviceHandler(t *testing.T) {
 	if response.Data.Label != requestBody.Label {
 		t.Errorf("Expected label %s, got %v", requestBody.Label, response.Data.Label)
 	}
+	if response.Data.SecuredDataFormat != domain.SecuredDataV3 {
+		t.Errorf("Expected the signing time to be signed by default, got format %s", response.Data.SecuredDataFormat)
+	}
 	if response.Data.LastSignature != "" {
 		t.Errorf("Expected LastSignature to be empty, got %v", response.Data.LastSignature)
 	}
@@ -182,6 +188,75 @@ func TestSignTransactionHandler(t *testing.T) {
 	}
 }
 
+// failingRepository fails the first transaction it is asked to store.
+type failingRepository struct {
+	*persistence.MockRepository
+	failed bool
+}
+
+func (r *failingRepository) SaveTransaction(ctx context.Context, fence persistence.Fence, transaction *domain.Transaction, fiscal *domain.FiscalTransaction, events ...*domain.Event) error {
+	if !r.failed {
+		r.failed = true
+		return errors.New("store unavailable")
+	}
+	return r.MockRepository.SaveTransaction(ctx, fence, transaction, fiscal, events...)
+}
+
+func TestSignTransactionNotStoredKeepsCounter(t *testing.T) {
+	repo := &failingRepository{MockRepository: persistence.NewMockRepository()}
+	server := NewServer(":8080", repo)
+	device, _ := domain.NewSignatureDevice("device", "ECC", "Test")
+	repo.Devices[device.Id] = device
+
+	body := SignTransactionRequest{DeviceId: device.Id, Data: "test-data"}
+	if recorder := serve(server, "POST", "/transactions/sign", "", body); recorder.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusInternalServerError, recorder.Code, recorder.Body)
+	}
+	if device.SignatureCounter != 0 {
+		t.Errorf("Expected counter 0 after the failed store, got %d", device.SignatureCounter)
+	}
+
+	if recorder := serve(server, "POST", "/transactions/sign", "", body); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body)
+	}
+	if len(repo.Transactions) != 1 || repo.Transactions[0].Counter != 0 {
+		t.Errorf("Expected the stored signature to take counter 0, got %+v", repo.Transactions)
+	}
+}
+
+func TestSignTransactionWithSecuredDataFormat(t *testing.T) {
+	server := NewServer(":8080", persistence.NewInMemoryPersistence())
+
+	recorder := serve(server, "POST", "/devices", "", CreateSignatureDeviceRequest{Algorithm: "ECC", SecuredDataFormat: "v2"})
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, recorder.Code, recorder.Body)
+	}
+	var created struct {
+		Data domain.SignatureDevice `json:"data"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &created)
+	if created.Data.SecuredDataFormat != domain.SecuredDataV2 {
+		t.Errorf("Expected format %s, got %s", domain.SecuredDataV2, created.Data.SecuredDataFormat)
+	}
+
+	recorder = serve(server, "POST", "/transactions/sign", "", SignTransactionRequest{DeviceId: created.Data.Id, Data: "a_b"})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body)
+	}
+	var signed struct {
+		Data map[string]string `json:"data"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &signed)
+	if signed.Data["secured_data_format"] != "v2" {
+		t.Errorf("Expected format v2, got %s", signed.Data["secured_data_format"])
+	}
+
+	recorder = serve(server, "POST", "/devices", "", CreateSignatureDeviceRequest{Algorithm: "ECC", SecuredDataFormat: "v9"})
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, recorder.Code)
+	}
+}
+
 func assertDeviceEquals(t *testing.T, expected *domain.SignatureDevice, actual *domain.SignatureDevice) {
 	if expected.Id != actual.Id {
 		t.Errorf("Expected Id %s, got %s", expected.Id, actual.Id)
@@ -193,3 +268,33 @@ func assertDeviceEquals(t *testing.T, expected *domain.SignatureDevice, actual *
 		t.Errorf("Expected label %s, got %s", expected.Label, actual.Label)
 	}
 }
+
+func TestRotateSignatureDeviceHandler(t *testing.T) {
+	server, deviceId := newPayloadServer(t)
+
+	recorder := serve(server, "POST", "/devices/"+deviceId+"/rotate", "", nil)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, recorder.Code, recorder.Body)
+	}
+	var response struct {
+		Data *domain.SignatureDevice `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Error unmarshaling response body: %v", err)
+	}
+	successor := response.Data
+	if successor.PredecessorId != deviceId || successor.Status != domain.DeviceStatusActive {
+		t.Errorf("Expected an active successor of %s, got %s of %s", deviceId, successor.Status, successor.PredecessorId)
+	}
+
+	device, _ := server.repo.GetSignatureDevice(context.Background(), "", deviceId)
+	if device.Status != domain.DeviceStatusSuspended || device.SuccessorId != successor.Id {
+		t.Errorf("Expected the device to be suspended in favor of %s, got %s in favor of %s", successor.Id, device.Status, device.SuccessorId)
+	}
+	signedData(t, serve(server, "POST", "/transactions/sign", "", SignTransactionRequest{DeviceId: successor.Id, Data: "data"}))
+
+	recorder = serve(server, "POST", "/devices/"+deviceId+"/rotate", "", nil)
+	if recorder.Code != http.StatusConflict || !strings.Contains(recorder.Body.String(), CodeDeviceRotated) {
+		t.Errorf("Expected %s, got %d: %s", CodeDeviceRotated, recorder.Code, recorder.Body)
+	}
+}
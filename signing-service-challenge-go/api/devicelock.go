@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/devicelock"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+// lockDevice holds the lease on device across the instances sharing the
+// repository, and returns the device as stored once the lease is held, since
+// another instance may have signed with it meanwhile. Without a Locker the device
+// is returned as is and the lease is nil: the signer lock of the device
+// serializes its signatures within the process.
+func (s *Server) lockDevice(ctx context.Context, device *domain.SignatureDevice) (*domain.SignatureDevice, devicelock.Lease, error) {
+	if s.locker == nil {
+		return device, nil, nil
+	}
+
+	lease, err := s.locker.Lock(ctx, device.Id)
+	if err != nil {
+		return nil, nil, err
+	}
+	device, err = s.repo.GetSignatureDevice(ctx, device.TenantId, device.Id)
+	if err != nil {
+		s.release(lease)
+		return nil, nil, err
+	}
+	return device, lease, nil
+}
+
+// held returns devicelock.ErrLeaseLost if the lease of lockDevice was lost, in
+// which case another instance may sign with the same counter and nothing signed
+// under the lease may be stored.
+func held(lease devicelock.Lease) error {
+	if lease == nil {
+		return nil
+	}
+	return lease.Err()
+}
+
+// fence returns the fence of the writes made under the lease of lockDevice, with
+// which the repository rejects them once a later lease was granted.
+func fence(lease devicelock.Lease) persistence.Fence {
+	if lease == nil {
+		return persistence.NoFence
+	}
+	return persistence.Fence(lease.Fence())
+}
+
+// releaser returns a function that gives up the lease of lockDevice once, so that
+// a handler can release it as soon as it signed and defer releasing it as well.
+func (s *Server) releaser(lease devicelock.Lease) func() {
+	var once sync.Once
+	return func() { once.Do(func() { s.release(lease) }) }
+}
+
+// release gives up the lease of lockDevice.
+func (s *Server) release(lease devicelock.Lease) {
+	if lease == nil {
+		return
+	}
+	// The lease expires by itself if releasing it fails.
+	if err := lease.Release(context.Background()); err != nil {
+		s.logger.Warn("Could not release device lease", slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/devicelock"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+func TestInstancesSharingAFileStoreKeepCountersGapFree(t *testing.T) {
+	dir := t.TempDir()
+	locks := miniredis.RunT(t)
+	// Every instance opens the directory itself and holds its own copy of the
+	// device, as the instances in separate processes do.
+	var stores []*persistence.SharedFilePersistence
+	var instances []*Server
+	for i := 0; i < 3; i++ {
+		store, err := persistence.OpenSharedFilePersistence(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		stores = append(stores, store)
+		client := redis.NewClient(&redis.Options{Addr: locks.Addr()})
+		t.Cleanup(func() { client.Close() })
+		locker := devicelock.NewRedisLocker(client, "signing-service:lock:", 5*time.Second)
+		instances = append(instances, NewServer(":8080", store, WithDeviceLocker(locker)))
+	}
+
+	device, err := domain.NewSignatureDevice("device", "ECC", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	device.SecuredDataFormat = domain.SecuredDataV2
+	stores[0].SaveSignatureDevice(context.Background(), device)
+
+	const signatures, transactions = 60, 10
+	var wg sync.WaitGroup
+	for i := 0; i < signatures; i++ {
+		wg.Add(1)
+		go func(instance *Server, i int) {
+			defer wg.Done()
+			recorder := serve(instance, "POST", "/transactions/sign", "", SignTransactionRequest{DeviceId: "device", Data: fmt.Sprint("receipt ", i)})
+			if recorder.Code != http.StatusOK {
+				t.Errorf("Expected status code %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body)
+			}
+		}(instances[i%len(instances)], i)
+	}
+	for i := 0; i < transactions; i++ {
+		wg.Add(1)
+		// Every transaction starts on one instance and finishes on another.
+		go func(start, finish *Server) {
+			defer wg.Done()
+			recorder := serve(start, "POST", "/transactions", "", SignTransactionRequest{DeviceId: "device", Data: "start"})
+			if recorder.Code != http.StatusCreated {
+				t.Errorf("Expected status code %d, got %d: %s", http.StatusCreated, recorder.Code, recorder.Body)
+				return
+			}
+			var started struct {
+				Data TransactionStepResponse `json:"data"`
+			}
+			json.Unmarshal(recorder.Body.Bytes(), &started)
+
+			recorder = serve(finish, "POST", "/transactions/"+started.Data.Transaction.Id+"/finish", "", TransactionStepRequest{Data: "finish"})
+			if recorder.Code != http.StatusOK {
+				t.Errorf("Expected status code %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body)
+			}
+		}(instances[i%len(instances)], instances[(i+1)%len(instances)])
+	}
+	wg.Wait()
+
+	stored, _ := stores[1].ListTransactions(context.Background(), "", "device")
+	if len(stored) != signatures+2*transactions {
+		t.Fatalf("Expected %d transactions, got %d", signatures+2*transactions, len(stored))
+	}
+	for i, transaction := range stored {
+		if transaction.Counter != i {
+			t.Fatalf("Expected counter %d, got %d", i, transaction.Counter)
+		}
+	}
+
+	numbers := make(map[int]bool)
+	fiscals, _ := stores[2].ListFiscalTransactions(context.Background(), "", "")
+	for _, fiscal := range fiscals {
+		if fiscal.State != domain.FiscalTransactionFinished || numbers[fiscal.Number] {
+			t.Errorf("Expected finished transactions with distinct numbers, got %d in state %s", fiscal.Number, fiscal.State)
+		}
+		numbers[fiscal.Number] = true
+	}
+
+	// Every instance continues the chain where the others left it.
+	report := verificationReport(t, instances[0], "device")
+	if !report.Valid || report.Transactions != len(stored) {
+		t.Errorf("Expected a valid chain of %d transactions, got %+v", len(stored), report)
+	}
+}
+
+func TestLostLeaseDropsSignature(t *testing.T) {
+	server, deviceId := newPayloadServer(t)
+	server.locker = lostLocker{}
+
+	recorder := serve(server, "POST", "/transactions/sign", "", SignTransactionRequest{DeviceId: deviceId, Data: "data"})
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusServiceUnavailable, recorder.Code, recorder.Body)
+	}
+	if stored, _ := server.repo.ListTransactions(context.Background(), "", deviceId); len(stored) != 0 {
+		t.Errorf("Expected no stored transactions, got %d", len(stored))
+	}
+}
+
+func TestStaleFenceDropsSignature(t *testing.T) {
+	repo := persistence.NewInMemoryPersistence()
+	device, _ := domain.NewSignatureDevice("device", "ECC", "")
+	// Another instance wrote the device under a later lease.
+	repo.SaveSignatureDevices(context.Background(), 2, []*domain.SignatureDevice{device})
+	server := NewServer(":8080", repo, WithDeviceLocker(staleLocker{}))
+
+	recorder := serve(server, "POST", "/transactions/sign", "", SignTransactionRequest{DeviceId: device.Id, Data: "data"})
+	if recorder.Code != http.StatusServiceUnavailable || !strings.Contains(recorder.Body.String(), CodeDeviceLeaseLost) {
+		t.Errorf("Expected %s, got %d: %s", CodeDeviceLeaseLost, recorder.Code, recorder.Body)
+	}
+	if stored, _ := repo.ListTransactions(context.Background(), "", device.Id); len(stored) != 0 {
+		t.Errorf("Expected no stored transactions, got %d", len(stored))
+	}
+	if device.SignatureCounter != 0 {
+		t.Errorf("Expected counter 0, got %d", device.SignatureCounter)
+	}
+}
+
+// lostLocker grants leases that are lost right away.
+type lostLocker struct{}
+
+func (lostLocker) Lock(ctx context.Context, key string) (devicelock.Lease, error) {
+	return lostLease{}, nil
+}
+
+type lostLease struct{}
+
+func (lostLease) Fence() int64                      { return 1 }
+func (lostLease) Err() error                        { return devicelock.ErrLeaseLost }
+func (lostLease) Release(ctx context.Context) error { return nil }
+
+// staleLocker grants leases that believe they are held, but were granted before
+// the last write of the device.
+type staleLocker struct{}
+
+func (staleLocker) Lock(ctx context.Context, key string) (devicelock.Lease, error) {
+	return staleLease{}, nil
+}
+
+type staleLease struct{}
+
+func (staleLease) Fence() int64                      { return 1 }
+func (staleLease) Err() error                        { return nil }
+func (staleLease) Release(ctx context.Context) error { return nil }
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/audit"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/export"
+)
+
+var fromQueryParameter = Parameter{
+	Name:   "from",
+	In:     "query",
+	Schema: &Schema{Type: "string", Format: "date-time"},
+}
+
+var toQueryParameter = Parameter{
+	Name:   "to",
+	In:     "query",
+	Schema: &Schema{Type: "string", Format: "date-time"},
+}
+
+var exportDeviceOperation = &Operation{
+	OperationId: "exportDevice",
+	Summary:     "Exports the signature log of a signature device as a TAR archive with a signed manifest. from is inclusive, to exclusive.",
+	Parameters:  []Parameter{deviceIdParameter, fromQueryParameter, toQueryParameter},
+	Responses: map[string]*ResponseObject{
+		"200": {
+			Description: "The archive of the device metadata, its public key, the transaction logs and the signed manifest.",
+			Content:     map[string]MediaType{export.ContentType: {Schema: &Schema{Type: "string", Format: "binary"}}},
+		},
+		"400": failure("from or to is not an RFC 3339 time."),
+		"404": failure("The signature device does not exist."),
+		"500": failure("The export could not be prepared."),
+	},
+}
+
+func (s *Server) ExportDeviceHandler(response http.ResponseWriter, request *http.Request) {
+	window, err := exportRange(request.URL.Query())
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	device, err := s.repo.GetSignatureDevice(request.Context(), TenantId(request), mux.Vars(request)["device_id"])
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+	logDevice(request, device.Id)
+
+	archive, err := export.Prepare(request.Context(), s.repo, device, window)
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+	defer archive.Close()
+	s.audit(request, audit.Entry{Event: audit.EventDeviceExported, DeviceId: device.Id, Algorithm: device.Algorithm})
+
+	response.Header().Set("Content-Type", export.ContentType)
+	response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", device.Id+".tar"))
+	response.WriteHeader(http.StatusOK)
+	// The status is sent already, a failure can only cut the archive short.
+	if err := archive.Write(response); err != nil {
+		s.logger.WarnContext(request.Context(), "Export aborted", slog.String("device_id", device.Id), slog.String("error", err.Error()))
+	}
+}
+
+// exportRange parses the from and to query parameters of an export.
+func exportRange(query url.Values) (export.Range, error) {
+	var window export.Range
+	var errs []ValidationError
+	for _, bound := range []struct {
+		name string
+		time *time.Time
+	}{{"from", &window.From}, {"to", &window.To}} {
+		value := query.Get(bound.name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			errs = append(errs, ValidationError{Field: bound.name, Message: "must be an RFC 3339 time"})
+			continue
+		}
+		*bound.time = parsed
+	}
+	if len(errs) > 0 {
+		return export.Range{}, validationFailed(errs...)
+	}
+	return window, nil
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/export"
+)
+
+func TestExportDeviceHandler(t *testing.T) {
+	server, deviceId := newPayloadServer(t)
+	signedData(t, serve(server, "POST", "/transactions/sign", "", SignTransactionRequest{DeviceId: deviceId, Data: "data"}))
+
+	recorder := serve(server, "GET", "/devices/"+deviceId+"/export?from=2024-01-01T00:00:00Z", "", nil)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != export.ContentType {
+		t.Errorf("Expected content type %s, got %s", export.ContentType, contentType)
+	}
+
+	var names []string
+	reader := tar.NewReader(bytes.NewReader(recorder.Body.Bytes()))
+	for header, err := reader.Next(); err == nil; header, err = reader.Next() {
+		names = append(names, header.Name)
+	}
+	if len(names) != 6 || names[len(names)-1] != export.ManifestSignatureFile {
+		t.Errorf("Expected a complete export, got %v", names)
+	}
+}
+
+func TestExportDeviceHandlerRejectsInvalidRange(t *testing.T) {
+	server, deviceId := newPayloadServer(t)
+
+	recorder := serve(server, "GET", "/devices/"+deviceId+"/export?from=yesterday", "", nil)
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), `"field":"from"`) {
+		t.Errorf("Expected a validation error for from, got %d: %s", recorder.Code, recorder.Body)
+	}
+}
@@ -1,25 +1,107 @@
 package api
 
-import "net/http"
+import (
+	"encoding/json"
+	"net/http"
 
-type HealthResponse struct {
-	Status  string `json:"status"`
-	Version string `json:"version"`
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/health"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/version"
+)
+
+// healthBody describes a health check response, which is served without the Response container.
+func healthBody(description string) *ResponseObject {
+	return &ResponseObject{
+		Description: description,
+		Content:     map[string]MediaType{health.ContentType: {Schema: ref("HealthResponse")}},
+	}
+}
+
+var healthOperation = &Operation{
+	OperationId: "health",
+	Summary:     "Reports the health of the service and the result of every registered check.",
+	Responses: map[string]*ResponseObject{
+		"200": healthBody("The service is healthy, possibly with warnings."),
+		"503": healthBody("A check failed or the service is shutting down."),
+	},
+}
+
+var liveOperation = &Operation{
+	OperationId: "live",
+	Summary:     "Reports whether the process is alive. It stays alive while draining.",
+	Responses: map[string]*ResponseObject{
+		"200": healthBody("The process is alive."),
+	},
+}
+
+var readyOperation = &Operation{
+	OperationId: "ready",
+	Summary:     "Reports whether the service accepts requests. It is not ready while draining or if a check fails.",
+	Responses: map[string]*ResponseObject{
+		"200": healthBody("The service accepts requests."),
+		"503": healthBody("A check failed or the service is shutting down."),
+	},
+}
+
+// WriteHealthResponse writes a health.Response as an application/health+json HTTP response.
+// Failing services are reported with status 503, all others with status 200.
+func WriteHealthResponse(w http.ResponseWriter, response health.Response) {
+	bytes, err := json.MarshalIndent(response, "", "  ")
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	code := http.StatusOK
+	if response.Status == health.Fail {
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", health.ContentType)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	w.Write(bytes)
+}
+
+// evaluate runs all health checks. A draining service fails regardless of its checks.
+func (s *Server) evaluate(request *http.Request) health.Response {
+	status, checks := s.health.Evaluate(request.Context())
+	response := health.Response{
+		Status:    status,
+		Version:   apiVersion,
+		ReleaseId: version.Release(),
+		Checks:    checks,
+	}
+
+	if s.drain.Draining() {
+		response.Status = health.Fail
+		response.Output = "The server is shutting down."
+	}
+	return response
 }
 
 // Health evaluates the health of the service and writes a standardized response.
 func (s *Server) Health(response http.ResponseWriter, request *http.Request) {
 	if request.Method != http.MethodGet {
-		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
-			http.StatusText(http.StatusMethodNotAllowed),
-		})
+		s.writeError(response, request, methodNotAllowed())
 		return
 	}
 
-	health := HealthResponse{
-		Status:  "pass",
-		Version: "v0",
-	}
+	WriteHealthResponse(response, s.evaluate(request))
+}
+
+// Live reports that the process is alive, even while it drains.
+func (s *Server) Live(response http.ResponseWriter, request *http.Request) {
+	WriteHealthResponse(response, health.Response{
+		Status:    health.Pass,
+		Version:   apiVersion,
+		ReleaseId: version.Release(),
+	})
+}
 
-	WriteAPIResponse(response, http.StatusOK, health)
+// Ready reports whether the service accepts requests, which it stops doing once it
+// drains or a check fails. The results of the checks are left to Health.
+func (s *Server) Ready(response http.ResponseWriter, request *http.Request) {
+	result := s.evaluate(request)
+	result.Checks = nil
+	WriteHealthResponse(response, result)
 }
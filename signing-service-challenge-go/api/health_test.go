@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/health"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/version"
+)
+
+func TestHealthReportsChecks(t *testing.T) {
+	var probeErr error
+	registry := health.NewRegistry()
+	registry.Register(health.Check{
+		Component:     "repository",
+		ComponentType: "datastore",
+		Probe:         func(context.Context) error { return probeErr },
+	})
+	server := NewServer(":8080", persistence.NewMockRepository(), WithHealthChecks(registry))
+
+	for _, test := range []struct {
+		err    error
+		code   int
+		status health.Status
+	}{
+		{nil, http.StatusOK, health.Pass},
+		{health.Warning(errors.New("slow")), http.StatusOK, health.Warn},
+		{errors.New("down"), http.StatusServiceUnavailable, health.Fail},
+	} {
+		probeErr = test.err
+		recorder := serve(server, "GET", "/health", "", nil)
+
+		if recorder.Code != test.code {
+			t.Errorf("Expected status code %d, got %d", test.code, recorder.Code)
+		}
+		if contentType := recorder.Header().Get("Content-Type"); contentType != health.ContentType {
+			t.Errorf("Expected content type %s, got %s", health.ContentType, contentType)
+		}
+
+		var response health.Response
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Error unmarshaling response body: %v", err)
+		}
+		if response.Status != test.status {
+			t.Errorf("Expected status %s, got %s", test.status, response.Status)
+		}
+		if response.ReleaseId != version.Release() {
+			t.Errorf("Expected release %s, got %s", version.Release(), response.ReleaseId)
+		}
+		results := response.Checks["repository:responseTime"]
+		if len(results) != 1 || results[0].Status != test.status {
+			t.Errorf("Expected the repository check to report %s, got %+v", test.status, results)
+		}
+	}
+
+	if recorder := serve(server, "GET", "/health/ready", "", nil); recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected readiness to fail with a failing check, got %d", recorder.Code)
+	}
+	if recorder := serve(server, "GET", "/health/live", "", nil); recorder.Code != http.StatusOK {
+		t.Errorf("Expected liveness to pass with a failing check, got %d", recorder.Code)
+	}
+}
@@ -0,0 +1,299 @@
+package api
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotentReplayedHeader marks responses replayed for a repeated request.
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+	// idempotencyKeyTTL is how long the response to an idempotency key is replayed.
+	idempotencyKeyTTL = 24 * time.Hour
+	// maxIdempotentResponses bounds the responses an instance keeps in memory.
+	// Signatures are replayed from the repository once their response is evicted.
+	maxIdempotentResponses = 10000
+)
+
+const idempotencyContextKey contextKey = iota + 2
+
+// idempotentRequest identifies a request with an idempotency key by the key,
+// scoped to the tenant and the API key, and the fingerprint of the request.
+type idempotentRequest struct {
+	key         string
+	fingerprint string
+}
+
+var idempotencyKeyParameter = Parameter{
+	Name:   idempotencyKeyHeader,
+	In:     "header",
+	Schema: &Schema{Type: "string", MaxLength: maxIdempotencyKeyLength},
+}
+
+func idempotencyKeyReused() *Problem {
+	return NewProblem(http.StatusUnprocessableEntity, CodeIdempotencyKeyReused, "Idempotency key reused", "The idempotency key was used for a different request.")
+}
+
+func idempotencyKeyInUse() *Problem {
+	return NewProblem(http.StatusConflict, CodeIdempotencyKeyInUse, "Idempotency key in use", "A request with this idempotency key is still in progress.")
+}
+
+// withIdempotencyFailures adds the responses to misused idempotency keys.
+func withIdempotencyFailures(responses map[string]*ResponseObject) map[string]*ResponseObject {
+	extended := map[string]*ResponseObject{
+		"409": failure("A request with the same idempotency key is still in progress."),
+		"422": failure("The idempotency key was used for a different request."),
+	}
+	for status, response := range responses {
+		extended[status] = response
+	}
+	return extended
+}
+
+// idempotentResponse is the response to the first request with an idempotency key.
+type idempotentResponse struct {
+	// fingerprint identifies the request: its method, target and body.
+	fingerprint [sha256.Size]byte
+	done        bool
+	status      int
+	header      http.Header
+	body        []byte
+	expires     time.Time
+	// element is the key in the order of the cache.
+	element *list.Element
+}
+
+// idempotencyCache keeps the responses to requests with idempotency keys, at most
+// limit of them. The oldest completed responses are evicted first.
+type idempotencyCache struct {
+	mu        sync.Mutex
+	limit     int
+	responses map[string]*idempotentResponse
+	// order lists the keys of the responses from the oldest to the newest claim.
+	order     *list.List
+	lastSweep time.Time
+}
+
+func newIdempotencyCache(limit int) *idempotencyCache {
+	return &idempotencyCache{limit: limit, responses: make(map[string]*idempotentResponse), order: list.New()}
+}
+
+// remove forgets key. The caller holds the mutex.
+func (c *idempotencyCache) remove(key string) {
+	if response, ok := c.responses[key]; ok {
+		c.order.Remove(response.element)
+		delete(c.responses, key)
+	}
+}
+
+// evict removes the oldest completed responses while the cache exceeds its
+// limit. Responses in progress are kept, their number is bounded by the requests
+// being served. The caller holds the mutex.
+func (c *idempotencyCache) evict() {
+	for element := c.order.Front(); element != nil && len(c.responses) > c.limit; {
+		next := element.Next()
+		if key := element.Value.(string); c.responses[key].done {
+			c.remove(key)
+		}
+		element = next
+	}
+}
+
+// claim returns the response to key. If there is none, it registers a response in
+// progress and reports true; the caller completes or releases it.
+func (c *idempotencyCache) claim(key string, fingerprint [sha256.Size]byte, now time.Time) (*idempotentResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.lastSweep) > time.Minute {
+		for cached, response := range c.responses {
+			if response.done && now.After(response.expires) {
+				c.remove(cached)
+			}
+		}
+		c.lastSweep = now
+	}
+
+	if response, ok := c.responses[key]; ok && !(response.done && now.After(response.expires)) {
+		// The response is copied, since it may be completed concurrently.
+		copied := *response
+		return &copied, false
+	}
+	c.remove(key)
+	response := &idempotentResponse{fingerprint: fingerprint, element: c.order.PushBack(key)}
+	c.responses[key] = response
+	c.evict()
+	return response, true
+}
+
+// complete stores the response to key for replay.
+func (c *idempotencyCache) complete(key string, status int, header http.Header, body []byte, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	response, ok := c.responses[key]
+	if !ok {
+		return
+	}
+	response.done = true
+	response.status, response.header, response.body = status, header, body
+	response.expires = now.Add(idempotencyKeyTTL)
+}
+
+// release forgets key, so that the request can be repeated.
+func (c *idempotencyCache) release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.remove(key)
+}
+
+// responseCapture records the response written by a handler while passing it on.
+type responseCapture struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseCapture) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseCapture) Write(p []byte) (int, error) {
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
+
+// Idempotent is a middleware that executes requests carrying an Idempotency-Key
+// header once per API key and replays the response to repetitions, so that clients
+// can safely retry requests whose response they missed. A key reused for another
+// request is rejected, as is a repetition while the first request is in progress.
+// Failures the client may resolve by retrying, server errors and rate limits, are
+// not replayed. Signatures are stored with the key in the repository as well, so
+// that the signing handlers answer repetitions this instance does not remember
+// with the stored signature (see storedSignature).
+func (s *Server) Idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		key := request.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			next.ServeHTTP(response, request)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			s.writeError(response, request, validationFailed(ValidationError{Field: idempotencyKeyHeader, Message: "must not exceed 255 characters"}))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(response, request.Body, s.maxBodySize))
+		if err != nil {
+			s.writeError(response, request, bodyError(err))
+			return
+		}
+		request.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.New()
+		io.WriteString(hash, request.Method+" "+request.URL.RequestURI()+"\n"+request.Header.Get("Content-Type")+"\n")
+		hash.Write(body)
+		var fingerprint [sha256.Size]byte
+		copy(fingerprint[:], hash.Sum(nil))
+
+		scope := TenantId(request) + "\x00"
+		if apiKey, ok := APIKeyFromContext(request.Context()); ok {
+			scope += apiKey.Id
+		}
+		scope += "\x00" + key
+
+		cached, first := s.idempotency.claim(scope, fingerprint, time.Now())
+		switch {
+		case !first && cached.fingerprint != fingerprint:
+			s.writeError(response, request, idempotencyKeyReused())
+			return
+		case !first && !cached.done:
+			s.writeError(response, request, idempotencyKeyInUse())
+			return
+		case !first:
+			for name, values := range cached.header {
+				response.Header()[name] = values
+			}
+			response.Header().Set(idempotentReplayedHeader, "true")
+			response.WriteHeader(cached.status)
+			response.Write(cached.body)
+			return
+		}
+
+		completed := false
+		defer func() {
+			// A handler that panics leaves the key for a retry.
+			if !completed {
+				s.idempotency.release(scope)
+			}
+		}()
+
+		ctx := context.WithValue(request.Context(), idempotencyContextKey, idempotentRequest{key: scope, fingerprint: hex.EncodeToString(fingerprint[:])})
+		before := response.Header().Clone()
+		capture := &responseCapture{ResponseWriter: response, status: http.StatusOK}
+		next.ServeHTTP(capture, request.WithContext(ctx))
+
+		if capture.status >= http.StatusInternalServerError || capture.status == http.StatusTooManyRequests {
+			return
+		}
+		// Only the headers of the handler are replayed, not those of the middlewares
+		// around it, such as the request id.
+		header := make(http.Header)
+		for name, values := range response.Header() {
+			if _, ok := before[name]; !ok {
+				header[name] = values
+			}
+		}
+		s.idempotency.complete(scope, capture.status, header, capture.body.Bytes(), time.Now())
+		completed = true
+	})
+}
+
+// storedSignature returns the transaction stored for an earlier request with the
+// idempotency key of request, nil if there is none or it expired. It answers the
+// repetitions the idempotency cache does not remember, after a restart, an
+// eviction or on another instance. It must be called under the lease of the
+// device, so that the earlier request has either stored its signature or not
+// signed at all.
+func (s *Server) storedSignature(request *http.Request, tenantId string) (*domain.Transaction, error) {
+	idempotent, ok := request.Context().Value(idempotencyContextKey).(idempotentRequest)
+	if !ok {
+		return nil, nil
+	}
+	transaction, err := s.repo.GetTransactionByIdempotencyKey(request.Context(), tenantId, idempotent.key)
+	if errors.Is(err, domain.ErrTransactionNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Since(transaction.CreatedAt) > idempotencyKeyTTL {
+		return nil, nil
+	}
+	if transaction.RequestFingerprint != idempotent.fingerprint {
+		return nil, idempotencyKeyReused()
+	}
+	return transaction, nil
+}
+
+// recordIdempotency sets the idempotency key and the fingerprint of the request
+// ctx belongs to on transaction, if it carried a key.
+func recordIdempotency(ctx context.Context, transaction *domain.Transaction) {
+	if idempotent, ok := ctx.Value(idempotencyContextKey).(idempotentRequest); ok {
+		transaction.IdempotencyKey, transaction.RequestFingerprint = idempotent.key, idempotent.fingerprint
+	}
+}
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveIdempotent serves a request with an Idempotency-Key header.
+func serveIdempotent(server *Server, path, key string, body interface{}) *httptest.ResponseRecorder {
+	var payload bytes.Buffer
+	json.NewEncoder(&payload).Encode(body)
+
+	request := httptest.NewRequest("POST", apiPrefix+path, &payload)
+	request.Header.Set(idempotencyKeyHeader, key)
+	recorder := httptest.NewRecorder()
+	server.Handler().ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestIdempotentReplaysResponse(t *testing.T) {
+	server, deviceId := newPayloadServer(t)
+	request := SignTransactionRequest{DeviceId: deviceId, Data: "receipt"}
+
+	first := signedData(t, serveIdempotent(server, "/transactions/sign", "key", request))
+	recorder := serveIdempotent(server, "/transactions/sign", "key", request)
+	replayed := signedData(t, recorder)
+
+	if replayed["signature"] != first["signature"] {
+		t.Errorf("Expected the signature to be replayed")
+	}
+	if recorder.Header().Get(idempotentReplayedHeader) != "true" {
+		t.Errorf("Expected the %s header on the replay", idempotentReplayedHeader)
+	}
+	if transactions, _ := server.repo.ListTransactions(context.Background(), "", deviceId); len(transactions) != 1 {
+		t.Errorf("Expected a single signature, got %d", len(transactions))
+	}
+
+	// Another key signs again.
+	if other := signedData(t, serveIdempotent(server, "/transactions/sign", "other", request)); other["signature"] == first["signature"] {
+		t.Errorf("Expected a new signature for another key")
+	}
+}
+
+func TestIdempotentReplaysStoredSignature(t *testing.T) {
+	server, deviceId := newPayloadServer(t)
+	request := SignTransactionRequest{DeviceId: deviceId, Data: "receipt"}
+	first := signedData(t, serveIdempotent(server, "/transactions/sign", "key", request))
+
+	// Another instance, or this one after a restart, does not remember the
+	// response but finds the signature in the repository.
+	restarted := NewServer(":8080", server.repo)
+	recorder := serveIdempotent(restarted, "/transactions/sign", "key", request)
+	if replayed := signedData(t, recorder); replayed["signature"] != first["signature"] {
+		t.Errorf("Expected the stored signature to be replayed")
+	}
+	if recorder.Header().Get(idempotentReplayedHeader) != "true" {
+		t.Errorf("Expected the %s header on the replay", idempotentReplayedHeader)
+	}
+	if transactions, _ := server.repo.ListTransactions(context.Background(), "", deviceId); len(transactions) != 1 {
+		t.Errorf("Expected a single signature, got %d", len(transactions))
+	}
+
+	restarted = NewServer(":8080", server.repo)
+	recorder = serveIdempotent(restarted, "/transactions/sign", "key", SignTransactionRequest{DeviceId: deviceId, Data: "another receipt"})
+	if recorder.Code != http.StatusUnprocessableEntity || !strings.Contains(recorder.Body.String(), CodeIdempotencyKeyReused) {
+		t.Errorf("Expected %s, got %d: %s", CodeIdempotencyKeyReused, recorder.Code, recorder.Body)
+	}
+}
+
+func TestIdempotentReplaysStoredStep(t *testing.T) {
+	server, deviceId := newPayloadServer(t)
+	started := serveIdempotent(server, "/transactions", "start", SignTransactionRequest{DeviceId: deviceId, Data: "start"})
+	if started.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, started.Code, started.Body)
+	}
+	var step struct {
+		Data TransactionStepResponse `json:"data"`
+	}
+	json.Unmarshal(started.Body.Bytes(), &step)
+	finish := "/transactions/" + step.Data.Transaction.Id + "/finish"
+	if recorder := serveIdempotent(server, finish, "finish", TransactionStepRequest{Data: "finish"}); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body)
+	}
+
+	restarted := NewServer(":8080", server.repo)
+	for _, recorder := range []*httptest.ResponseRecorder{
+		serveIdempotent(restarted, "/transactions", "start", SignTransactionRequest{DeviceId: deviceId, Data: "start"}),
+		serveIdempotent(restarted, finish, "finish", TransactionStepRequest{Data: "finish"}),
+	} {
+		if recorder.Header().Get(idempotentReplayedHeader) != "true" {
+			t.Errorf("Expected a replay, got %d: %s", recorder.Code, recorder.Body)
+		}
+	}
+	if transactions, _ := server.repo.ListTransactions(context.Background(), "", deviceId); len(transactions) != 2 {
+		t.Errorf("Expected 2 signatures, got %d", len(transactions))
+	}
+}
+
+func TestIdempotencyCacheEvictsOldestResponses(t *testing.T) {
+	cache := newIdempotencyCache(2)
+	now := time.Now()
+	for _, key := range []string{"first", "second", "third"} {
+		cache.claim(key, [32]byte{}, now)
+		cache.complete(key, http.StatusOK, nil, nil, now)
+	}
+	if len(cache.responses) != 2 {
+		t.Errorf("Expected 2 responses, got %d", len(cache.responses))
+	}
+	if _, first := cache.claim("first", [32]byte{}, now); !first {
+		t.Errorf("Expected the oldest response to be evicted")
+	}
+
+	// Responses in progress are not evicted.
+	cache.claim("fourth", [32]byte{}, now)
+	if _, first := cache.claim("fourth", [32]byte{}, now); first {
+		t.Errorf("Expected the response in progress to be kept")
+	}
+	if _, first := cache.claim("first", [32]byte{}, now); first {
+		t.Errorf("Expected the response in progress to be kept")
+	}
+}
+
+func TestIdempotentRejectsReusedKey(t *testing.T) {
+	server, deviceId := newPayloadServer(t)
+
+	signedData(t, serveIdempotent(server, "/transactions/sign", "key", SignTransactionRequest{DeviceId: deviceId, Data: "receipt"}))
+	recorder := serveIdempotent(server, "/transactions/sign", "key", SignTransactionRequest{DeviceId: deviceId, Data: "another receipt"})
+
+	if recorder.Code != http.StatusUnprocessableEntity || !strings.Contains(recorder.Body.String(), CodeIdempotencyKeyReused) {
+		t.Errorf("Expected %s, got %d: %s", CodeIdempotencyKeyReused, recorder.Code, recorder.Body)
+	}
+}
+
+func TestIdempotentRejectsKeyInProgress(t *testing.T) {
+	server, _ := newPayloadServer(t)
+	entered, release := make(chan struct{}), make(chan struct{})
+	handler := server.Idempotent(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		close(entered)
+		<-release
+	}))
+	request := func() *httptest.ResponseRecorder {
+		request := httptest.NewRequest("POST", "/", strings.NewReader("{}"))
+		request.Header.Set(idempotencyKeyHeader, "key")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	done := make(chan struct{})
+	go func() {
+		request()
+		close(done)
+	}()
+	<-entered
+	recorder := request()
+	close(release)
+	<-done
+
+	if recorder.Code != http.StatusConflict || !strings.Contains(recorder.Body.String(), CodeIdempotencyKeyInUse) {
+		t.Errorf("Expected %s, got %d: %s", CodeIdempotencyKeyInUse, recorder.Code, recorder.Body)
+	}
+}
+
+func TestIdempotentDoesNotReplayServerErrors(t *testing.T) {
+	server, _ := newPayloadServer(t)
+	calls := 0
+	handler := server.Idempotent(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		calls++
+		WriteInternalError(response)
+	}))
+
+	for i := 0; i < 2; i++ {
+		request := httptest.NewRequest("POST", "/", strings.NewReader("{}"))
+		request.Header.Set(idempotencyKeyHeader, "key")
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+	}
+	if calls != 2 {
+		t.Errorf("Expected the failed request to be executed again, got %d calls", calls)
+	}
+}
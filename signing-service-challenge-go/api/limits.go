@@ -0,0 +1,28 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+)
+
+const (
+	// DefaultMaxBodySize is the size limit of request bodies in bytes unless set by WithMaxBodySize.
+	DefaultMaxBodySize = 64 << 10
+	// MaxDataLength is the maximum number of characters of the data of a transaction.
+	MaxDataLength = 8192
+	// MaxLabelLength is the maximum number of characters of device labels and names.
+	MaxLabelLength = 64
+)
+
+// labelPattern restricts labels and names to letters, digits, spaces and common
+// punctuation, keeping control characters out of listings and logs.
+const labelPattern = `^[\p{L}\p{N} _.,:;/#()'-]*$`
+
+// bodyError maps an error reading or decoding a request body to its Problem.
+func bodyError(err error) *Problem {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return payloadTooLarge(tooLarge.Limit)
+	}
+	return invalidPayload()
+}
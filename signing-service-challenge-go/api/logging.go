@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/audit"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+const (
+	requestIdHeader = "X-Request-Id"
+	// maxRequestIdLength bounds the request ids taken over from clients.
+	maxRequestIdLength = 128
+)
+
+const accessEntryContextKey contextKey = iota + 1
+
+// accessEntry collects what handlers learn about a request for its access log line.
+type accessEntry struct {
+	requestId string
+	tenantId  string
+	apiKeyId  string
+	deviceId  string
+}
+
+func accessEntryFromContext(ctx context.Context) *accessEntry {
+	entry, _ := ctx.Value(accessEntryContextKey).(*accessEntry)
+	if entry == nil {
+		return &accessEntry{}
+	}
+	return entry
+}
+
+// RequestId returns the id of the request ctx belongs to, as logged and sent in the
+// X-Request-Id response header.
+func RequestId(ctx context.Context) string {
+	return accessEntryFromContext(ctx).requestId
+}
+
+// logDevice records the device a request acts on in its access log line.
+func logDevice(request *http.Request, deviceId string) {
+	accessEntryFromContext(request.Context()).deviceId = deviceId
+}
+
+// logAPIKey records the API key that authenticated a request in its access log line.
+func logAPIKey(request *http.Request, key *domain.APIKey) {
+	entry := accessEntryFromContext(request.Context())
+	entry.apiKeyId = key.Id
+	entry.tenantId = key.TenantId
+}
+
+// Log is a middleware that writes an access log line for every request of a route.
+// Request ids sent by clients in the X-Request-Id header are reused, all other
+// requests get a fresh one. Request and response bodies are never logged.
+func (s *Server) Log(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+
+		entry := &accessEntry{requestId: request.Header.Get(requestIdHeader)}
+		if entry.requestId == "" || len(entry.requestId) > maxRequestIdLength {
+			entry.requestId = uuid.New().String()
+		}
+		response.Header().Set(requestIdHeader, entry.requestId)
+
+		ctx := context.WithValue(request.Context(), accessEntryContextKey, entry)
+		recorder := &statusRecorder{ResponseWriter: response, status: http.StatusOK}
+		next.ServeHTTP(recorder, request.WithContext(ctx))
+
+		if entry.deviceId == "" {
+			entry.deviceId = mux.Vars(request)["device_id"]
+		}
+
+		attributes := []slog.Attr{
+			slog.String("request_id", entry.requestId),
+			slog.String("method", request.Method),
+			slog.String("route", route),
+			slog.Int("status", recorder.status),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+		}
+		if entry.deviceId != "" {
+			attributes = append(attributes, slog.String("device_id", entry.deviceId))
+		}
+		if entry.apiKeyId != "" {
+			attributes = append(attributes,
+				slog.String("tenant_id", entry.tenantId),
+				slog.String("api_key_id", entry.apiKeyId),
+			)
+		}
+		if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+			attributes = append(attributes, slog.String("trace_id", spanContext.TraceID().String()))
+		}
+
+		s.logger.LogAttrs(ctx, slog.LevelInfo, "request", attributes...)
+	})
+}
+
+// audit appends an entry about a request to the audit log.
+func (s *Server) audit(request *http.Request, entry audit.Entry) {
+	entry.RequestId = RequestId(request.Context())
+	entry.TenantId = TenantId(request)
+	if key, ok := APIKeyFromContext(request.Context()); ok {
+		entry.APIKeyId = key.Id
+	}
+	s.auditLog.Record(request.Context(), entry)
+}
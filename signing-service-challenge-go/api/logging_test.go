@@ -0,0 +1,129 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/audit"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+// lines decodes the JSON lines written to a log.
+func lines(t *testing.T, buffer *bytes.Buffer) []map[string]interface{} {
+	var result []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Expected a JSON line, got %q", line)
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
+func TestAccessLog(t *testing.T) {
+	var buffer bytes.Buffer
+	server := NewServer(":8080", persistence.NewMockRepository(), WithLogger(slog.New(slog.NewJSONHandler(&buffer, nil))))
+
+	req := httptest.NewRequest("GET", apiPrefix+"/devices/unknown", nil)
+	req.Header.Set(requestIdHeader, "request-1")
+	recorder := httptest.NewRecorder()
+	server.Handler().ServeHTTP(recorder, req)
+
+	if requestId := recorder.Header().Get(requestIdHeader); requestId != "request-1" {
+		t.Errorf("Expected request id %s, got %s", "request-1", requestId)
+	}
+
+	entries := lines(t, &buffer)
+	if len(entries) != 1 {
+		t.Fatalf("Expected %d access log line, got %d", 1, len(entries))
+	}
+	entry := entries[0]
+	expected := map[string]interface{}{
+		"request_id": "request-1",
+		"method":     "GET",
+		"route":      apiPrefix + "/devices/{device_id}",
+		"status":     float64(http.StatusNotFound),
+		"device_id":  "unknown",
+	}
+	for key, value := range expected {
+		if entry[key] != value {
+			t.Errorf("Expected %s %v, got %v", key, value, entry[key])
+		}
+	}
+	if _, ok := entry["duration_ms"]; !ok {
+		t.Errorf("Expected the access log line to contain the duration")
+	}
+}
+
+func TestAccessLogGeneratesRequestIds(t *testing.T) {
+	server := NewServer(":8080", persistence.NewMockRepository())
+
+	recorder := serve(server, "GET", "/health", "", nil)
+	if recorder.Header().Get(requestIdHeader) == "" {
+		t.Errorf("Expected a generated request id")
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	var buffer bytes.Buffer
+	server := NewServer(":8080", persistence.NewMockRepository(), WithAuditLog(audit.New(&buffer)))
+
+	var created struct {
+		Data *domain.SignatureDevice `json:"data"`
+	}
+	recorder := serve(server, "POST", "/devices", "", CreateSignatureDeviceRequest{Algorithm: "ECC", Label: "Device"})
+	if err := json.Unmarshal(recorder.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Error unmarshaling response body: %v", err)
+	}
+	deviceId := created.Data.Id
+
+	serve(server, "POST", "/transactions/sign", "", SignTransactionRequest{DeviceId: deviceId, Data: "secret-payload"})
+	serve(server, "POST", "/transactions/sign", "", SignTransactionRequest{DeviceId: deviceId, Data: "secret-payload"})
+	serve(server, "GET", "/devices/"+deviceId+"/public-key", "", nil)
+	serve(server, "POST", "/devices/"+deviceId+"/suspend", "", nil)
+	serve(server, "POST", "/devices/"+deviceId+"/suspend", "", nil)
+
+	if recorder := serve(server, "POST", "/transactions/sign", "", SignTransactionRequest{DeviceId: deviceId, Data: "data"}); recorder.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d", http.StatusConflict, recorder.Code)
+	}
+
+	if strings.Contains(buffer.String(), "secret-payload") || strings.Contains(buffer.String(), "PUBLIC KEY") {
+		t.Errorf("Expected the audit log to contain neither payloads nor keys")
+	}
+
+	entries := lines(t, &buffer)
+	events := []audit.Event{
+		audit.EventDeviceCreated,
+		audit.EventSignatureIssued,
+		audit.EventSignatureIssued,
+		audit.EventKeyExported,
+		audit.EventDeviceSuspended,
+	}
+	if len(entries) != len(events) {
+		t.Fatalf("Expected %d audit entries, got %d", len(events), len(entries))
+	}
+	for i, event := range events {
+		if entries[i]["event"] != string(event) {
+			t.Errorf("Expected event %s, got %v", event, entries[i]["event"])
+		}
+		if entries[i]["device_id"] != deviceId {
+			t.Errorf("Expected device id %s, got %v", deviceId, entries[i]["device_id"])
+		}
+		if entries[i]["request_id"] == "" {
+			t.Errorf("Expected entry %d to contain the request id", i)
+		}
+	}
+	if entries[2]["counter"] != float64(1) {
+		t.Errorf("Expected counter %d, got %v", 1, entries[2]["counter"])
+	}
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Instrument is a middleware that records the count and latency of the requests of a
+// route, and has the signature devices report the timing of their operations.
+func (s *Server) Instrument(route string, next http.Handler) http.Handler {
+	if s.metrics == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: response, status: http.StatusOK}
+
+		next.ServeHTTP(recorder, request.WithContext(s.instrumented(request.Context())))
+
+		s.metrics.ObserveRequest(route, request.Method, recorder.status, time.Since(start))
+	})
+}
+
+// instrumented returns a copy of ctx that has the signature devices report the
+// timing of their operations to the metrics, if there are any.
+func (s *Server) instrumented(ctx context.Context) context.Context {
+	if s.metrics == nil {
+		return ctx
+	}
+	return domain.WithInstrumentation(ctx, s.metrics)
+}
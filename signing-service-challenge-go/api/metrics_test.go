@@ -0,0 +1,57 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/metrics"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+func TestMetricsRecordRoutes(t *testing.T) {
+	server := NewServer(":8080", persistence.NewMockRepository(), WithMetrics(metrics.New()))
+
+	serve(server, "GET", "/devices/unknown", "", nil)
+
+	recorder := httptest.NewRecorder()
+	server.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, recorder.Code)
+	}
+
+	expected := `signing_service_http_requests_total{method="GET",route="/api/v0/devices/{device_id}",status="404"} 1`
+	if !strings.Contains(recorder.Body.String(), expected) {
+		t.Errorf("Expected exposition to contain %s", expected)
+	}
+}
+
+func TestMetricsRecordDeviceOperations(t *testing.T) {
+	server := NewServer(":8080", persistence.NewInMemoryPersistence(), WithMetrics(metrics.New()))
+
+	recorder := serve(server, "POST", "/devices", "", CreateSignatureDeviceRequest{Algorithm: "ECC", Label: "Device"})
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, recorder.Code, recorder.Body)
+	}
+	var created struct {
+		Data struct {
+			Id string `json:"id"`
+		} `json:"data"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &created)
+	signedData(t, serve(server, "POST", "/transactions/sign", "", SignTransactionRequest{DeviceId: created.Data.Id, Data: "data"}))
+
+	recorder = httptest.NewRecorder()
+	server.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	for _, expected := range []string{
+		`signing_service_key_generation_duration_seconds_count{algorithm="ECC"} 1`,
+		`signing_service_device_lock_wait_seconds_count{algorithm="ECC"} 1`,
+		`signing_service_signing_duration_seconds_count{algorithm="ECC"} 1`,
+	} {
+		if !strings.Contains(recorder.Body.String(), expected) {
+			t.Errorf("Expected exposition to contain %s", expected)
+		}
+	}
+}
@@ -0,0 +1,838 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/health"
+)
+
+const (
+	openAPIVersion  = "3.0.3"
+	schemaRefPrefix = "#/components/schemas/"
+)
+
+// OpenAPI is the subset of the OpenAPI 3 document model needed to describe this API.
+type OpenAPI struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Servers    []ServerObject      `json:"servers,omitempty"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+// Info holds the metadata of the API.
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// ServerObject describes the base URL of the API.
+type ServerObject struct {
+	Url string `json:"url"`
+}
+
+// PathItem maps lower case HTTP methods to the operations of a single path.
+type PathItem map[string]*Operation
+
+// Components holds the reusable schemas referenced throughout the document.
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme describes how clients authenticate.
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// SecurityRequirement maps security scheme names to the scopes they require.
+type SecurityRequirement map[string][]string
+
+// Operation describes a single API operation on a path.
+type Operation struct {
+	OperationId string                     `json:"operationId"`
+	Summary     string                     `json:"summary,omitempty"`
+	Parameters  []Parameter                `json:"parameters,omitempty"`
+	RequestBody *RequestBody               `json:"requestBody,omitempty"`
+	Responses   map[string]*ResponseObject `json:"responses"`
+	Security    []SecurityRequirement      `json:"security,omitempty"`
+	// Scope is the API key scope required by the operation.
+	Scope domain.Scope `json:"x-required-scope,omitempty"`
+}
+
+// Parameter describes a single path or query parameter.
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+// RequestBody describes the payload accepted by an operation.
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// ResponseObject describes a single response of an operation.
+type ResponseObject struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType binds a schema to a content type.
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is the subset of the OpenAPI schema object used by this API.
+type Schema struct {
+	Ref        string             `json:"$ref,omitempty"`
+	Type       string             `json:"type,omitempty"`
+	Format     string             `json:"format,omitempty"`
+	Enum       []string           `json:"enum,omitempty"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+	// MinLength and MaxLength bound the number of characters of strings if not zero.
+	MinLength int `json:"minLength,omitempty"`
+	MaxLength int `json:"maxLength,omitempty"`
+	// Pattern is a regular expression that strings must match.
+	Pattern string `json:"pattern,omitempty"`
+	// AdditionalProperties describes the values of objects used as maps.
+	AdditionalProperties *Schema `json:"additionalProperties,omitempty"`
+	// Closed objects reject properties missing from Properties. It is documented
+	// as additionalProperties: false.
+	Closed bool `json:"-"`
+}
+
+// MarshalJSON implements json.Marshaler, documenting closed objects.
+func (s Schema) MarshalJSON() ([]byte, error) {
+	type plain Schema
+	if !s.Closed {
+		return json.Marshal(plain(s))
+	}
+	return json.Marshal(struct {
+		plain
+		AdditionalProperties bool `json:"additionalProperties"`
+	}{plain(s), false})
+}
+
+// UnmarshalJSON implements json.Unmarshaler, accepting a boolean additionalProperties.
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	type plain Schema
+	var raw struct {
+		plain
+		AdditionalProperties json.RawMessage `json:"additionalProperties"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*s = Schema(raw.plain)
+	switch string(raw.AdditionalProperties) {
+	case "", "true":
+		return nil
+	case "false":
+		s.Closed = true
+		return nil
+	}
+	return json.Unmarshal(raw.AdditionalProperties, &s.AdditionalProperties)
+}
+
+// ValidationError describes why a single field of a request failed validation.
+type ValidationError struct {
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) String() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+func ref(name string) *Schema {
+	return &Schema{Ref: schemaRefPrefix + name}
+}
+
+func jsonBody(schema *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: schema}}
+}
+
+// envelope wraps a schema into the Response container.
+func envelope(schema *Schema) *Schema {
+	return &Schema{
+		Type:       "object",
+		Properties: map[string]*Schema{"data": schema},
+		Required:   []string{"data"},
+	}
+}
+
+func success(description string, data *Schema) *ResponseObject {
+	return &ResponseObject{Description: description, Content: jsonBody(envelope(data))}
+}
+
+// failure describes an error response. Problem details are served by default,
+// the ErrorResponse only by servers running with legacy errors.
+func failure(description string) *ResponseObject {
+	return &ResponseObject{
+		Description: description,
+		Content: map[string]MediaType{
+			problemContentType: {Schema: ref("Problem")},
+			"application/json": {Schema: ref("ErrorResponse")},
+		},
+	}
+}
+
+// withAccessFailures adds the responses of the authentication and rate limiting middlewares.
+func (s *Server) withAccessFailures(responses map[string]*ResponseObject) map[string]*ResponseObject {
+	extended := make(map[string]*ResponseObject)
+	if s.authentication {
+		extended["401"] = failure("The request carries no valid API key.")
+		extended["403"] = failure("The API key lacks the required scope.")
+	}
+	if s.limiter != nil {
+		extended["429"] = failure("The rate limit of the API key or the tenant is exhausted.")
+	}
+
+	for status, response := range responses {
+		extended[status] = response
+	}
+	return extended
+}
+
+// withBodyFailures adds the responses to request bodies exceeding the size limit.
+func withBodyFailures(responses map[string]*ResponseObject) map[string]*ResponseObject {
+	extended := map[string]*ResponseObject{"413": failure("The request body exceeds the size limit.")}
+	for status, response := range responses {
+		extended[status] = response
+	}
+	return extended
+}
+
+// componentSchemas describes the types exchanged by the handlers.
+var componentSchemas = map[string]*Schema{
+	"Problem": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"type":     {Type: "string", Format: "uri"},
+			"code":     {Type: "string"},
+			"title":    {Type: "string"},
+			"status":   {Type: "integer"},
+			"detail":   {Type: "string"},
+			"instance": {Type: "string", Format: "uri-reference"},
+			"errors":   {Type: "array", Items: ref("ValidationError")},
+		},
+		Required: []string{"type", "code", "title", "status"},
+	},
+	"ValidationError": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"field":   {Type: "string"},
+			"message": {Type: "string"},
+		},
+		Required: []string{"message"},
+	},
+	"ErrorResponse": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"errors": {Type: "array", Items: &Schema{Type: "string"}},
+		},
+		Required: []string{"errors"},
+	},
+	"HealthResponse": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"status":    {Type: "string", Enum: []string{string(health.Pass), string(health.Warn), string(health.Fail)}},
+			"version":   {Type: "string"},
+			"releaseId": {Type: "string"},
+			"output":    {Type: "string"},
+			"checks": {
+				Type:                 "object",
+				AdditionalProperties: &Schema{Type: "array", Items: ref("HealthCheckResult")},
+			},
+		},
+		Required: []string{"status"},
+	},
+	"HealthCheckResult": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"componentId":   {Type: "string"},
+			"componentType": {Type: "string"},
+			"observedValue": {Type: "number"},
+			"observedUnit":  {Type: "string"},
+			"status":        {Type: "string", Enum: []string{string(health.Pass), string(health.Warn), string(health.Fail)}},
+			"time":          {Type: "string", Format: "date-time"},
+			"output":        {Type: "string"},
+		},
+		Required: []string{"componentId", "observedValue", "observedUnit", "status", "time"},
+	},
+	"SignatureDevice": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"Id":                 {Type: "string"},
+			"TenantId":           {Type: "string"},
+			"Algorithm":          {Type: "string", Enum: []string{"RSA", "ECC"}},
+			"Label":              {Type: "string"},
+			"Status":             {Type: "string", Enum: []string{string(domain.DeviceStatusActive), string(domain.DeviceStatusSuspended)}},
+			"SignatureCounter":   {Type: "integer"},
+			"LastSignature":      {Type: "string", Format: "byte"},
+			"SecuredDataFormat":  ref("SecuredDataFormat"),
+			"TransactionCounter": {Type: "integer"},
+			"PredecessorId":      {Type: "string"},
+			"SuccessorId":        {Type: "string"},
+		},
+		Required: []string{"Id", "TenantId", "Algorithm", "Label", "Status", "SignatureCounter", "LastSignature", "SecuredDataFormat", "TransactionCounter"},
+	},
+	"CreateSignatureDeviceRequest": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"algorithm":           {Type: "string", Enum: []string{"RSA", "ECC"}},
+			"label":               {Type: "string", MaxLength: MaxLabelLength, Pattern: labelPattern},
+			"secured_data_format": ref("SecuredDataFormat"),
+		},
+		Required: []string{"algorithm"},
+		Closed:   true,
+	},
+	"SignTransactionRequest": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"device_id": {Type: "string", MinLength: 1},
+			"data":      {Type: "string", MinLength: 1, MaxLength: MaxDataLength},
+			"encoding":  {Type: "string", Enum: []string{EncodingUTF8, EncodingBase64, EncodingHex}},
+			"digest":    {Type: "string", Enum: []string{DigestSHA256}},
+		},
+		Required: []string{"device_id", "data"},
+		Closed:   true,
+	},
+	"Transaction": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"tenant_id":           {Type: "string"},
+			"device_id":           {Type: "string"},
+			"counter":             {Type: "integer"},
+			"signature":           {Type: "string", Format: "byte"},
+			"signed_data":         {Type: "string"},
+			"secured_data_format": ref("SecuredDataFormat"),
+			"data_encoding":       ref("PayloadEncoding"),
+			"api_key_id":          {Type: "string"},
+			"transaction_id":      {Type: "string"},
+			"operation":           ref("Operation"),
+			"created_at":          {Type: "string", Format: "date-time"},
+			"timestamp_token":     {Type: "string", Format: "byte"},
+			"timestamped_at":      {Type: "string", Format: "date-time"},
+		},
+		Required: []string{"device_id", "counter", "signature", "signed_data", "secured_data_format", "created_at"},
+	},
+	"TransactionStepRequest": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"data":     {Type: "string", MinLength: 1, MaxLength: MaxDataLength},
+			"encoding": {Type: "string", Enum: []string{EncodingUTF8, EncodingBase64, EncodingHex}},
+			"digest":   {Type: "string", Enum: []string{DigestSHA256}},
+		},
+		Required: []string{"data"},
+		Closed:   true,
+	},
+	"FiscalTransaction": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"id":                 {Type: "string"},
+			"tenant_id":          {Type: "string"},
+			"device_id":          {Type: "string"},
+			"number":             {Type: "integer"},
+			"state":              ref("FiscalTransactionState"),
+			"signature_counters": {Type: "array", Items: &Schema{Type: "integer"}},
+			"started_at":         {Type: "string", Format: "date-time"},
+			"updated_at":         {Type: "string", Format: "date-time"},
+			"finished_at":        {Type: "string", Format: "date-time"},
+			"expires_at":         {Type: "string", Format: "date-time"},
+		},
+		Required: []string{"id", "device_id", "number", "state", "signature_counters", "started_at", "updated_at", "expires_at"},
+	},
+	"FiscalTransactionState": {Type: "string", Enum: fiscalTransactionStateEnum()},
+	"Operation":              {Type: "string", Enum: []string{string(domain.OperationStart), string(domain.OperationUpdate), string(domain.OperationFinish)}},
+	"TransactionStepResponse": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"transaction": ref("FiscalTransaction"),
+			"signature":   ref("SignatureResponse"),
+		},
+		Required: []string{"transaction", "signature"},
+	},
+	"VerificationReport": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"valid":         {Type: "boolean"},
+			"device_id":     {Type: "string"},
+			"transactions":  {Type: "integer"},
+			"first_counter": {Type: "integer"},
+			"last_counter":  {Type: "integer"},
+			"failures":      {Type: "array", Items: ref("VerificationFailure")},
+		},
+		Required: []string{"valid", "device_id", "transactions", "first_counter", "last_counter", "failures"},
+	},
+	"VerificationFailure": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"counter": {Type: "integer"},
+			"file":    {Type: "string"},
+			"reason":  {Type: "string"},
+		},
+		Required: []string{"reason"},
+	},
+	"APIKey": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"id":         {Type: "string"},
+			"tenant_id":  {Type: "string"},
+			"name":       {Type: "string"},
+			"scopes":     {Type: "array", Items: ref("Scope")},
+			"created_at": {Type: "string", Format: "date-time"},
+			"revoked_at": {Type: "string", Format: "date-time"},
+		},
+		Required: []string{"id", "name", "scopes", "created_at"},
+	},
+	"CreateAPIKeyRequest": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"tenant_id": {Type: "string"},
+			"name":      {Type: "string", MinLength: 1, MaxLength: MaxLabelLength, Pattern: labelPattern},
+			"scopes":    {Type: "array", Items: ref("Scope")},
+		},
+		Required: []string{"name", "scopes"},
+		Closed:   true,
+	},
+	"CreateAPIKeyResponse": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"id":         {Type: "string"},
+			"tenant_id":  {Type: "string"},
+			"name":       {Type: "string"},
+			"scopes":     {Type: "array", Items: ref("Scope")},
+			"created_at": {Type: "string", Format: "date-time"},
+			"key":        {Type: "string"},
+		},
+		Required: []string{"id", "name", "scopes", "created_at", "key"},
+	},
+	"Organization": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"id":         {Type: "string"},
+			"name":       {Type: "string"},
+			"created_at": {Type: "string", Format: "date-time"},
+		},
+		Required: []string{"id", "name", "created_at"},
+	},
+	"CreateOrganizationRequest": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"name": {Type: "string", MinLength: 1, MaxLength: MaxLabelLength, Pattern: labelPattern},
+		},
+		Required: []string{"name"},
+		Closed:   true,
+	},
+	"Quota": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"id":        {Type: "string"},
+			"unlimited": {Type: "boolean"},
+			"rate":      {Type: "number"},
+			"burst":     {Type: "integer"},
+			"remaining": {Type: "number"},
+		},
+		Required: []string{"id", "unlimited"},
+	},
+	"QuotasResponse": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"tenant":  ref("Quota"),
+			"api_key": ref("Quota"),
+			"devices": {Type: "array", Items: ref("Quota")},
+		},
+		Required: []string{"tenant", "devices"},
+	},
+	"Scope":     {Type: "string", Enum: scopeEnum()},
+	"EventType": {Type: "string", Enum: eventTypeEnum()},
+	"Event": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"id":          {Type: "string"},
+			"sequence":    {Type: "integer"},
+			"type":        ref("EventType"),
+			"tenant_id":   {Type: "string"},
+			"device_id":   {Type: "string"},
+			"occurred_at": {Type: "string", Format: "date-time"},
+			"data":        {Type: "object"},
+		},
+		Required: []string{"id", "sequence", "type", "device_id", "occurred_at", "data"},
+	},
+	"Webhook": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"id":         {Type: "string"},
+			"tenant_id":  {Type: "string"},
+			"url":        {Type: "string", Format: "uri"},
+			"events":     {Type: "array", Items: ref("EventType")},
+			"created_at": {Type: "string", Format: "date-time"},
+		},
+		Required: []string{"id", "url", "events", "created_at"},
+	},
+	"CreateWebhookRequest": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"url":    {Type: "string", Format: "uri", MinLength: 1},
+			"events": {Type: "array", Items: ref("EventType")},
+		},
+		Required: []string{"url"},
+		Closed:   true,
+	},
+	"CreateWebhookResponse": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"id":         {Type: "string"},
+			"tenant_id":  {Type: "string"},
+			"url":        {Type: "string", Format: "uri"},
+			"events":     {Type: "array", Items: ref("EventType")},
+			"created_at": {Type: "string", Format: "date-time"},
+			"secret":     {Type: "string"},
+		},
+		Required: []string{"id", "url", "events", "created_at", "secret"},
+	},
+	"WebhookDelivery": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"id":              {Type: "string"},
+			"tenant_id":       {Type: "string"},
+			"webhook_id":      {Type: "string"},
+			"event":           ref("Event"),
+			"state":           {Type: "string", Enum: []string{string(domain.DeliveryPending), string(domain.DeliveryDelivered), string(domain.DeliveryDead)}},
+			"attempts":        {Type: "integer"},
+			"next_attempt_at": {Type: "string", Format: "date-time"},
+			"last_attempt_at": {Type: "string", Format: "date-time"},
+			"last_status":     {Type: "integer"},
+			"last_error":      {Type: "string"},
+			"delivered_at":    {Type: "string", Format: "date-time"},
+		},
+		Required: []string{"id", "webhook_id", "event", "state", "attempts", "next_attempt_at"},
+	},
+	"SignatureResponse": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"signature":           {Type: "string", Format: "byte"},
+			"signed_data":         {Type: "string"},
+			"secured_data_format": ref("SecuredDataFormat"),
+			"data_encoding":       ref("PayloadEncoding"),
+			"signed_at":           {Type: "string", Format: "date-time"},
+			"timestamp_token":     {Type: "string", Format: "byte"},
+			"timestamped_at":      {Type: "string", Format: "date-time"},
+		},
+		Required: []string{"signature", "signed_data", "secured_data_format", "data_encoding", "signed_at"},
+	},
+	"SecuredDataFormat": {Type: "string", Enum: securedDataFormatEnum()},
+	"PayloadEncoding":   {Type: "string", Enum: []string{string(domain.PayloadText), string(domain.PayloadBinary), string(domain.PayloadSHA256)}},
+	"PublicKeyResponse": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"device_id":  {Type: "string"},
+			"algorithm":  {Type: "string", Enum: []string{"RSA", "ECC"}},
+			"public_key": {Type: "string"},
+		},
+		Required: []string{"device_id", "algorithm", "public_key"},
+	},
+}
+
+var openAPIOperation = &Operation{
+	OperationId: "openAPI",
+	Summary:     "Serves this OpenAPI document.",
+	Responses: map[string]*ResponseObject{
+		"200": {Description: "The OpenAPI 3 document of the API.", Content: jsonBody(&Schema{Type: "object"})},
+	},
+}
+
+// OpenAPI generates the OpenAPI document for every route served by the Server.
+func (s *Server) OpenAPI() *OpenAPI {
+	spec := &OpenAPI{
+		OpenAPI: openAPIVersion,
+		Info: Info{
+			Title:   "Signature Service",
+			Version: apiVersion,
+		},
+		Servers:    []ServerObject{{Url: apiPrefix}},
+		Paths:      make(map[string]PathItem),
+		Components: Components{Schemas: componentSchemas},
+	}
+
+	if s.authentication {
+		spec.Components.SecuritySchemes = map[string]*SecurityScheme{"apiKey": apiKeySecurityScheme}
+	}
+
+	for _, r := range s.routes() {
+		item, ok := spec.Paths[r.path]
+		if !ok {
+			item = make(PathItem)
+			spec.Paths[r.path] = item
+		}
+
+		operation := *r.operation
+		if s.authentication && r.scope != "" {
+			operation.Security = []SecurityRequirement{{"apiKey": {}}}
+			operation.Scope = r.scope
+		}
+		if r.scope != "" {
+			operation.Responses = s.withAccessFailures(operation.Responses)
+		}
+		if operation.RequestBody != nil {
+			operation.Responses = withBodyFailures(operation.Responses)
+		}
+		if r.method == http.MethodPost {
+			operation.Parameters = append(append([]Parameter(nil), operation.Parameters...), idempotencyKeyParameter)
+			operation.Responses = withIdempotencyFailures(operation.Responses)
+		}
+		item[strings.ToLower(r.method)] = &operation
+	}
+
+	return spec
+}
+
+// OpenAPIHandler serves the OpenAPI document of the API.
+func (s *Server) OpenAPIHandler(response http.ResponseWriter, request *http.Request) {
+	bytes, err := json.MarshalIndent(s.OpenAPI(), "", "  ")
+	if err != nil {
+		WriteInternalError(response)
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(http.StatusOK)
+	response.Write(bytes)
+}
+
+// ValidateRequest is a middleware that rejects requests whose JSON body does not
+// match the request schema of the given operation. Bodies of the other media types
+// documented for the operation are left to the handler; bodies of undocumented
+// types are taken for JSON, as clients often omit or misstate the content type.
+func (s *Server) ValidateRequest(spec *OpenAPI, operation *Operation, next http.Handler) http.Handler {
+	if operation == nil || operation.RequestBody == nil {
+		return next
+	}
+
+	media, ok := operation.RequestBody.Content["application/json"]
+	if !ok {
+		return next
+	}
+
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if media := mediaType(request); media != "application/json" {
+			if _, ok := operation.RequestBody.Content[media]; ok {
+				next.ServeHTTP(response, request)
+				return
+			}
+		}
+
+		_, span := tracer.Start(request.Context(), "openapi.ValidateRequest")
+		body, err := io.ReadAll(http.MaxBytesReader(response, request.Body, s.maxBodySize))
+		if err != nil {
+			span.End()
+			s.writeError(response, request, bodyError(err))
+			return
+		}
+
+		var payload interface{}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			span.End()
+			s.writeError(response, request, invalidPayload())
+			return
+		}
+
+		errs := spec.Validate(media.Schema, "", payload)
+		span.End()
+		if len(errs) > 0 {
+			s.writeError(response, request, validationFailed(errs...))
+			return
+		}
+
+		request.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(response, request)
+	})
+}
+
+// Validate checks a decoded JSON value against a schema of the document.
+func (spec *OpenAPI) Validate(schema *Schema, field string, value interface{}) []ValidationError {
+	schema = spec.resolve(schema)
+	if schema == nil {
+		return nil
+	}
+
+	invalid := func(message string) []ValidationError {
+		return []ValidationError{{Field: field, Message: message}}
+	}
+
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return invalid("must be an object")
+		}
+
+		var errs []ValidationError
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				errs = append(errs, ValidationError{Field: join(field, name), Message: "is required"})
+			}
+		}
+
+		if schema.Closed {
+			var unknown []string
+			for name := range object {
+				if _, ok := schema.Properties[name]; !ok {
+					unknown = append(unknown, name)
+				}
+			}
+			sort.Strings(unknown)
+			for _, name := range unknown {
+				errs = append(errs, ValidationError{Field: join(field, name), Message: "is not a known field"})
+			}
+		}
+
+		names := make([]string, 0, len(schema.Properties))
+		for name := range schema.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if property, ok := object[name]; ok {
+				errs = append(errs, spec.Validate(schema.Properties[name], join(field, name), property)...)
+			}
+		}
+		return errs
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return invalid("must be an array")
+		}
+
+		var errs []ValidationError
+		for i, item := range items {
+			errs = append(errs, spec.Validate(schema.Items, fmt.Sprintf("%s[%d]", field, i), item)...)
+		}
+		return errs
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return invalid("must be a string")
+		}
+		if len(schema.Enum) > 0 && !contains(schema.Enum, str) {
+			return invalid(fmt.Sprintf("must be one of %s", strings.Join(schema.Enum, ", ")))
+		}
+		length := utf8.RuneCountInString(str)
+		if length < schema.MinLength {
+			if schema.MinLength == 1 {
+				return invalid("must not be empty")
+			}
+			return invalid(fmt.Sprintf("must be at least %d characters long", schema.MinLength))
+		}
+		if schema.MaxLength > 0 && length > schema.MaxLength {
+			return invalid(fmt.Sprintf("must be at most %d characters long", schema.MaxLength))
+		}
+		if schema.Pattern != "" && !pattern(schema.Pattern).MatchString(str) {
+			return invalid(fmt.Sprintf("must match %s", schema.Pattern))
+		}
+	case "integer":
+		number, ok := value.(float64)
+		if !ok || number != float64(int64(number)) {
+			return invalid("must be an integer")
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return invalid("must be a number")
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return invalid("must be a boolean")
+		}
+	}
+
+	return nil
+}
+
+// patterns caches the compiled patterns of the schemas.
+var patterns sync.Map
+
+func pattern(expr string) *regexp.Regexp {
+	if compiled, ok := patterns.Load(expr); ok {
+		return compiled.(*regexp.Regexp)
+	}
+	compiled, _ := patterns.LoadOrStore(expr, regexp.MustCompile(expr))
+	return compiled.(*regexp.Regexp)
+}
+
+func (spec *OpenAPI) resolve(schema *Schema) *Schema {
+	for schema != nil && schema.Ref != "" {
+		schema = spec.Components.Schemas[strings.TrimPrefix(schema.Ref, schemaRefPrefix)]
+	}
+	return schema
+}
+
+func securedDataFormatEnum() []string {
+	formats := make([]string, 0, len(domain.SecuredDataFormats))
+	for _, format := range domain.SecuredDataFormats {
+		formats = append(formats, string(format))
+	}
+	return formats
+}
+
+func fiscalTransactionStateEnum() []string {
+	states := make([]string, 0, len(domain.FiscalTransactionStates))
+	for _, state := range domain.FiscalTransactionStates {
+		states = append(states, string(state))
+	}
+	return states
+}
+
+func scopeEnum() []string {
+	scopes := make([]string, 0, len(domain.Scopes))
+	for _, scope := range domain.Scopes {
+		scopes = append(scopes, string(scope))
+	}
+	return scopes
+}
+
+func eventTypeEnum() []string {
+	eventTypes := make([]string, 0, len(domain.EventTypes))
+	for _, eventType := range domain.EventTypes {
+		eventTypes = append(eventTypes, string(eventType))
+	}
+	return eventTypes
+}
+
+func join(parent, field string) string {
+	if parent == "" {
+		return field
+	}
+	return parent + "." + field
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
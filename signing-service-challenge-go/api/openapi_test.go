@@ -0,0 +1,292 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+// documentedRoutes lists every route of the API. It is kept by hand, so a route
+// that is added, removed or renamed in the router or the document fails
+// TestOpenAPICoversAllRoutes until it is listed here as well.
+var documentedRoutes = []string{
+	"GET /health",
+	"GET /health/live",
+	"GET /health/ready",
+	"GET /openapi.json",
+	"POST /devices",
+	"GET /devices",
+	"GET /devices/{device_id}",
+	"GET /devices/{device_id}/transactions",
+	"GET /devices/{device_id}/export",
+	"GET /devices/{device_id}/verify",
+	"GET /devices/{device_id}/public-key",
+	"POST /devices/{device_id}/suspend",
+	"POST /devices/{device_id}/rotate",
+	"GET /quotas",
+	"POST /transactions/sign",
+	"POST /transactions",
+	"GET /transactions",
+	"GET /transactions/{transaction_id}",
+	"POST /transactions/{transaction_id}/update",
+	"POST /transactions/{transaction_id}/finish",
+	"POST /admin/keys",
+	"GET /admin/keys",
+	"DELETE /admin/keys/{key_id}",
+	"POST /admin/organizations",
+	"GET /admin/organizations",
+	"POST /webhooks",
+	"GET /webhooks",
+	"GET /webhooks/{webhook_id}",
+	"DELETE /webhooks/{webhook_id}",
+	"GET /webhooks/{webhook_id}/deliveries",
+	"POST /webhooks/{webhook_id}/deliveries/{delivery_id}/retry",
+}
+
+func TestOpenAPICoversAllRoutes(t *testing.T) {
+	server := NewServer(":8080", persistence.NewMockRepository())
+	spec := server.OpenAPI()
+
+	router, ok := server.Handler().(*mux.Router)
+	if !ok {
+		t.Fatal("Expected the server handler to be a router")
+	}
+
+	registered := map[string]bool{}
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return err
+		}
+
+		if !strings.HasPrefix(template, apiPrefix) {
+			return nil
+		}
+		for _, method := range methods {
+			registered[method+" "+strings.TrimPrefix(template, apiPrefix)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	documented := map[string]bool{}
+	for path, item := range spec.Paths {
+		for method, operation := range item {
+			route := strings.ToUpper(method) + " " + path
+			documented[route] = true
+			switch {
+			case operation.OperationId == "":
+				t.Errorf("Expected an operation id for %s", route)
+			case len(operation.Responses) == 0:
+				t.Errorf("Expected responses for %s", route)
+			}
+		}
+	}
+
+	expected := map[string]bool{}
+	for _, route := range documentedRoutes {
+		expected[route] = true
+		if !registered[route] {
+			t.Errorf("Route %s is not served", route)
+		}
+		if !documented[route] {
+			t.Errorf("Route %s is missing from the OpenAPI document", route)
+		}
+	}
+	for route := range registered {
+		if !expected[route] {
+			t.Errorf("Route %s is served but not listed in documentedRoutes", route)
+		}
+	}
+	for route := range documented {
+		if !expected[route] {
+			t.Errorf("Route %s is documented but not listed in documentedRoutes", route)
+		}
+	}
+}
+
+func TestOpenAPIReferencesResolve(t *testing.T) {
+	spec := NewServer(":8080", persistence.NewMockRepository()).OpenAPI()
+
+	var check func(schema *Schema)
+	check = func(schema *Schema) {
+		if schema == nil {
+			return
+		}
+		if schema.Ref != "" && spec.resolve(schema) == nil {
+			t.Errorf("Unresolvable schema reference %s", schema.Ref)
+		}
+		for _, property := range schema.Properties {
+			check(property)
+		}
+		check(schema.Items)
+		check(schema.AdditionalProperties)
+	}
+
+	for path, item := range spec.Paths {
+		for method, operation := range item {
+			if len(operation.Responses) == 0 {
+				t.Errorf("Operation %s %s has no responses", method, path)
+			}
+			if operation.RequestBody != nil {
+				for _, media := range operation.RequestBody.Content {
+					check(media.Schema)
+				}
+			}
+			for _, response := range operation.Responses {
+				for _, media := range response.Content {
+					check(media.Schema)
+				}
+			}
+		}
+	}
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	server := NewServer(":8080", persistence.NewMockRepository())
+
+	req, err := http.NewRequest("GET", apiPrefix+"/openapi.json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	server.Handler().ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, recorder.Code)
+	}
+
+	var document OpenAPI
+	if err := json.Unmarshal(recorder.Body.Bytes(), &document); err != nil {
+		t.Fatalf("Error unmarshaling response body: %v", err)
+	}
+	if document.OpenAPI != openAPIVersion {
+		t.Errorf("Expected openapi version %s, got %s", openAPIVersion, document.OpenAPI)
+	}
+	if _, ok := document.Paths["/devices"]["post"]; !ok {
+		t.Errorf("Document is missing the create device operation")
+	}
+}
+
+func TestValidateRequestRejectsInvalidPayload(t *testing.T) {
+	server := NewServer(":8080", persistence.NewMockRepository())
+
+	body, _ := json.Marshal(map[string]interface{}{"algorithm": "DSA", "label": 42})
+	req, err := http.NewRequest("POST", apiPrefix+"/devices", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	server.Handler().ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, recorder.Code)
+	}
+
+	var problem Problem
+	if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("Error unmarshaling response body: %v", err)
+	}
+	if problem.Code != CodeValidationFailed {
+		t.Errorf("Expected code %s, got %s", CodeValidationFailed, problem.Code)
+	}
+	if len(problem.Errors) != 2 {
+		t.Errorf("Expected %d validation errors, got %v", 2, problem.Errors)
+	}
+}
+
+func TestValidateRequestAcceptsValidPayload(t *testing.T) {
+	server := NewServer(":8080", persistence.NewMockRepository())
+
+	body, _ := json.Marshal(CreateSignatureDeviceRequest{Algorithm: "ECC", Label: "Device"})
+	req, err := http.NewRequest("POST", apiPrefix+"/devices", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	server.Handler().ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusCreated {
+		t.Errorf("Expected status code %d, got %d", http.StatusCreated, recorder.Code)
+	}
+}
+
+func TestValidateRequestRejectsInvalidFields(t *testing.T) {
+	server := NewServer(":8080", persistence.NewMockRepository())
+
+	tests := []struct {
+		path    string
+		body    interface{}
+		field   string
+		message string
+	}{
+		{"/devices", map[string]interface{}{"algorithm": "ECC", "lable": "Device"}, "lable", "is not a known field"},
+		{"/devices", map[string]interface{}{"algorithm": "ECC", "label": strings.Repeat("a", MaxLabelLength+1)}, "label", "must be at most 64 characters long"},
+		{"/devices", map[string]interface{}{"algorithm": "ECC", "label": "Device\n"}, "label", "must match " + labelPattern},
+		{"/transactions/sign", map[string]interface{}{"device_id": "device", "data": ""}, "data", "must not be empty"},
+		{"/transactions/sign", map[string]interface{}{"device_id": "device", "data": strings.Repeat("a", MaxDataLength+1)}, "data", "must be at most 8192 characters long"},
+	}
+
+	for _, test := range tests {
+		recorder := serve(server, "POST", test.path, "", test.body)
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, recorder.Code)
+			continue
+		}
+
+		var problem Problem
+		if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+			t.Fatalf("Error unmarshaling response body: %v", err)
+		}
+		if len(problem.Errors) != 1 || problem.Errors[0].Field != test.field || problem.Errors[0].Message != test.message {
+			t.Errorf("Expected %s: %s, got %v", test.field, test.message, problem.Errors)
+		}
+	}
+}
+
+func TestValidateRequestRejectsLargeBody(t *testing.T) {
+	server := NewServer(":8080", persistence.NewMockRepository(), WithMaxBodySize(1024))
+
+	recorder := serve(server, "POST", "/devices", "", CreateSignatureDeviceRequest{Algorithm: "ECC", Label: strings.Repeat("a", 2048)})
+
+	if recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status code %d, got %d", http.StatusRequestEntityTooLarge, recorder.Code)
+	}
+	if !strings.Contains(recorder.Body.String(), CodePayloadTooLarge) {
+		t.Errorf("Expected code %s, got %s", CodePayloadTooLarge, recorder.Body)
+	}
+}
+
+func TestSchemaDocumentsClosedObjects(t *testing.T) {
+	encoded, err := json.Marshal(componentSchemas["SignTransactionRequest"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(encoded), `"additionalProperties":false`) {
+		t.Errorf("Expected additionalProperties false, got %s", encoded)
+	}
+
+	var decoded Schema
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Closed || decoded.Properties["data"].MaxLength != MaxDataLength {
+		t.Errorf("Expected the schema to survive a round trip, got %+v", decoded)
+	}
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+type CreateOrganizationRequest struct {
+	Name string `json:"name"`
+}
+
+var createOrganizationOperation = &Operation{
+	OperationId: "createOrganization",
+	Summary:     "Creates an organization, i.e. a tenant with its own isolated devices.",
+	RequestBody: &RequestBody{Required: true, Content: jsonBody(ref("CreateOrganizationRequest"))},
+	Responses: map[string]*ResponseObject{
+		"201": success("The created organization.", ref("Organization")),
+		"400": failure("The request payload is invalid."),
+	},
+}
+
+var listOrganizationsOperation = &Operation{
+	OperationId: "listOrganizations",
+	Summary:     "Lists all organizations, ordered by id.",
+	Parameters:  pageParameters,
+	Responses: map[string]*ResponseObject{
+		"200": successPage("The organizations, or a page of them if a limit is given.", ref("Organization")),
+		"400": failure("The limit or the cursor is invalid."),
+	},
+}
+
+func (s *Server) CreateOrganizationHandler(response http.ResponseWriter, request *http.Request) {
+	var createReq CreateOrganizationRequest
+	if err := s.decode(request, &createReq); err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	organization := domain.NewOrganization(uuid.New().String(), createReq.Name)
+	if err := s.repo.SaveOrganization(request.Context(), organization); err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusCreated, organization)
+}
+
+func (s *Server) ListOrganizationsHandler(response http.ResponseWriter, request *http.Request) {
+	page, err := parsePageRequest(request)
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	organizations, err := s.repo.ListOrganizations(request.Context())
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	organizations, next := paginate(organizations, page, func(organization *domain.Organization) string { return organization.Id })
+	WritePage(response, organizations, next)
+}
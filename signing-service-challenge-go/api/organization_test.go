@@ -0,0 +1,158 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+func createOrganization(t *testing.T, server *Server, name string) domain.Organization {
+	recorder := serve(server, "POST", "/admin/organizations", adminSecret, CreateOrganizationRequest{Name: name})
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, recorder.Code, recorder.Body)
+	}
+
+	var response struct {
+		Data domain.Organization `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Error unmarshaling response body: %v", err)
+	}
+	return response.Data
+}
+
+func issueTenantKey(t *testing.T, server *Server, tenantId string, scopes ...domain.Scope) CreateAPIKeyResponse {
+	recorder := serve(server, "POST", "/admin/keys", adminSecret, CreateAPIKeyRequest{TenantId: tenantId, Name: "test", Scopes: scopes})
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, recorder.Code, recorder.Body)
+	}
+
+	var response struct {
+		Data CreateAPIKeyResponse `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Error unmarshaling response body: %v", err)
+	}
+	return response.Data
+}
+
+func TestDevicesAreIsolatedByTenant(t *testing.T) {
+	server, _ := newAuthenticatedServer(t)
+	allScopes := []domain.Scope{domain.ScopeDevicesCreate, domain.ScopeDevicesRead, domain.ScopeSign, domain.ScopeAudit}
+
+	tenantA := issueTenantKey(t, server, createOrganization(t, server, "A").Id, allScopes...)
+	tenantB := issueTenantKey(t, server, createOrganization(t, server, "B").Id, allScopes...)
+
+	recorder := serve(server, "POST", "/devices", tenantA.Key, CreateSignatureDeviceRequest{Algorithm: "ECC"})
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d", http.StatusCreated, recorder.Code)
+	}
+	var created struct {
+		Data domain.SignatureDevice `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Error unmarshaling response body: %v", err)
+	}
+	if created.Data.TenantId != tenantA.TenantId {
+		t.Errorf("Expected tenant %s, got %s", tenantA.TenantId, created.Data.TenantId)
+	}
+
+	for _, path := range []string{"/devices/" + created.Data.Id, "/devices/" + created.Data.Id + "/transactions"} {
+		if recorder := serve(server, "GET", path, tenantB.Key, nil); recorder.Code != http.StatusNotFound {
+			t.Errorf("Expected status code %d for %s, got %d", http.StatusNotFound, path, recorder.Code)
+		}
+	}
+
+	recorder = serve(server, "POST", "/transactions/sign", tenantB.Key, SignTransactionRequest{DeviceId: created.Data.Id, Data: "data"})
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, recorder.Code)
+	}
+
+	recorder = serve(server, "GET", "/devices", tenantB.Key, nil)
+	var listed struct {
+		Data []domain.SignatureDevice `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &listed); err != nil {
+		t.Fatalf("Error unmarshaling response body: %v", err)
+	}
+	if len(listed.Data) != 0 {
+		t.Errorf("Expected no devices for other tenant, got %d", len(listed.Data))
+	}
+}
+
+func TestCreateAPIKeyForUnknownOrganization(t *testing.T) {
+	server, _ := newAuthenticatedServer(t)
+
+	recorder := serve(server, "POST", "/admin/keys", adminSecret, CreateAPIKeyRequest{TenantId: "unknown", Name: "test", Scopes: []domain.Scope{domain.ScopeSign}})
+
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, recorder.Code)
+	}
+}
+
+func TestTenantAdminManagesOwnTenantKeysOnly(t *testing.T) {
+	server, mockRepo := newAuthenticatedServer(t)
+	tenantA := createOrganization(t, server, "A").Id
+	tenantB := createOrganization(t, server, "B").Id
+	adminA := issueTenantKey(t, server, tenantA, domain.ScopeAdmin)
+	readerB := issueTenantKey(t, server, tenantB, domain.ScopeDevicesRead)
+
+	recorder := serve(server, "POST", "/admin/keys", adminA.Key, CreateAPIKeyRequest{TenantId: tenantB, Name: "test", Scopes: []domain.Scope{domain.ScopeSign}})
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, recorder.Code, recorder.Body)
+	}
+	var created struct {
+		Data CreateAPIKeyResponse `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Error unmarshaling response body: %v", err)
+	}
+	if created.Data.TenantId != tenantA {
+		t.Errorf("Expected tenant %s, got %s", tenantA, created.Data.TenantId)
+	}
+
+	recorder = serve(server, "GET", "/admin/keys", adminA.Key, nil)
+	var listed struct {
+		Data []domain.APIKey `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &listed); err != nil {
+		t.Fatalf("Error unmarshaling response body: %v", err)
+	}
+	for _, key := range listed.Data {
+		if key.TenantId != tenantA {
+			t.Errorf("Expected only keys of tenant %s, got one of %q", tenantA, key.TenantId)
+		}
+	}
+
+	recorder = serve(server, "DELETE", "/admin/keys/"+readerB.Id, adminA.Key, nil)
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, recorder.Code)
+	}
+	if mockRepo.APIKeys[readerB.Id].RevokedAt != nil {
+		t.Errorf("Expected the key of the other tenant to stay active")
+	}
+
+	for _, request := range []struct{ method, path string }{{"GET", "/admin/organizations"}, {"POST", "/admin/organizations"}} {
+		if recorder := serve(server, request.method, request.path, adminA.Key, CreateOrganizationRequest{Name: "C"}); recorder.Code != http.StatusForbidden {
+			t.Errorf("Expected status code %d for %s %s, got %d", http.StatusForbidden, request.method, request.path, recorder.Code)
+		}
+	}
+}
+
+func TestTenantKeysCannotBeGrantedThePlatformScope(t *testing.T) {
+	server, _ := newAuthenticatedServer(t)
+	tenantId := createOrganization(t, server, "A").Id
+	admin := issueKey(t, server, domain.ScopeAdmin)
+
+	recorder := serve(server, "POST", "/admin/keys", adminSecret, CreateAPIKeyRequest{TenantId: tenantId, Name: "test", Scopes: []domain.Scope{domain.ScopePlatform}})
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, recorder.Code)
+	}
+
+	recorder = serve(server, "POST", "/admin/keys", admin.Key, CreateAPIKeyRequest{Name: "test", Scopes: []domain.Scope{domain.ScopePlatform}})
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, recorder.Code)
+	}
+}
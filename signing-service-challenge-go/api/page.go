@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// maxPageLimit bounds the number of items of a page.
+const maxPageLimit = 1000
+
+var limitQueryParameter = Parameter{
+	Name:   "limit",
+	In:     "query",
+	Schema: &Schema{Type: "integer"},
+}
+
+var cursorQueryParameter = Parameter{
+	Name:   "cursor",
+	In:     "query",
+	Schema: &Schema{Type: "string"},
+}
+
+// pageParameters are the query parameters of the lists that are served in pages.
+var pageParameters = []Parameter{limitQueryParameter, cursorQueryParameter}
+
+// successPage describes a page of a list, the data of its Response carries the
+// items and next_cursor the cursor of the following page.
+func successPage(description string, items *Schema) *ResponseObject {
+	schema := envelope(&Schema{Type: "array", Items: items})
+	schema.Properties["next_cursor"] = &Schema{Type: "string"}
+	return &ResponseObject{Description: description, Content: jsonBody(schema)}
+}
+
+// pageRequest is the page a list request asks for. Without a limit, a list is
+// served in full.
+type pageRequest struct {
+	limit int
+	// after is the key of the last item of the previous page.
+	after string
+}
+
+// parsePageRequest reads the limit and cursor query parameters of a request.
+func parsePageRequest(request *http.Request) (pageRequest, error) {
+	query := request.URL.Query()
+	var page pageRequest
+	var errs []ValidationError
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			errs = append(errs, ValidationError{Field: "limit", Message: "must be an integer between 1 and " + strconv.Itoa(maxPageLimit)})
+		}
+		page.limit = limit
+	}
+	if value := query.Get("cursor"); value != "" {
+		after, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil || len(after) == 0 {
+			errs = append(errs, ValidationError{Field: "cursor", Message: "is not a cursor returned by this list"})
+		}
+		page.after = string(after)
+	}
+
+	if len(errs) > 0 {
+		return pageRequest{}, validationFailed(errs...)
+	}
+	return page, nil
+}
+
+// paginate returns the items of a list sorted by key that follow the cursor of page,
+// and the cursor of the next page if more items follow.
+func paginate[T any](items []T, page pageRequest, key func(T) string) ([]T, string) {
+	if page.after != "" {
+		items = items[sort.Search(len(items), func(i int) bool { return key(items[i]) > page.after }):]
+	}
+	if page.limit == 0 || len(items) <= page.limit {
+		return items, ""
+	}
+	items = items[:page.limit]
+	return items, base64.RawURLEncoding.EncodeToString([]byte(key(items[len(items)-1])))
+}
+
+// counterKey is the key of a counter, which sorts like the counter.
+func counterKey(counter int) string {
+	return fmt.Sprintf("%020d", counter)
+}
+
+// WritePage writes a page of a list as an HTTP response, with the cursor of the
+// next page if there is one.
+func WritePage(w http.ResponseWriter, data interface{}, next string) {
+	writeResponse(w, http.StatusOK, Response{Data: data, NextCursor: next})
+}
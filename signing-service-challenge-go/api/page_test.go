@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+func TestListTransactionsInPages(t *testing.T) {
+	server, deviceId := newPayloadServer(t)
+	for i := 0; i < 12; i++ {
+		signedData(t, serve(server, "POST", "/transactions/sign", "", SignTransactionRequest{DeviceId: deviceId, Data: "receipt"}))
+	}
+
+	var counters []int
+	path := "/devices/" + deviceId + "/transactions?limit=5"
+	for pages := 0; path != ""; pages++ {
+		if pages > 3 {
+			t.Fatalf("Expected 3 pages")
+		}
+		recorder := serve(server, "GET", path, "", nil)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body)
+		}
+		var response struct {
+			Data       []*domain.Transaction `json:"data"`
+			NextCursor string                `json:"next_cursor"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Error unmarshaling response body: %v", err)
+		}
+		for _, transaction := range response.Data {
+			counters = append(counters, transaction.Counter)
+		}
+		path = ""
+		if response.NextCursor != "" {
+			path = fmt.Sprintf("/devices/%s/transactions?limit=5&cursor=%s", deviceId, response.NextCursor)
+		}
+	}
+
+	if len(counters) != 12 {
+		t.Fatalf("Expected 12 transactions, got %d", len(counters))
+	}
+	for i, counter := range counters {
+		if counter != i {
+			t.Errorf("Expected counter %d at position %d, got %d", i, i, counter)
+		}
+	}
+}
+
+func TestListDevicesInPages(t *testing.T) {
+	server, _ := newPayloadServer(t)
+	for _, id := range []string{"a", "b"} {
+		device, _ := domain.NewSignatureDevice(id, "ECC", "")
+		server.repo.SaveSignatureDevice(context.Background(), device)
+	}
+
+	recorder := serve(server, "GET", "/devices?limit=2", "", nil)
+	var response struct {
+		Data       []*domain.SignatureDevice `json:"data"`
+		NextCursor string                    `json:"next_cursor"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	if len(response.Data) != 2 || response.Data[0].Id != "a" || response.NextCursor == "" {
+		t.Fatalf("Expected the first page of devices, got %s", recorder.Body)
+	}
+
+	recorder = serve(server, "GET", "/devices?limit=2&cursor="+response.NextCursor, "", nil)
+	response.NextCursor = ""
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	if len(response.Data) != 1 || response.Data[0].Id != "device" || response.NextCursor != "" {
+		t.Errorf("Expected the last page of devices, got %s", recorder.Body)
+	}
+}
+
+func TestListRejectsInvalidPages(t *testing.T) {
+	server, _ := newPayloadServer(t)
+
+	for _, query := range []string{"limit=0", "limit=1001", "limit=x", "cursor=!"} {
+		if recorder := serve(server, "GET", "/devices?"+query, "", nil); recorder.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %s, got %d", http.StatusBadRequest, query, recorder.Code)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+const octetStreamContentType = "application/octet-stream"
+
+// Encodings of the data of a SignTransactionRequest.
+const (
+	EncodingUTF8   = "utf-8"
+	EncodingBase64 = "base64"
+	EncodingHex    = "hex"
+)
+
+// DigestSHA256 marks the data of a SignTransactionRequest as a precomputed SHA-256 digest.
+const DigestSHA256 = "sha256"
+
+// mediaType returns the media type of the request body, application/json if unset.
+func mediaType(request *http.Request) string {
+	contentType := request.Header.Get("Content-Type")
+	if contentType == "" {
+		return "application/json"
+	}
+	media, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	return media
+}
+
+// signRequest reads the device and the payload of a sign request, either from a
+// SignTransactionRequest or from an application/octet-stream body whose device and
+// digest mode are passed as query parameters. The steps of a transaction, which
+// belongs to a device already, are read with withDevice false.
+func (s *Server) signRequest(request *http.Request, withDevice bool) (string, domain.Payload, error) {
+	if mediaType(request) == octetStreamContentType {
+		body, err := io.ReadAll(http.MaxBytesReader(nil, request.Body, s.maxBodySize))
+		if err != nil {
+			return "", domain.Payload{}, bodyError(err)
+		}
+
+		query := request.URL.Query()
+		var errs []ValidationError
+		if withDevice && query.Get("device_id") == "" {
+			errs = append(errs, ValidationError{Field: "device_id", Message: "is required"})
+		}
+		digest := query.Get("digest")
+		if digest != "" && digest != DigestSHA256 {
+			errs = append(errs, ValidationError{Field: "digest", Message: "must be one of " + DigestSHA256})
+		}
+		if len(body) == 0 {
+			errs = append(errs, ValidationError{Field: "data", Message: "must not be empty"})
+		} else if len(body) > MaxDataLength {
+			errs = append(errs, ValidationError{Field: "data", Message: fmt.Sprintf("must be at most %d bytes long", MaxDataLength)})
+		}
+		if len(errs) > 0 {
+			return "", domain.Payload{}, validationFailed(errs...)
+		}
+
+		payload, err := payloadOf(body, digest)
+		return query.Get("device_id"), payload, err
+	}
+
+	var signReq SignTransactionRequest
+	if err := s.decode(request, &signReq); err != nil {
+		return "", domain.Payload{}, err
+	}
+
+	var data []byte
+	var err error
+	switch signReq.Encoding {
+	case EncodingUTF8, "":
+		if signReq.Digest == "" {
+			return signReq.DeviceId, domain.TextPayload(signReq.Data), nil
+		}
+		return "", domain.Payload{}, validationFailed(ValidationError{Field: "encoding", Message: "must be base64 or hex for digests"})
+	case EncodingBase64:
+		data, err = base64.StdEncoding.DecodeString(signReq.Data)
+	case EncodingHex:
+		data, err = hex.DecodeString(signReq.Data)
+	}
+	if err != nil {
+		return "", domain.Payload{}, validationFailed(ValidationError{Field: "data", Message: "must be " + signReq.Encoding + " encoded"})
+	}
+
+	payload, err := payloadOf(data, signReq.Digest)
+	return signReq.DeviceId, payload, err
+}
+
+// payloadOf returns the Payload of binary data, which is a SHA-256 digest if digest is set.
+func payloadOf(data []byte, digest string) (domain.Payload, error) {
+	if digest == "" {
+		return domain.Payload{Encoding: domain.PayloadBinary, Data: data}, nil
+	}
+	if len(data) != sha256.Size {
+		return domain.Payload{}, validationFailed(ValidationError{Field: "data", Message: fmt.Sprintf("must be a SHA-256 digest of %d bytes", sha256.Size)})
+	}
+	return domain.Payload{Encoding: domain.PayloadSHA256, Data: data}, nil
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+func newPayloadServer(t *testing.T) (*Server, string) {
+	repo := persistence.NewInMemoryPersistence()
+	device, err := domain.NewSignatureDevice("device", "ECC", "Device")
+	if err != nil {
+		t.Fatal(err)
+	}
+	device.SecuredDataFormat = domain.SecuredDataV2
+	repo.SaveSignatureDevice(context.Background(), device)
+	return NewServer(":8080", repo), device.Id
+}
+
+func signedData(t *testing.T, recorder *httptest.ResponseRecorder) map[string]string {
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body)
+	}
+	var response struct {
+		Data map[string]string `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Error unmarshaling response body: %v", err)
+	}
+	return response.Data
+}
+
+func TestSignBinaryPayloads(t *testing.T) {
+	binary := []byte{0x00, 0xff, '_', 0x10}
+	digest := sha256.Sum256([]byte("receipt"))
+
+	tests := []struct {
+		request  SignTransactionRequest
+		encoding domain.PayloadEncoding
+		data     string
+	}{
+		{SignTransactionRequest{Data: base64.StdEncoding.EncodeToString(binary), Encoding: EncodingBase64}, domain.PayloadBinary, "AP9fEA=="},
+		{SignTransactionRequest{Data: hex.EncodeToString(binary), Encoding: EncodingHex}, domain.PayloadBinary, "AP9fEA=="},
+		{SignTransactionRequest{Data: hex.EncodeToString(digest[:]), Encoding: EncodingHex, Digest: DigestSHA256}, domain.PayloadSHA256, hex.EncodeToString(digest[:])},
+	}
+
+	for _, test := range tests {
+		server, deviceId := newPayloadServer(t)
+		test.request.DeviceId = deviceId
+
+		data := signedData(t, serve(server, "POST", "/transactions/sign", "", test.request))
+		if data["data_encoding"] != string(test.encoding) {
+			t.Errorf("Expected data encoding %s, got %s", test.encoding, data["data_encoding"])
+		}
+
+		var secured map[string]interface{}
+		if err := json.Unmarshal([]byte(data["signed_data"]), &secured); err != nil {
+			t.Fatalf("Error unmarshaling signed data: %v", err)
+		}
+		if secured["data"] != test.data || secured["encoding"] != string(test.encoding) {
+			t.Errorf("Expected data %s encoded as %s, got %s", test.data, test.encoding, data["signed_data"])
+		}
+	}
+}
+
+func TestSignOctetStream(t *testing.T) {
+	server, deviceId := newPayloadServer(t)
+
+	req := httptest.NewRequest("POST", apiPrefix+"/transactions/sign?device_id="+deviceId, bytes.NewReader([]byte{0x00, 0xff}))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	recorder := httptest.NewRecorder()
+	server.Handler().ServeHTTP(recorder, req)
+
+	data := signedData(t, recorder)
+	if data["data_encoding"] != string(domain.PayloadBinary) {
+		t.Errorf("Expected data encoding %s, got %s", domain.PayloadBinary, data["data_encoding"])
+	}
+}
+
+func TestSignRejectsInvalidPayloads(t *testing.T) {
+	server, deviceId := newPayloadServer(t)
+
+	tests := []struct {
+		request SignTransactionRequest
+		field   string
+	}{
+		{SignTransactionRequest{DeviceId: deviceId, Data: "not base64!", Encoding: EncodingBase64}, "data"},
+		{SignTransactionRequest{DeviceId: deviceId, Data: "abc", Encoding: EncodingHex}, "data"},
+		{SignTransactionRequest{DeviceId: deviceId, Data: "00ff", Encoding: EncodingHex, Digest: DigestSHA256}, "data"},
+		{SignTransactionRequest{DeviceId: deviceId, Data: "text", Digest: DigestSHA256}, "encoding"},
+	}
+
+	for _, test := range tests {
+		recorder := serve(server, "POST", "/transactions/sign", "", test.request)
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, recorder.Code)
+			continue
+		}
+
+		var problem Problem
+		json.Unmarshal(recorder.Body.Bytes(), &problem)
+		if len(problem.Errors) != 1 || problem.Errors[0].Field != test.field {
+			t.Errorf("Expected an error of field %s, got %v", test.field, problem.Errors)
+		}
+	}
+
+	req := httptest.NewRequest("POST", apiPrefix+"/transactions/sign", bytes.NewReader([]byte{0x00}))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	recorder := httptest.NewRecorder()
+	server.Handler().ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d without device id, got %d", http.StatusBadRequest, recorder.Code)
+	}
+}
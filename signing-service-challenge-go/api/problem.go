@@ -0,0 +1,231 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/devicelock"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+const (
+	problemContentType = "application/problem+json"
+	problemTypePrefix  = "urn:signing-service:problem:"
+)
+
+// Error codes are the stable, machine-readable identifiers of every problem the API reports.
+// Clients should match on them instead of on titles or details, which may change.
+const (
+	// CodeInvalidPayload means the request body is not well-formed JSON.
+	CodeInvalidPayload = "invalid_payload"
+	// CodePayloadTooLarge means the request body exceeds the size limit of the server.
+	CodePayloadTooLarge = "payload_too_large"
+	// CodeValidationFailed means the request is well-formed but some fields are invalid.
+	// The offending fields are listed in the errors member.
+	CodeValidationFailed = "validation_failed"
+	// CodeNotFound means no route matches the requested path.
+	CodeNotFound = "not_found"
+	// CodeMethodNotAllowed means the route does not support the requested method.
+	CodeMethodNotAllowed = "method_not_allowed"
+	// CodeRateLimited means a rate limit of the device, the API key or the tenant is
+	// exhausted. The Retry-After header tells when to retry.
+	CodeRateLimited = "rate_limited"
+	// CodeShuttingDown means the server is draining and admits no further signatures.
+	// The request can be retried with another instance.
+	CodeShuttingDown = "shutting_down"
+	// CodeIdempotencyKeyReused means the Idempotency-Key of the request was used for a
+	// request with another method, target or body.
+	CodeIdempotencyKeyReused = "idempotency_key_reused"
+	// CodeIdempotencyKeyInUse means a request with the same Idempotency-Key is still
+	// in progress. The request can be retried once it completed.
+	CodeIdempotencyKeyInUse = "idempotency_key_in_use"
+	// CodeInternal means the request failed for a reason the client cannot resolve.
+	CodeInternal = "internal_error"
+	// CodeUnauthenticated means the request carries no valid API key.
+	CodeUnauthenticated = "unauthenticated"
+	// CodeForbidden means the API key has not been granted the scope the route requires.
+	CodeForbidden = "forbidden"
+	// CodeDeviceNotFound is reported for domain.ErrDeviceNotFound.
+	CodeDeviceNotFound = "device_not_found"
+	// CodeUnsupportedAlgorithm is reported for domain.ErrUnsupportedAlgorithm.
+	CodeUnsupportedAlgorithm = "unsupported_algorithm"
+	// CodeUnsupportedSecuredDataFormat is reported for domain.ErrUnsupportedSecuredDataFormat.
+	CodeUnsupportedSecuredDataFormat = "unsupported_secured_data_format"
+	// CodeDeviceSuspended is reported for domain.ErrDeviceSuspended.
+	CodeDeviceSuspended = "device_suspended"
+	// CodeAmbiguousData is reported for domain.ErrAmbiguousData.
+	CodeAmbiguousData = "ambiguous_data"
+	// CodeInvalidDigest is reported for domain.ErrInvalidDigest.
+	CodeInvalidDigest = "invalid_digest"
+	// CodeDeviceRotated is reported for domain.ErrDeviceRotated.
+	CodeDeviceRotated = "device_rotated"
+	// CodeTransactionNotFound is reported for domain.ErrTransactionNotFound.
+	CodeTransactionNotFound = "transaction_not_found"
+	// CodeTransactionClosed is reported for domain.ErrTransactionClosed.
+	CodeTransactionClosed = "transaction_closed"
+	// CodeTransactionExpired is reported for domain.ErrTransactionExpired.
+	CodeTransactionExpired = "transaction_expired"
+	// CodeAPIKeyNotFound is reported for domain.ErrAPIKeyNotFound.
+	CodeAPIKeyNotFound = "api_key_not_found"
+	// CodeInvalidScope is reported for domain.ErrInvalidScope.
+	CodeInvalidScope = "invalid_scope"
+	// CodeOrganizationNotFound is reported for domain.ErrOrganizationNotFound.
+	CodeOrganizationNotFound = "organization_not_found"
+	// CodeWebhookNotFound is reported for domain.ErrWebhookNotFound.
+	CodeWebhookNotFound = "webhook_not_found"
+	// CodeInvalidWebhook is reported for domain.ErrInvalidWebhook.
+	CodeInvalidWebhook = "invalid_webhook"
+	// CodeInvalidEventType is reported for domain.ErrInvalidEventType.
+	CodeInvalidEventType = "invalid_event_type"
+	// CodeDeliveryNotFound is reported for domain.ErrDeliveryNotFound.
+	CodeDeliveryNotFound = "delivery_not_found"
+	// CodeDeviceLeaseLost is reported for devicelock.ErrLeaseLost and for
+	// persistence.ErrStaleFence. The signature was not stored and the request can
+	// be retried.
+	CodeDeviceLeaseLost = "device_lease_lost"
+)
+
+// Problem is an RFC 7807 problem details object extended by a stable error code
+// and field-level validation errors.
+type Problem struct {
+	Type     string            `json:"type"`
+	Code     string            `json:"code"`
+	Title    string            `json:"title"`
+	Status   int               `json:"status"`
+	Detail   string            `json:"detail,omitempty"`
+	Instance string            `json:"instance,omitempty"`
+	Errors   []ValidationError `json:"errors,omitempty"`
+}
+
+// NewProblem creates a Problem of the given code.
+func NewProblem(status int, code, title, detail string) *Problem {
+	return &Problem{
+		Type:   problemTypePrefix + code,
+		Code:   code,
+		Title:  title,
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// Error implements the error interface.
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
+
+// messages flattens the problem into the messages of the legacy ErrorResponse.
+func (p *Problem) messages() []string {
+	if len(p.Errors) == 0 {
+		return []string{p.Error()}
+	}
+
+	messages := make([]string, 0, len(p.Errors))
+	for _, e := range p.Errors {
+		messages = append(messages, e.String())
+	}
+	return messages
+}
+
+// sentinelProblems documents the problem every sentinel error of the domain,
+// persistence and devicelock packages is reported as.
+var sentinelProblems = []struct {
+	err    error
+	status int
+	code   string
+	title  string
+}{
+	{domain.ErrDeviceNotFound, http.StatusNotFound, CodeDeviceNotFound, "Signature device not found"},
+	{domain.ErrUnsupportedAlgorithm, http.StatusBadRequest, CodeUnsupportedAlgorithm, "Unsupported algorithm"},
+	{domain.ErrUnsupportedSecuredDataFormat, http.StatusBadRequest, CodeUnsupportedSecuredDataFormat, "Unsupported secured data format"},
+	{domain.ErrDeviceSuspended, http.StatusConflict, CodeDeviceSuspended, "Signature device suspended"},
+	{domain.ErrAmbiguousData, http.StatusBadRequest, CodeAmbiguousData, "Ambiguous data"},
+	{domain.ErrInvalidDigest, http.StatusBadRequest, CodeInvalidDigest, "Invalid digest"},
+	{domain.ErrDeviceRotated, http.StatusConflict, CodeDeviceRotated, "Signature device rotated"},
+	{domain.ErrTransactionNotFound, http.StatusNotFound, CodeTransactionNotFound, "Transaction not found"},
+	{domain.ErrTransactionClosed, http.StatusConflict, CodeTransactionClosed, "Transaction closed"},
+	{domain.ErrTransactionExpired, http.StatusConflict, CodeTransactionExpired, "Transaction expired"},
+	{domain.ErrAPIKeyNotFound, http.StatusNotFound, CodeAPIKeyNotFound, "API key not found"},
+	{domain.ErrInvalidScope, http.StatusBadRequest, CodeInvalidScope, "Invalid scope"},
+	{domain.ErrOrganizationNotFound, http.StatusNotFound, CodeOrganizationNotFound, "Organization not found"},
+	{domain.ErrWebhookNotFound, http.StatusNotFound, CodeWebhookNotFound, "Webhook not found"},
+	{domain.ErrInvalidWebhook, http.StatusBadRequest, CodeInvalidWebhook, "Invalid webhook"},
+	{domain.ErrInvalidEventType, http.StatusBadRequest, CodeInvalidEventType, "Invalid event type"},
+	{domain.ErrDeliveryNotFound, http.StatusNotFound, CodeDeliveryNotFound, "Webhook delivery not found"},
+	{devicelock.ErrLeaseLost, http.StatusServiceUnavailable, CodeDeviceLeaseLost, "Device lease lost"},
+	{persistence.ErrStaleFence, http.StatusServiceUnavailable, CodeDeviceLeaseLost, "Device lease lost"},
+}
+
+// ProblemFromError maps an error to the Problem that describes it to clients.
+// Errors without a documented code are reported as internal errors without details.
+func ProblemFromError(err error) *Problem {
+	var problem *Problem
+	if errors.As(err, &problem) {
+		return problem
+	}
+
+	for _, sentinel := range sentinelProblems {
+		if errors.Is(err, sentinel.err) {
+			return NewProblem(sentinel.status, sentinel.code, sentinel.title, err.Error())
+		}
+	}
+
+	return NewProblem(http.StatusInternalServerError, CodeInternal, http.StatusText(http.StatusInternalServerError), "")
+}
+
+func invalidPayload() *Problem {
+	return NewProblem(http.StatusBadRequest, CodeInvalidPayload, "Invalid request payload", "")
+}
+
+func payloadTooLarge(limit int64) *Problem {
+	return NewProblem(http.StatusRequestEntityTooLarge, CodePayloadTooLarge, "Payload too large", fmt.Sprintf("The request body exceeds %d bytes.", limit))
+}
+
+func methodNotAllowed() *Problem {
+	return NewProblem(http.StatusMethodNotAllowed, CodeMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed), "")
+}
+
+func unauthenticated() *Problem {
+	return NewProblem(http.StatusUnauthorized, CodeUnauthenticated, "Unauthenticated", "A valid API key is required.")
+}
+
+func forbidden(scope domain.Scope) *Problem {
+	return NewProblem(http.StatusForbidden, CodeForbidden, "Forbidden", fmt.Sprintf("The API key lacks the %s scope.", scope))
+}
+
+func validationFailed(errs ...ValidationError) *Problem {
+	problem := NewProblem(http.StatusBadRequest, CodeValidationFailed, "Validation failed", "One or more fields are invalid.")
+	problem.Errors = errs
+	return problem
+}
+
+// WriteProblem writes a Problem as an application/problem+json HTTP response.
+func WriteProblem(w http.ResponseWriter, problem *Problem) {
+	bytes, err := json.Marshal(problem)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(problem.Status)
+	w.Write(bytes)
+}
+
+// writeError reports an error to the client, either as problem details or, if the
+// Server runs with legacy errors, as an ErrorResponse.
+func (s *Server) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	problem := *ProblemFromError(err)
+	problem.Instance = r.URL.Path
+
+	if s.legacyErrors {
+		WriteErrorResponse(w, problem.Status, problem.messages())
+		return
+	}
+	WriteProblem(w, &problem)
+}
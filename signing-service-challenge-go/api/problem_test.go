@@ -0,0 +1,110 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+func TestSentinelErrorsHaveCodes(t *testing.T) {
+	sentinels := []error{
+		domain.ErrDeviceNotFound,
+		domain.ErrUnsupportedAlgorithm,
+		domain.ErrUnsupportedSecuredDataFormat,
+		domain.ErrDeviceSuspended,
+		domain.ErrAmbiguousData,
+		domain.ErrInvalidDigest,
+		domain.ErrDeviceRotated,
+		domain.ErrTransactionNotFound,
+		domain.ErrTransactionClosed,
+		domain.ErrTransactionExpired,
+		domain.ErrAPIKeyNotFound,
+		domain.ErrInvalidScope,
+		domain.ErrOrganizationNotFound,
+	}
+
+	for _, sentinel := range sentinels {
+		problem := ProblemFromError(fmt.Errorf("wrapped: %w", sentinel))
+		if problem.Code == CodeInternal {
+			t.Errorf("Sentinel error %q has no documented code", sentinel)
+		}
+		if problem.Type != problemTypePrefix+problem.Code {
+			t.Errorf("Expected type %s, got %s", problemTypePrefix+problem.Code, problem.Type)
+		}
+	}
+}
+
+func TestProblemFromUnknownErrorHidesDetails(t *testing.T) {
+	problem := ProblemFromError(fmt.Errorf("database password is wrong"))
+
+	if problem.Code != CodeInternal {
+		t.Errorf("Expected code %s, got %s", CodeInternal, problem.Code)
+	}
+	if problem.Detail != "" {
+		t.Errorf("Expected no detail, got %s", problem.Detail)
+	}
+}
+
+func TestGetUnknownDeviceReturnsProblem(t *testing.T) {
+	server := NewServer(":8080", persistence.NewMockRepository())
+
+	req, err := http.NewRequest("GET", apiPrefix+"/devices/unknown", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	server.Handler().ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, recorder.Code)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != problemContentType {
+		t.Errorf("Expected content type %s, got %s", problemContentType, contentType)
+	}
+
+	var problem Problem
+	if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("Error unmarshaling response body: %v", err)
+	}
+	if problem.Code != CodeDeviceNotFound {
+		t.Errorf("Expected code %s, got %s", CodeDeviceNotFound, problem.Code)
+	}
+	if problem.Status != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, problem.Status)
+	}
+	if problem.Instance != apiPrefix+"/devices/unknown" {
+		t.Errorf("Expected instance %s, got %s", apiPrefix+"/devices/unknown", problem.Instance)
+	}
+}
+
+func TestLegacyErrors(t *testing.T) {
+	server := NewServer(":8080", persistence.NewMockRepository(), WithLegacyErrors())
+
+	body, _ := json.Marshal(SignTransactionRequest{DeviceId: "unknown", Data: "data"})
+	req, err := http.NewRequest("POST", apiPrefix+"/transactions/sign", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	server.Handler().ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, recorder.Code)
+	}
+
+	var response ErrorResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Error unmarshaling response body: %v", err)
+	}
+	if len(response.Errors) != 1 || response.Errors[0] != domain.ErrDeviceNotFound.Error() {
+		t.Errorf("Expected errors [%s], got %v", domain.ErrDeviceNotFound, response.Errors)
+	}
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/ratelimit"
+)
+
+// Quota reports the state of a single rate limit bucket.
+type Quota struct {
+	Id        string   `json:"id"`
+	Unlimited bool     `json:"unlimited"`
+	Rate      float64  `json:"rate,omitempty"`
+	Burst     int      `json:"burst,omitempty"`
+	Remaining *float64 `json:"remaining,omitempty"`
+}
+
+// QuotasResponse reports the rate limit buckets a client is charged against.
+type QuotasResponse struct {
+	Tenant  Quota   `json:"tenant"`
+	APIKey  *Quota  `json:"api_key,omitempty"`
+	Devices []Quota `json:"devices"`
+}
+
+var quotasOperation = &Operation{
+	OperationId: "quotas",
+	Summary:     "Reports the remaining rate limit tokens of the tenant, the API key and every device of the tenant.",
+	Responses: map[string]*ResponseObject{
+		"200": success("The current quotas.", ref("QuotasResponse")),
+	},
+}
+
+// RateLimit is a middleware that charges every request against the buckets of its
+// tenant and API key and rejects it once either is exhausted.
+func (s *Server) RateLimit(next http.Handler) http.Handler {
+	if s.limiter == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		subjects := []ratelimit.Subject{s.limiter.Tenant(TenantId(request))}
+		if key, ok := APIKeyFromContext(request.Context()); ok {
+			subjects = append(subjects, s.limiter.APIKey(key.Id))
+		}
+
+		if !s.allow(response, request, subjects...) {
+			return
+		}
+		next.ServeHTTP(response, request)
+	})
+}
+
+// allow takes a token from every subject and writes a rate limited response if one of
+// them is exhausted. Requests are admitted if the limiter itself fails.
+func (s *Server) allow(response http.ResponseWriter, request *http.Request, subjects ...ratelimit.Subject) bool {
+	if s.limiter == nil {
+		return true
+	}
+
+	result, err := s.limiter.Allow(request.Context(), subjects...)
+	if err != nil {
+		s.logger.WarnContext(request.Context(), "Rate limiter failed, admitting request", slog.String("error", err.Error()))
+		return true
+	}
+	if result.Allowed {
+		return true
+	}
+
+	retryAfter := int(math.Ceil(result.RetryAfter.Seconds()))
+	response.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	s.writeError(response, request, rateLimited(result.RetryAfter))
+	return false
+}
+
+func (s *Server) QuotasHandler(response http.ResponseWriter, request *http.Request) {
+	if s.limiter == nil {
+		s.writeError(response, request, rateLimitingDisabled())
+		return
+	}
+
+	tenantId := TenantId(request)
+	quotas := QuotasResponse{Devices: []Quota{}}
+
+	var err error
+	if quotas.Tenant, err = s.quota(request, tenantId, s.limiter.Tenant(tenantId)); err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	if key, ok := APIKeyFromContext(request.Context()); ok {
+		quota, err := s.quota(request, key.Id, s.limiter.APIKey(key.Id))
+		if err != nil {
+			s.writeError(response, request, err)
+			return
+		}
+		quotas.APIKey = &quota
+	}
+
+	devices, err := s.repo.ListSignatureDevices(request.Context(), tenantId)
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+	for _, device := range devices {
+		quota, err := s.quota(request, device.Id, s.limiter.Device(tenantId, device.Id))
+		if err != nil {
+			s.writeError(response, request, err)
+			return
+		}
+		quotas.Devices = append(quotas.Devices, quota)
+	}
+
+	WriteAPIResponse(response, http.StatusOK, quotas)
+}
+
+func (s *Server) quota(request *http.Request, id string, subject ratelimit.Subject) (Quota, error) {
+	if subject.Limit.Unlimited() {
+		return Quota{Id: id, Unlimited: true}, nil
+	}
+
+	usage, err := s.limiter.Usage(request.Context(), subject)
+	if err != nil {
+		return Quota{}, err
+	}
+
+	return Quota{
+		Id:        id,
+		Rate:      subject.Limit.Rate,
+		Burst:     subject.Limit.Burst,
+		Remaining: &usage.Remaining,
+	}, nil
+}
+
+func rateLimited(retryAfter time.Duration) *Problem {
+	return NewProblem(http.StatusTooManyRequests, CodeRateLimited, "Rate limit exceeded",
+		"Retry after "+retryAfter.Round(time.Millisecond).String()+".")
+}
+
+func rateLimitingDisabled() *Problem {
+	return NewProblem(http.StatusNotFound, CodeNotFound, http.StatusText(http.StatusNotFound), "Rate limiting is disabled.")
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/ratelimit"
+)
+
+func TestSignTransactionIsRateLimitedPerDevice(t *testing.T) {
+	mockRepo := persistence.NewMockRepository()
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), ratelimit.Limits{
+		Device: ratelimit.Limit{Rate: 0.5, Burst: 1},
+	})
+	server := NewServer(":8080", mockRepo, WithRateLimiter(limiter))
+
+	device, err := domain.NewSignatureDevice("device", "ECC", "Device")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockRepo.Devices[device.Id] = device
+
+	recorder := serve(server, "POST", "/transactions/sign", "", SignTransactionRequest{DeviceId: device.Id, Data: "data"})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, recorder.Code)
+	}
+
+	recorder = serve(server, "POST", "/transactions/sign", "", SignTransactionRequest{DeviceId: device.Id, Data: "data"})
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status code %d, got %d", http.StatusTooManyRequests, recorder.Code)
+	}
+	if retryAfter := recorder.Header().Get("Retry-After"); retryAfter != "2" {
+		t.Errorf("Expected Retry-After %s, got %s", "2", retryAfter)
+	}
+	if device.SignatureCounter != 1 {
+		t.Errorf("Expected rejected request not to advance the counter")
+	}
+}
+
+func TestQuotasHandler(t *testing.T) {
+	mockRepo := persistence.NewMockRepository()
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), ratelimit.Limits{
+		Device: ratelimit.Limit{Rate: 1, Burst: 5},
+		Tenant: ratelimit.Limit{Rate: 1, Burst: 10},
+	})
+	server := NewServer(":8080", mockRepo, WithRateLimiter(limiter))
+	mockRepo.Devices["device"] = &domain.SignatureDevice{Id: "device", Algorithm: "ECC"}
+
+	recorder := serve(server, "GET", "/quotas", "", nil)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, recorder.Code)
+	}
+
+	var response struct {
+		Data QuotasResponse `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Error unmarshaling response body: %v", err)
+	}
+
+	if remaining := response.Data.Tenant.Remaining; remaining == nil || *remaining < 9 || *remaining >= 10 {
+		t.Errorf("Expected the quota request itself to be charged to the tenant")
+	}
+	if len(response.Data.Devices) != 1 || *response.Data.Devices[0].Remaining != 5 {
+		t.Errorf("Expected a full device bucket, got %v", response.Data.Devices)
+	}
+}
@@ -1,22 +1,36 @@
 package api
 
 import (
+	"crypto/tls"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"github.com/gorilla/mux"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
+	"sync"
+	"time"
 
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/audit"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/devicelock"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/health"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/metrics"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/ratelimit"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/tsa"
 )
 
 const (
 	apiVersion = "v0"
+	apiPrefix  = "/api/" + apiVersion
 )
 
 // Response is the generic API response container.
 type Response struct {
 	Data interface{} `json:"data"`
+	// NextCursor continues a list served in pages, it is empty on the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 // ErrorResponse is the generic error API response container.
@@ -26,45 +40,268 @@ type ErrorResponse struct {
 
 // Server manages HTTP requests and dispatches them to the appropriate services.
 type Server struct {
-	listenAddress string
-	repo          persistence.SignatureDeviceRepository
+	listenAddress      string
+	repo               persistence.Repository
+	legacyErrors       bool
+	authentication     bool
+	limiter            *ratelimit.Limiter
+	locker             devicelock.Locker
+	metrics            *metrics.Metrics
+	logger             *slog.Logger
+	auditLog           *audit.Log
+	keys               domain.KeyParameters
+	tlsConfig          *tls.Config
+	clientIdentities   map[string]ClientIdentity
+	maxBodySize        int64
+	timestamper        *tsa.Client
+	transactionTimeout time.Duration
+	drain              *drain
+	health             *health.Registry
+	idempotency        *idempotencyCache
+
+	mu         sync.Mutex
+	httpServer *http.Server
+}
+
+// Option configures optional behavior of a Server.
+type Option func(*Server)
+
+// WithLegacyErrors makes the Server report errors as ErrorResponse instead of
+// problem details, for clients that have not migrated to the error model of v0 yet.
+func WithLegacyErrors() Option {
+	return func(s *Server) {
+		s.legacyErrors = true
+	}
+}
+
+// WithAuthentication requires API keys with the appropriate scope on every route
+// except the health check and the OpenAPI document.
+func WithAuthentication() Option {
+	return func(s *Server) {
+		s.authentication = true
+	}
+}
+
+// WithRateLimiter limits the request rate of every device, API key and tenant.
+func WithRateLimiter(limiter *ratelimit.Limiter) Option {
+	return func(s *Server) {
+		s.limiter = limiter
+	}
+}
+
+// WithDeviceLocker holds the lease on a device from locker while it signs or
+// changes, for instances that share their repository with others. Such instances
+// hold their own copies of a device, whose signer locks do not exclude each other.
+func WithDeviceLocker(locker devicelock.Locker) Option {
+	return func(s *Server) {
+		s.locker = locker
+	}
+}
+
+// WithMetrics records request metrics and the timing of the operations of signature
+// devices, and serves all metrics on /metrics.
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(s *Server) {
+		s.metrics = m
+	}
+}
+
+// WithLogger writes access logs and operational messages to logger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// WithAuditLog records security-relevant events, such as issued signatures, in log.
+func WithAuditLog(log *audit.Log) Option {
+	return func(s *Server) {
+		s.auditLog = log
+	}
+}
+
+// WithKeyParameters generates the key pairs of new signature devices as described by keys.
+func WithKeyParameters(keys domain.KeyParameters) Option {
+	return func(s *Server) {
+		s.keys = keys
+	}
+}
+
+// WithTLS serves HTTPS, and HTTP/2 if config offers it, instead of plain HTTP.
+func WithTLS(config *tls.Config) Option {
+	return func(s *Server) {
+		s.tlsConfig = config
+	}
+}
+
+// WithClientCertificates authenticates clients presenting a verified certificate whose
+// subject common name is a key of identities. Client certificates are only requested
+// if the TLS configuration asks for them.
+func WithClientCertificates(identities map[string]ClientIdentity) Option {
+	return func(s *Server) {
+		s.clientIdentities = identities
+	}
+}
+
+// WithHealthChecks reports the checks of registry in the health and readiness endpoints.
+func WithHealthChecks(registry *health.Registry) Option {
+	return func(s *Server) {
+		s.health = registry
+	}
+}
+
+// WithMaxBodySize rejects request bodies larger than limit bytes.
+func WithMaxBodySize(limit int64) Option {
+	return func(s *Server) {
+		s.maxBodySize = limit
+	}
+}
+
+// WithTimestampAuthority attaches an RFC 3161 timestamp token from client to every
+// signature. Signatures are still issued if the timestamp authority fails.
+func WithTimestampAuthority(client *tsa.Client) Option {
+	return func(s *Server) {
+		s.timestamper = client
+	}
+}
+
+// WithTransactionTimeout expires transactions that are neither updated nor finished
+// within timeout.
+func WithTransactionTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.transactionTimeout = timeout
+	}
 }
 
 // NewServer is a factory to instantiate a new Server.
-func NewServer(listenAddress string, repo persistence.SignatureDeviceRepository) *Server {
-	return &Server{
-		listenAddress: listenAddress,
-		repo:          repo,
+func NewServer(listenAddress string, repo persistence.Repository, options ...Option) *Server {
+	server := &Server{
+		listenAddress:      listenAddress,
+		repo:               repo,
+		logger:             slog.New(slog.NewJSONHandler(io.Discard, nil)),
+		auditLog:           audit.Discard(),
+		keys:               domain.DefaultKeyParameters,
+		maxBodySize:        DefaultMaxBodySize,
+		transactionTimeout: domain.DefaultTransactionTimeout,
+		drain:              newDrain(),
+		health:             health.NewRegistry(),
+		idempotency:        newIdempotencyCache(maxIdempotentResponses),
+	}
+
+	for _, option := range options {
+		option(server)
 	}
+
+	return server
 }
 
-// Run registers all HandlerFuncs for the existing HTTP routes and starts the Server.
-func (s *Server) Run() error {
+// route binds a HandlerFunc to a method and path and describes it for the OpenAPI document.
+type route struct {
+	method    string
+	path      string
+	scope     domain.Scope
+	handler   http.HandlerFunc
+	operation *Operation
+}
+
+// routes lists every HTTP route exposed by the Server. Both the router and the
+// OpenAPI document are built from this table, so they cannot drift apart.
+func (s *Server) routes() []route {
+	return []route{
+		{http.MethodGet, "/health", "", s.Health, healthOperation},
+		{http.MethodGet, "/health/live", "", s.Live, liveOperation},
+		{http.MethodGet, "/health/ready", "", s.Ready, readyOperation},
+		{http.MethodGet, "/openapi.json", "", s.OpenAPIHandler, openAPIOperation},
+		{http.MethodPost, "/devices", domain.ScopeDevicesCreate, s.CreateSignatureDeviceHandler, createSignatureDeviceOperation},
+		{http.MethodPost, "/transactions/sign", domain.ScopeSign, s.SignTransactionHandler, signTransactionOperation},
+		{http.MethodPost, "/transactions", domain.ScopeSign, s.StartTransactionHandler, startTransactionOperation},
+		{http.MethodGet, "/transactions", domain.ScopeDevicesRead, s.ListFiscalTransactionsHandler, listFiscalTransactionsOperation},
+		{http.MethodGet, "/transactions/{transaction_id}", domain.ScopeDevicesRead, s.GetFiscalTransactionHandler, getFiscalTransactionOperation},
+		{http.MethodPost, "/transactions/{transaction_id}/update", domain.ScopeSign, s.UpdateTransactionHandler, updateTransactionOperation},
+		{http.MethodPost, "/transactions/{transaction_id}/finish", domain.ScopeSign, s.FinishTransactionHandler, finishTransactionOperation},
+		{http.MethodGet, "/devices/{device_id}", domain.ScopeDevicesRead, s.GetSignatureDeviceHandler, getSignatureDeviceOperation},
+		{http.MethodGet, "/devices", domain.ScopeDevicesRead, s.ListSignatureDevicesHandler, listSignatureDevicesOperation},
+		{http.MethodGet, "/quotas", domain.ScopeDevicesRead, s.QuotasHandler, quotasOperation},
+		{http.MethodGet, "/devices/{device_id}/transactions", domain.ScopeAudit, s.ListTransactionsHandler, listTransactionsOperation},
+		{http.MethodGet, "/devices/{device_id}/export", domain.ScopeAudit, s.ExportDeviceHandler, exportDeviceOperation},
+		{http.MethodGet, "/devices/{device_id}/verify", domain.ScopeAudit, s.VerifyDeviceHandler, verifyDeviceOperation},
+		{http.MethodGet, "/devices/{device_id}/public-key", domain.ScopeDevicesRead, s.GetPublicKeyHandler, getPublicKeyOperation},
+		{http.MethodPost, "/devices/{device_id}/suspend", domain.ScopeDevicesManage, s.SuspendSignatureDeviceHandler, suspendSignatureDeviceOperation},
+		{http.MethodPost, "/devices/{device_id}/rotate", domain.ScopeDevicesManage, s.RotateSignatureDeviceHandler, rotateSignatureDeviceOperation},
+		{http.MethodPost, "/admin/keys", domain.ScopeAdmin, s.CreateAPIKeyHandler, createAPIKeyOperation},
+		{http.MethodGet, "/admin/keys", domain.ScopeAdmin, s.ListAPIKeysHandler, listAPIKeysOperation},
+		{http.MethodDelete, "/admin/keys/{key_id}", domain.ScopeAdmin, s.RevokeAPIKeyHandler, revokeAPIKeyOperation},
+		{http.MethodPost, "/admin/organizations", domain.ScopePlatform, s.CreateOrganizationHandler, createOrganizationOperation},
+		{http.MethodGet, "/admin/organizations", domain.ScopePlatform, s.ListOrganizationsHandler, listOrganizationsOperation},
+		{http.MethodPost, "/webhooks", domain.ScopeWebhooks, s.CreateWebhookHandler, createWebhookOperation},
+		{http.MethodGet, "/webhooks", domain.ScopeWebhooks, s.ListWebhooksHandler, listWebhooksOperation},
+		{http.MethodGet, "/webhooks/{webhook_id}", domain.ScopeWebhooks, s.GetWebhookHandler, getWebhookOperation},
+		{http.MethodDelete, "/webhooks/{webhook_id}", domain.ScopeWebhooks, s.DeleteWebhookHandler, deleteWebhookOperation},
+		{http.MethodGet, "/webhooks/{webhook_id}/deliveries", domain.ScopeWebhooks, s.ListWebhookDeliveriesHandler, listWebhookDeliveriesOperation},
+		{http.MethodPost, "/webhooks/{webhook_id}/deliveries/{delivery_id}/retry", domain.ScopeWebhooks, s.RetryWebhookDeliveryHandler, retryWebhookDeliveryOperation},
+	}
+}
+
+// Handler registers all HandlerFuncs for the existing HTTP routes and returns the resulting router.
+func (s *Server) Handler() http.Handler {
 	router := mux.NewRouter()
+	spec := s.OpenAPI()
+
+	for _, r := range s.routes() {
+		var handler http.Handler = s.ValidateRequest(spec, r.operation, r.handler)
+		if r.method == http.MethodPost {
+			handler = s.Idempotent(handler)
+		}
+		if r.scope != "" {
+			handler = s.Authenticate(r.scope, s.RateLimit(handler))
+		}
+
+		router.
+			Handle(apiPrefix+r.path, s.Trace(apiPrefix+r.path, s.Log(apiPrefix+r.path, s.Instrument(apiPrefix+r.path, handler)))).
+			Methods(r.method)
+	}
 
-	router.
-		HandleFunc(fmt.Sprintf("/api/%s/health", apiVersion), s.Health).
-		Methods(http.MethodGet)
-	router.
-		HandleFunc(fmt.Sprintf("/api/%s/devices", apiVersion), s.CreateSignatureDeviceHandler).
-		Methods(http.MethodPost)
-	router.
-		HandleFunc(fmt.Sprintf("/api/%s/transactions/sign", apiVersion), s.SignTransactionHandler).
-		Methods(http.MethodPost)
-	router.
-		HandleFunc(fmt.Sprintf("/api/%s/devices/{device_id}", apiVersion), s.GetSignatureDeviceHandler).
-		Methods(http.MethodGet)
-	router.
-		HandleFunc(fmt.Sprintf("/api/%s/devices", apiVersion), s.ListSignatureDevicesHandler).
-		Methods(http.MethodGet)
+	if s.metrics != nil {
+		router.Handle("/metrics", s.metrics.Handler()).Methods(http.MethodGet)
+	}
+
+	router.NotFoundHandler = http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		s.writeError(response, request, NewProblem(http.StatusNotFound, CodeNotFound, http.StatusText(http.StatusNotFound), ""))
+	})
+	router.MethodNotAllowedHandler = http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		s.writeError(response, request, methodNotAllowed())
+	})
+
+	return router
+}
 
+// Run starts the Server with all existing HTTP routes. It blocks until the Server fails
+// or is shut down, in which case it returns nil.
+func (s *Server) Run() error {
 	server := &http.Server{
-		Addr:    s.listenAddress,
-		Handler: router,
+		Addr:      s.listenAddress,
+		Handler:   s.Handler(),
+		TLSConfig: s.tlsConfig,
+		ErrorLog:  slog.NewLogLogger(s.logger.Handler(), slog.LevelWarn),
+	}
+	s.mu.Lock()
+	s.httpServer = server
+	s.mu.Unlock()
+	if s.drain.Draining() {
+		return nil
 	}
 
-	log.Println("Server listening on", s.listenAddress)
-	return server.ListenAndServe()
+	s.logger.Info("Server listening", slog.String("address", s.listenAddress), slog.Bool("tls", s.tlsConfig != nil))
+	var err error
+	if s.tlsConfig != nil {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
 }
 
 // WriteInternalError writes a default internal error message as an HTTP response.
@@ -75,6 +312,9 @@ func WriteInternalError(w http.ResponseWriter) {
 
 // WriteErrorResponse takes an HTTP status code and a slice of errors
 // and writes those as an HTTP error response in a structured format.
+//
+// Deprecated: handlers report errors as problem details, see WriteProblem. The
+// ErrorResponse format is only served by servers created WithLegacyErrors.
 func WriteErrorResponse(w http.ResponseWriter, code int, errors []string) {
 	w.WriteHeader(code)
 
@@ -93,11 +333,11 @@ func WriteErrorResponse(w http.ResponseWriter, code int, errors []string) {
 // WriteAPIResponse takes an HTTP status code and a generic data struct
 // and writes those as an HTTP response in a structured format.
 func WriteAPIResponse(w http.ResponseWriter, code int, data interface{}) {
-	w.WriteHeader(code)
+	writeResponse(w, code, Response{Data: data})
+}
 
-	response := Response{
-		Data: data,
-	}
+func writeResponse(w http.ResponseWriter, code int, response Response) {
+	w.WriteHeader(code)
 
 	bytes, err := json.MarshalIndent(response, "", "  ")
 	if err != nil {
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+// drain tracks the signatures in flight so that shutting down does not abandon a
+// signature whose counter has already been advanced.
+type drain struct {
+	mu       sync.Mutex
+	draining bool
+	inflight int
+	idle     chan struct{}
+}
+
+func newDrain() *drain {
+	return &drain{idle: make(chan struct{})}
+}
+
+// enter registers a signature in flight. It reports false once draining has started.
+func (d *drain) enter() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.draining {
+		return false
+	}
+	d.inflight++
+	return true
+}
+
+// leave unregisters a signature registered by enter.
+func (d *drain) leave() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.inflight--
+	if d.draining && d.inflight == 0 {
+		close(d.idle)
+	}
+}
+
+// start stops admitting signatures and returns a channel that is closed once the
+// last signature in flight has left.
+func (d *drain) start() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.draining {
+		d.draining = true
+		if d.inflight == 0 {
+			close(d.idle)
+		}
+	}
+	return d.idle
+}
+
+// Draining reports whether the server is shutting down.
+func (d *drain) Draining() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.draining
+}
+
+func shuttingDown() *Problem {
+	return NewProblem(http.StatusServiceUnavailable, CodeShuttingDown, "Shutting down", "The server is shutting down, retry with another instance.")
+}
+
+// Shutdown gracefully shuts the Server down. It stops admitting signatures, reports
+// itself as not ready, closes the listener, waits for the requests and signatures in
+// flight and flushes the repository. If ctx expires first, Shutdown returns its error
+// and the remaining requests are abandoned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.logger.InfoContext(ctx, "Server draining")
+	idle := s.drain.start()
+
+	s.mu.Lock()
+	server := s.httpServer
+	s.mu.Unlock()
+
+	var err error
+	if server != nil {
+		err = server.Shutdown(ctx)
+	}
+	if err == nil {
+		select {
+		case <-idle:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+
+	err = errors.Join(err, persistence.Flush(ctx, s.repo))
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Server shut down before draining completed", slog.String("error", err.Error()))
+		return err
+	}
+	s.logger.InfoContext(ctx, "Server shut down")
+	return nil
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+// blockingRepository holds every transaction in SaveTransaction until it is released.
+type blockingRepository struct {
+	*persistence.MockRepository
+	saving  chan struct{}
+	release chan struct{}
+	flushed bool
+}
+
+func newBlockingRepository() *blockingRepository {
+	return &blockingRepository{
+		MockRepository: persistence.NewMockRepository(),
+		saving:         make(chan struct{}),
+		release:        make(chan struct{}),
+	}
+}
+
+func (r *blockingRepository) SaveTransaction(ctx context.Context, fence persistence.Fence, transaction *domain.Transaction, fiscal *domain.FiscalTransaction, events ...*domain.Event) error {
+	close(r.saving)
+	<-r.release
+	return r.MockRepository.SaveTransaction(ctx, fence, transaction, fiscal, events...)
+}
+
+func (r *blockingRepository) Flush(ctx context.Context) error {
+	r.flushed = true
+	return nil
+}
+
+func TestShutdownRejectsNewSignatures(t *testing.T) {
+	server := NewServer(":8080", persistence.NewMockRepository())
+
+	if recorder := serve(server, "GET", "/health/ready", "", nil); recorder.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, recorder.Code)
+	}
+
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if recorder := serve(server, "GET", "/health/ready", "", nil); recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d, got %d", http.StatusServiceUnavailable, recorder.Code)
+	}
+	if recorder := serve(server, "GET", "/health/live", "", nil); recorder.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, recorder.Code)
+	}
+
+	recorder := serve(server, "POST", "/transactions/sign", "", SignTransactionRequest{DeviceId: "device", Data: "data"})
+	var problem Problem
+	if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("Error unmarshaling response body: %v", err)
+	}
+	if problem.Code != CodeShuttingDown {
+		t.Errorf("Expected code %s, got %s", CodeShuttingDown, problem.Code)
+	}
+}
+
+func TestShutdownWaitsForSignaturesInFlight(t *testing.T) {
+	repo := newBlockingRepository()
+	server := NewServer(":8080", repo)
+
+	device, _ := domain.NewSignatureDevice("device", "ECC", "Device")
+	repo.SaveSignatureDevice(context.Background(), device)
+
+	signed := make(chan int)
+	go func() {
+		signed <- serve(server, "POST", "/transactions/sign", "", SignTransactionRequest{DeviceId: "device", Data: "data"}).Code
+	}()
+	<-repo.saving
+
+	shutdown := make(chan error)
+	go func() {
+		shutdown <- server.Shutdown(context.Background())
+	}()
+
+	select {
+	case <-shutdown:
+		t.Fatal("Expected shutdown to wait for the signature in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(repo.release)
+	if code := <-signed; code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, code)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if !repo.flushed {
+		t.Errorf("Expected the repository to be flushed")
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	repo := newBlockingRepository()
+	server := NewServer(":8080", repo)
+
+	device, _ := domain.NewSignatureDevice("device", "ECC", "Device")
+	repo.SaveSignatureDevice(context.Background(), device)
+
+	go serve(server, "POST", "/transactions/sign", "", SignTransactionRequest{DeviceId: "device", Data: "data"})
+	<-repo.saving
+	defer close(repo.release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := server.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
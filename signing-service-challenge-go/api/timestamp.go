@@ -0,0 +1,56 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+// timestamp returns a copy of transaction with a timestamp token over its
+// signature, which is stored with the transaction. The transaction is stored
+// already and the signature chain has advanced, so a failing timestamp authority
+// does not fail the transaction; it is kept and returned without a token instead.
+func (s *Server) timestamp(ctx context.Context, transaction *domain.Transaction) *domain.Transaction {
+	ctx, span := tracer.Start(ctx, "tsa.Timestamp")
+	defer span.End()
+
+	timestamped, err := s.requestTimestamp(ctx, transaction)
+	if err == nil {
+		err = s.repo.SaveTransactionTimestamp(ctx, timestamped)
+	}
+	if err == nil {
+		return timestamped
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, "timestamp not issued")
+	s.logger.WarnContext(ctx, "Transaction stored without timestamp",
+		slog.String("device_id", transaction.DeviceId),
+		slog.Int("counter", transaction.Counter),
+		slog.String("error", err.Error()),
+	)
+	return transaction
+}
+
+// requestTimestamp returns a copy of transaction with a timestamp token over its
+// signature from the timestamp authority. The transaction itself may be read
+// concurrently once it is stored, so it is left as it is.
+func (s *Server) requestTimestamp(ctx context.Context, transaction *domain.Transaction) (*domain.Transaction, error) {
+	signature, err := base64.StdEncoding.DecodeString(transaction.Signature)
+	if err != nil {
+		return nil, err
+	}
+	token, err := s.timestamper.Timestamp(ctx, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamped := *transaction
+	timestamped.TimestampToken = token.Raw
+	timestamped.TimestampedAt = &token.Time
+	return &timestamped, nil
+}
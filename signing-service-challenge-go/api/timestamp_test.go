@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/tsa"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/tsa/tsatest"
+)
+
+func TestSignTransactionAttachesTimestamp(t *testing.T) {
+	authority := tsatest.NewTSA(t)
+	server, deviceId := newPayloadServer(t)
+	WithTimestampAuthority(&tsa.Client{URL: authority.URL, Roots: authority.Roots})(server)
+
+	data := signedData(t, serve(server, "POST", "/transactions/sign", "", SignTransactionRequest{DeviceId: deviceId, Data: "data"}))
+
+	raw, err := base64.StdEncoding.DecodeString(data["timestamp_token"])
+	if err != nil {
+		t.Fatalf("Expected a base64 timestamp token, got %q", data["timestamp_token"])
+	}
+	token, err := tsa.Parse(raw, authority.Roots)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing the token: %v", err)
+	}
+	signature, _ := base64.StdEncoding.DecodeString(data["signature"])
+	if !token.Covers(signature) {
+		t.Errorf("Expected the token to cover the signature")
+	}
+	if data["signed_at"] == "" || data["timestamped_at"] == "" {
+		t.Errorf("Expected signing and timestamp times, got %v", data)
+	}
+}
+
+func TestSignTransactionWithoutTimestampAuthority(t *testing.T) {
+	authority := tsatest.NewTSA(t)
+	authority.Reject()
+	server, deviceId := newPayloadServer(t)
+	WithTimestampAuthority(&tsa.Client{URL: authority.URL})(server)
+
+	data := signedData(t, serve(server, "POST", "/transactions/sign", "", SignTransactionRequest{DeviceId: deviceId, Data: "data"}))
+
+	if _, ok := data["timestamp_token"]; ok {
+		t.Errorf("Expected no timestamp token from a rejecting authority")
+	}
+	if data["signature"] == "" {
+		t.Errorf("Expected the transaction to be signed anyway")
+	}
+}
+
+func TestTimestampIsRequestedOutsideTheDeviceLock(t *testing.T) {
+	authority := tsatest.NewTSA(t)
+	target, _ := url.Parse(authority.URL)
+	requested, proceed := make(chan struct{}, 2), make(chan struct{})
+	proxy := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		requested <- struct{}{}
+		<-proceed
+		httputil.NewSingleHostReverseProxy(target).ServeHTTP(response, request)
+	}))
+	defer proxy.Close()
+
+	server, deviceId := newPayloadServer(t)
+	WithTimestampAuthority(&tsa.Client{URL: proxy.URL, Roots: authority.Roots})(server)
+
+	// The second signature is signed while the first one waits for its timestamp.
+	recorders := make(chan *httptest.ResponseRecorder, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			recorders <- serve(server, "POST", "/transactions/sign", "", SignTransactionRequest{DeviceId: deviceId, Data: "data"})
+		}()
+		select {
+		case <-requested:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected signature %d to request a timestamp while the other one waits", i+1)
+		}
+	}
+	close(proceed)
+	for i := 0; i < 2; i++ {
+		if recorder := <-recorders; recorder.Code != http.StatusOK {
+			t.Errorf("Expected status code %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body)
+		}
+	}
+
+	transactions, _ := server.repo.ListTransactions(context.Background(), "", deviceId)
+	for _, transaction := range transactions {
+		if transaction.TimestampToken == nil || transaction.TimestampedAt == nil {
+			t.Errorf("Expected the timestamp to be stored with signature %d", transaction.Counter)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/certs"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/certs/certstest"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+// serveTLS serves server over TLS with client certificates of ca required and returns its base URL.
+func serveTLS(t *testing.T, server *Server, ca *certstest.CA) string {
+	dir := t.TempDir()
+	certPEM, keyPEM := ca.Issue(t, "localhost")
+	reloader, err := certs.NewReloader(certstest.WriteFile(t, dir, "cert.pem", certPEM), certstest.WriteFile(t, dir, "key.pem", keyPEM), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := certs.ServerConfig(reloader, certs.ClientAuthRequire, certstest.WriteFile(t, dir, "ca.pem", ca.PEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := &http.Server{Handler: server.Handler(), TLSConfig: config}
+	go httpServer.ServeTLS(listener, "", "")
+	t.Cleanup(func() { httpServer.Close() })
+
+	return "https://" + listener.Addr().String() + apiPrefix
+}
+
+// tlsClient returns a client presenting a certificate of ca for commonName.
+func tlsClient(t *testing.T, ca *certstest.CA, commonName string) *http.Client {
+	certPEM, keyPEM := ca.Issue(t, commonName)
+	certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Certificate)
+
+	return &http.Client{Transport: &http.Transport{
+		ForceAttemptHTTP2: true,
+		TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			Certificates: []tls.Certificate{certificate},
+			ServerName:   "localhost",
+		},
+	}}
+}
+
+func TestClientCertificatesAuthenticate(t *testing.T) {
+	ca := certstest.NewCA(t)
+	server := NewServer(":8080", persistence.NewMockRepository(),
+		WithAuthentication(),
+		WithClientCertificates(map[string]ClientIdentity{
+			"pos-1": {TenantId: "acme", Scopes: []domain.Scope{domain.ScopeDevicesCreate}},
+		}),
+	)
+	url := serveTLS(t, server, ca)
+	client := tlsClient(t, ca, "pos-1")
+
+	body, _ := json.Marshal(CreateSignatureDeviceRequest{Algorithm: "ECC", Label: "Device"})
+	response, err := client.Post(url+"/devices", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d", http.StatusCreated, response.StatusCode)
+	}
+	if response.ProtoMajor != 2 {
+		t.Errorf("Expected HTTP/2, got %s", response.Proto)
+	}
+	var created struct {
+		Data *domain.SignatureDevice `json:"data"`
+	}
+	json.NewDecoder(response.Body).Decode(&created)
+	if created.Data.TenantId != "acme" {
+		t.Errorf("Expected tenant %s, got %s", "acme", created.Data.TenantId)
+	}
+
+	response, err = client.Get(url + "/devices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, response.StatusCode)
+	}
+
+	response, err = tlsClient(t, ca, "intruder").Get(url + "/devices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, response.StatusCode)
+	}
+}
+
+func TestClientCertificatesOfOtherCAsAreRejected(t *testing.T) {
+	ca := certstest.NewCA(t)
+	server := NewServer(":8080", persistence.NewMockRepository(), WithAuthentication())
+	url := serveTLS(t, server, ca)
+
+	client := tlsClient(t, certstest.NewCA(t), "pos-1")
+	client.Transport.(*http.Transport).TLSClientConfig.RootCAs.AddCert(ca.Certificate)
+
+	if _, err := client.Get(url + "/health"); err == nil {
+		t.Errorf("Expected the handshake to fail")
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var errTrailingData = errors.New("trailing data after the JSON value")
+
+var tracer = otel.Tracer("github.com/fiskaly/coding-challenges/signing-service-challenge/api")
+
+// Trace is a middleware that runs every request of a route in a server span. The span
+// continues the trace of the client if the request carries W3C trace context headers.
+func (s *Server) Trace(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+		ctx, span := tracer.Start(ctx, request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", request.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", request.URL.Path),
+			),
+		)
+		defer span.End()
+
+		recorder := &statusRecorder{ResponseWriter: response, status: http.StatusOK}
+		next.ServeHTTP(recorder, request.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.response.status_code", recorder.status))
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.status))
+		}
+	})
+}
+
+// decode strictly decodes the JSON body of a request into v. Unknown fields, trailing
+// data and bodies beyond the size limit are rejected.
+func (s *Server) decode(request *http.Request, v interface{}) error {
+	_, span := tracer.Start(request.Context(), "json.Decode")
+	defer span.End()
+
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, request.Body, s.maxBodySize))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(v)
+	if err == nil {
+		if _, err = decoder.Token(); err == io.EOF {
+			err = nil
+		} else if err == nil {
+			err = errTrailingData
+		}
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "invalid request payload")
+		return bodyError(err)
+	}
+	return nil
+}
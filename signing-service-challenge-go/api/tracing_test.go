@@ -0,0 +1,73 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/tracing"
+)
+
+func TestSignTransactionIsTraced(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	server := NewServer(":8080", tracing.InstrumentRepository(persistence.NewMockRepository(), "mock"))
+
+	var created struct {
+		Data *domain.SignatureDevice `json:"data"`
+	}
+	response := serve(server, "POST", "/devices", "", CreateSignatureDeviceRequest{Algorithm: "ECC", Label: "Device"})
+	if err := json.Unmarshal(response.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Error unmarshaling response body: %v", err)
+	}
+
+	const traceId = "4bf92f3577b34da6a3ce929d0e0e4736"
+	body, _ := json.Marshal(SignTransactionRequest{DeviceId: created.Data.Id, Data: "data"})
+	req := httptest.NewRequest("POST", apiPrefix+"/transactions/sign", bytes.NewBuffer(body))
+	req.Header.Set("traceparent", "00-"+traceId+"-00f067aa0ba902b7-01")
+
+	response = httptest.NewRecorder()
+	server.Handler().ServeHTTP(response, req)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+
+	names := map[string]bool{}
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID().String() != traceId {
+			continue
+		}
+		names[span.Name()] = true
+	}
+
+	expected := []string{
+		"POST " + apiPrefix + "/transactions/sign",
+		"json.Decode",
+		"Repository.GetSignatureDevice",
+		"SignatureDevice.SignTransaction",
+		"SignatureDevice.lock",
+		"ECCSigner.Sign",
+		"Repository.SaveTransaction",
+	}
+	for _, name := range expected {
+		if !names[name] {
+			t.Errorf("Expected span %s in the trace of the client, got %v", name, names)
+		}
+	}
+}
@@ -0,0 +1,401 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/audit"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+// TransactionStepRequest is the payload of an update or the finish of a
+// transaction. It is read like a SignTransactionRequest without a device.
+type TransactionStepRequest struct {
+	Data     string `json:"data"`
+	Encoding string `json:"encoding,omitempty"`
+	Digest   string `json:"digest,omitempty"`
+}
+
+// TransactionStepResponse is the transaction after a step and the signature of the step.
+type TransactionStepResponse struct {
+	Transaction *domain.FiscalTransaction `json:"transaction"`
+	Signature   map[string]string         `json:"signature"`
+}
+
+var transactionIdParameter = Parameter{
+	Name:     "transaction_id",
+	In:       "path",
+	Required: true,
+	Schema:   &Schema{Type: "string"},
+}
+
+var stateQueryParameter = Parameter{
+	Name:   "state",
+	In:     "query",
+	Schema: ref("FiscalTransactionState"),
+}
+
+var startTransactionOperation = &Operation{
+	OperationId: "startTransaction",
+	Summary:     "Starts a transaction on a signature device, signing its start. Requires secured data format v2 or later.",
+	Parameters:  []Parameter{deviceIdQueryParameter, digestQueryParameter},
+	RequestBody: &RequestBody{Required: true, Content: map[string]MediaType{
+		"application/json":     {Schema: ref("SignTransactionRequest")},
+		octetStreamContentType: {Schema: &Schema{Type: "string", Format: "binary"}},
+	}},
+	Responses: map[string]*ResponseObject{
+		"201": success("The started transaction and the signature of its start.", ref("TransactionStepResponse")),
+		"400": failure("The request payload is invalid or the device signs secured data format v1."),
+		"404": failure("The signature device does not exist."),
+		"409": failure("The signature device is suspended."),
+		"429": failure("The rate limit of the device is exhausted."),
+		"500": failure("The transaction could not be started."),
+		"503": failure("The server is shutting down."),
+	},
+}
+
+var updateTransactionOperation = &Operation{
+	OperationId: "updateTransaction",
+	Summary:     "Signs an update of an open transaction, which restarts its timeout.",
+	Parameters:  []Parameter{transactionIdParameter, digestQueryParameter},
+	RequestBody: &RequestBody{Required: true, Content: map[string]MediaType{
+		"application/json":     {Schema: ref("TransactionStepRequest")},
+		octetStreamContentType: {Schema: &Schema{Type: "string", Format: "binary"}},
+	}},
+	Responses: map[string]*ResponseObject{
+		"200": success("The updated transaction and the signature of the update.", ref("TransactionStepResponse")),
+		"400": failure("The request payload is invalid."),
+		"404": failure("The transaction does not exist."),
+		"409": failure("The transaction is finished or expired, or the signature device is suspended."),
+		"429": failure("The rate limit of the device is exhausted."),
+		"500": failure("The update could not be signed."),
+		"503": failure("The server is shutting down."),
+	},
+}
+
+var finishTransactionOperation = &Operation{
+	OperationId: "finishTransaction",
+	Summary:     "Signs the finish of an open transaction, which accepts no further steps.",
+	Parameters:  []Parameter{transactionIdParameter, digestQueryParameter},
+	RequestBody: &RequestBody{Required: true, Content: map[string]MediaType{
+		"application/json":     {Schema: ref("TransactionStepRequest")},
+		octetStreamContentType: {Schema: &Schema{Type: "string", Format: "binary"}},
+	}},
+	Responses: map[string]*ResponseObject{
+		"200": success("The finished transaction and the signature of the finish.", ref("TransactionStepResponse")),
+		"400": failure("The request payload is invalid."),
+		"404": failure("The transaction does not exist."),
+		"409": failure("The transaction is finished or expired, or the signature device is suspended."),
+		"429": failure("The rate limit of the device is exhausted."),
+		"500": failure("The finish could not be signed."),
+		"503": failure("The server is shutting down."),
+	},
+}
+
+var getFiscalTransactionOperation = &Operation{
+	OperationId: "getFiscalTransaction",
+	Summary:     "Retrieves a single transaction.",
+	Parameters:  []Parameter{transactionIdParameter},
+	Responses: map[string]*ResponseObject{
+		"200": success("The transaction.", ref("FiscalTransaction")),
+		"404": failure("The transaction does not exist."),
+		"500": failure("The transaction could not be retrieved."),
+	},
+}
+
+var listFiscalTransactionsOperation = &Operation{
+	OperationId: "listFiscalTransactions",
+	Summary:     "Lists the transactions of the tenant, e.g. the unfinished ones with state OPEN or EXPIRED.",
+	Parameters:  []Parameter{stateQueryParameter, deviceIdQueryParameter},
+	Responses: map[string]*ResponseObject{
+		"200": success("The transactions ordered by start.", &Schema{Type: "array", Items: ref("FiscalTransaction")}),
+		"400": failure("The state is invalid."),
+		"404": failure("The signature device does not exist."),
+		"500": failure("The transactions could not be listed."),
+	},
+}
+
+func (s *Server) StartTransactionHandler(response http.ResponseWriter, request *http.Request) {
+	if !s.drain.enter() {
+		s.writeError(response, request, shuttingDown())
+		return
+	}
+	defer s.drain.leave()
+
+	deviceId, payload, err := s.signRequest(request, true)
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	logDevice(request, deviceId)
+	device, err := s.repo.GetSignatureDevice(request.Context(), TenantId(request), deviceId)
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	if s.limiter != nil && !s.allow(response, request, s.limiter.Device(device.TenantId, device.Id)) {
+		return
+	}
+	device, lease, err := s.lockDevice(request.Context(), device)
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+	release := s.releaser(lease)
+	defer release()
+
+	stored, err := s.storedSignature(request, device.TenantId)
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+	if stored != nil {
+		s.replayStep(response, request, http.StatusCreated, stored)
+		return
+	}
+
+	// As with SignTransactionHandler, a signed step must be stored even if the
+	// client hangs up.
+	ctx := context.WithoutCancel(request.Context())
+
+	fiscal, transaction, err := device.StartTransaction(ctx, uuid.New().String(), payload, s.transactionTimeout, s.commit(ctx, request, lease, device))
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+	release()
+	transaction = s.signed(ctx, request, device, transaction)
+
+	WriteAPIResponse(response, http.StatusCreated, TransactionStepResponse{Transaction: fiscal, Signature: signatureResponse(transaction)})
+}
+
+func (s *Server) UpdateTransactionHandler(response http.ResponseWriter, request *http.Request) {
+	s.stepTransaction(response, request, domain.OperationUpdate)
+}
+
+func (s *Server) FinishTransactionHandler(response http.ResponseWriter, request *http.Request) {
+	s.stepTransaction(response, request, domain.OperationFinish)
+}
+
+// stepTransaction signs the update or the finish of the transaction of the request.
+func (s *Server) stepTransaction(response http.ResponseWriter, request *http.Request, operation domain.Operation) {
+	if !s.drain.enter() {
+		s.writeError(response, request, shuttingDown())
+		return
+	}
+	defer s.drain.leave()
+
+	_, payload, err := s.signRequest(request, false)
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	fiscal, err := s.repo.GetFiscalTransaction(request.Context(), TenantId(request), mux.Vars(request)["transaction_id"])
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	logDevice(request, fiscal.DeviceId)
+	device, err := s.repo.GetSignatureDevice(request.Context(), fiscal.TenantId, fiscal.DeviceId)
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	if s.limiter != nil && !s.allow(response, request, s.limiter.Device(device.TenantId, device.Id)) {
+		return
+	}
+	device, lease, err := s.lockDevice(request.Context(), device)
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+	release := s.releaser(lease)
+	defer release()
+
+	stored, err := s.storedSignature(request, fiscal.TenantId)
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+	if stored != nil {
+		s.replayStep(response, request, http.StatusOK, stored)
+		return
+	}
+
+	ctx := context.WithoutCancel(request.Context())
+
+	if _, err := s.expire(ctx, fence(lease), fiscal, time.Now()); err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	// The transaction is loaded again under the locks of the device, another
+	// request or instance may have signed a step meanwhile.
+	load := func() (*domain.FiscalTransaction, error) {
+		return s.repo.GetFiscalTransaction(ctx, fiscal.TenantId, fiscal.Id)
+	}
+	var transaction *domain.Transaction
+	if operation == domain.OperationFinish {
+		fiscal, transaction, err = device.FinishTransaction(ctx, load, payload, s.commit(ctx, request, lease, device))
+	} else {
+		fiscal, transaction, err = device.UpdateTransaction(ctx, load, payload, s.transactionTimeout, s.commit(ctx, request, lease, device))
+	}
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+	release()
+	transaction = s.signed(ctx, request, device, transaction)
+
+	WriteAPIResponse(response, http.StatusOK, TransactionStepResponse{Transaction: fiscal, Signature: signatureResponse(transaction)})
+}
+
+// replayStep answers the repetition of a step with the signature stored for it
+// and the transaction as it is now.
+func (s *Server) replayStep(response http.ResponseWriter, request *http.Request, status int, stored *domain.Transaction) {
+	fiscal, err := s.repo.GetFiscalTransaction(request.Context(), stored.TenantId, stored.TransactionId)
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+	response.Header().Set(idempotentReplayedHeader, "true")
+	WriteAPIResponse(response, status, TransactionStepResponse{Transaction: fiscal.At(time.Now()), Signature: signatureResponse(stored)})
+}
+
+func (s *Server) GetFiscalTransactionHandler(response http.ResponseWriter, request *http.Request) {
+	fiscal, err := s.repo.GetFiscalTransaction(request.Context(), TenantId(request), mux.Vars(request)["transaction_id"])
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	// Reads leave storing the expiry to the holder of the device lease, an overdue
+	// transaction is reported as expired meanwhile.
+	WriteAPIResponse(response, http.StatusOK, fiscal.At(time.Now()))
+}
+
+func (s *Server) ListFiscalTransactionsHandler(response http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	state := domain.FiscalTransactionState(query.Get("state"))
+	if state != "" && !contains(fiscalTransactionStateEnum(), string(state)) {
+		s.writeError(response, request, validationFailed(ValidationError{Field: "state", Message: "must be one of " + strings.Join(fiscalTransactionStateEnum(), ", ")}))
+		return
+	}
+
+	deviceId := query.Get("device_id")
+	if deviceId != "" {
+		if _, err := s.repo.GetSignatureDevice(request.Context(), TenantId(request), deviceId); err != nil {
+			s.writeError(response, request, err)
+			return
+		}
+	}
+
+	// The state is filtered as of now, so that overdue transactions are reported
+	// as expired before they are stored as such.
+	transactions, err := s.repo.ListFiscalTransactions(request.Context(), TenantId(request), "")
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+	now := time.Now()
+	listed := make([]*domain.FiscalTransaction, 0, len(transactions))
+	for _, fiscal := range transactions {
+		fiscal = fiscal.At(now)
+		if (state == "" || fiscal.State == state) && (deviceId == "" || fiscal.DeviceId == deviceId) {
+			listed = append(listed, fiscal)
+		}
+	}
+
+	WriteAPIResponse(response, http.StatusOK, listed)
+}
+
+// ExpireTransactions expires every open transaction whose timeout has passed and
+// returns how many expired. Transactions are also expired when a step finds them
+// overdue and reads report them as expired meanwhile, so this only needs to run
+// periodically to report abandoned ones in time.
+func (s *Server) ExpireTransactions(ctx context.Context) (int, error) {
+	ctx = s.instrumented(ctx)
+	now := time.Now()
+	overdue, err := s.repo.ListOverdueFiscalTransactions(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+
+	var expired int
+	var errs []error
+	for _, fiscal := range overdue {
+		ok, err := s.expireOverdue(ctx, fiscal, now)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if ok {
+			expired++
+		}
+	}
+	return expired, errors.Join(errs...)
+}
+
+// expireOverdue expires fiscal, found overdue without holding the lease of its
+// device, under that lease.
+func (s *Server) expireOverdue(ctx context.Context, fiscal *domain.FiscalTransaction, now time.Time) (bool, error) {
+	if s.locker == nil {
+		return s.expire(ctx, persistence.NoFence, fiscal, now)
+	}
+
+	lease, err := s.locker.Lock(ctx, fiscal.DeviceId)
+	if err != nil {
+		return false, err
+	}
+	defer s.release(lease)
+	return s.expire(ctx, fence(lease), fiscal, now)
+}
+
+// expire marks fiscal as expired if its timeout has passed at now, stores it and
+// records it in the audit log. It reports whether the transaction expired. The
+// transaction is loaded again under the chain lock of its device, and the write
+// is fenced by the lease of the device the caller holds, if any.
+func (s *Server) expire(ctx context.Context, fence persistence.Fence, fiscal *domain.FiscalTransaction, now time.Time) (bool, error) {
+	if fiscal.State != domain.FiscalTransactionOpen || now.Before(fiscal.ExpiresAt) {
+		return false, nil
+	}
+
+	device, err := s.repo.GetSignatureDevice(ctx, fiscal.TenantId, fiscal.DeviceId)
+	if err != nil {
+		return false, err
+	}
+	load := func() (*domain.FiscalTransaction, error) {
+		return s.repo.GetFiscalTransaction(ctx, fiscal.TenantId, fiscal.Id)
+	}
+	save := func(expired *domain.FiscalTransaction) error {
+		return s.repo.SaveFiscalTransaction(ctx, fence, expired)
+	}
+	if expired, err := device.ExpireTransaction(load, now, save); !expired || err != nil {
+		return false, err
+	}
+
+	s.logger.WarnContext(ctx, "Transaction expired before it was finished",
+		slog.String("transaction_id", fiscal.Id), slog.String("device_id", fiscal.DeviceId), slog.String("tenant_id", fiscal.TenantId))
+	s.auditLog.Record(ctx, audit.Entry{
+		Event:         audit.EventTransactionExpired,
+		RequestId:     RequestId(ctx),
+		TenantId:      fiscal.TenantId,
+		DeviceId:      device.Id,
+		Algorithm:     device.Algorithm,
+		TransactionId: fiscal.Id,
+	})
+	return true, nil
+}
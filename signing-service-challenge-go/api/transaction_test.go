@@ -0,0 +1,202 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/audit"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+func stepResponse(t *testing.T, recorder *httptest.ResponseRecorder, code int) TransactionStepResponse {
+	if recorder.Code != code {
+		t.Fatalf("Expected status code %d, got %d: %s", code, recorder.Code, recorder.Body)
+	}
+	var response struct {
+		Data TransactionStepResponse `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Error unmarshaling response body: %v", err)
+	}
+	return response.Data
+}
+
+func listFiscalTransactions(t *testing.T, server *Server, query string) []*domain.FiscalTransaction {
+	recorder := serve(server, "GET", "/transactions"+query, "", nil)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body)
+	}
+	var response struct {
+		Data []*domain.FiscalTransaction `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Error unmarshaling response body: %v", err)
+	}
+	return response.Data
+}
+
+func TestTransactionLifecycle(t *testing.T) {
+	server, deviceId := newPayloadServer(t)
+
+	started := stepResponse(t, serve(server, "POST", "/transactions", "", SignTransactionRequest{DeviceId: deviceId, Data: "start"}), http.StatusCreated)
+	if started.Transaction.State != domain.FiscalTransactionOpen || started.Transaction.Number != 1 {
+		t.Errorf("Expected open transaction 1, got %+v", started.Transaction)
+	}
+	path := "/transactions/" + started.Transaction.Id
+
+	stepResponse(t, serve(server, "POST", path+"/update", "", TransactionStepRequest{Data: "update"}), http.StatusOK)
+	finished := stepResponse(t, serve(server, "POST", path+"/finish", "", TransactionStepRequest{Data: "00ff", Encoding: EncodingHex}), http.StatusOK)
+
+	if finished.Transaction.State != domain.FiscalTransactionFinished {
+		t.Errorf("Expected a finished transaction, got %s", finished.Transaction.State)
+	}
+	if len(finished.Transaction.SignatureCounters) != 3 {
+		t.Errorf("Expected three signatures, got %v", finished.Transaction.SignatureCounters)
+	}
+	if !strings.Contains(finished.Signature["signed_data"], `"operation":"finish"`) {
+		t.Errorf("Expected the finish in the secured data, got %s", finished.Signature["signed_data"])
+	}
+
+	recorder := serve(server, "POST", path+"/update", "", TransactionStepRequest{Data: "late"})
+	if recorder.Code != http.StatusConflict || !strings.Contains(recorder.Body.String(), CodeTransactionClosed) {
+		t.Errorf("Expected %s, got %d: %s", CodeTransactionClosed, recorder.Code, recorder.Body)
+	}
+
+	var signatures struct {
+		Data []domain.Transaction `json:"data"`
+	}
+	json.Unmarshal(serve(server, "GET", "/devices/"+deviceId+"/transactions", "", nil).Body.Bytes(), &signatures)
+	operations := []domain.Operation{domain.OperationStart, domain.OperationUpdate, domain.OperationFinish}
+	if len(signatures.Data) != len(operations) {
+		t.Fatalf("Expected %d signatures of the device, got %d", len(operations), len(signatures.Data))
+	}
+	for i, signature := range signatures.Data {
+		if signature.Operation != operations[i] || signature.TransactionId != started.Transaction.Id {
+			t.Errorf("Expected signature %d to be the %s of the transaction, got %+v", i, operations[i], signature)
+		}
+	}
+}
+
+func TestTransactionStepOctetStream(t *testing.T) {
+	server, deviceId := newPayloadServer(t)
+	started := stepResponse(t, serve(server, "POST", "/transactions", "", SignTransactionRequest{DeviceId: deviceId, Data: "start"}), http.StatusCreated)
+
+	request := httptest.NewRequest("POST", apiPrefix+"/transactions/"+started.Transaction.Id+"/update", bytes.NewReader([]byte{0x00, 0xff}))
+	request.Header.Set("Content-Type", octetStreamContentType)
+	recorder := httptest.NewRecorder()
+	server.Handler().ServeHTTP(recorder, request)
+
+	updated := stepResponse(t, recorder, http.StatusOK)
+	if updated.Signature["data_encoding"] != string(domain.PayloadBinary) {
+		t.Errorf("Expected a binary update, got %v", updated.Signature)
+	}
+}
+
+func TestTransactionRequiresSecuredDataV2(t *testing.T) {
+	server, deviceId := newPayloadServer(t)
+	device, _ := server.repo.GetSignatureDevice(context.Background(), "", deviceId)
+	device.SecuredDataFormat = domain.SecuredDataV1
+
+	recorder := serve(server, "POST", "/transactions", "", SignTransactionRequest{DeviceId: deviceId, Data: "start"})
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), CodeUnsupportedSecuredDataFormat) {
+		t.Errorf("Expected %s, got %d: %s", CodeUnsupportedSecuredDataFormat, recorder.Code, recorder.Body)
+	}
+}
+
+func TestTransactionExpires(t *testing.T) {
+	server, deviceId := newPayloadServer(t)
+	WithTransactionTimeout(time.Nanosecond)(server)
+
+	started := stepResponse(t, serve(server, "POST", "/transactions", "", SignTransactionRequest{DeviceId: deviceId, Data: "start"}), http.StatusCreated)
+
+	if open := listFiscalTransactions(t, server, "?state=OPEN"); len(open) != 0 {
+		t.Errorf("Expected no open transactions, got %d", len(open))
+	}
+	expired := listFiscalTransactions(t, server, "?state=EXPIRED&device_id="+deviceId)
+	if len(expired) != 1 || expired[0].Id != started.Transaction.Id {
+		t.Errorf("Expected the expired transaction, got %v", expired)
+	}
+
+	stored, _ := server.repo.GetFiscalTransaction(context.Background(), "", started.Transaction.Id)
+	if stored.State != domain.FiscalTransactionOpen {
+		t.Errorf("Expected reads not to store the expiry, got %s", stored.State)
+	}
+
+	recorder := serve(server, "POST", "/transactions/"+started.Transaction.Id+"/finish", "", TransactionStepRequest{Data: "finish"})
+	if recorder.Code != http.StatusConflict || !strings.Contains(recorder.Body.String(), CodeTransactionExpired) {
+		t.Errorf("Expected %s, got %d: %s", CodeTransactionExpired, recorder.Code, recorder.Body)
+	}
+	if stored, _ := server.repo.GetFiscalTransaction(context.Background(), "", started.Transaction.Id); stored.State != domain.FiscalTransactionExpired {
+		t.Errorf("Expected the step to store the expiry, got %s", stored.State)
+	}
+}
+
+func TestTransactionReadsDuringSteps(t *testing.T) {
+	server, _ := newPayloadServer(t)
+	started := stepResponse(t, serve(server, "POST", "/transactions", "", SignTransactionRequest{DeviceId: "device", Data: "start"}), http.StatusCreated)
+	path := "/transactions/" + started.Transaction.Id
+
+	const updates = 20
+	var wg sync.WaitGroup
+	for i := 0; i < updates; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if recorder := serve(server, "POST", path+"/update", "", TransactionStepRequest{Data: "update"}); recorder.Code != http.StatusOK {
+				t.Errorf("Expected status code %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			serve(server, "GET", path, "", nil)
+			listFiscalTransactions(t, server, "")
+		}()
+	}
+	wg.Wait()
+
+	fiscal, _ := server.repo.GetFiscalTransaction(context.Background(), "", started.Transaction.Id)
+	if len(fiscal.SignatureCounters) != updates+1 {
+		t.Errorf("Expected %d signatures of the transaction, got %v", updates+1, fiscal.SignatureCounters)
+	}
+}
+
+func TestExpireTransactions(t *testing.T) {
+	var log bytes.Buffer
+	server, deviceId := newPayloadServer(t)
+	WithTransactionTimeout(time.Nanosecond)(server)
+	WithAuditLog(audit.New(&log))(server)
+
+	started := stepResponse(t, serve(server, "POST", "/transactions", "", SignTransactionRequest{DeviceId: deviceId, Data: "start"}), http.StatusCreated)
+
+	expired, err := server.ExpireTransactions(context.Background())
+	if err != nil || expired != 1 {
+		t.Errorf("Expected one expired transaction, got %d: %v", expired, err)
+	}
+	if expired, _ := server.ExpireTransactions(context.Background()); expired != 0 {
+		t.Errorf("Expected transactions to expire once, got %d", expired)
+	}
+
+	fiscal, _ := server.repo.GetFiscalTransaction(context.Background(), "", started.Transaction.Id)
+	if fiscal.State != domain.FiscalTransactionExpired {
+		t.Errorf("Expected an expired transaction, got %s", fiscal.State)
+	}
+	if !strings.Contains(log.String(), string(audit.EventTransactionExpired)) {
+		t.Errorf("Expected the expiry in the audit log, got %s", log.String())
+	}
+}
+
+func TestListFiscalTransactionsRejectsUnknownState(t *testing.T) {
+	server, _ := newPayloadServer(t)
+
+	recorder := serve(server, "GET", "/transactions?state=PENDING", "", nil)
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), CodeValidationFailed) {
+		t.Errorf("Expected %s, got %d: %s", CodeValidationFailed, recorder.Code, recorder.Body)
+	}
+}
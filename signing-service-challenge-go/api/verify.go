@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/verify"
+)
+
+var verifyDeviceOperation = &Operation{
+	OperationId: "verifyDevice",
+	Summary:     "Verifies every signature and chain link of the signature log of a signature device, as cmd/verify does for exports.",
+	Parameters:  []Parameter{deviceIdParameter},
+	Responses: map[string]*ResponseObject{
+		"200": success("The verification report. valid is false if any check failed.", ref("VerificationReport")),
+		"404": failure("The signature device does not exist."),
+		"500": failure("The signature log could not be read."),
+	},
+}
+
+func (s *Server) VerifyDeviceHandler(response http.ResponseWriter, request *http.Request) {
+	device, err := s.repo.GetSignatureDevice(request.Context(), TenantId(request), mux.Vars(request)["device_id"])
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+	logDevice(request, device.Id)
+
+	publicKey, err := device.PublicKey()
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+	key, err := verify.ParsePublicKey(publicKey)
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	verifier := verify.NewVerifier(device.Id, key)
+	err = s.repo.WalkTransactions(request.Context(), device.TenantId, device.Id, func(transaction *domain.Transaction) error {
+		verifier.Add(transaction)
+		return nil
+	})
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, verifier.Report())
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/verify"
+)
+
+func verificationReport(t *testing.T, server *Server, deviceId string) verify.Report {
+	recorder := serve(server, "GET", "/devices/"+deviceId+"/verify", "", nil)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body)
+	}
+	var response struct {
+		Data verify.Report `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Error unmarshaling response body: %v", err)
+	}
+	return response.Data
+}
+
+func TestVerifyDeviceHandler(t *testing.T) {
+	server, deviceId := newPayloadServer(t)
+	for _, data := range []string{"first", "second", "third"} {
+		signedData(t, serve(server, "POST", "/transactions/sign", "", SignTransactionRequest{DeviceId: deviceId, Data: data}))
+	}
+
+	report := verificationReport(t, server, deviceId)
+	if !report.Valid || report.Transactions != 3 || report.LastCounter != 2 {
+		t.Errorf("Expected a valid log of three transactions, got %+v", report)
+	}
+
+	transactions, _ := server.repo.ListTransactions(context.Background(), "", deviceId)
+	transactions[1].SignedData = transactions[0].SignedData
+	report = verificationReport(t, server, deviceId)
+	if report.Valid || len(report.Failures) == 0 || *report.Failures[0].Counter != 1 {
+		t.Errorf("Expected the tampered transaction to fail verification, got %+v", report)
+	}
+}
+
+func TestVerifyDeviceHandlerNotFound(t *testing.T) {
+	server, _ := newPayloadServer(t)
+
+	if recorder := serve(server, "GET", "/devices/unknown/verify", "", nil); recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, recorder.Code)
+	}
+}
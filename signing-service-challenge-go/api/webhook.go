@@ -0,0 +1,210 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+type CreateWebhookRequest struct {
+	URL string `json:"url"`
+	// Events are the types of the events delivered, every type if empty.
+	Events []domain.EventType `json:"events,omitempty"`
+}
+
+// CreateWebhookResponse carries the secret that signs the deliveries of a webhook.
+// It is the only time the secret is revealed.
+type CreateWebhookResponse struct {
+	*domain.Webhook
+	Secret string `json:"secret"`
+}
+
+var webhookIdParameter = Parameter{
+	Name:     "webhook_id",
+	In:       "path",
+	Required: true,
+	Schema:   &Schema{Type: "string"},
+}
+
+var deliveryIdParameter = Parameter{
+	Name:     "delivery_id",
+	In:       "path",
+	Required: true,
+	Schema:   &Schema{Type: "string"},
+}
+
+var deliveryStateQueryParameter = Parameter{
+	Name:   "state",
+	In:     "query",
+	Schema: &Schema{Type: "string", Enum: []string{string(domain.DeliveryPending), string(domain.DeliveryDelivered), string(domain.DeliveryDead)}},
+}
+
+var createWebhookOperation = &Operation{
+	OperationId: "createWebhook",
+	Summary:     "Subscribes a URL to the events of the devices of the tenant. The secret that signs the deliveries is only returned in this response.",
+	RequestBody: &RequestBody{Required: true, Content: jsonBody(ref("CreateWebhookRequest"))},
+	Responses: map[string]*ResponseObject{
+		"201": success("The webhook including its secret.", ref("CreateWebhookResponse")),
+		"400": failure("The request payload is invalid."),
+	},
+}
+
+var listWebhooksOperation = &Operation{
+	OperationId: "listWebhooks",
+	Summary:     "Lists the webhooks of the tenant without their secrets.",
+	Responses: map[string]*ResponseObject{
+		"200": success("The webhooks ordered by creation.", &Schema{Type: "array", Items: ref("Webhook")}),
+	},
+}
+
+var getWebhookOperation = &Operation{
+	OperationId: "getWebhook",
+	Summary:     "Retrieves a webhook.",
+	Parameters:  []Parameter{webhookIdParameter},
+	Responses: map[string]*ResponseObject{
+		"200": success("The webhook.", ref("Webhook")),
+		"404": failure("The webhook does not exist."),
+	},
+}
+
+var deleteWebhookOperation = &Operation{
+	OperationId: "deleteWebhook",
+	Summary:     "Deletes a webhook together with its pending and dead deliveries.",
+	Parameters:  []Parameter{webhookIdParameter},
+	Responses: map[string]*ResponseObject{
+		"200": success("The deleted webhook.", ref("Webhook")),
+		"404": failure("The webhook does not exist."),
+	},
+}
+
+var listWebhookDeliveriesOperation = &Operation{
+	OperationId: "listWebhookDeliveries",
+	Summary:     "Lists the deliveries of a webhook, e.g. the dead letters with state DEAD.",
+	Parameters:  append([]Parameter{webhookIdParameter, deliveryStateQueryParameter}, pageParameters...),
+	Responses: map[string]*ResponseObject{
+		"200": successPage("The deliveries ordered by event, or a page of them if a limit is given.", ref("WebhookDelivery")),
+		"400": failure("The state, the limit or the cursor is invalid."),
+		"404": failure("The webhook does not exist."),
+	},
+}
+
+var retryWebhookDeliveryOperation = &Operation{
+	OperationId: "retryWebhookDelivery",
+	Summary:     "Attempts a delivery again with a fresh budget of attempts, e.g. a dead letter once the webhook is fixed.",
+	Parameters:  []Parameter{webhookIdParameter, deliveryIdParameter},
+	Responses: map[string]*ResponseObject{
+		"200": success("The pending delivery.", ref("WebhookDelivery")),
+		"404": failure("The webhook or the delivery does not exist."),
+	},
+}
+
+// newEvent creates an Event of device carrying data.
+func newEvent(eventType domain.EventType, device *domain.SignatureDevice, data interface{}) (*domain.Event, error) {
+	return domain.NewEvent(uuid.New().String(), eventType, device, data)
+}
+
+func (s *Server) CreateWebhookHandler(response http.ResponseWriter, request *http.Request) {
+	var createReq CreateWebhookRequest
+	if err := s.decode(request, &createReq); err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	webhook, err := domain.NewWebhook(uuid.New().String(), createReq.URL, createReq.Events)
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+	webhook.TenantId = TenantId(request)
+
+	if err := s.repo.SaveWebhook(request.Context(), webhook); err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusCreated, CreateWebhookResponse{Webhook: webhook, Secret: webhook.Secret})
+}
+
+func (s *Server) ListWebhooksHandler(response http.ResponseWriter, request *http.Request) {
+	webhooks, err := s.repo.ListWebhooks(request.Context(), TenantId(request))
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, webhooks)
+}
+
+func (s *Server) GetWebhookHandler(response http.ResponseWriter, request *http.Request) {
+	webhook, err := s.repo.GetWebhook(request.Context(), TenantId(request), mux.Vars(request)["webhook_id"])
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, webhook)
+}
+
+func (s *Server) DeleteWebhookHandler(response http.ResponseWriter, request *http.Request) {
+	webhook, err := s.repo.GetWebhook(request.Context(), TenantId(request), mux.Vars(request)["webhook_id"])
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	if err := s.repo.DeleteWebhook(request.Context(), webhook.TenantId, webhook.Id); err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, webhook)
+}
+
+func (s *Server) ListWebhookDeliveriesHandler(response http.ResponseWriter, request *http.Request) {
+	page, err := parsePageRequest(request)
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	webhook, err := s.repo.GetWebhook(request.Context(), TenantId(request), mux.Vars(request)["webhook_id"])
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	state := domain.DeliveryState(request.URL.Query().Get("state"))
+	deliveries, err := s.repo.ListWebhookDeliveries(request.Context(), webhook.TenantId, webhook.Id, state)
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	deliveries, next := paginate(deliveries, page, func(delivery *domain.WebhookDelivery) string { return counterKey(int(delivery.Event.Sequence)) })
+	WritePage(response, deliveries, next)
+}
+
+func (s *Server) RetryWebhookDeliveryHandler(response http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	delivery, err := s.repo.GetWebhookDelivery(request.Context(), TenantId(request), vars["delivery_id"])
+	if err == nil && delivery.WebhookId != vars["webhook_id"] {
+		err = domain.ErrDeliveryNotFound
+	}
+	if err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	retried := *delivery
+	retried.Retry(time.Now().UTC())
+	if err := s.repo.SaveWebhookDelivery(request.Context(), &retried); err != nil {
+		s.writeError(response, request, err)
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, &retried)
+}
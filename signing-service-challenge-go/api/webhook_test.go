@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+func TestDeviceChangesRecordEvents(t *testing.T) {
+	repo := persistence.NewInMemoryPersistence()
+	server := NewServer(":8080", repo)
+
+	recorder := serve(server, "POST", "/devices", "", CreateSignatureDeviceRequest{Algorithm: "ECC", SecuredDataFormat: string(domain.SecuredDataV2)})
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, recorder.Code, recorder.Body)
+	}
+	var created struct {
+		Data domain.SignatureDevice `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Error unmarshaling response body: %v", err)
+	}
+	deviceId := created.Data.Id
+
+	signedData(t, serve(server, "POST", "/transactions/sign", "", SignTransactionRequest{DeviceId: deviceId, Data: "data"}))
+	if recorder := serve(server, "POST", "/devices/"+deviceId+"/rotate", "", nil); recorder.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, recorder.Code, recorder.Body)
+	}
+
+	events, err := repo.ListEvents(context.Background(), 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []domain.EventType{domain.EventDeviceCreated, domain.EventTransactionSigned, domain.EventDeviceCreated, domain.EventDeviceRotated}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, got %d", len(expected), len(events))
+	}
+	for i, event := range events {
+		if event.Type != expected[i] || event.Sequence != int64(i+1) {
+			t.Errorf("Expected event %d to be %s, got %s with sequence %d", i+1, expected[i], event.Type, event.Sequence)
+		}
+	}
+
+	var transaction domain.Transaction
+	if err := json.Unmarshal(events[1].Data, &transaction); err != nil {
+		t.Fatalf("Error unmarshaling event data: %v", err)
+	}
+	if events[1].DeviceId != deviceId || transaction.Counter != 0 || transaction.Signature == "" {
+		t.Errorf("Expected the signature of counter 0 of %s, got %+v of %s", deviceId, transaction, events[1].DeviceId)
+	}
+}
+
+func TestWebhookHandlers(t *testing.T) {
+	repo := persistence.NewInMemoryPersistence()
+	server := NewServer(":8080", repo)
+
+	recorder := serve(server, "POST", "/webhooks", "", CreateWebhookRequest{URL: "ftp://example.com"})
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), CodeInvalidWebhook) {
+		t.Errorf("Expected %s, got %d: %s", CodeInvalidWebhook, recorder.Code, recorder.Body)
+	}
+	recorder = serve(server, "POST", "/webhooks", "", CreateWebhookRequest{URL: "https://example.com/hook", Events: []domain.EventType{"device.deleted"}})
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusBadRequest, recorder.Code, recorder.Body)
+	}
+
+	recorder = serve(server, "POST", "/webhooks", "", CreateWebhookRequest{URL: "https://example.com/hook", Events: []domain.EventType{domain.EventTransactionSigned}})
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, recorder.Code, recorder.Body)
+	}
+	var created struct {
+		Data CreateWebhookResponse `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Error unmarshaling response body: %v", err)
+	}
+	if !strings.HasPrefix(created.Data.Secret, "whsec_") {
+		t.Errorf("Expected a webhook secret, got %q", created.Data.Secret)
+	}
+	webhookId := created.Data.Id
+
+	for _, path := range []string{"/webhooks", "/webhooks/" + webhookId} {
+		recorder = serve(server, "GET", path, "", nil)
+		if recorder.Code != http.StatusOK || strings.Contains(recorder.Body.String(), created.Data.Secret) {
+			t.Errorf("Expected %s without the secret, got %d: %s", path, recorder.Code, recorder.Body)
+		}
+	}
+
+	webhook, _ := repo.GetWebhook(context.Background(), "", webhookId)
+	device, _ := domain.NewSignatureDevice("device", "ECC", "")
+	event, _ := domain.NewEvent("event", domain.EventTransactionSigned, device, map[string]string{})
+	dead := domain.NewWebhookDelivery("delivery", webhook, event)
+	dead.Fail(time.Now(), http.StatusInternalServerError, "failed", time.Time{})
+	repo.SaveWebhookDelivery(context.Background(), dead)
+
+	recorder = serve(server, "GET", "/webhooks/"+webhookId+"/deliveries?state=DEAD", "", nil)
+	var deliveries struct {
+		Data []domain.WebhookDelivery `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &deliveries); err != nil {
+		t.Fatalf("Error unmarshaling response body: %v", err)
+	}
+	if len(deliveries.Data) != 1 || deliveries.Data[0].Id != "delivery" {
+		t.Fatalf("Expected the dead delivery, got %s", recorder.Body)
+	}
+	if recorder := serve(server, "GET", "/webhooks/"+webhookId+"/deliveries?state=PENDING", "", nil); strings.Contains(recorder.Body.String(), "delivery") {
+		t.Errorf("Expected no pending deliveries, got %s", recorder.Body)
+	}
+
+	recorder = serve(server, "POST", "/webhooks/"+webhookId+"/deliveries/delivery/retry", "", nil)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body)
+	}
+	retried, _ := repo.GetWebhookDelivery(context.Background(), "", "delivery")
+	if retried.State != domain.DeliveryPending || retried.Attempts != 0 {
+		t.Errorf("Expected a pending delivery without attempts, got %s after %d", retried.State, retried.Attempts)
+	}
+	if recorder := serve(server, "POST", "/webhooks/other/deliveries/delivery/retry", "", nil); recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, recorder.Code)
+	}
+
+	if recorder := serve(server, "DELETE", "/webhooks/"+webhookId, "", nil); recorder.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body)
+	}
+	recorder = serve(server, "GET", "/webhooks/"+webhookId, "", nil)
+	if recorder.Code != http.StatusNotFound || !strings.Contains(recorder.Body.String(), CodeWebhookNotFound) {
+		t.Errorf("Expected %s, got %d: %s", CodeWebhookNotFound, recorder.Code, recorder.Body)
+	}
+	if _, err := repo.GetWebhookDelivery(context.Background(), "", "delivery"); err != domain.ErrDeliveryNotFound {
+		t.Errorf("Expected the deliveries to be deleted, got %v", err)
+	}
+}
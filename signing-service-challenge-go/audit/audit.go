@@ -0,0 +1,97 @@
+package audit
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// Event names a security-relevant action recorded in the audit log.
+type Event string
+
+const (
+	// EventDeviceCreated records the creation of a signature device and its key pair.
+	EventDeviceCreated Event = "device.created"
+	// EventKeyExported records the export of the public key of a signature device.
+	EventKeyExported Event = "device.key_exported"
+	// EventDeviceSuspended records the suspension of a signature device.
+	EventDeviceSuspended Event = "device.suspended"
+	// EventDeviceRotated records the rotation of a signature device to a successor
+	// with a new key pair.
+	EventDeviceRotated Event = "device.rotated"
+	// EventDeviceExported records the export of the signature log of a signature device.
+	EventDeviceExported Event = "device.exported"
+	// EventSignatureIssued records a signature and the counter it was issued with.
+	EventSignatureIssued Event = "signature.issued"
+	// EventTransactionExpired records a fiscal transaction that timed out before it
+	// was finished.
+	EventTransactionExpired Event = "transaction.expired"
+)
+
+// Entry describes an Event. It deliberately has no room for signed data, signatures
+// or key material, which must never reach the audit log.
+type Entry struct {
+	Event     Event
+	RequestId string
+	TenantId  string
+	APIKeyId  string
+	DeviceId  string
+	Algorithm string
+	// Counter is the signature counter of EventSignatureIssued.
+	Counter int
+	// TransactionId is the fiscal transaction a signature was issued for or that expired.
+	TransactionId string
+	// SuccessorId is the device that replaces the device of EventDeviceRotated.
+	SuccessorId string
+}
+
+// Log appends entries as JSON lines to a writer.
+type Log struct {
+	logger *slog.Logger
+}
+
+// New creates a Log writing to w.
+func New(w io.Writer) *Log {
+	return &Log{logger: slog.New(slog.NewJSONHandler(w, nil))}
+}
+
+// Discard is a Log that records nothing.
+func Discard() *Log {
+	return New(io.Discard)
+}
+
+// Open creates a Log appending to the file at path, which is created if it does
+// not exist. Existing entries are never truncated or rewritten.
+func Open(path string) (*Log, io.Closer, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, nil, err
+	}
+	return New(file), file, nil
+}
+
+// Record appends an entry to the log.
+func (l *Log) Record(ctx context.Context, entry Entry) {
+	attributes := []slog.Attr{
+		slog.String("event", string(entry.Event)),
+		slog.String("request_id", entry.RequestId),
+		slog.String("tenant_id", entry.TenantId),
+		slog.String("api_key_id", entry.APIKeyId),
+		slog.String("device_id", entry.DeviceId),
+	}
+	if entry.Algorithm != "" {
+		attributes = append(attributes, slog.String("algorithm", entry.Algorithm))
+	}
+	if entry.Event == EventSignatureIssued {
+		attributes = append(attributes, slog.Int("counter", entry.Counter))
+	}
+	if entry.TransactionId != "" {
+		attributes = append(attributes, slog.String("transaction_id", entry.TransactionId))
+	}
+	if entry.SuccessorId != "" {
+		attributes = append(attributes, slog.String("successor_id", entry.SuccessorId))
+	}
+
+	l.logger.LogAttrs(ctx, slog.LevelInfo, "audit", attributes...)
+}
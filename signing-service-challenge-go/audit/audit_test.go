@@ -0,0 +1,56 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordWritesJSON(t *testing.T) {
+	var buffer bytes.Buffer
+	New(&buffer).Record(context.Background(), Entry{
+		Event:    EventSignatureIssued,
+		TenantId: "tenant",
+		DeviceId: "device",
+		Counter:  0,
+	})
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(buffer.Bytes(), &line); err != nil {
+		t.Fatalf("Expected a JSON line, got %q", buffer.String())
+	}
+	if line["event"] != string(EventSignatureIssued) {
+		t.Errorf("Expected event %s, got %v", EventSignatureIssued, line["event"])
+	}
+	if line["counter"] != float64(0) {
+		t.Errorf("Expected counter %d, got %v", 0, line["counter"])
+	}
+	if line["device_id"] != "device" {
+		t.Errorf("Expected device id %s, got %v", "device", line["device_id"])
+	}
+}
+
+func TestOpenAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	for i := 0; i < 2; i++ {
+		log, closer, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		log.Record(context.Background(), Entry{Event: EventDeviceCreated, DeviceId: "device"})
+		closer.Close()
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(content), "\n"); lines != 2 {
+		t.Errorf("Expected %d lines, got %d", 2, lines)
+	}
+}
@@ -0,0 +1,159 @@
+// Package certs serves TLS certificates that are reloaded from disk when they change,
+// so that certificates can be rotated without restarting the service.
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultInterval is how often a Reloader checks its files for changes.
+const DefaultInterval = 10 * time.Second
+
+// Reloader holds a certificate and its private key, and reloads both once either file
+// changes. If reloading fails, the previous certificate is kept.
+type Reloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+	now      func() time.Time
+
+	mu          sync.Mutex
+	certificate *tls.Certificate
+	modified    time.Time
+	checked     time.Time
+}
+
+// NewReloader loads the PEM encoded certificate and private key in the given files.
+// The files are checked for changes at most once per interval while handshakes happen.
+func NewReloader(certFile, keyFile string, interval time.Duration) (*Reloader, error) {
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		interval: interval,
+		now:      time.Now,
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// modTime returns the time the later of both files was modified.
+func (r *Reloader) modTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// Reload loads the certificate and private key from disk.
+func (r *Reloader) Reload() error {
+	modified, err := r.modTime()
+	if err != nil {
+		return fmt.Errorf("loading certificate: %w", err)
+	}
+	certificate, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading certificate: %w", err)
+	}
+	if certificate.Leaf == nil {
+		certificate.Leaf, err = x509.ParseCertificate(certificate.Certificate[0])
+		if err != nil {
+			return fmt.Errorf("parsing certificate: %w", err)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.certificate = &certificate
+	r.modified = modified
+	r.checked = r.now()
+	return nil
+}
+
+// GetCertificate returns the current certificate, reloading it first if its files
+// changed. It is meant for tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	due := r.now().Sub(r.checked) >= r.interval
+	if due {
+		r.checked = r.now()
+	}
+	modified := r.modified
+	r.mu.Unlock()
+
+	if due {
+		if latest, err := r.modTime(); err != nil || latest.After(modified) {
+			if err == nil {
+				err = r.Reload()
+			}
+			if err != nil {
+				slog.Error("Could not reload certificate, keeping the previous one",
+					slog.String("cert_file", r.certFile), slog.String("error", err.Error()))
+			} else {
+				slog.Info("Reloaded certificate", slog.String("cert_file", r.certFile))
+			}
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.certificate, nil
+}
+
+// ClientAuth selects whether clients are asked for certificates.
+type ClientAuth string
+
+const (
+	// ClientAuthNone does not ask clients for certificates.
+	ClientAuthNone ClientAuth = "none"
+	// ClientAuthOptional verifies certificates of clients that present one.
+	ClientAuthOptional ClientAuth = "optional"
+	// ClientAuthRequire rejects clients without a valid certificate.
+	ClientAuthRequire ClientAuth = "require"
+)
+
+// ServerConfig returns a TLS configuration serving the certificate of r over HTTP/2
+// and HTTP/1.1. Unless clientAuth is ClientAuthNone, client certificates are verified
+// against the PEM encoded CA certificates in clientCAFile.
+func ServerConfig(r *Reloader, clientAuth ClientAuth, clientCAFile string) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+
+	switch clientAuth {
+	case ClientAuthNone, "":
+		return config, nil
+	case ClientAuthOptional:
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown client authentication %q", clientAuth)
+	}
+
+	pem, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading client CA: %w", err)
+	}
+	config.ClientCAs = x509.NewCertPool()
+	if !config.ClientCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("loading client CA: no certificates in %s", clientCAFile)
+	}
+	return config, nil
+}
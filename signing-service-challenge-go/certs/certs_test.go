@@ -0,0 +1,94 @@
+package certs
+
+import (
+	"crypto/tls"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/certs/certstest"
+)
+
+func TestReloaderReloadsChangedFiles(t *testing.T) {
+	ca := certstest.NewCA(t)
+	dir := t.TempDir()
+
+	certPEM, keyPEM := ca.Issue(t, "first")
+	certFile := certstest.WriteFile(t, dir, "cert.pem", certPEM)
+	keyFile := certstest.WriteFile(t, dir, "key.pem", keyPEM)
+
+	reloader, err := NewReloader(certFile, keyFile, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	reloader.now = func() time.Time { return now }
+
+	certificate, _ := reloader.GetCertificate(&tls.ClientHelloInfo{})
+	if certificate.Leaf.Subject.CommonName != "first" {
+		t.Fatalf("Expected certificate %s, got %s", "first", certificate.Leaf.Subject.CommonName)
+	}
+
+	certPEM, keyPEM = ca.Issue(t, "second")
+	certstest.WriteFile(t, dir, "cert.pem", certPEM)
+	certstest.WriteFile(t, dir, "key.pem", keyPEM)
+	later := time.Now().Add(time.Second)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+
+	certificate, _ = reloader.GetCertificate(&tls.ClientHelloInfo{})
+	if certificate.Leaf.Subject.CommonName != "first" {
+		t.Errorf("Expected files to be checked only once per interval")
+	}
+
+	now = now.Add(time.Minute)
+	certificate, _ = reloader.GetCertificate(&tls.ClientHelloInfo{})
+	if certificate.Leaf.Subject.CommonName != "second" {
+		t.Errorf("Expected certificate %s, got %s", "second", certificate.Leaf.Subject.CommonName)
+	}
+}
+
+func TestReloaderKeepsCertificateOnError(t *testing.T) {
+	ca := certstest.NewCA(t)
+	dir := t.TempDir()
+
+	certPEM, keyPEM := ca.Issue(t, "first")
+	certFile := certstest.WriteFile(t, dir, "cert.pem", certPEM)
+	keyFile := certstest.WriteFile(t, dir, "key.pem", keyPEM)
+
+	reloader, err := NewReloader(certFile, keyFile, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certstest.WriteFile(t, dir, "cert.pem", []byte("garbage"))
+	later := time.Now().Add(time.Second)
+	os.Chtimes(certFile, later, later)
+
+	certificate, err := reloader.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil || certificate.Leaf.Subject.CommonName != "first" {
+		t.Errorf("Expected the previous certificate, got %v", err)
+	}
+}
+
+func TestServerConfigRequiresClientCA(t *testing.T) {
+	ca := certstest.NewCA(t)
+	dir := t.TempDir()
+	certPEM, keyPEM := ca.Issue(t, "server")
+	reloader, err := NewReloader(certstest.WriteFile(t, dir, "cert.pem", certPEM), certstest.WriteFile(t, dir, "key.pem", keyPEM), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ServerConfig(reloader, ClientAuthRequire, certstest.WriteFile(t, dir, "ca.pem", []byte("garbage"))); err == nil {
+		t.Errorf("Expected an error for a CA file without certificates")
+	}
+
+	config, err := ServerConfig(reloader, ClientAuthRequire, certstest.WriteFile(t, dir, "ca.pem", ca.PEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Errorf("Expected client certificates to be required")
+	}
+}
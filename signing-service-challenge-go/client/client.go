@@ -0,0 +1,385 @@
+// Package client calls the API of the signing service. The routes of its
+// operations are generated from the OpenAPI document of the server.
+//
+// Requests that fail transiently are retried. Every POST carries an
+// Idempotency-Key that stays the same across its attempts, so that a retried
+// request is executed by the service at most once.
+package client
+
+//go:generate go run ./internal/gen -o operations.go
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+)
+
+// operation is the route of an operation of the API.
+type operation struct {
+	method string
+	path   string
+}
+
+// Client calls the API of a signing service.
+type Client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+	retries    RetryPolicy
+	pageSize   int
+	// verify has the signatures returned by the service verified.
+	verify bool
+	// publicKeys caches the public keys of the devices by id.
+	publicKeys sync.Map
+}
+
+// RetryPolicy tells how requests that failed transiently are retried: after
+// transport errors, rate limits, unavailable services and idempotency keys still
+// in use.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts of a request, including the first; 1
+	// disables retries.
+	MaxAttempts int
+	// MinBackoff is the delay before the first retry, which doubles with every
+	// further attempt up to MaxBackoff. The delays are jittered.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy is the RetryPolicy of a Client unless WithRetryPolicy
+// configures another.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 4, MinBackoff: 100 * time.Millisecond, MaxBackoff: 5 * time.Second}
+
+// DefaultPageSize is the number of items iterators fetch per page unless
+// WithPageSize configures another.
+const DefaultPageSize = 100
+
+// Option configures optional behavior of a Client.
+type Option func(*Client)
+
+// WithAPIKey authenticates every request with the secret of an API key.
+func WithAPIKey(secret string) Option {
+	return func(c *Client) {
+		c.apiKey = secret
+	}
+}
+
+// WithHTTPClient sends the requests with httpClient instead of http.DefaultClient.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithHandler serves the requests in-process by handler, such as the Handler of an
+// api.Server, instead of sending them over the network.
+func WithHandler(handler http.Handler) Option {
+	return func(c *Client) {
+		c.httpClient = &http.Client{Transport: handlerTransport{handler}}
+	}
+}
+
+// WithRetryPolicy retries requests as policy tells.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retries = policy
+	}
+}
+
+// WithPageSize has iterators fetch size items per page, at most 1000.
+func WithPageSize(size int) Option {
+	return func(c *Client) {
+		c.pageSize = size
+	}
+}
+
+// New creates a Client of the service at baseURL, such as https://signing.example.com.
+func New(baseURL string, options ...Option) *Client {
+	client := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		retries:    DefaultRetryPolicy,
+		pageSize:   DefaultPageSize,
+	}
+
+	for _, option := range options {
+		option(client)
+	}
+
+	return client
+}
+
+// Error is a problem reported by the service.
+type Error struct {
+	Status int
+	// Code is the machine readable code of the problem, one of the Code constants
+	// of the api package.
+	Code   string
+	Title  string
+	Detail string
+	Errors []api.ValidationError
+	// RetryAfter is how long the service asked to wait before retrying, if it did.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	if e.Status == 0 {
+		// The errors of the package only name a code to match.
+		return e.Code
+	}
+	message := fmt.Sprintf("%d %s", e.Status, e.Title)
+	if e.Code != "" {
+		message += " (" + e.Code + ")"
+	}
+	if e.Detail != "" {
+		message += ": " + e.Detail
+	}
+	for _, validation := range e.Errors {
+		message += "; " + validation.String()
+	}
+	return message
+}
+
+// Request describes a call of an operation.
+type Request struct {
+	// Operation is the id of the operation, one of the Operation constants.
+	Operation string
+	// Path holds the values of the path parameters of the operation.
+	Path  map[string]string
+	Query url.Values
+	// Body is encoded as JSON unless it is an io.Reader, which is sent as is.
+	Body        interface{}
+	ContentType string
+	// IdempotencyKey identifies a POST across its attempts. Unless it is set here or
+	// by WithIdempotencyKey, a random key is generated for every call.
+	IdempotencyKey string
+}
+
+type idempotencyKeyContextKey struct{}
+
+// WithIdempotencyKey returns a context whose POST calls carry key as their
+// Idempotency-Key, such as the number of a receipt, so that the service executes
+// them once even when they are repeated after a restart of the caller.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyContextKey{}, key)
+}
+
+// Call calls an operation and decodes the data of its response into out, unless
+// out is nil. Problems reported by the service are returned as *Error.
+func (c *Client) Call(ctx context.Context, request Request, out interface{}) error {
+	_, err := c.call(ctx, request, out)
+	return err
+}
+
+// call calls an operation like Call and returns the cursor of the next page of a
+// list, if there is one.
+func (c *Client) call(ctx context.Context, request Request, out interface{}) (string, error) {
+	response, err := c.Open(ctx, request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if out == nil {
+		return "", nil
+	}
+	envelope := api.Response{Data: out}
+	if err := json.NewDecoder(response.Body).Decode(&envelope); err != nil {
+		return "", fmt.Errorf("decoding the response of %s: %w", request.Operation, err)
+	}
+	return envelope.NextCursor, nil
+}
+
+// Open calls an operation and returns its successful response, whose body the
+// caller must close. Problems reported by the service are returned as *Error.
+func (c *Client) Open(ctx context.Context, request Request) (*http.Response, error) {
+	operation, ok := operations[request.Operation]
+	if !ok {
+		return nil, fmt.Errorf("unknown operation %q", request.Operation)
+	}
+
+	body, contentType, err := encodeBody(request)
+	if err != nil {
+		return nil, err
+	}
+	if operation.method == http.MethodPost && request.IdempotencyKey == "" {
+		if key, ok := ctx.Value(idempotencyKeyContextKey{}).(string); ok {
+			request.IdempotencyKey = key
+		} else {
+			request.IdempotencyKey = uuid.NewString()
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		httpRequest, err := c.newRequest(ctx, operation, request, body, contentType)
+		if err != nil {
+			return nil, err
+		}
+
+		var retryAfter time.Duration
+		response, err := c.httpClient.Do(httpRequest)
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return nil, err
+			}
+		case response.StatusCode < 300:
+			return response, nil
+		default:
+			problem := readError(response)
+			response.Body.Close()
+			if !retryable(problem) {
+				return nil, problem
+			}
+			err, retryAfter = problem, problem.RetryAfter
+		}
+
+		if attempt >= c.retries.MaxAttempts || retryAfter > c.retries.MaxBackoff {
+			return nil, err
+		}
+		delay := c.retries.backoff(attempt)
+		if retryAfter > delay {
+			delay = retryAfter
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+// retryable tells whether a problem may be resolved by retrying the request.
+func retryable(problem *Error) bool {
+	switch problem.Status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return problem.Code == api.CodeIdempotencyKeyInUse
+}
+
+// backoff returns the jittered delay after the attempt-th attempt.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.MinBackoff
+	for i := 1; i < attempt && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// encodeBody returns the body of a request, read into memory so that it can be
+// sent again, and its content type.
+func encodeBody(request Request) ([]byte, string, error) {
+	switch value := request.Body.(type) {
+	case nil:
+		return nil, request.ContentType, nil
+	case io.Reader:
+		body, err := io.ReadAll(value)
+		return body, request.ContentType, err
+	default:
+		body, err := json.Marshal(value)
+		if err != nil {
+			return nil, "", err
+		}
+		if request.ContentType == "" {
+			return body, "application/json", nil
+		}
+		return body, request.ContentType, nil
+	}
+}
+
+// newRequest builds the HTTP request of an attempt of a call.
+func (c *Client) newRequest(ctx context.Context, operation operation, request Request, body []byte, contentType string) (*http.Request, error) {
+	path := operation.path
+	for name, value := range request.Path {
+		path = strings.ReplaceAll(path, "{"+name+"}", url.PathEscape(value))
+	}
+	if strings.Contains(path, "{") {
+		return nil, fmt.Errorf("missing path parameters of %s in %s", request.Operation, path)
+	}
+	target := c.baseURL + basePath + path
+	if len(request.Query) > 0 {
+		target += "?" + request.Query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	httpRequest, err := http.NewRequestWithContext(ctx, operation.method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		httpRequest.Header.Set("Content-Type", contentType)
+	}
+	if c.apiKey != "" {
+		httpRequest.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	if request.IdempotencyKey != "" {
+		httpRequest.Header.Set("Idempotency-Key", request.IdempotencyKey)
+	}
+	return httpRequest, nil
+}
+
+// readError reads the problem of an unsuccessful response.
+func readError(response *http.Response) *Error {
+	content, _ := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	var retryAfter time.Duration
+	if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		retryAfter = time.Duration(seconds) * time.Second
+	}
+
+	var problem api.Problem
+	if err := json.Unmarshal(content, &problem); err == nil && problem.Code != "" {
+		return &Error{Status: response.StatusCode, Code: problem.Code, Title: problem.Title, Detail: problem.Detail, Errors: problem.Errors, RetryAfter: retryAfter}
+	}
+
+	// Servers with legacy errors report a list of messages.
+	problemError := &Error{Status: response.StatusCode, Title: http.StatusText(response.StatusCode), RetryAfter: retryAfter}
+	var legacy api.ErrorResponse
+	if err := json.Unmarshal(content, &legacy); err == nil {
+		problemError.Detail = strings.Join(legacy.Errors, "; ")
+	}
+	return problemError
+}
+
+// handlerTransport serves requests by a handler.
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t handlerTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Body != nil {
+		defer request.Body.Close()
+	} else {
+		// Servers always pass a body to their handlers.
+		request = request.Clone(request.Context())
+		request.Body = http.NoBody
+	}
+	recorder := httptest.NewRecorder()
+	t.handler.ServeHTTP(recorder, request)
+	return recorder.Result(), nil
+}
@@ -0,0 +1,257 @@
+package client_test
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/client"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+const adminSecret = "admin-secret"
+
+// newServer returns an authenticating server with an API key holding every scope.
+func newServer(t *testing.T) *api.Server {
+	repo := persistence.NewInMemoryPersistence()
+	key, err := domain.NewAPIKeyWithSecret("admin", "admin", adminSecret, domain.Scopes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.SaveAPIKey(context.Background(), key)
+	return api.NewServer("", repo, api.WithAuthentication())
+}
+
+// exercise manages a device and an API key through c.
+func exercise(t *testing.T, c *client.Client) {
+	ctx := context.Background()
+
+	device, err := c.CreateDevice(ctx, api.CreateSignatureDeviceRequest{Algorithm: "ECC", Label: "Till"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	signature, err := c.Sign(ctx, api.SignTransactionRequest{DeviceId: device.Id, Data: "receipt"})
+	if err != nil || signature.Signature == "" || signature.SignedAt.IsZero() {
+		t.Fatalf("Expected a signature, got %+v: %v", signature, err)
+	}
+	if devices, err := c.ListDevices(ctx); err != nil || len(devices) != 1 || devices[0].SignatureCounter != 1 {
+		t.Errorf("Expected the device with a signature, got %v: %v", devices, err)
+	}
+	if report, err := c.VerifyDevice(ctx, device.Id); err != nil || !report.Valid || report.Transactions != 1 {
+		t.Errorf("Expected a valid signature log, got %+v: %v", report, err)
+	}
+	if key, err := c.PublicKey(ctx, device.Id); err != nil || key.PublicKey == "" {
+		t.Errorf("Expected the public key, got %+v: %v", key, err)
+	}
+
+	archive, err := c.ExportDevice(ctx, device.Id, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := tar.NewReader(archive).Next(); err != nil {
+		t.Errorf("Expected a TAR archive: %v", err)
+	}
+	archive.Close()
+
+	successor, err := c.RotateDevice(ctx, device.Id)
+	if err != nil || successor.PredecessorId != device.Id {
+		t.Errorf("Expected the successor of %s, got %+v: %v", device.Id, successor, err)
+	}
+	if rotated, err := c.GetDevice(ctx, device.Id); err != nil || rotated.Status != domain.DeviceStatusSuspended {
+		t.Errorf("Expected the rotated device to be suspended, got %+v: %v", rotated, err)
+	}
+
+	issued, err := c.CreateAPIKey(ctx, api.CreateAPIKeyRequest{Name: "till", Scopes: []domain.Scope{domain.ScopeSign}})
+	if err != nil || issued.Key == "" {
+		t.Fatalf("Expected an API key with its secret, got %+v: %v", issued, err)
+	}
+	if revoked, err := c.RevokeAPIKey(ctx, issued.Id); err != nil || revoked.RevokedAt == nil {
+		t.Errorf("Expected the key to be revoked, got %+v: %v", revoked, err)
+	}
+	if keys, err := c.ListAPIKeys(ctx); err != nil || len(keys) != 2 {
+		t.Errorf("Expected 2 API keys, got %v: %v", keys, err)
+	}
+}
+
+func TestClient(t *testing.T) {
+	httpServer := httptest.NewServer(newServer(t).Handler())
+	defer httpServer.Close()
+
+	exercise(t, client.New(httpServer.URL, client.WithAPIKey(adminSecret)))
+}
+
+func TestClientWithHandler(t *testing.T) {
+	exercise(t, client.New("", client.WithHandler(newServer(t).Handler()), client.WithAPIKey(adminSecret)))
+}
+
+func TestClientReportsProblems(t *testing.T) {
+	c := client.New("", client.WithHandler(newServer(t).Handler()), client.WithAPIKey(adminSecret))
+
+	_, err := c.GetDevice(context.Background(), "missing")
+	var problem *client.Error
+	if !errors.As(err, &problem) || problem.Status != 404 || problem.Code != api.CodeDeviceNotFound {
+		t.Errorf("Expected %s, got %v", api.CodeDeviceNotFound, err)
+	}
+	if !errors.Is(err, client.ErrDeviceNotFound) || errors.Is(err, client.ErrTransactionNotFound) {
+		t.Errorf("Expected the error to match only %s, got %v", api.CodeDeviceNotFound, err)
+	}
+
+	_, err = client.New("", client.WithHandler(newServer(t).Handler())).ListDevices(context.Background())
+	if !errors.As(err, &problem) || problem.Code != api.CodeUnauthenticated {
+		t.Errorf("Expected %s, got %v", api.CodeUnauthenticated, err)
+	}
+}
+
+func TestClientRetriesWithIdempotencyKey(t *testing.T) {
+	handler := newServer(t).Handler()
+	failures := 1
+	// The first signature is executed, but its response is lost.
+	flaky := http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if request.Method == http.MethodPost && request.URL.Path == "/api/v0/transactions/sign" && failures > 0 {
+			failures--
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+			response.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		handler.ServeHTTP(response, request)
+	})
+	c := client.New("", client.WithHandler(flaky), client.WithAPIKey(adminSecret),
+		client.WithRetryPolicy(client.RetryPolicy{MaxAttempts: 2, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}))
+	ctx := context.Background()
+
+	device, err := c.CreateDevice(ctx, api.CreateSignatureDeviceRequest{Algorithm: "ECC"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := c.Sign(ctx, api.SignTransactionRequest{DeviceId: device.Id, Data: "receipt"}); err != nil {
+		t.Fatalf("Expected the retry to succeed, got %v", err)
+	}
+	if transactions, err := c.ListDeviceTransactions(ctx, device.Id); err != nil || len(transactions) != 1 {
+		t.Errorf("Expected a single signature, got %d: %v", len(transactions), err)
+	}
+
+	// Without retries, the lost response is reported.
+	failures = 1
+	c = client.New("", client.WithHandler(flaky), client.WithAPIKey(adminSecret), client.WithRetryPolicy(client.RetryPolicy{MaxAttempts: 1}))
+	_, err = c.Sign(ctx, api.SignTransactionRequest{DeviceId: device.Id, Data: "receipt"})
+	var problem *client.Error
+	if !errors.As(err, &problem) || problem.Status != http.StatusBadGateway {
+		t.Errorf("Expected status %d, got %v", http.StatusBadGateway, err)
+	}
+}
+
+func TestIterators(t *testing.T) {
+	c := client.New("", client.WithHandler(newServer(t).Handler()), client.WithAPIKey(adminSecret), client.WithPageSize(2))
+	ctx := context.Background()
+
+	var device *domain.SignatureDevice
+	for i := 0; i < 3; i++ {
+		var err error
+		if device, err = c.CreateDevice(ctx, api.CreateSignatureDeviceRequest{Algorithm: "ECC"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := c.Sign(ctx, api.SignTransactionRequest{DeviceId: device.Id, Data: "receipt"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	devices := c.Devices(ctx)
+	count := 0
+	for devices.Next() {
+		count++
+	}
+	if devices.Err() != nil || count != 3 {
+		t.Errorf("Expected 3 devices, got %d: %v", count, devices.Err())
+	}
+
+	transactions := c.DeviceTransactions(ctx, device.Id)
+	counter := 0
+	for transactions.Next() {
+		if transactions.Value().Counter != counter {
+			t.Errorf("Expected counter %d, got %d", counter, transactions.Value().Counter)
+		}
+		counter++
+	}
+	if transactions.Err() != nil || counter != 5 {
+		t.Errorf("Expected 5 transactions, got %d: %v", counter, transactions.Err())
+	}
+
+	missing := c.DeviceTransactions(ctx, "missing")
+	if missing.Next() || !errors.Is(missing.Err(), client.ErrDeviceNotFound) {
+		t.Errorf("Expected %s, got %v", api.CodeDeviceNotFound, missing.Err())
+	}
+}
+
+func TestVerification(t *testing.T) {
+	c := client.New("", client.WithHandler(newServer(t).Handler()), client.WithAPIKey(adminSecret), client.WithVerification())
+	ctx := context.Background()
+
+	for _, format := range []string{"", "v2", "v3"} {
+		device, err := c.CreateDevice(ctx, api.CreateSignatureDeviceRequest{Algorithm: "RSA", SecuredDataFormat: format})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for i := 0; i < 2; i++ {
+			if _, err := c.Sign(ctx, api.SignTransactionRequest{DeviceId: device.Id, Data: "receipt"}); err != nil {
+				t.Errorf("Expected a verified %q signature, got %v", format, err)
+			}
+		}
+		if format == "" {
+			continue
+		}
+
+		started, err := c.StartTransaction(ctx, api.SignTransactionRequest{DeviceId: device.Id, Data: "start"})
+		if err != nil {
+			t.Fatalf("Expected a verified start, got %v", err)
+		}
+		finished, err := c.FinishTransaction(ctx, started.Transaction.Id, api.TransactionStepRequest{Data: "finish"})
+		if err != nil || finished.Transaction.State != domain.FiscalTransactionFinished {
+			t.Errorf("Expected a verified finish, got %+v: %v", finished, err)
+		}
+
+		forged := *finished.Signature
+		forged.SignedData = started.Signature.SignedData
+		if err := c.VerifySignature(ctx, device.Id, &forged); !errors.Is(err, client.ErrInvalidSignature) {
+			t.Errorf("Expected %v for a forged %q signature, got %v", client.ErrInvalidSignature, format, err)
+		}
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	c := client.New("", client.WithHandler(newServer(t).Handler()), client.WithAPIKey(adminSecret))
+	ctx := context.Background()
+
+	if _, err := c.CreateWebhook(ctx, api.CreateWebhookRequest{URL: "example.com"}); !errors.Is(err, client.ErrInvalidWebhook) {
+		t.Errorf("Expected %s, got %v", api.CodeInvalidWebhook, err)
+	}
+	created, err := c.CreateWebhook(ctx, api.CreateWebhookRequest{URL: "https://example.com/hook", Events: []domain.EventType{domain.EventDeviceRotated}})
+	if err != nil || created.Secret == "" {
+		t.Fatalf("Expected a webhook with its secret, got %+v: %v", created, err)
+	}
+
+	if webhooks, err := c.ListWebhooks(ctx); err != nil || len(webhooks) != 1 || webhooks[0].Id != created.Id {
+		t.Errorf("Expected the webhook to be listed, got %v: %v", webhooks, err)
+	}
+	deliveries := c.WebhookDeliveries(ctx, created.Id, domain.DeliveryDead)
+	if deliveries.Next() || deliveries.Err() != nil {
+		t.Errorf("Expected no dead deliveries, got %v", deliveries.Err())
+	}
+	if _, err := c.RetryWebhookDelivery(ctx, created.Id, "missing"); !errors.Is(err, client.ErrDeliveryNotFound) {
+		t.Errorf("Expected %s, got %v", api.CodeDeliveryNotFound, err)
+	}
+
+	if _, err := c.DeleteWebhook(ctx, created.Id); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := c.GetWebhook(ctx, created.Id); !errors.Is(err, client.ErrWebhookNotFound) {
+		t.Errorf("Expected %s, got %v", api.CodeWebhookNotFound, err)
+	}
+}
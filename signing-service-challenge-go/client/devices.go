@@ -0,0 +1,141 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/verify"
+)
+
+// Signature is a signature issued by a signature device.
+type Signature struct {
+	Signature         string                   `json:"signature"`
+	SignedData        string                   `json:"signed_data"`
+	SecuredDataFormat domain.SecuredDataFormat `json:"secured_data_format"`
+	DataEncoding      domain.PayloadEncoding   `json:"data_encoding"`
+	SignedAt          time.Time                `json:"signed_at"`
+	// TimestampToken is the DER encoded RFC 3161 timestamp token over the
+	// signature, if the service requests them.
+	TimestampToken []byte     `json:"timestamp_token,omitempty"`
+	TimestampedAt  *time.Time `json:"timestamped_at,omitempty"`
+}
+
+// device returns the path parameters naming a device.
+func device(id string) map[string]string {
+	return map[string]string{"device_id": id}
+}
+
+// CreateDevice creates a signature device with a freshly generated key pair.
+func (c *Client) CreateDevice(ctx context.Context, request api.CreateSignatureDeviceRequest) (*domain.SignatureDevice, error) {
+	var created *domain.SignatureDevice
+	err := c.Call(ctx, Request{Operation: OperationCreateSignatureDevice, Body: request}, &created)
+	return created, err
+}
+
+// ListDevices lists the signature devices of the tenant.
+func (c *Client) ListDevices(ctx context.Context) ([]*domain.SignatureDevice, error) {
+	var devices []*domain.SignatureDevice
+	err := c.Call(ctx, Request{Operation: OperationListSignatureDevices}, &devices)
+	return devices, err
+}
+
+// Devices iterates over the signature devices of the tenant page by page.
+func (c *Client) Devices(ctx context.Context) *Iterator[*domain.SignatureDevice] {
+	return iterate[*domain.SignatureDevice](ctx, c, Request{Operation: OperationListSignatureDevices})
+}
+
+// GetDevice retrieves a signature device.
+func (c *Client) GetDevice(ctx context.Context, id string) (*domain.SignatureDevice, error) {
+	var found *domain.SignatureDevice
+	err := c.Call(ctx, Request{Operation: OperationGetSignatureDevice, Path: device(id)}, &found)
+	return found, err
+}
+
+// SuspendDevice suspends a signature device.
+func (c *Client) SuspendDevice(ctx context.Context, id string) (*domain.SignatureDevice, error) {
+	var suspended *domain.SignatureDevice
+	err := c.Call(ctx, Request{Operation: OperationSuspendSignatureDevice, Path: device(id)}, &suspended)
+	return suspended, err
+}
+
+// RotateDevice rotates the key of a signature device and returns its successor.
+func (c *Client) RotateDevice(ctx context.Context, id string) (*domain.SignatureDevice, error) {
+	var successor *domain.SignatureDevice
+	err := c.Call(ctx, Request{Operation: OperationRotateSignatureDevice, Path: device(id)}, &successor)
+	return successor, err
+}
+
+// PublicKey exports the public key of a signature device.
+func (c *Client) PublicKey(ctx context.Context, id string) (*api.PublicKeyResponse, error) {
+	var key *api.PublicKeyResponse
+	err := c.Call(ctx, Request{Operation: OperationGetPublicKey, Path: device(id)}, &key)
+	return key, err
+}
+
+// Sign signs data with a signature device.
+func (c *Client) Sign(ctx context.Context, request api.SignTransactionRequest) (*Signature, error) {
+	var signature *Signature
+	if err := c.Call(ctx, Request{Operation: OperationSignTransaction, Body: request}, &signature); err != nil {
+		return nil, err
+	}
+	return signature, c.verifyReturned(ctx, request.DeviceId, signature)
+}
+
+// SignBytes signs raw data with a signature device, sent as is instead of encoded
+// in a SignTransactionRequest.
+func (c *Client) SignBytes(ctx context.Context, deviceId string, data []byte) (*Signature, error) {
+	var signature *Signature
+	request := Request{
+		Operation:   OperationSignTransaction,
+		Query:       url.Values{"device_id": {deviceId}},
+		Body:        bytes.NewReader(data),
+		ContentType: "application/octet-stream",
+	}
+	if err := c.Call(ctx, request, &signature); err != nil {
+		return nil, err
+	}
+	return signature, c.verifyReturned(ctx, deviceId, signature)
+}
+
+// ListDeviceTransactions lists the transactions signed by a signature device,
+// ordered by signature counter.
+func (c *Client) ListDeviceTransactions(ctx context.Context, id string) ([]*domain.Transaction, error) {
+	var transactions []*domain.Transaction
+	err := c.Call(ctx, Request{Operation: OperationListTransactions, Path: device(id)}, &transactions)
+	return transactions, err
+}
+
+// DeviceTransactions iterates over the transactions signed by a signature device
+// page by page.
+func (c *Client) DeviceTransactions(ctx context.Context, id string) *Iterator[*domain.Transaction] {
+	return iterate[*domain.Transaction](ctx, c, Request{Operation: OperationListTransactions, Path: device(id)})
+}
+
+// VerifyDevice has the service verify the signature log of a device.
+func (c *Client) VerifyDevice(ctx context.Context, id string) (*verify.Report, error) {
+	var report *verify.Report
+	err := c.Call(ctx, Request{Operation: OperationVerifyDevice, Path: device(id)}, &report)
+	return report, err
+}
+
+// ExportDevice returns the export of a device, a TAR archive the caller must close.
+// Zero times leave the range of the signing times open.
+func (c *Client) ExportDevice(ctx context.Context, id string, from, to time.Time) (io.ReadCloser, error) {
+	query := url.Values{}
+	if !from.IsZero() {
+		query.Set("from", from.Format(time.RFC3339Nano))
+	}
+	if !to.IsZero() {
+		query.Set("to", to.Format(time.RFC3339Nano))
+	}
+	response, err := c.Open(ctx, Request{Operation: OperationExportDevice, Path: device(id), Query: query})
+	if err != nil {
+		return nil, err
+	}
+	return response.Body, nil
+}
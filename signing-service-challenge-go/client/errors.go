@@ -0,0 +1,53 @@
+package client
+
+import (
+	"errors"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+)
+
+// The errors of the service by code, to be matched with errors.Is:
+//
+//	if errors.Is(err, client.ErrDeviceSuspended) { ... }
+var (
+	ErrInvalidPayload               = &Error{Code: api.CodeInvalidPayload}
+	ErrPayloadTooLarge              = &Error{Code: api.CodePayloadTooLarge}
+	ErrValidationFailed             = &Error{Code: api.CodeValidationFailed}
+	ErrNotFound                     = &Error{Code: api.CodeNotFound}
+	ErrMethodNotAllowed             = &Error{Code: api.CodeMethodNotAllowed}
+	ErrRateLimited                  = &Error{Code: api.CodeRateLimited}
+	ErrShuttingDown                 = &Error{Code: api.CodeShuttingDown}
+	ErrIdempotencyKeyReused         = &Error{Code: api.CodeIdempotencyKeyReused}
+	ErrIdempotencyKeyInUse          = &Error{Code: api.CodeIdempotencyKeyInUse}
+	ErrInternal                     = &Error{Code: api.CodeInternal}
+	ErrUnauthenticated              = &Error{Code: api.CodeUnauthenticated}
+	ErrForbidden                    = &Error{Code: api.CodeForbidden}
+	ErrDeviceNotFound               = &Error{Code: api.CodeDeviceNotFound}
+	ErrUnsupportedAlgorithm         = &Error{Code: api.CodeUnsupportedAlgorithm}
+	ErrUnsupportedSecuredDataFormat = &Error{Code: api.CodeUnsupportedSecuredDataFormat}
+	ErrDeviceSuspended              = &Error{Code: api.CodeDeviceSuspended}
+	ErrAmbiguousData                = &Error{Code: api.CodeAmbiguousData}
+	ErrInvalidDigest                = &Error{Code: api.CodeInvalidDigest}
+	ErrDeviceRotated                = &Error{Code: api.CodeDeviceRotated}
+	ErrTransactionNotFound          = &Error{Code: api.CodeTransactionNotFound}
+	ErrTransactionClosed            = &Error{Code: api.CodeTransactionClosed}
+	ErrTransactionExpired           = &Error{Code: api.CodeTransactionExpired}
+	ErrAPIKeyNotFound               = &Error{Code: api.CodeAPIKeyNotFound}
+	ErrInvalidScope                 = &Error{Code: api.CodeInvalidScope}
+	ErrOrganizationNotFound         = &Error{Code: api.CodeOrganizationNotFound}
+	ErrWebhookNotFound              = &Error{Code: api.CodeWebhookNotFound}
+	ErrInvalidWebhook               = &Error{Code: api.CodeInvalidWebhook}
+	ErrInvalidEventType             = &Error{Code: api.CodeInvalidEventType}
+	ErrDeliveryNotFound             = &Error{Code: api.CodeDeliveryNotFound}
+	ErrDeviceLeaseLost              = &Error{Code: api.CodeDeviceLeaseLost}
+)
+
+// ErrInvalidSignature is returned for signatures that fail the verification of
+// the client.
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// Is reports whether target is an error of the same code, such as ErrDeviceNotFound.
+func (e *Error) Is(target error) bool {
+	other, ok := target.(*Error)
+	return ok && other.Code != "" && other.Code == e.Code
+}
@@ -0,0 +1,111 @@
+// Command gen generates the operation table of the client from the OpenAPI
+// document of the server, so that the client follows every route change:
+//
+//	go generate ./client
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+func main() {
+	output := flag.String("o", "operations.go", "file to write")
+	flag.Parse()
+
+	source, err := generate(spec())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Cannot generate the operations:", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(*output, source, 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, "Cannot write the operations:", err)
+		os.Exit(1)
+	}
+}
+
+// spec returns the OpenAPI document of the server.
+func spec() *api.OpenAPI {
+	return api.NewServer("", persistence.NewMockRepository()).OpenAPI()
+}
+
+// generated describes an operation of the document.
+type generated struct {
+	id      string
+	method  string
+	path    string
+	summary string
+}
+
+// generate returns the formatted source of the operation table of spec.
+func generate(spec *api.OpenAPI) ([]byte, error) {
+	if len(spec.Servers) != 1 {
+		return nil, fmt.Errorf("expected a single server, got %d", len(spec.Servers))
+	}
+
+	var operations []generated
+	for path, item := range spec.Paths {
+		for method, operation := range item {
+			operations = append(operations, generated{
+				id:      operation.OperationId,
+				method:  strings.ToUpper(method),
+				path:    path,
+				summary: operation.Summary,
+			})
+		}
+	}
+	sort.Slice(operations, func(i, j int) bool { return operations[i].id < operations[j].id })
+
+	var source bytes.Buffer
+	fmt.Fprintf(&source, "// Code generated by go run ./internal/gen; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&source, "package client\n\n")
+	fmt.Fprintf(&source, "import \"net/http\"\n\n")
+	fmt.Fprintf(&source, "// basePath prefixes the paths of all operations.\n")
+	fmt.Fprintf(&source, "const basePath = %q\n\n", spec.Servers[0].Url)
+	fmt.Fprintf(&source, "// Ids of the operations of the API.\nconst (\n")
+	for _, operation := range operations {
+		fmt.Fprintf(&source, "\t// %s %s\n", goName(operation.id), sentence(operation.summary))
+		fmt.Fprintf(&source, "\t%s = %q\n", goName(operation.id), operation.id)
+	}
+	fmt.Fprintf(&source, ")\n\n")
+	fmt.Fprintf(&source, "// operations maps the ids of the operations to their routes.\n")
+	fmt.Fprintf(&source, "var operations = map[string]operation{\n")
+	for _, operation := range operations {
+		fmt.Fprintf(&source, "\t%s: {method: %s, path: %q},\n", goName(operation.id), methodConstant(operation.method), operation.path)
+	}
+	fmt.Fprintf(&source, "}\n")
+
+	return format.Source(source.Bytes())
+}
+
+// goName names the constant of an operation id.
+func goName(id string) string {
+	return "Operation" + strings.ToUpper(id[:1]) + id[1:]
+}
+
+// sentence continues a comment with summary.
+func sentence(summary string) string {
+	if len(summary) > 1 && strings.ToUpper(summary[1:2]) == summary[1:2] {
+		return summary
+	}
+	return strings.ToLower(summary[:1]) + summary[1:]
+}
+
+// methodConstant names the net/http constant of method.
+func methodConstant(method string) string {
+	for _, known := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		if method == known {
+			return "http.Method" + known[:1] + strings.ToLower(known[1:])
+		}
+	}
+	return fmt.Sprintf("%q", method)
+}
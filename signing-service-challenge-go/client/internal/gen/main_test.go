@@ -0,0 +1,21 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestOperationsAreCurrent(t *testing.T) {
+	expected, err := generate(spec())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	actual, err := os.ReadFile("../../operations.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("Expected client/operations.go to match the OpenAPI document, run go generate ./client")
+	}
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// Iterator iterates over a list of the service, fetching it page by page:
+//
+//	devices := c.Devices(ctx)
+//	for devices.Next() {
+//		device := devices.Value()
+//	}
+//	if err := devices.Err(); err != nil { ... }
+type Iterator[T any] struct {
+	ctx context.Context
+	// fetch fetches the page after cursor and returns the cursor of the next page,
+	// empty on the last page.
+	fetch   func(ctx context.Context, cursor string) ([]T, string, error)
+	items   []T
+	cursor  string
+	last    bool
+	current T
+	err     error
+}
+
+// Next advances to the next item and reports whether there is one. It returns
+// false at the end of the list and when a page cannot be fetched, which Err reports.
+func (it *Iterator[T]) Next() bool {
+	for len(it.items) == 0 {
+		if it.last || it.err != nil {
+			return false
+		}
+		it.items, it.cursor, it.err = it.fetch(it.ctx, it.cursor)
+		if it.err != nil {
+			return false
+		}
+		it.last = it.cursor == ""
+	}
+	it.current, it.items = it.items[0], it.items[1:]
+	return true
+}
+
+// Value returns the item Next advanced to.
+func (it *Iterator[T]) Value() T {
+	return it.current
+}
+
+// Err returns the error that ended the iteration, if any.
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
+
+// iterate returns an Iterator over the pages of a list operation.
+func iterate[T any](ctx context.Context, c *Client, request Request) *Iterator[T] {
+	return &Iterator[T]{
+		ctx: ctx,
+		fetch: func(ctx context.Context, cursor string) ([]T, string, error) {
+			query := url.Values{"limit": {strconv.Itoa(c.pageSize)}}
+			for name, values := range request.Query {
+				query[name] = values
+			}
+			if cursor != "" {
+				query.Set("cursor", cursor)
+			}
+			page := request
+			page.Query = query
+
+			var items []T
+			next, err := c.call(ctx, page, &items)
+			return items, next, err
+		},
+	}
+}
@@ -0,0 +1,29 @@
+package client
+
+import (
+	"context"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+// CreateAPIKey issues an API key. Its secret is only returned here.
+func (c *Client) CreateAPIKey(ctx context.Context, request api.CreateAPIKeyRequest) (*api.CreateAPIKeyResponse, error) {
+	var created *api.CreateAPIKeyResponse
+	err := c.Call(ctx, Request{Operation: OperationCreateAPIKey, Body: request}, &created)
+	return created, err
+}
+
+// ListAPIKeys lists all API keys without their secrets.
+func (c *Client) ListAPIKeys(ctx context.Context) ([]*domain.APIKey, error) {
+	var keys []*domain.APIKey
+	err := c.Call(ctx, Request{Operation: OperationListAPIKeys}, &keys)
+	return keys, err
+}
+
+// RevokeAPIKey revokes an API key.
+func (c *Client) RevokeAPIKey(ctx context.Context, id string) (*domain.APIKey, error) {
+	var revoked *domain.APIKey
+	err := c.Call(ctx, Request{Operation: OperationRevokeAPIKey, Path: map[string]string{"key_id": id}}, &revoked)
+	return revoked, err
+}
@@ -0,0 +1,109 @@
+// Code generated by go run ./internal/gen; DO NOT EDIT.
+
+package client
+
+import "net/http"
+
+// basePath prefixes the paths of all operations.
+const basePath = "/api/v0"
+
+// Ids of the operations of the API.
+const (
+	// OperationCreateAPIKey issues an API key acting on behalf of the caller's tenant, or of tenant_id for callers with the platform scope. The secret is only returned in this response.
+	OperationCreateAPIKey = "createAPIKey"
+	// OperationCreateOrganization creates an organization, i.e. a tenant with its own isolated devices.
+	OperationCreateOrganization = "createOrganization"
+	// OperationCreateSignatureDevice creates a signature device with a freshly generated key pair.
+	OperationCreateSignatureDevice = "createSignatureDevice"
+	// OperationCreateWebhook subscribes a URL to the events of the devices of the tenant. The secret that signs the deliveries is only returned in this response.
+	OperationCreateWebhook = "createWebhook"
+	// OperationDeleteWebhook deletes a webhook together with its pending and dead deliveries.
+	OperationDeleteWebhook = "deleteWebhook"
+	// OperationExportDevice exports the signature log of a signature device as a TAR archive with a signed manifest. from is inclusive, to exclusive.
+	OperationExportDevice = "exportDevice"
+	// OperationFinishTransaction signs the finish of an open transaction, which accepts no further steps.
+	OperationFinishTransaction = "finishTransaction"
+	// OperationGetFiscalTransaction retrieves a single transaction.
+	OperationGetFiscalTransaction = "getFiscalTransaction"
+	// OperationGetPublicKey exports the public key that verifies the signatures of a signature device.
+	OperationGetPublicKey = "getPublicKey"
+	// OperationGetSignatureDevice retrieves a single signature device.
+	OperationGetSignatureDevice = "getSignatureDevice"
+	// OperationGetWebhook retrieves a webhook.
+	OperationGetWebhook = "getWebhook"
+	// OperationHealth reports the health of the service and the result of every registered check.
+	OperationHealth = "health"
+	// OperationListAPIKeys lists the API keys of the caller's tenant, or of all tenants for callers with the platform scope, without their secrets.
+	OperationListAPIKeys = "listAPIKeys"
+	// OperationListFiscalTransactions lists the transactions of the tenant, e.g. the unfinished ones with state OPEN or EXPIRED.
+	OperationListFiscalTransactions = "listFiscalTransactions"
+	// OperationListOrganizations lists all organizations, ordered by id.
+	OperationListOrganizations = "listOrganizations"
+	// OperationListSignatureDevices lists all signature devices of the tenant, ordered by id.
+	OperationListSignatureDevices = "listSignatureDevices"
+	// OperationListTransactions lists the transactions signed by a signature device, including the API key that requested them.
+	OperationListTransactions = "listTransactions"
+	// OperationListWebhookDeliveries lists the deliveries of a webhook, e.g. the dead letters with state DEAD.
+	OperationListWebhookDeliveries = "listWebhookDeliveries"
+	// OperationListWebhooks lists the webhooks of the tenant without their secrets.
+	OperationListWebhooks = "listWebhooks"
+	// OperationLive reports whether the process is alive. It stays alive while draining.
+	OperationLive = "live"
+	// OperationOpenAPI serves this OpenAPI document.
+	OperationOpenAPI = "openAPI"
+	// OperationQuotas reports the remaining rate limit tokens of the tenant, the API key and every device of the tenant.
+	OperationQuotas = "quotas"
+	// OperationReady reports whether the service accepts requests. It is not ready while draining or if a check fails.
+	OperationReady = "ready"
+	// OperationRetryWebhookDelivery attempts a delivery again with a fresh budget of attempts, e.g. a dead letter once the webhook is fixed.
+	OperationRetryWebhookDelivery = "retryWebhookDelivery"
+	// OperationRevokeAPIKey revokes an API key of the caller's tenant, or of any tenant for callers with the platform scope.
+	OperationRevokeAPIKey = "revokeAPIKey"
+	// OperationRotateSignatureDevice rotates the key of a signature device: creates its successor with a fresh key pair and suspends the device.
+	OperationRotateSignatureDevice = "rotateSignatureDevice"
+	// OperationSignTransaction signs transaction data with a signature device.
+	OperationSignTransaction = "signTransaction"
+	// OperationStartTransaction starts a transaction on a signature device, signing its start. Requires secured data format v2 or later.
+	OperationStartTransaction = "startTransaction"
+	// OperationSuspendSignatureDevice suspends a signature device, which then refuses to sign transactions. Suspending is idempotent.
+	OperationSuspendSignatureDevice = "suspendSignatureDevice"
+	// OperationUpdateTransaction signs an update of an open transaction, which restarts its timeout.
+	OperationUpdateTransaction = "updateTransaction"
+	// OperationVerifyDevice verifies every signature and chain link of the signature log of a signature device, as cmd/verify does for exports.
+	OperationVerifyDevice = "verifyDevice"
+)
+
+// operations maps the ids of the operations to their routes.
+var operations = map[string]operation{
+	OperationCreateAPIKey:           {method: http.MethodPost, path: "/admin/keys"},
+	OperationCreateOrganization:     {method: http.MethodPost, path: "/admin/organizations"},
+	OperationCreateSignatureDevice:  {method: http.MethodPost, path: "/devices"},
+	OperationCreateWebhook:          {method: http.MethodPost, path: "/webhooks"},
+	OperationDeleteWebhook:          {method: http.MethodDelete, path: "/webhooks/{webhook_id}"},
+	OperationExportDevice:           {method: http.MethodGet, path: "/devices/{device_id}/export"},
+	OperationFinishTransaction:      {method: http.MethodPost, path: "/transactions/{transaction_id}/finish"},
+	OperationGetFiscalTransaction:   {method: http.MethodGet, path: "/transactions/{transaction_id}"},
+	OperationGetPublicKey:           {method: http.MethodGet, path: "/devices/{device_id}/public-key"},
+	OperationGetSignatureDevice:     {method: http.MethodGet, path: "/devices/{device_id}"},
+	OperationGetWebhook:             {method: http.MethodGet, path: "/webhooks/{webhook_id}"},
+	OperationHealth:                 {method: http.MethodGet, path: "/health"},
+	OperationListAPIKeys:            {method: http.MethodGet, path: "/admin/keys"},
+	OperationListFiscalTransactions: {method: http.MethodGet, path: "/transactions"},
+	OperationListOrganizations:      {method: http.MethodGet, path: "/admin/organizations"},
+	OperationListSignatureDevices:   {method: http.MethodGet, path: "/devices"},
+	OperationListTransactions:       {method: http.MethodGet, path: "/devices/{device_id}/transactions"},
+	OperationListWebhookDeliveries:  {method: http.MethodGet, path: "/webhooks/{webhook_id}/deliveries"},
+	OperationListWebhooks:           {method: http.MethodGet, path: "/webhooks"},
+	OperationLive:                   {method: http.MethodGet, path: "/health/live"},
+	OperationOpenAPI:                {method: http.MethodGet, path: "/openapi.json"},
+	OperationQuotas:                 {method: http.MethodGet, path: "/quotas"},
+	OperationReady:                  {method: http.MethodGet, path: "/health/ready"},
+	OperationRetryWebhookDelivery:   {method: http.MethodPost, path: "/webhooks/{webhook_id}/deliveries/{delivery_id}/retry"},
+	OperationRevokeAPIKey:           {method: http.MethodDelete, path: "/admin/keys/{key_id}"},
+	OperationRotateSignatureDevice:  {method: http.MethodPost, path: "/devices/{device_id}/rotate"},
+	OperationSignTransaction:        {method: http.MethodPost, path: "/transactions/sign"},
+	OperationStartTransaction:       {method: http.MethodPost, path: "/transactions"},
+	OperationSuspendSignatureDevice: {method: http.MethodPost, path: "/devices/{device_id}/suspend"},
+	OperationUpdateTransaction:      {method: http.MethodPost, path: "/transactions/{transaction_id}/update"},
+	OperationVerifyDevice:           {method: http.MethodGet, path: "/devices/{device_id}/verify"},
+}
@@ -0,0 +1,27 @@
+package client
+
+import (
+	"context"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+// CreateOrganization creates an organization, a tenant with its own devices.
+func (c *Client) CreateOrganization(ctx context.Context, request api.CreateOrganizationRequest) (*domain.Organization, error) {
+	var created *domain.Organization
+	err := c.Call(ctx, Request{Operation: OperationCreateOrganization, Body: request}, &created)
+	return created, err
+}
+
+// ListOrganizations lists all organizations.
+func (c *Client) ListOrganizations(ctx context.Context) ([]*domain.Organization, error) {
+	var organizations []*domain.Organization
+	err := c.Call(ctx, Request{Operation: OperationListOrganizations}, &organizations)
+	return organizations, err
+}
+
+// Organizations iterates over the organizations page by page.
+func (c *Client) Organizations(ctx context.Context) *Iterator[*domain.Organization] {
+	return iterate[*domain.Organization](ctx, c, Request{Operation: OperationListOrganizations})
+}
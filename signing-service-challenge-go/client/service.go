@@ -0,0 +1,73 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/health"
+)
+
+// Health reports the health of the service with the results of its checks. A
+// failing service is reported by the status of the result, not as an error.
+func (c *Client) Health(ctx context.Context) (*health.Response, error) {
+	return c.health(ctx, OperationHealth)
+}
+
+// Live reports whether the process of the service is alive.
+func (c *Client) Live(ctx context.Context) (*health.Response, error) {
+	return c.health(ctx, OperationLive)
+}
+
+// Ready reports whether the service accepts requests.
+func (c *Client) Ready(ctx context.Context) (*health.Response, error) {
+	return c.health(ctx, OperationReady)
+}
+
+// health calls a health operation once, since a failing result is an answer and
+// not a problem to retry.
+func (c *Client) health(ctx context.Context, id string) (*health.Response, error) {
+	httpRequest, err := c.newRequest(ctx, operations[id], Request{Operation: id}, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	response, err := c.httpClient.Do(httpRequest)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusServiceUnavailable {
+		return nil, readError(response)
+	}
+	var result *health.Response
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decoding the response of %s: %w", id, err)
+	}
+	return result, nil
+}
+
+// Quotas reports the remaining rate limit tokens of the tenant, the API key and
+// the devices of the tenant.
+func (c *Client) Quotas(ctx context.Context) (*api.QuotasResponse, error) {
+	var quotas *api.QuotasResponse
+	err := c.Call(ctx, Request{Operation: OperationQuotas}, &quotas)
+	return quotas, err
+}
+
+// OpenAPI retrieves the OpenAPI document of the service.
+func (c *Client) OpenAPI(ctx context.Context) (*api.OpenAPI, error) {
+	response, err := c.Open(ctx, Request{Operation: OperationOpenAPI})
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var document *api.OpenAPI
+	if err := json.NewDecoder(response.Body).Decode(&document); err != nil {
+		return nil, fmt.Errorf("decoding the response of %s: %w", OperationOpenAPI, err)
+	}
+	return document, nil
+}
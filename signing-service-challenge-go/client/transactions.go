@@ -0,0 +1,66 @@
+package client
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+// TransactionStep is a transaction after a step and the signature of the step.
+type TransactionStep struct {
+	Transaction *domain.FiscalTransaction `json:"transaction"`
+	Signature   *Signature                `json:"signature"`
+}
+
+// transaction returns the path parameters naming a transaction.
+func transaction(id string) map[string]string {
+	return map[string]string{"transaction_id": id}
+}
+
+// step calls the operation of a step of a transaction.
+func (c *Client) step(ctx context.Context, request Request) (*TransactionStep, error) {
+	var step *TransactionStep
+	if err := c.Call(ctx, request, &step); err != nil {
+		return nil, err
+	}
+	return step, c.verifyReturned(ctx, step.Transaction.DeviceId, step.Signature)
+}
+
+// StartTransaction starts a transaction on a signature device, signing its start.
+func (c *Client) StartTransaction(ctx context.Context, request api.SignTransactionRequest) (*TransactionStep, error) {
+	return c.step(ctx, Request{Operation: OperationStartTransaction, Body: request})
+}
+
+// UpdateTransaction signs an update of an open transaction.
+func (c *Client) UpdateTransaction(ctx context.Context, id string, request api.TransactionStepRequest) (*TransactionStep, error) {
+	return c.step(ctx, Request{Operation: OperationUpdateTransaction, Path: transaction(id), Body: request})
+}
+
+// FinishTransaction signs the finish of an open transaction.
+func (c *Client) FinishTransaction(ctx context.Context, id string, request api.TransactionStepRequest) (*TransactionStep, error) {
+	return c.step(ctx, Request{Operation: OperationFinishTransaction, Path: transaction(id), Body: request})
+}
+
+// GetTransaction retrieves a transaction.
+func (c *Client) GetTransaction(ctx context.Context, id string) (*domain.FiscalTransaction, error) {
+	var found *domain.FiscalTransaction
+	err := c.Call(ctx, Request{Operation: OperationGetFiscalTransaction, Path: transaction(id)}, &found)
+	return found, err
+}
+
+// ListTransactions lists the transactions of the tenant, ordered by start. An
+// empty state or deviceId does not filter.
+func (c *Client) ListTransactions(ctx context.Context, state domain.FiscalTransactionState, deviceId string) ([]*domain.FiscalTransaction, error) {
+	query := url.Values{}
+	if state != "" {
+		query.Set("state", string(state))
+	}
+	if deviceId != "" {
+		query.Set("device_id", deviceId)
+	}
+	var transactions []*domain.FiscalTransaction
+	err := c.Call(ctx, Request{Operation: OperationListFiscalTransactions, Query: query}, &transactions)
+	return transactions, err
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/verify"
+)
+
+// WithVerification verifies every signature the service returns against the
+// public key of its device before returning it, so that a compromised or faulty
+// service cannot hand out invalid signatures unnoticed. The public key of every
+// device is fetched once.
+func WithVerification() Option {
+	return func(c *Client) {
+		c.verify = true
+	}
+}
+
+// verifyReturned verifies a signature returned by the service if the client was
+// created WithVerification.
+func (c *Client) verifyReturned(ctx context.Context, deviceId string, signature *Signature) error {
+	if !c.verify {
+		return nil
+	}
+	return c.VerifySignature(ctx, deviceId, signature)
+}
+
+// VerifySignature verifies a signature of the device deviceId against the public
+// key of the device. Its secured data must be canonical and name the device; the
+// link to the previous signature is left to VerifyDevice. Signatures that do not
+// verify are reported as ErrInvalidSignature.
+func (c *Client) VerifySignature(ctx context.Context, deviceId string, signature *Signature) error {
+	key, err := c.publicKey(ctx, deviceId)
+	if err != nil {
+		return err
+	}
+
+	transaction := &domain.Transaction{
+		DeviceId:          deviceId,
+		Signature:         signature.Signature,
+		SignedData:        signature.SignedData,
+		SecuredDataFormat: signature.SecuredDataFormat,
+		DataEncoding:      signature.DataEncoding,
+		CreatedAt:         signature.SignedAt,
+	}
+	secured, err := domain.ParseSecuredData(transaction)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	// The counter and the step are only known from the secured data, which the
+	// signature covers.
+	transaction.Counter, transaction.Operation = secured.Counter, secured.Operation
+
+	verifier := verify.NewVerifier(deviceId, key)
+	verifier.Add(transaction)
+	if report := verifier.Report(); !report.Valid {
+		return fmt.Errorf("%w: %s", ErrInvalidSignature, report.Failures[0].Reason)
+	}
+	return nil
+}
+
+// publicKey returns the public key of a device, fetching it on first use.
+func (c *Client) publicKey(ctx context.Context, deviceId string) (crypto.PublicKey, error) {
+	if key, ok := c.publicKeys.Load(deviceId); ok {
+		return key, nil
+	}
+
+	exported, err := c.PublicKey(ctx, deviceId)
+	if err != nil {
+		return nil, err
+	}
+	key, err := verify.ParsePublicKey([]byte(exported.PublicKey))
+	if err != nil {
+		return nil, fmt.Errorf("public key of device %s: %w", deviceId, err)
+	}
+	c.publicKeys.Store(deviceId, key)
+	return key, nil
+}
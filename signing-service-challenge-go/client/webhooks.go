@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+// webhook returns the path parameters naming a webhook.
+func webhook(id string) map[string]string {
+	return map[string]string{"webhook_id": id}
+}
+
+// CreateWebhook subscribes a URL to the events of the tenant. The response
+// carries the secret that signs the deliveries, which is not returned again.
+func (c *Client) CreateWebhook(ctx context.Context, request api.CreateWebhookRequest) (*api.CreateWebhookResponse, error) {
+	var created *api.CreateWebhookResponse
+	err := c.Call(ctx, Request{Operation: OperationCreateWebhook, Body: request}, &created)
+	return created, err
+}
+
+// ListWebhooks lists the webhooks of the tenant.
+func (c *Client) ListWebhooks(ctx context.Context) ([]*domain.Webhook, error) {
+	var webhooks []*domain.Webhook
+	err := c.Call(ctx, Request{Operation: OperationListWebhooks}, &webhooks)
+	return webhooks, err
+}
+
+// GetWebhook retrieves a webhook.
+func (c *Client) GetWebhook(ctx context.Context, id string) (*domain.Webhook, error) {
+	var found *domain.Webhook
+	err := c.Call(ctx, Request{Operation: OperationGetWebhook, Path: webhook(id)}, &found)
+	return found, err
+}
+
+// DeleteWebhook deletes a webhook together with its deliveries.
+func (c *Client) DeleteWebhook(ctx context.Context, id string) (*domain.Webhook, error) {
+	var deleted *domain.Webhook
+	err := c.Call(ctx, Request{Operation: OperationDeleteWebhook, Path: webhook(id)}, &deleted)
+	return deleted, err
+}
+
+// WebhookDeliveries iterates over the deliveries of a webhook page by page. An
+// empty state does not filter; DEAD lists the dead letters.
+func (c *Client) WebhookDeliveries(ctx context.Context, id string, state domain.DeliveryState) *Iterator[*domain.WebhookDelivery] {
+	query := url.Values{}
+	if state != "" {
+		query.Set("state", string(state))
+	}
+	return iterate[*domain.WebhookDelivery](ctx, c, Request{Operation: OperationListWebhookDeliveries, Path: webhook(id), Query: query})
+}
+
+// RetryWebhookDelivery attempts a delivery of a webhook again with a fresh
+// budget of attempts.
+func (c *Client) RetryWebhookDelivery(ctx context.Context, webhookId, deliveryId string) (*domain.WebhookDelivery, error) {
+	var retried *domain.WebhookDelivery
+	err := c.Call(ctx, Request{
+		Operation: OperationRetryWebhookDelivery,
+		Path:      map[string]string{"webhook_id": webhookId, "delivery_id": deliveryId},
+	}, &retried)
+	return retried, err
+}
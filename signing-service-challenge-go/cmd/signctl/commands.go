@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/verify"
+)
+
+// errInvalid reports a signature log that failed verification. The report has
+// been printed.
+var errInvalid = errors.New("verification failed")
+
+var commands = []command{
+	{"devices create", "-algorithm ECC|RSA -label <label> [-format v1|v2|v3]", "Creates a signature device.", createDevice},
+	{"devices list", "", "Lists the signature devices.", listDevices},
+	{"devices get", "<device_id>", "Shows a signature device.", getDevice},
+	{"devices suspend", "<device_id>", "Suspends a signature device.", suspendDevice},
+	{"devices rotate", "<device_id>", "Rotates the key of a signature device and shows its successor.", rotateDevice},
+	{"devices public-key", "<device_id>", "Shows the public key of a signature device.", publicKey},
+	{"sign", "-device <device_id> [-encoding base64|hex] [-digest sha256] <data> | -file <path>", "Signs data with a signature device.", sign},
+	{"verify", "<device_id>", "Verifies the signature log of a signature device; exits with 1 if it is invalid.", verifyDevice},
+	{"export", "[-from <time>] [-to <time>] [-o <file>] <device_id>", "Exports the signature log of a signature device as a TAR archive.", exportDevice},
+	{"keys create", "-name <name> -scopes <scope,...> [-tenant <tenant_id>]", "Issues an API key and shows its secret, which is not shown again.", createAPIKey},
+	{"keys list", "", "Lists the API keys.", listAPIKeys},
+	{"keys revoke", "<key_id>", "Revokes an API key.", revokeAPIKey},
+}
+
+// parse parses the flags of a command and returns its arguments, of which it
+// expects count.
+func parse(flags *flag.FlagSet, args []string, count int) ([]string, error) {
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		return nil, errUsage
+	}
+	if flags.NArg() != count {
+		flags.Usage()
+		return nil, errUsage
+	}
+	return flags.Args(), nil
+}
+
+// devicesTable shows devices as a table.
+func devicesTable(devices ...*domain.SignatureDevice) table {
+	view := table{header: []string{"ID", "ALGORITHM", "LABEL", "STATUS", "FORMAT", "COUNTER", "SUCCESSOR"}}
+	for _, device := range devices {
+		view.rows = append(view.rows, []string{
+			device.Id,
+			device.Algorithm,
+			orDash(device.Label),
+			string(device.Status),
+			string(device.SecuredDataFormat),
+			strconv.Itoa(device.SignatureCounter),
+			orDash(device.SuccessorId),
+		})
+	}
+	return view
+}
+
+func createDevice(ctx context.Context, env *environment, flags *flag.FlagSet, args []string) error {
+	algorithm := flags.String("algorithm", "", "key algorithm: ECC or RSA")
+	label := flags.String("label", "", "label of the device")
+	format := flags.String("format", "", "secured data format; defaults to the format of the service")
+	if _, err := parse(flags, args, 0); err != nil {
+		return err
+	}
+	if *algorithm == "" {
+		flags.Usage()
+		return errUsage
+	}
+
+	device, err := env.client.CreateDevice(ctx, api.CreateSignatureDeviceRequest{Algorithm: *algorithm, Label: *label, SecuredDataFormat: *format})
+	if err != nil {
+		return err
+	}
+	return env.print(device, devicesTable(device))
+}
+
+func listDevices(ctx context.Context, env *environment, flags *flag.FlagSet, args []string) error {
+	if _, err := parse(flags, args, 0); err != nil {
+		return err
+	}
+	devices, err := env.client.ListDevices(ctx)
+	if err != nil {
+		return err
+	}
+	return env.print(devices, devicesTable(devices...))
+}
+
+func getDevice(ctx context.Context, env *environment, flags *flag.FlagSet, args []string) error {
+	args, err := parse(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	device, err := env.client.GetDevice(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	return env.print(device, devicesTable(device))
+}
+
+func suspendDevice(ctx context.Context, env *environment, flags *flag.FlagSet, args []string) error {
+	args, err := parse(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	device, err := env.client.SuspendDevice(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	return env.print(device, devicesTable(device))
+}
+
+func rotateDevice(ctx context.Context, env *environment, flags *flag.FlagSet, args []string) error {
+	args, err := parse(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	successor, err := env.client.RotateDevice(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	return env.print(successor, devicesTable(successor))
+}
+
+func publicKey(ctx context.Context, env *environment, flags *flag.FlagSet, args []string) error {
+	args, err := parse(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	key, err := env.client.PublicKey(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if env.output == outputTable {
+		// The PEM block is printed as is, ready to be passed to verify -key.
+		_, err := io.WriteString(env.stdout, key.PublicKey)
+		return err
+	}
+	return env.print(key, table{})
+}
+
+func sign(ctx context.Context, env *environment, flags *flag.FlagSet, args []string) error {
+	deviceId := flags.String("device", "", "id of the signature device")
+	encoding := flags.String("encoding", "", "encoding of the data: utf-8 (the default), base64 or hex")
+	digest := flags.String("digest", "", "sha256 if the data is a SHA-256 digest of a document")
+	file := flags.String("file", "", "sign the content of this file instead of data; - reads standard input")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	if *deviceId == "" || (*file == "") == (flags.NArg() == 0) || flags.NArg() > 1 {
+		flags.Usage()
+		return errUsage
+	}
+
+	request := api.SignTransactionRequest{DeviceId: *deviceId, Encoding: *encoding, Digest: *digest}
+	if *file != "" {
+		content, err := readFile(env, *file)
+		if err != nil {
+			return err
+		}
+		request.Data, request.Encoding = base64.StdEncoding.EncodeToString(content), api.EncodingBase64
+	} else {
+		request.Data = flags.Arg(0)
+	}
+
+	signature, err := env.client.Sign(ctx, request)
+	if err != nil {
+		return err
+	}
+	return env.print(signature, table{
+		header: []string{"FIELD", "VALUE"},
+		rows: [][]string{
+			{"signature", signature.Signature},
+			{"signed_data", signature.SignedData},
+			{"secured_data_format", string(signature.SecuredDataFormat)},
+			{"signed_at", signature.SignedAt.Format(time.RFC3339Nano)},
+		},
+	})
+}
+
+// readFile reads the file at path, or standard input if path is -.
+func readFile(env *environment, path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(env.stdin)
+	}
+	return os.ReadFile(path)
+}
+
+func verifyDevice(ctx context.Context, env *environment, flags *flag.FlagSet, args []string) error {
+	args, err := parse(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	report, err := env.client.VerifyDevice(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if err := env.print(report, reportTable(report)); err != nil {
+		return err
+	}
+	if !report.Valid {
+		return errInvalid
+	}
+	return nil
+}
+
+// reportTable shows a verification report as a table.
+func reportTable(report *verify.Report) table {
+	result := "VALID"
+	if !report.Valid {
+		result = fmt.Sprintf("INVALID, %d failures", len(report.Failures))
+	}
+	view := table{
+		header: []string{"FIELD", "VALUE"},
+		rows: [][]string{
+			{"device", report.DeviceId},
+			{"transactions", strconv.Itoa(report.Transactions)},
+			{"result", result},
+		},
+	}
+	for _, failure := range report.Failures {
+		view.rows = append(view.rows, []string{"failure", failure.String()})
+	}
+	return view
+}
+
+func exportDevice(ctx context.Context, env *environment, flags *flag.FlagSet, args []string) error {
+	from := flags.String("from", "", "export the transactions signed at or after this RFC 3339 time")
+	to := flags.String("to", "", "export the transactions signed before this RFC 3339 time")
+	output := flags.String("o", "", "file to write the archive to; defaults to standard output")
+	args, err := parse(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	var times [2]time.Time
+	for i, value := range []string{*from, *to} {
+		if value == "" {
+			continue
+		}
+		if times[i], err = time.Parse(time.RFC3339Nano, value); err != nil {
+			fmt.Fprintf(env.stderr, "Invalid time %q: %v\n", value, err)
+			return errUsage
+		}
+	}
+
+	archive, err := env.client.ExportDevice(ctx, args[0], times[0], times[1])
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	if *output == "" {
+		_, err = io.Copy(env.stdout, archive)
+		return err
+	}
+	file, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, archive); err != nil {
+		file.Close()
+		os.Remove(*output)
+		return err
+	}
+	return file.Close()
+}
+
+// keysTable shows API keys as a table.
+func keysTable(keys ...*domain.APIKey) table {
+	view := table{header: []string{"ID", "NAME", "TENANT", "SCOPES", "CREATED", "REVOKED"}}
+	for _, key := range keys {
+		scopes := make([]string, len(key.Scopes))
+		for i, scope := range key.Scopes {
+			scopes[i] = string(scope)
+		}
+		revoked := ""
+		if key.RevokedAt != nil {
+			revoked = key.RevokedAt.Format(time.RFC3339)
+		}
+		view.rows = append(view.rows, []string{
+			key.Id,
+			key.Name,
+			orDash(key.TenantId),
+			strings.Join(scopes, ","),
+			key.CreatedAt.Format(time.RFC3339),
+			orDash(revoked),
+		})
+	}
+	return view
+}
+
+func createAPIKey(ctx context.Context, env *environment, flags *flag.FlagSet, args []string) error {
+	name := flags.String("name", "", "name of the key")
+	scopes := flags.String("scopes", "", "comma separated scopes granted to the key")
+	tenant := flags.String("tenant", "", "tenant the key acts on behalf of")
+	if _, err := parse(flags, args, 0); err != nil {
+		return err
+	}
+	if *name == "" || *scopes == "" {
+		flags.Usage()
+		return errUsage
+	}
+	request := api.CreateAPIKeyRequest{TenantId: *tenant, Name: *name}
+	for _, scope := range strings.Split(*scopes, ",") {
+		request.Scopes = append(request.Scopes, domain.Scope(strings.TrimSpace(scope)))
+	}
+
+	issued, err := env.client.CreateAPIKey(ctx, request)
+	if err != nil {
+		return err
+	}
+	view := keysTable(issued.APIKey)
+	view.header = append(view.header, "KEY")
+	view.rows[0] = append(view.rows[0], issued.Key)
+	return env.print(issued, view)
+}
+
+func listAPIKeys(ctx context.Context, env *environment, flags *flag.FlagSet, args []string) error {
+	if _, err := parse(flags, args, 0); err != nil {
+		return err
+	}
+	keys, err := env.client.ListAPIKeys(ctx)
+	if err != nil {
+		return err
+	}
+	return env.print(keys, keysTable(keys...))
+}
+
+func revokeAPIKey(ctx context.Context, env *environment, flags *flag.FlagSet, args []string) error {
+	args, err := parse(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	key, err := env.client.RevokeAPIKey(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	return env.print(key, keysTable(key))
+}
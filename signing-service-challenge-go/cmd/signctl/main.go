@@ -0,0 +1,211 @@
+// Command signctl manages the devices and API keys of a signing service. It calls
+// the API through the client package, or in break-glass mode runs the API in-process
+// over the file store of a stopped service.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/audit"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/client"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/version"
+)
+
+const usage = `Usage:
+  signctl [flags] <command> [command flags] [arguments]
+
+Commands:
+%s
+Flags:
+`
+
+// Exit codes of the command.
+const (
+	exitOK     = 0
+	exitFailed = 1
+	exitUsage  = 2
+)
+
+// Environment variables overriding the profile.
+const (
+	envAPIKey  = "SIGNCTL_API_KEY"
+	envConfig  = "SIGNCTL_CONFIG"
+	envProfile = "SIGNCTL_PROFILE"
+)
+
+// localAuditFile is the audit log of break-glass changes in the directory of a
+// file store.
+const localAuditFile = "audit.log"
+
+// errUsage reports invalid arguments of a command, whose usage has been printed.
+var errUsage = errors.New("invalid usage")
+
+// environment is what commands run with.
+type environment struct {
+	client *client.Client
+	output string
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// command is a subcommand of signctl.
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(ctx context.Context, env *environment, flags *flag.FlagSet, args []string) error
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the command named by args and returns the exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("signctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, usage, commandList())
+		flags.PrintDefaults()
+	}
+	configFile := flags.String("config", "", "profile file; defaults to $"+envConfig+" or "+defaultProfileFile+" in the user config directory")
+	profileName := flags.String("profile", os.Getenv(envProfile), "profile to use; defaults to $"+envProfile+" or the default profile of the file")
+	url := flags.String("url", "", "base URL of the service, overriding the profile")
+	local := flags.String("local", "", "break-glass mode: operate on the file store in this directory instead of a service; the service must be stopped")
+	output := flags.String("output", "", "output format: table (the default), json or yaml")
+	showVersion := flags.Bool("version", false, "print the version and exit")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if *showVersion {
+		fmt.Fprintln(stdout, version.Release())
+		return exitOK
+	}
+
+	cmd, rest := findCommand(flags.Args())
+	if cmd == nil {
+		flags.Usage()
+		return exitUsage
+	}
+
+	profile, err := loadProfile(*configFile, *profileName)
+	if err != nil {
+		fmt.Fprintln(stderr, "Cannot read the profile:", err)
+		return exitUsage
+	}
+	profile.override(*url, *local, *output, os.Getenv(envAPIKey))
+	if !contains(outputFormats, profile.Output) {
+		fmt.Fprintf(stderr, "Unknown output format %q, expected one of %s\n", profile.Output, strings.Join(outputFormats, ", "))
+		return exitUsage
+	}
+	if profile.URL == "" && profile.Local == "" {
+		fmt.Fprintln(stderr, "No service configured: pass -url or -local, or configure a profile")
+		return exitUsage
+	}
+
+	env := &environment{output: profile.Output, stdin: stdin, stdout: stdout, stderr: stderr}
+	if profile.Local != "" {
+		closeLocal, err := env.openLocal(profile.Local)
+		if err != nil {
+			fmt.Fprintln(stderr, "Cannot open the local store:", err)
+			return exitFailed
+		}
+		defer closeLocal()
+	} else {
+		env.client = client.New(profile.URL, client.WithAPIKey(profile.APIKey))
+	}
+
+	commandFlags := flag.NewFlagSet("signctl "+cmd.name, flag.ContinueOnError)
+	commandFlags.SetOutput(stderr)
+	commandFlags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage:\n  signctl %s %s\n\n%s\n", cmd.name, cmd.args, cmd.summary)
+		commandFlags.PrintDefaults()
+	}
+	err = cmd.run(context.Background(), env, commandFlags, rest)
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.Is(err, errUsage):
+		return exitUsage
+	case errors.Is(err, errInvalid):
+		return exitFailed
+	}
+	fmt.Fprintln(stderr, "Error:", err)
+	return exitFailed
+}
+
+// openLocal serves the API in-process over the file store in dir, without
+// authentication. Changes are recorded in the audit log of the store. The returned
+// function closes the store.
+func (env *environment) openLocal(dir string) (func(), error) {
+	store, err := persistence.OpenFilePersistence(dir)
+	if errors.Is(err, persistence.ErrStoreLocked) {
+		return nil, fmt.Errorf("%w; stop the service or use its API", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	auditLog, closer, err := audit.Open(filepath.Join(dir, localAuditFile))
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	server := api.NewServer("", store, api.WithAuditLog(auditLog))
+	env.client = client.New("", client.WithHandler(server.Handler()))
+	return func() {
+		closer.Close()
+		store.Close()
+	}, nil
+}
+
+// findCommand returns the command named by the leading words of args and the
+// remaining arguments.
+func findCommand(args []string) (*command, []string) {
+	for words := 2; words >= 1; words-- {
+		if len(args) < words {
+			continue
+		}
+		name := strings.Join(args[:words], " ")
+		for i := range commands {
+			if commands[i].name == name {
+				return &commands[i], args[words:]
+			}
+		}
+	}
+	return nil, nil
+}
+
+// commandList describes every command for the usage.
+func commandList() string {
+	var list strings.Builder
+	sorted := append([]command(nil), commands...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].name < sorted[j].name })
+	for _, cmd := range sorted {
+		fmt.Fprintf(&list, "  %-16s %s\n", cmd.name, cmd.summary)
+	}
+	return list.String()
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+// signctl runs signctl with args and returns its exit code and output.
+func signctl(t *testing.T, args ...string) (int, string) {
+	t.Setenv(envConfig, filepath.Join(t.TempDir(), "missing.yaml"))
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(""), &stdout, &stderr)
+	if stderr.Len() > 0 {
+		t.Logf("signctl %s: %s", strings.Join(args, " "), stderr.String())
+	}
+	return code, stdout.String()
+}
+
+func TestLocalMode(t *testing.T) {
+	dir := t.TempDir()
+
+	code, output := signctl(t, "-local", dir, "-output", "json", "devices", "create", "-algorithm", "ECC", "-label", "Till")
+	if code != exitOK {
+		t.Fatalf("Expected exit code %d, got %d", exitOK, code)
+	}
+	var device struct{ Id string }
+	if err := json.Unmarshal([]byte(output), &device); err != nil || device.Id == "" {
+		t.Fatalf("Expected the created device, got %s: %v", output, err)
+	}
+
+	if code, _ := signctl(t, "-local", dir, "sign", "-device", device.Id, "receipt"); code != exitOK {
+		t.Errorf("Expected the data to be signed, got exit code %d", code)
+	}
+	code, output = signctl(t, "-local", dir, "verify", device.Id)
+	if code != exitOK || !strings.Contains(output, "VALID") {
+		t.Errorf("Expected a valid signature log, got %d: %s", code, output)
+	}
+
+	code, output = signctl(t, "-local", dir, "-output", "yaml", "devices", "rotate", device.Id)
+	var successor map[string]interface{}
+	if err := yaml.Unmarshal([]byte(output), &successor); code != exitOK || err != nil || successor["PredecessorId"] != device.Id {
+		t.Errorf("Expected the successor of %s, got %d: %s", device.Id, code, output)
+	}
+	code, output = signctl(t, "-local", dir, "devices", "list")
+	if code != exitOK || !strings.Contains(output, "SUSPENDED") || strings.Count(output, "\n") != 3 {
+		t.Errorf("Expected a table of both devices, got %d:\n%s", code, output)
+	}
+
+	archive := filepath.Join(t.TempDir(), "export.tar")
+	if code, _ := signctl(t, "-local", dir, "export", "-o", archive, device.Id); code != exitOK {
+		t.Errorf("Expected the device to be exported, got exit code %d", code)
+	}
+	if info, err := os.Stat(archive); err != nil || info.Size() == 0 {
+		t.Errorf("Expected an archive: %v", err)
+	}
+
+	code, output = signctl(t, "-local", dir, "keys", "create", "-name", "till", "-scopes", "sign,devices:read")
+	if code != exitOK || !strings.Contains(output, "sign,devices:read") {
+		t.Errorf("Expected the issued key, got %d: %s", code, output)
+	}
+
+	if audit, err := os.ReadFile(filepath.Join(dir, localAuditFile)); err != nil || !bytes.Contains(audit, []byte("device.rotated")) {
+		t.Errorf("Expected the changes in the audit log of the store: %v", err)
+	}
+}
+
+func TestLocalModeRequiresStoppedService(t *testing.T) {
+	dir := t.TempDir()
+	store, err := persistence.OpenFilePersistence(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	if code, _ := signctl(t, "-local", dir, "devices", "list"); code != exitFailed {
+		t.Errorf("Expected exit code %d, got %d", exitFailed, code)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte(`
+default: production
+profiles:
+  production:
+    url: https://signing.example.com
+    api_key: secret
+  break-glass:
+    local: /var/lib/signing-service
+    output: yaml
+`), 0o600)
+
+	profile, err := loadProfile(path, "")
+	if err != nil || profile.URL != "https://signing.example.com" || profile.APIKey != "secret" {
+		t.Errorf("Expected the default profile, got %+v: %v", profile, err)
+	}
+	profile, err = loadProfile(path, "break-glass")
+	if err != nil || profile.Local != "/var/lib/signing-service" || profile.Output != outputYAML {
+		t.Errorf("Expected the break-glass profile, got %+v: %v", profile, err)
+	}
+	if _, err := loadProfile(path, "staging"); err == nil {
+		t.Errorf("Expected an error for an unknown profile")
+	}
+
+	profile.override("https://localhost:8080", "", "", "")
+	if profile.URL != "https://localhost:8080" || profile.Local != "" {
+		t.Errorf("Expected -url to leave break-glass mode, got %+v", profile)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"devices"},
+		{"-url", "http://localhost", "devices", "get"},
+		{"-url", "http://localhost", "-output", "xml", "devices", "list"},
+		{"devices", "list"},
+	} {
+		if code, _ := signctl(t, args...); code != exitUsage {
+			t.Errorf("Expected exit code %d for %v, got %d", exitUsage, args, code)
+		}
+	}
+}
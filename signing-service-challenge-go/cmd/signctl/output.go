@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats.
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+var outputFormats = []string{outputTable, outputJSON, outputYAML}
+
+// table is the tabular view of a result.
+type table struct {
+	header []string
+	rows   [][]string
+}
+
+// print writes value in the output format of env, or view as a table.
+func (env *environment) print(value interface{}, view table) error {
+	switch env.output {
+	case outputJSON:
+		encoder := json.NewEncoder(env.stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	case outputYAML:
+		// The value takes the detour over JSON so that YAML shows the same field
+		// names as the API.
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		var generic interface{}
+		if err := json.Unmarshal(encoded, &generic); err != nil {
+			return err
+		}
+		encoder := yaml.NewEncoder(env.stdout)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(generic); err != nil {
+			return err
+		}
+		return encoder.Close()
+	}
+
+	writer := tabwriter.NewWriter(env.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, strings.Join(view.header, "\t"))
+	for _, row := range view.rows {
+		fmt.Fprintln(writer, strings.Join(row, "\t"))
+	}
+	return writer.Flush()
+}
+
+// orDash shows empty cells of a table as a dash.
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultProfileFile is the profile file in the user config directory.
+const defaultProfileFile = "signctl/config.yaml"
+
+// Profile says which service signctl manages and how.
+type Profile struct {
+	// URL is the base URL of the service.
+	URL    string `yaml:"url"`
+	APIKey string `yaml:"api_key"`
+	// Local is the directory of a file store to operate on in break-glass mode.
+	Local  string `yaml:"local"`
+	Output string `yaml:"output"`
+}
+
+// profileFile is the content of a profile file:
+//
+//	default: production
+//	profiles:
+//	  production:
+//	    url: https://signing.example.com
+//	    api_key: ...
+//	  break-glass:
+//	    local: /var/lib/signing-service
+type profileFile struct {
+	Default  string             `yaml:"default"`
+	Profiles map[string]Profile `yaml:"profiles"`
+}
+
+// loadProfile reads the profile name, or the default profile if name is empty,
+// from path. A missing file yields an empty profile unless path or name is given
+// explicitly.
+func loadProfile(path, name string) (Profile, error) {
+	explicit := path != "" || name != ""
+	if path == "" {
+		path = os.Getenv(envConfig)
+	}
+	if path == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return Profile{}, nil
+		}
+		path = filepath.Join(dir, defaultProfileFile)
+	}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return Profile{}, nil
+	}
+	if err != nil {
+		return Profile{}, err
+	}
+	var file profileFile
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return Profile{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if name == "" {
+		name = file.Default
+	}
+	if name == "" && len(file.Profiles) == 0 {
+		return Profile{}, nil
+	}
+	profile, ok := file.Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("%s: no profile %q", path, name)
+	}
+	return profile, nil
+}
+
+// override replaces the settings of the profile by the non-empty arguments. A URL
+// leaves break-glass mode and a local store leaves the service.
+func (p *Profile) override(url, local, output, apiKey string) {
+	if url != "" {
+		p.URL, p.Local = url, ""
+	}
+	if local != "" {
+		p.URL, p.Local = "", local
+	}
+	if output != "" {
+		p.Output = output
+	}
+	if p.Output == "" {
+		p.Output = outputTable
+	}
+	if apiKey != "" {
+		p.APIKey = apiKey
+	}
+}
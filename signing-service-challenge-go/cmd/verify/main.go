@@ -0,0 +1,161 @@
+// Command verify checks the evidence of a signature device without access to the
+// signing service: a device export or a stream of transactions, against the public
+// key or certificate of the device.
+package main
+
+import (
+	"bufio"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/verify"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/version"
+)
+
+const usage = `Usage:
+  verify [flags] <export.tar | transactions.jsonl | ->
+
+Verifies every signature and chain link of the signature log of a device. The input
+is a device export, or transactions as JSON lines, a JSON array or the response of
+GET /devices/{device_id}/transactions. - reads standard input.
+
+Exit codes:
+  0  every check passed
+  1  a check failed
+  2  the input or the flags are invalid
+
+Flags:
+`
+
+// Exit codes of the command.
+const (
+	exitValid   = 0
+	exitInvalid = 1
+	exitUsage   = 2
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run verifies the input named by args and returns the exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	keyFile := flags.String("key", "", "PEM encoded public key or certificate of the device; required for transactions, exports fall back to their own key")
+	deviceId := flags.String("device", "", "id of the device; defaults to the device of the export or the first transaction")
+	output := flags.String("output", "text", "format of the report: text or json")
+	showVersion := flags.Bool("version", false, "print the version and exit")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitValid
+		}
+		return exitUsage
+	}
+	if *showVersion {
+		fmt.Fprintln(stdout, version.Release())
+		return exitValid
+	}
+	if flags.NArg() != 1 || (*output != "text" && *output != "json") {
+		flags.Usage()
+		return exitUsage
+	}
+
+	var key crypto.PublicKey
+	if *keyFile != "" {
+		content, err := os.ReadFile(*keyFile)
+		if err != nil {
+			fmt.Fprintln(stderr, "Cannot read the key:", err)
+			return exitUsage
+		}
+		if key, err = verify.ParsePublicKey(content); err != nil {
+			fmt.Fprintf(stderr, "Cannot read the key %s: %v\n", *keyFile, err)
+			return exitUsage
+		}
+	}
+
+	input := stdin
+	if name := flags.Arg(0); name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintln(stderr, "Cannot read the input:", err)
+			return exitUsage
+		}
+		defer file.Close()
+		input = file
+	}
+
+	report, err := check(bufio.NewReader(input), *deviceId, key)
+	if err != nil {
+		fmt.Fprintln(stderr, "Cannot verify the input:", err)
+		return exitUsage
+	}
+
+	if *output == "json" {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	} else {
+		printReport(stdout, report, key == nil)
+	}
+	if !report.Valid {
+		return exitInvalid
+	}
+	return exitValid
+}
+
+// check verifies an export or a transaction log, telling them apart by their first
+// bytes.
+func check(input *bufio.Reader, deviceId string, key crypto.PublicKey) (*verify.Report, error) {
+	header, _ := input.Peek(512)
+	if !verify.IsExport(header) {
+		if key == nil {
+			return nil, errors.New("transactions require -key")
+		}
+		return verify.Transactions(input, deviceId, key)
+	}
+
+	report, err := verify.Export(input, key)
+	if err != nil {
+		return nil, err
+	}
+	if deviceId != "" && report.DeviceId != deviceId {
+		report.Failures = append(report.Failures, verify.Failure{Reason: fmt.Sprintf("the export belongs to device %q", report.DeviceId)})
+		report.Valid = false
+	}
+	return report, nil
+}
+
+// printReport writes report for humans.
+func printReport(w io.Writer, report *verify.Report, exportedKey bool) {
+	fmt.Fprintf(w, "Device:        %s\n", report.DeviceId)
+	fmt.Fprintf(w, "Transactions:  %d", report.Transactions)
+	if report.Transactions > 0 {
+		fmt.Fprintf(w, " (counters %d to %d)", report.FirstCounter, report.LastCounter)
+	}
+	fmt.Fprintln(w)
+	if report.Transactions > 0 && report.FirstCounter > 0 {
+		fmt.Fprintf(w, "Note:          the log starts at counter %d, its link to counter %d is not verified\n", report.FirstCounter, report.FirstCounter-1)
+	}
+	if exportedKey {
+		fmt.Fprintln(w, "Note:          verified with the public key of the export; pass -key to verify with a trusted key")
+	}
+
+	if report.Valid {
+		fmt.Fprintln(w, "Result:        VALID")
+		return
+	}
+	fmt.Fprintf(w, "Result:        INVALID, %d failures\n", len(report.Failures))
+	for _, failure := range report.Failures {
+		fmt.Fprintf(w, "  - %s\n", failure)
+	}
+}
@@ -0,0 +1,540 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/certs"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/tracing"
+)
+
+// Variable names the environment variable holding the path of the config file.
+const Variable = "SIGNING_SERVICE_CONFIG"
+
+// redacted replaces the value of secrets when a Config is printed.
+const redacted = "REDACTED"
+
+// Storage backends.
+const (
+	// BackendMemory keeps all data in the memory of the process.
+	BackendMemory = "memory"
+	// BackendFile journals all data to the directory named by the DSN.
+	BackendFile = "file"
+	// BackendSharedFile journals all data to the directory named by the DSN,
+	// which several instances open at the same time.
+	BackendSharedFile = "shared-file"
+)
+
+// Backends lists the storage backends the service can run with.
+var Backends = []string{BackendMemory, BackendFile, BackendSharedFile}
+
+// Config is the complete configuration of the signing service.
+type Config struct {
+	Server       Server       `yaml:"server"`
+	TLS          TLS          `yaml:"tls"`
+	Storage      Storage      `yaml:"storage"`
+	Keys         Keys         `yaml:"keys"`
+	RateLimits   RateLimits   `yaml:"rate_limits"`
+	Log          Log          `yaml:"log"`
+	Metrics      Metrics      `yaml:"metrics"`
+	Tracing      Tracing      `yaml:"tracing"`
+	Auth         Auth         `yaml:"auth"`
+	TSA          TSA          `yaml:"tsa"`
+	Transactions Transactions `yaml:"transactions"`
+	Webhooks     Webhooks     `yaml:"webhooks"`
+	Stream       Stream       `yaml:"stream"`
+	DeviceLocks  DeviceLocks  `yaml:"device_locks"`
+}
+
+type Server struct {
+	ListenAddress string `yaml:"listen_address"`
+	// ShutdownTimeout bounds how long draining requests and signatures may take on shutdown.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// MaxBodyBytes is the size limit of request bodies.
+	MaxBodyBytes int `yaml:"max_body_bytes"`
+	// LegacyErrors reports errors in the ErrorResponse format of the service before
+	// problem details, for clients that have not migrated yet.
+	LegacyErrors bool `yaml:"legacy_errors"`
+}
+
+// TLS enables HTTPS and HTTP/2 if both files are set.
+type TLS struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ReloadInterval is how often the files are checked for a rotated certificate.
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+	// ClientAuth is none, optional or require.
+	ClientAuth string `yaml:"client_auth"`
+	// ClientCAFile holds the CA certificates that client certificates are verified against.
+	ClientCAFile string `yaml:"client_ca_file"`
+	// ClientIdentities grant the clients presenting a certificate for a common name the
+	// scopes of an API key of a tenant. They can only be set in the config file.
+	ClientIdentities []ClientIdentity `yaml:"client_identities"`
+}
+
+// ClientIdentity maps the common name of client certificates to a tenant and scopes.
+type ClientIdentity struct {
+	CommonName string   `yaml:"common_name"`
+	TenantId   string   `yaml:"tenant_id"`
+	Scopes     []string `yaml:"scopes"`
+}
+
+type Storage struct {
+	// Backend is one of Backends.
+	Backend string `yaml:"backend"`
+	// DSN locates the database of backends that use one. It may contain credentials.
+	DSN string `yaml:"dsn"`
+}
+
+// Keys are the parameters of the key pairs generated for new signature devices.
+type Keys struct {
+	RSABits  int    `yaml:"rsa_bits"`
+	ECCCurve string `yaml:"ecc_curve"`
+}
+
+// Limit is a token bucket refilled by Rate tokens per second up to Burst tokens.
+type Limit struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+type RateLimits struct {
+	// RedisAddress shares the buckets of all instances through Redis if set.
+	RedisAddress string `yaml:"redis_address"`
+	Device       Limit  `yaml:"device"`
+	APIKey       Limit  `yaml:"api_key"`
+	Tenant       Limit  `yaml:"tenant"`
+}
+
+type Log struct {
+	// Level is the minimum level of the logged messages: debug, info, warn or error.
+	Level string `yaml:"level"`
+	// AuditFile is the file the audit log is appended to. It is written to stderr if empty.
+	AuditFile string `yaml:"audit_file"`
+}
+
+type Metrics struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+type Tracing struct {
+	// Exporter is one of tracing.ExporterNone, tracing.ExporterStdout or tracing.ExporterOTLP.
+	Exporter string `yaml:"exporter"`
+	Endpoint string `yaml:"endpoint"`
+	Insecure bool   `yaml:"insecure"`
+}
+
+type Auth struct {
+	// AdminKey is the secret of the bootstrap API key granted the admin and platform scopes.
+	AdminKey string `yaml:"admin_key"`
+}
+
+// TSA requests RFC 3161 timestamp tokens over every signature if URL is set.
+type TSA struct {
+	URL string `yaml:"url"`
+	// CAFile holds the CA certificates the certificate of the TSA is verified against,
+	// the system roots if it is empty.
+	CAFile  string        `yaml:"ca_file"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+type Transactions struct {
+	// Timeout is how long a transaction stays open without being updated or finished.
+	Timeout time.Duration `yaml:"timeout"`
+	// ExpiryInterval is how often transactions past their timeout are expired.
+	ExpiryInterval time.Duration `yaml:"expiry_interval"`
+}
+
+type Webhooks struct {
+	// MaxAttempts is how often a delivery is attempted before it is dead.
+	MaxAttempts int `yaml:"max_attempts"`
+	// MinBackoff is the delay after the first failed attempt, which doubles with
+	// every further one up to MaxBackoff.
+	MinBackoff time.Duration `yaml:"min_backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+	// Timeout bounds every attempt.
+	Timeout time.Duration `yaml:"timeout"`
+	// Interval is how often new events are fanned out and due deliveries attempted.
+	Interval time.Duration `yaml:"interval"`
+}
+
+type Stream struct {
+	// NATSURL is the NATS server the signatures are published to. They are not
+	// published if it is empty.
+	NATSURL string `yaml:"nats_url"`
+	// Subject prefixes the subjects of the signatures, which are published on
+	// <subject>.<device id>.
+	Subject string `yaml:"subject"`
+	// Interval is how often new signatures are published.
+	Interval time.Duration `yaml:"interval"`
+}
+
+type DeviceLocks struct {
+	// RedisAddress is the Redis server holding the leases on devices, for instances
+	// sharing a repository. Devices are only locked within the process if it is empty.
+	RedisAddress string `yaml:"redis_address"`
+	// TTL is how long the lease of an instance that stopped renewing it lasts.
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// Default returns the configuration used for every setting that is not configured.
+func Default() *Config {
+	return &Config{
+		Server:  Server{ListenAddress: ":8080", ShutdownTimeout: 30 * time.Second, MaxBodyBytes: 64 << 10},
+		TLS:     TLS{ReloadInterval: certs.DefaultInterval, ClientAuth: string(certs.ClientAuthNone)},
+		Storage: Storage{Backend: BackendMemory},
+		Keys:    Keys{RSABits: 2048, ECCCurve: "P-384"},
+		RateLimits: RateLimits{
+			Device: Limit{Rate: 20, Burst: 40},
+			APIKey: Limit{Rate: 50, Burst: 100},
+			Tenant: Limit{Rate: 100, Burst: 200},
+		},
+		Log:     Log{Level: "info"},
+		Metrics: Metrics{Enabled: true},
+		Tracing: Tracing{Exporter: tracing.ExporterNone},
+		TSA:     TSA{Timeout: 5 * time.Second},
+		Transactions: Transactions{
+			Timeout:        15 * time.Minute,
+			ExpiryInterval: time.Minute,
+		},
+		Webhooks: Webhooks{
+			MaxAttempts: 10,
+			MinBackoff:  10 * time.Second,
+			MaxBackoff:  time.Hour,
+			Timeout:     10 * time.Second,
+			Interval:    time.Second,
+		},
+		Stream:      Stream{Subject: "signatures", Interval: time.Second},
+		DeviceLocks: DeviceLocks{TTL: 10 * time.Second},
+	}
+}
+
+// field binds a setting to its environment variable and flag.
+type field struct {
+	name   string
+	env    string
+	flag   string
+	usage  string
+	secret bool
+	value  interface{}
+}
+
+// fields lists every setting of c. The environment variables and flags of the
+// settings are derived from this table, so they cannot drift apart.
+func (c *Config) fields() []field {
+	return []field{
+		{"server.listen_address", "SIGNING_SERVICE_LISTEN_ADDRESS", "listen-address", "address the server listens on", false, &c.Server.ListenAddress},
+		{"server.shutdown_timeout", "SIGNING_SERVICE_SHUTDOWN_TIMEOUT", "shutdown-timeout", "deadline for draining on shutdown", false, &c.Server.ShutdownTimeout},
+		{"server.max_body_bytes", "SIGNING_SERVICE_MAX_BODY_BYTES", "max-body-bytes", "size limit of request bodies", false, &c.Server.MaxBodyBytes},
+		{"server.legacy_errors", "SIGNING_SERVICE_LEGACY_ERRORS", "legacy-errors", "report errors in the legacy format instead of problem details", false, &c.Server.LegacyErrors},
+		{"tls.cert_file", "SIGNING_SERVICE_TLS_CERT_FILE", "tls-cert-file", "PEM encoded TLS certificate", false, &c.TLS.CertFile},
+		{"tls.key_file", "SIGNING_SERVICE_TLS_KEY_FILE", "tls-key-file", "PEM encoded TLS private key", false, &c.TLS.KeyFile},
+		{"tls.reload_interval", "SIGNING_SERVICE_TLS_RELOAD_INTERVAL", "tls-reload-interval", "interval of checking the certificate for changes", false, &c.TLS.ReloadInterval},
+		{"tls.client_auth", "SIGNING_SERVICE_TLS_CLIENT_AUTH", "tls-client-auth", "client certificates: none, optional or require", false, &c.TLS.ClientAuth},
+		{"tls.client_ca_file", "SIGNING_SERVICE_TLS_CLIENT_CA_FILE", "tls-client-ca-file", "PEM encoded CA certificates of clients", false, &c.TLS.ClientCAFile},
+		{"storage.backend", "SIGNING_SERVICE_STORAGE_BACKEND", "storage-backend", "storage backend", false, &c.Storage.Backend},
+		{"storage.dsn", "SIGNING_SERVICE_STORAGE_DSN", "storage-dsn", "data source name of the storage backend", true, &c.Storage.DSN},
+		{"keys.rsa_bits", "SIGNING_SERVICE_RSA_BITS", "rsa-bits", "size of generated RSA keys", false, &c.Keys.RSABits},
+		{"keys.ecc_curve", "SIGNING_SERVICE_ECC_CURVE", "ecc-curve", "curve of generated ECC keys", false, &c.Keys.ECCCurve},
+		{"rate_limits.redis_address", "SIGNING_SERVICE_REDIS_ADDRESS", "redis-address", "Redis server sharing rate limits", false, &c.RateLimits.RedisAddress},
+		{"rate_limits.device.rate", "SIGNING_SERVICE_DEVICE_RATE", "device-rate", "signatures per second of a device", false, &c.RateLimits.Device.Rate},
+		{"rate_limits.device.burst", "SIGNING_SERVICE_DEVICE_BURST", "device-burst", "signature burst of a device", false, &c.RateLimits.Device.Burst},
+		{"rate_limits.api_key.rate", "SIGNING_SERVICE_API_KEY_RATE", "api-key-rate", "requests per second of an API key", false, &c.RateLimits.APIKey.Rate},
+		{"rate_limits.api_key.burst", "SIGNING_SERVICE_API_KEY_BURST", "api-key-burst", "request burst of an API key", false, &c.RateLimits.APIKey.Burst},
+		{"rate_limits.tenant.rate", "SIGNING_SERVICE_TENANT_RATE", "tenant-rate", "requests per second of a tenant", false, &c.RateLimits.Tenant.Rate},
+		{"rate_limits.tenant.burst", "SIGNING_SERVICE_TENANT_BURST", "tenant-burst", "request burst of a tenant", false, &c.RateLimits.Tenant.Burst},
+		{"log.level", "SIGNING_SERVICE_LOG_LEVEL", "log-level", "minimum log level", false, &c.Log.Level},
+		{"log.audit_file", "SIGNING_SERVICE_AUDIT_LOG", "audit-log", "file the audit log is appended to", false, &c.Log.AuditFile},
+		{"metrics.enabled", "SIGNING_SERVICE_METRICS_ENABLED", "metrics", "serve metrics on /metrics", false, &c.Metrics.Enabled},
+		{"tracing.exporter", "OTEL_TRACES_EXPORTER", "tracing-exporter", "span exporter: none, stdout or otlp", false, &c.Tracing.Exporter},
+		{"tracing.endpoint", "", "tracing-endpoint", "OTLP/HTTP collector", false, &c.Tracing.Endpoint},
+		{"tracing.insecure", "", "tracing-insecure", "send spans to the collector without TLS", false, &c.Tracing.Insecure},
+		{"auth.admin_key", "SIGNING_SERVICE_ADMIN_KEY", "admin-key", "secret of the bootstrap admin API key", true, &c.Auth.AdminKey},
+		{"tsa.url", "SIGNING_SERVICE_TSA_URL", "tsa-url", "RFC 3161 timestamp authority", false, &c.TSA.URL},
+		{"tsa.ca_file", "SIGNING_SERVICE_TSA_CA_FILE", "tsa-ca-file", "PEM encoded CA certificates of the timestamp authority", false, &c.TSA.CAFile},
+		{"tsa.timeout", "SIGNING_SERVICE_TSA_TIMEOUT", "tsa-timeout", "deadline of timestamp requests", false, &c.TSA.Timeout},
+		{"transactions.timeout", "SIGNING_SERVICE_TRANSACTION_TIMEOUT", "transaction-timeout", "time after which unfinished transactions expire", false, &c.Transactions.Timeout},
+		{"transactions.expiry_interval", "SIGNING_SERVICE_TRANSACTION_EXPIRY_INTERVAL", "transaction-expiry-interval", "interval of expiring unfinished transactions", false, &c.Transactions.ExpiryInterval},
+		{"webhooks.max_attempts", "SIGNING_SERVICE_WEBHOOK_MAX_ATTEMPTS", "webhook-max-attempts", "attempts of a webhook delivery before it is dead", false, &c.Webhooks.MaxAttempts},
+		{"webhooks.min_backoff", "SIGNING_SERVICE_WEBHOOK_MIN_BACKOFF", "webhook-min-backoff", "delay after the first failed webhook delivery", false, &c.Webhooks.MinBackoff},
+		{"webhooks.max_backoff", "SIGNING_SERVICE_WEBHOOK_MAX_BACKOFF", "webhook-max-backoff", "longest delay between webhook delivery attempts", false, &c.Webhooks.MaxBackoff},
+		{"webhooks.timeout", "SIGNING_SERVICE_WEBHOOK_TIMEOUT", "webhook-timeout", "deadline of webhook delivery attempts", false, &c.Webhooks.Timeout},
+		{"webhooks.interval", "SIGNING_SERVICE_WEBHOOK_INTERVAL", "webhook-interval", "interval of delivering webhook events", false, &c.Webhooks.Interval},
+		{"stream.nats_url", "SIGNING_SERVICE_STREAM_NATS_URL", "stream-nats-url", "NATS server signatures are published to", true, &c.Stream.NATSURL},
+		{"stream.subject", "SIGNING_SERVICE_STREAM_SUBJECT", "stream-subject", "subject prefix of published signatures", false, &c.Stream.Subject},
+		{"stream.interval", "SIGNING_SERVICE_STREAM_INTERVAL", "stream-interval", "interval of publishing signatures", false, &c.Stream.Interval},
+		{"device_locks.redis_address", "SIGNING_SERVICE_DEVICE_LOCK_REDIS_ADDRESS", "device-lock-redis-address", "Redis server holding the leases on devices", false, &c.DeviceLocks.RedisAddress},
+		{"device_locks.ttl", "SIGNING_SERVICE_DEVICE_LOCK_TTL", "device-lock-ttl", "lifetime of unrenewed device leases", false, &c.DeviceLocks.TTL},
+	}
+}
+
+// set parses raw into the setting value points to.
+func set(value interface{}, raw string) error {
+	var err error
+	switch value := value.(type) {
+	case *string:
+		*value = raw
+	case *int:
+		*value, err = strconv.Atoi(raw)
+	case *float64:
+		*value, err = strconv.ParseFloat(raw, 64)
+	case *bool:
+		*value, err = strconv.ParseBool(raw)
+	case *time.Duration:
+		*value, err = time.ParseDuration(raw)
+	default:
+		err = fmt.Errorf("unsupported setting type %T", value)
+	}
+	return err
+}
+
+// Load builds the configuration from the defaults, the config file, the environment
+// and the flags in args, each taking precedence over the former. The config file is
+// named by the -config flag or the SIGNING_SERVICE_CONFIG environment variable.
+// The resulting configuration is validated.
+func Load(name string, args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	config := Default()
+
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	path := flags.String("config", "", "YAML config file")
+	values := map[string]string{}
+	for _, f := range config.fields() {
+		f := f
+		flags.Func(f.flag, f.usage+" ("+f.name+")", func(raw string) error {
+			values[f.name] = raw
+			return nil
+		})
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+
+	if *path == "" {
+		*path, _ = lookupEnv(Variable)
+	}
+	if *path != "" {
+		if err := config.readFile(*path); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, f := range config.fields() {
+		if f.env == "" {
+			continue
+		}
+		if raw, ok := lookupEnv(f.env); ok {
+			if err := set(f.value, raw); err != nil {
+				return nil, fmt.Errorf("environment variable %s: %w", f.env, err)
+			}
+		}
+	}
+
+	for _, f := range config.fields() {
+		if raw, ok := values[f.name]; ok {
+			if err := set(f.value, raw); err != nil {
+				return nil, fmt.Errorf("flag -%s: %w", f.flag, err)
+			}
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// readFile overrides the settings of c with those in the YAML file at path.
+func (c *Config) readFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate reports every invalid setting of c.
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(name, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: "+format, append([]interface{}{name}, args...)...))
+	}
+
+	if c.Server.ListenAddress == "" {
+		invalid("server.listen_address", "must not be empty")
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		invalid("server.shutdown_timeout", "must be positive, got %s", c.Server.ShutdownTimeout)
+	}
+	if c.Server.MaxBodyBytes <= 0 {
+		invalid("server.max_body_bytes", "must be positive, got %d", c.Server.MaxBodyBytes)
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		invalid("tls", "cert_file and key_file must be set together")
+	}
+	if c.TLS.ReloadInterval <= 0 {
+		invalid("tls.reload_interval", "must be positive, got %s", c.TLS.ReloadInterval)
+	}
+	switch certs.ClientAuth(c.TLS.ClientAuth) {
+	case certs.ClientAuthNone:
+	case certs.ClientAuthOptional, certs.ClientAuthRequire:
+		if c.TLS.CertFile == "" {
+			invalid("tls.client_auth", "requires cert_file and key_file")
+		}
+		if c.TLS.ClientCAFile == "" {
+			invalid("tls.client_ca_file", "must be set to verify client certificates")
+		}
+	default:
+		invalid("tls.client_auth", "must be none, optional or require, got %q", c.TLS.ClientAuth)
+	}
+	for i, identity := range c.TLS.ClientIdentities {
+		if identity.CommonName == "" {
+			invalid(fmt.Sprintf("tls.client_identities[%d].common_name", i), "must not be empty")
+		}
+		for _, scope := range identity.Scopes {
+			if !contains(scopes(), scope) {
+				invalid(fmt.Sprintf("tls.client_identities[%d].scopes", i), "unknown scope %q", scope)
+			}
+		}
+	}
+	if !contains(Backends, c.Storage.Backend) {
+		invalid("storage.backend", "must be one of %v, got %q", Backends, c.Storage.Backend)
+	}
+	if (c.Storage.Backend == BackendFile || c.Storage.Backend == BackendSharedFile) && c.Storage.DSN == "" {
+		invalid("storage.dsn", "must name a directory for the %s backend", c.Storage.Backend)
+	}
+	if c.Storage.Backend == BackendSharedFile && c.DeviceLocks.RedisAddress == "" {
+		invalid("device_locks.redis_address", "must be set for the %s backend, the instances lease devices from each other", BackendSharedFile)
+	}
+	if c.Keys.RSABits < 2048 {
+		invalid("keys.rsa_bits", "must be at least 2048, got %d", c.Keys.RSABits)
+	}
+	if _, err := crypto.Curve(c.Keys.ECCCurve); err != nil {
+		invalid("keys.ecc_curve", "must be P-256, P-384 or P-521, got %q", c.Keys.ECCCurve)
+	}
+	for _, limit := range []struct {
+		name string
+		Limit
+	}{
+		{"rate_limits.device", c.RateLimits.Device},
+		{"rate_limits.api_key", c.RateLimits.APIKey},
+		{"rate_limits.tenant", c.RateLimits.Tenant},
+	} {
+		if limit.Rate < 0 || limit.Burst < 0 {
+			invalid(limit.name, "rate and burst must not be negative")
+		}
+	}
+	if _, err := c.Log.SlogLevel(); err != nil {
+		invalid("log.level", "must be debug, info, warn or error, got %q", c.Log.Level)
+	}
+	switch c.Tracing.Exporter {
+	case "", tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+	default:
+		invalid("tracing.exporter", "must be none, stdout or otlp, got %q", c.Tracing.Exporter)
+	}
+	if c.TSA.URL != "" {
+		if u, err := url.Parse(c.TSA.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			invalid("tsa.url", "must be an http or https URL, got %q", c.TSA.URL)
+		}
+	} else if c.TSA.CAFile != "" {
+		invalid("tsa.ca_file", "requires tsa.url")
+	}
+	if c.TSA.Timeout <= 0 {
+		invalid("tsa.timeout", "must be positive, got %s", c.TSA.Timeout)
+	}
+	if c.Transactions.Timeout <= 0 {
+		invalid("transactions.timeout", "must be positive, got %s", c.Transactions.Timeout)
+	}
+	if c.Transactions.ExpiryInterval <= 0 {
+		invalid("transactions.expiry_interval", "must be positive, got %s", c.Transactions.ExpiryInterval)
+	}
+	if c.Webhooks.MaxAttempts < 1 {
+		invalid("webhooks.max_attempts", "must be at least 1, got %d", c.Webhooks.MaxAttempts)
+	}
+	if c.Webhooks.MinBackoff <= 0 {
+		invalid("webhooks.min_backoff", "must be positive, got %s", c.Webhooks.MinBackoff)
+	}
+	if c.Webhooks.MaxBackoff < c.Webhooks.MinBackoff {
+		invalid("webhooks.max_backoff", "must not be less than webhooks.min_backoff, got %s", c.Webhooks.MaxBackoff)
+	}
+	if c.Webhooks.Timeout <= 0 {
+		invalid("webhooks.timeout", "must be positive, got %s", c.Webhooks.Timeout)
+	}
+	if c.Webhooks.Interval <= 0 {
+		invalid("webhooks.interval", "must be positive, got %s", c.Webhooks.Interval)
+	}
+	if c.Stream.Subject == "" || strings.ContainsAny(c.Stream.Subject, "*> \t") {
+		invalid("stream.subject", "must be a subject without wildcards, got %q", c.Stream.Subject)
+	}
+	if c.Stream.Interval <= 0 {
+		invalid("stream.interval", "must be positive, got %s", c.Stream.Interval)
+	}
+	if c.DeviceLocks.TTL < time.Second {
+		invalid("device_locks.ttl", "must be at least 1s, got %s", c.DeviceLocks.TTL)
+	}
+
+	return errors.Join(errs...)
+}
+
+// SlogLevel parses the log level.
+func (l Log) SlogLevel() (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(l.Level))
+	return level, err
+}
+
+// Print writes c to w as YAML, with all secrets redacted.
+func (c *Config) Print(w io.Writer) error {
+	printed := *c
+	for _, f := range printed.fields() {
+		if value, ok := f.value.(*string); ok && f.secret && *value != "" {
+			*value = redacted
+		}
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&printed); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// scopes lists the names of all API key scopes.
+func scopes() []string {
+	names := make([]string, 0, len(domain.Scopes))
+	for _, scope := range domain.Scopes {
+		names = append(names, string(scope))
+	}
+	return names
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
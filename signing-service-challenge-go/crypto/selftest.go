@@ -0,0 +1,54 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+)
+
+var selfTestKeys struct {
+	once sync.Once
+	rsa  *rsa.PrivateKey
+	ecc  *ecdsa.PrivateKey
+	err  error
+}
+
+// SelfTest signs a known message with every supported algorithm and verifies the
+// signatures, to detect a broken signer backend before devices use it. The keys it
+// signs with are generated on the first call.
+func SelfTest() error {
+	selfTestKeys.once.Do(func() {
+		selfTestKeys.rsa, selfTestKeys.err = rsa.GenerateKey(rand.Reader, 2048)
+		if selfTestKeys.err == nil {
+			selfTestKeys.ecc, selfTestKeys.err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		}
+	})
+	if selfTestKeys.err != nil {
+		return fmt.Errorf("generating self test keys: %w", selfTestKeys.err)
+	}
+
+	message := []byte("signing service self test")
+	hash := sha256.Sum256(message)
+
+	signature, err := NewRSASigner(selfTestKeys.rsa).Sign(message)
+	if err != nil {
+		return fmt.Errorf("RSA signing: %w", err)
+	}
+	if err := rsa.VerifyPKCS1v15(&selfTestKeys.rsa.PublicKey, crypto.SHA256, hash[:], signature); err != nil {
+		return fmt.Errorf("RSA verification: %w", err)
+	}
+
+	signature, err = NewECCSigner(selfTestKeys.ecc).Sign(message)
+	if err != nil {
+		return fmt.Errorf("ECC signing: %w", err)
+	}
+	if !ecdsa.VerifyASN1(&selfTestKeys.ecc.PublicKey, hash[:], signature) {
+		return fmt.Errorf("ECC verification failed")
+	}
+	return nil
+}
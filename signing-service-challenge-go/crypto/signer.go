@@ -1,18 +1,80 @@
 package crypto
 
 import (
+	"context"
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/fiskaly/coding-challenges/signing-service-challenge/crypto")
+
 // Signer defines a contract for different types of signing implementations.
 type Signer interface {
 	Sign(dataToBeSigned []byte) ([]byte, error)
 }
 
+// ContextSigner is a Signer that traces its operations as part of a context.
+type ContextSigner interface {
+	Signer
+	SignContext(ctx context.Context, dataToBeSigned []byte) ([]byte, error)
+}
+
+// SignContext signs data with signer, as part of ctx if the signer supports it.
+func SignContext(ctx context.Context, signer Signer, dataToBeSigned []byte) ([]byte, error) {
+	if contextSigner, ok := signer.(ContextSigner); ok {
+		return contextSigner.SignContext(ctx, dataToBeSigned)
+	}
+	return signer.Sign(dataToBeSigned)
+}
+
+// PublicSigner is a Signer that discloses its public key for verifying its signatures.
+type PublicSigner interface {
+	Signer
+	Public() crypto.PublicKey
+}
+
+// EncodePublicKey returns the public key of signer as a PEM encoded SubjectPublicKeyInfo.
+func EncodePublicKey(signer Signer) ([]byte, error) {
+	publicSigner, ok := signer.(PublicSigner)
+	if !ok {
+		return nil, fmt.Errorf("signer %T does not disclose its public key", signer)
+	}
+
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicSigner.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: publicKeyBytes,
+	}), nil
+}
+
+// traceSign runs sign in a span describing the signing operation.
+func traceSign(ctx context.Context, name string, sign func() ([]byte, error), attributes ...attribute.KeyValue) ([]byte, error) {
+	_, span := tracer.Start(ctx, name, trace.WithAttributes(attributes...))
+	defer span.End()
+
+	signature, err := sign()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return signature, err
+}
+
 type RSASigner struct {
 	PrivateKey *rsa.PrivateKey
 }
@@ -30,6 +92,18 @@ func (signer RSASigner) Sign(dataToBeSigned []byte) ([]byte, error) {
 	return signature, nil
 }
 
+// SignContext signs data in a span of ctx.
+func (signer RSASigner) SignContext(ctx context.Context, dataToBeSigned []byte) ([]byte, error) {
+	return traceSign(ctx, "RSASigner.Sign", func() ([]byte, error) {
+		return signer.Sign(dataToBeSigned)
+	}, attribute.Int("crypto.key_size", signer.PrivateKey.N.BitLen()))
+}
+
+// Public returns the public key of the signer.
+func (signer RSASigner) Public() crypto.PublicKey {
+	return &signer.PrivateKey.PublicKey
+}
+
 type ECCSigner struct {
 	PrivateKey *ecdsa.PrivateKey
 }
@@ -47,3 +121,15 @@ func (signer ECCSigner) Sign(dataToBeSigned []byte) ([]byte, error) {
 
 	return signature, nil
 }
+
+// SignContext signs data in a span of ctx.
+func (signer ECCSigner) SignContext(ctx context.Context, dataToBeSigned []byte) ([]byte, error) {
+	return traceSign(ctx, "ECCSigner.Sign", func() ([]byte, error) {
+		return signer.Sign(dataToBeSigned)
+	}, attribute.String("crypto.curve", signer.PrivateKey.Curve.Params().Name))
+}
+
+// Public returns the public key of the signer.
+func (signer ECCSigner) Public() crypto.PublicKey {
+	return &signer.PrivateKey.PublicKey
+}
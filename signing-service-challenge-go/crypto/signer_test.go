@@ -7,6 +7,8 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
 	"testing"
 )
 
@@ -55,3 +57,33 @@ func TestECCSigner(t *testing.T) {
 		t.Fatal("ECC signature verification failed")
 	}
 }
+
+func TestEncodePublicKey(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("Failed to generate ECC key:", err)
+	}
+
+	encoded, err := EncodePublicKey(NewECCSigner(privateKey))
+	if err != nil {
+		t.Fatal("Public key encoding failed:", err)
+	}
+
+	block, _ := pem.Decode(encoded)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		t.Fatalf("Expected a PUBLIC KEY PEM block, got %q", encoded)
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatal("Public key parsing failed:", err)
+	}
+	if !privateKey.PublicKey.Equal(publicKey) {
+		t.Errorf("Expected the public key of the signer")
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	if err := SelfTest(); err != nil {
+		t.Errorf("Expected the self test to pass, got %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+// Package devicelock serializes the signatures of a device across the server
+// instances that share a repository. Within one instance the signer lock of a
+// device suffices; instances holding their own copies of a device must also hold
+// its lease, so that no two of them sign with the same counter.
+package devicelock
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrLeaseLost is reported by Lease.Err once a lease expired or was taken over
+// before it was released.
+var ErrLeaseLost = errors.New("device lease lost")
+
+// Locker grants exclusive leases on keys.
+type Locker interface {
+	// Lock waits until it holds the lease on key, or until ctx is done.
+	Lock(ctx context.Context, key string) (Lease, error)
+}
+
+// Lease is the exclusive hold of a key.
+type Lease interface {
+	// Fence returns the fencing token of the lease. Every lease a Locker grants
+	// has a greater token than the ones granted before, so a store that remembers
+	// the greatest token it was written with rejects the writes of a holder that
+	// lost its lease to a later one.
+	Fence() int64
+	// Err returns ErrLeaseLost once the lease can no longer be relied on, and nil
+	// while it is held.
+	Err() error
+	// Release gives up the lease.
+	Release(ctx context.Context) error
+}
+
+// MemoryLocker grants leases within the process, for a single instance and for
+// tests.
+type MemoryLocker struct {
+	mutex sync.Mutex
+	keys  map[string]*memoryKey
+	// fence is the fencing token of the last lease granted.
+	fence int64
+}
+
+// memoryKey is the lease on a key: holding it means having sent to held.
+type memoryKey struct {
+	held    chan struct{}
+	waiters int
+}
+
+// NewMemoryLocker creates a MemoryLocker.
+func NewMemoryLocker() *MemoryLocker {
+	return &MemoryLocker{keys: make(map[string]*memoryKey)}
+}
+
+func (l *MemoryLocker) Lock(ctx context.Context, key string) (Lease, error) {
+	l.mutex.Lock()
+	k, ok := l.keys[key]
+	if !ok {
+		k = &memoryKey{held: make(chan struct{}, 1)}
+		l.keys[key] = k
+	}
+	k.waiters++
+	l.mutex.Unlock()
+
+	select {
+	case k.held <- struct{}{}:
+		l.mutex.Lock()
+		l.fence++
+		lease := &memoryLease{locker: l, key: key, fence: l.fence}
+		l.mutex.Unlock()
+		return lease, nil
+	case <-ctx.Done():
+		l.forget(key, k)
+		return nil, ctx.Err()
+	}
+}
+
+// forget drops a key once nobody holds or waits for it.
+func (l *MemoryLocker) forget(key string, k *memoryKey) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	k.waiters--
+	if k.waiters == 0 {
+		delete(l.keys, key)
+	}
+}
+
+type memoryLease struct {
+	locker *MemoryLocker
+	key    string
+	fence  int64
+	once   sync.Once
+}
+
+func (l *memoryLease) Fence() int64 {
+	return l.fence
+}
+
+func (l *memoryLease) Err() error {
+	return nil
+}
+
+func (l *memoryLease) Release(ctx context.Context) error {
+	l.once.Do(func() {
+		l.locker.mutex.Lock()
+		k := l.locker.keys[l.key]
+		l.locker.mutex.Unlock()
+
+		<-k.held
+		l.locker.forget(l.key, k)
+	})
+	return nil
+}
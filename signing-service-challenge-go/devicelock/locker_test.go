@@ -0,0 +1,154 @@
+package devicelock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// assertExclusive checks that no two holders of the lease on a key overlap and
+// that every holder has a greater fencing token than the one before.
+func assertExclusive(t *testing.T, lockers ...Locker) {
+	var wg sync.WaitGroup
+	var held, overlaps, counter, unfenced int
+	var fence int64
+	var mutex sync.Mutex
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(locker Locker) {
+			defer wg.Done()
+			lease, err := locker.Lock(context.Background(), "device")
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+			mutex.Lock()
+			held++
+			if held > 1 {
+				overlaps++
+			}
+			mutex.Unlock()
+
+			// Reading and writing without the mutex is only safe under the lease.
+			value := counter
+			if lease.Fence() <= fence {
+				unfenced++
+			}
+			fence = lease.Fence()
+			time.Sleep(time.Millisecond)
+			counter = value + 1
+
+			mutex.Lock()
+			held--
+			mutex.Unlock()
+			if err := lease.Release(context.Background()); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}(lockers[i%len(lockers)])
+	}
+	wg.Wait()
+
+	if overlaps != 0 || counter != 50 {
+		t.Errorf("Expected 50 exclusive holders, got %d overlaps and %d increments", overlaps, counter)
+	}
+	if unfenced != 0 {
+		t.Errorf("Expected increasing fencing tokens, got %d holders without", unfenced)
+	}
+}
+
+// assertCancelable checks that waiting for a held lease ends with its context.
+func assertCancelable(t *testing.T, locker Locker) {
+	lease, err := locker.Lock(context.Background(), "device")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := locker.Lock(ctx, "device"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if other, err := locker.Lock(context.Background(), "other"); err != nil || other.Err() != nil {
+		t.Errorf("Expected the lease on another key, got %v", err)
+	}
+
+	lease.Release(context.Background())
+	if _, err := locker.Lock(context.Background(), "device"); err != nil {
+		t.Errorf("Expected the released lease, got %v", err)
+	}
+}
+
+func newRedisLocker(t *testing.T, server *miniredis.Miniredis, ttl time.Duration) *RedisLocker {
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedisLocker(client, "lock:", ttl)
+}
+
+func TestMemoryLocker(t *testing.T) {
+	locker := NewMemoryLocker()
+	assertExclusive(t, locker)
+	assertCancelable(t, locker)
+}
+
+func TestRedisLocker(t *testing.T) {
+	server := miniredis.RunT(t)
+	assertExclusive(t, newRedisLocker(t, server, time.Second), newRedisLocker(t, server, time.Second))
+	assertCancelable(t, newRedisLocker(t, server, time.Second))
+}
+
+func TestRedisLeaseIsRenewed(t *testing.T) {
+	server := miniredis.RunT(t)
+	locker := newRedisLocker(t, server, 90*time.Millisecond)
+
+	lease, err := locker.Lock(context.Background(), "device")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if err := lease.Err(); err != nil {
+		t.Errorf("Expected the lease to be renewed, got %v", err)
+	}
+	if !server.Exists("lock:device") {
+		t.Error("Expected the lease to be stored")
+	}
+
+	lease.Release(context.Background())
+	if server.Exists("lock:device") {
+		t.Error("Expected the lease to be deleted")
+	}
+}
+
+func TestRedisLeaseIsLost(t *testing.T) {
+	server := miniredis.RunT(t)
+	locker := newRedisLocker(t, server, 300*time.Millisecond)
+
+	lease, err := locker.Lock(context.Background(), "device")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The lease expires, e.g. because the holder was paused, and another instance takes it.
+	server.FastForward(time.Second)
+	other, err := newRedisLocker(t, server, time.Minute).Lock(context.Background(), "device")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for lease.Err() == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !errors.Is(lease.Err(), ErrLeaseLost) {
+		t.Errorf("Expected %v, got %v", ErrLeaseLost, lease.Err())
+	}
+
+	// Releasing the lost lease leaves the lease of the other instance alone.
+	lease.Release(context.Background())
+	if other.Err() != nil || !server.Exists("lock:device") {
+		t.Error("Expected the other instance to keep its lease")
+	}
+}
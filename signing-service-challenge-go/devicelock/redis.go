@@ -0,0 +1,170 @@
+package devicelock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	mathrand "math/rand"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// acquireScript takes a lease that is not held and returns its fencing token, the
+// next value of a counter shared by all keys, or 0 if the lease is held.
+var acquireScript = redis.NewScript(`
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return redis.call("INCR", KEYS[2])
+end
+return 0
+`)
+
+// renewScript extends a lease if it is still held with the token.
+var renewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseScript deletes a lease if it is still held with the token.
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// RedisLocker grants leases stored in Redis, so that several service instances
+// share them. A lease expires after its TTL unless it is renewed, which the
+// holder does every third of the TTL, so the lease of a crashed instance frees up
+// after the TTL.
+type RedisLocker struct {
+	client redis.Cmdable
+	prefix string
+	ttl    time.Duration
+	// minRetry and maxRetry bound how long Lock waits before it tries again to
+	// take a held lease.
+	minRetry time.Duration
+	maxRetry time.Duration
+}
+
+// NewRedisLocker creates a RedisLocker whose keys start with prefix and whose
+// leases expire after ttl without renewal. The fencing tokens are counted in the
+// key prefix + "fence".
+func NewRedisLocker(client redis.Cmdable, prefix string, ttl time.Duration) *RedisLocker {
+	return &RedisLocker{
+		client:   client,
+		prefix:   prefix,
+		ttl:      ttl,
+		minRetry: 2 * time.Millisecond,
+		maxRetry: 25 * time.Millisecond,
+	}
+}
+
+func (l *RedisLocker) Lock(ctx context.Context, key string) (Lease, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	lease := &redisLease{locker: l, key: l.prefix + key, token: hex.EncodeToString(token), stop: make(chan struct{}), stopped: make(chan struct{})}
+
+	retry := l.minRetry
+	for {
+		fence, err := acquireScript.Run(ctx, l.client, []string{lease.key, l.prefix + "fence"}, lease.token, l.ttl.Milliseconds()).Int64()
+		if err != nil {
+			return nil, err
+		}
+		if fence != 0 {
+			lease.fence = fence
+			lease.renewed = time.Now()
+			go lease.renew()
+			return lease, nil
+		}
+
+		// The jitter keeps waiting instances from retrying in lockstep.
+		timer := time.NewTimer(retry/2 + time.Duration(mathrand.Int63n(int64(retry))))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		if retry *= 2; retry > l.maxRetry {
+			retry = l.maxRetry
+		}
+	}
+}
+
+type redisLease struct {
+	locker  *RedisLocker
+	key     string
+	token   string
+	fence   int64
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+
+	mutex   sync.Mutex
+	renewed time.Time
+	lost    bool
+}
+
+// renew extends the lease every third of the TTL until it is released.
+func (l *redisLease) renew() {
+	defer close(l.stopped)
+	ticker := time.NewTicker(l.locker.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), l.locker.ttl/3)
+		renewed, err := renewScript.Run(ctx, l.locker.client, []string{l.key}, l.token, l.locker.ttl.Milliseconds()).Int()
+		cancel()
+
+		l.mutex.Lock()
+		if err == nil && renewed == 1 {
+			l.renewed = start
+		} else if err == nil {
+			// Another instance holds the lease.
+			l.lost = true
+		}
+		lost := l.lost
+		l.mutex.Unlock()
+		if lost {
+			return
+		}
+	}
+}
+
+func (l *redisLease) Fence() int64 {
+	return l.fence
+}
+
+func (l *redisLease) Err() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// The lease expires a TTL after the last renewal that was sent.
+	if l.lost || time.Since(l.renewed) >= l.locker.ttl {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (l *redisLease) Release(ctx context.Context) error {
+	var err error
+	l.once.Do(func() {
+		close(l.stop)
+		<-l.stopped
+		err = releaseScript.Run(ctx, l.locker.client, []string{l.key}, l.token).Err()
+	})
+	return err
+}
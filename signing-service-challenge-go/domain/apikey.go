@@ -0,0 +1,119 @@
+package domain
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrAPIKeyNotFound = fmt.Errorf("api key not found")
+	ErrInvalidScope   = fmt.Errorf("invalid scope")
+)
+
+// Scope is a permission granted to an APIKey.
+type Scope string
+
+const (
+	ScopeDevicesCreate Scope = "devices:create"
+	ScopeDevicesRead   Scope = "devices:read"
+	ScopeDevicesManage Scope = "devices:manage"
+	ScopeSign          Scope = "sign"
+	ScopeAudit         Scope = "audit"
+	ScopeAdmin         Scope = "admin"
+	ScopeWebhooks      Scope = "webhooks"
+	// ScopePlatform manages the API keys and organizations of every tenant. Keys
+	// bound to a tenant never hold it, see Allows.
+	ScopePlatform Scope = "platform"
+)
+
+// Scopes lists every Scope that can be granted.
+var Scopes = []Scope{ScopeDevicesCreate, ScopeDevicesRead, ScopeDevicesManage, ScopeSign, ScopeAudit, ScopeAdmin, ScopeWebhooks, ScopePlatform}
+
+const apiKeySecretLength = 32
+
+// APIKey is a credential that authenticates API clients on behalf of a tenant.
+// Only the hash of the secret is kept, the secret itself is handed out once when
+// the key is issued. Keys without a tenant act on the default tenant.
+type APIKey struct {
+	Id        string     `json:"id"`
+	TenantId  string     `json:"tenant_id,omitempty"`
+	Name      string     `json:"name"`
+	Hash      string     `json:"-"`
+	Scopes    []Scope    `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// NewAPIKey issues an APIKey with a random secret. It returns the key and its secret.
+func NewAPIKey(id, name string, scopes []Scope) (*APIKey, string, error) {
+	secretBytes := make([]byte, apiKeySecretLength)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return nil, "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(secretBytes)
+
+	key, err := NewAPIKeyWithSecret(id, name, secret, scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	return key, secret, nil
+}
+
+// NewAPIKeyWithSecret creates an APIKey for a secret chosen by the caller, e.g. a bootstrap key.
+func NewAPIKeyWithSecret(id, name, secret string, scopes []Scope) (*APIKey, error) {
+	for _, scope := range scopes {
+		if !scope.valid() {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+	}
+
+	return &APIKey{
+		Id:        id,
+		Name:      name,
+		Hash:      HashAPIKeySecret(secret),
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+// HashAPIKeySecret derives the hash under which the APIKey of a secret is stored.
+// Secrets are random and long, so a plain SHA-256 is sufficient.
+func HashAPIKeySecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+// Allows reports whether the APIKey is active and has been granted the scope.
+// ScopePlatform is only honored for keys without a tenant.
+func (k *APIKey) Allows(scope Scope) bool {
+	if k.RevokedAt != nil || (scope == ScopePlatform && k.TenantId != "") {
+		return false
+	}
+	for _, granted := range k.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Revoke permanently deactivates the APIKey.
+func (k *APIKey) Revoke() {
+	if k.RevokedAt == nil {
+		now := time.Now().UTC()
+		k.RevokedAt = &now
+	}
+}
+
+func (s Scope) valid() bool {
+	for _, scope := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewAPIKey(t *testing.T) {
+	key, secret, err := NewAPIKey("key", "Test Key", []Scope{ScopeSign})
+	if err != nil {
+		t.Fatalf("Error creating API key: %v", err)
+	}
+
+	if secret == "" {
+		t.Errorf("Secret should not be empty")
+	}
+	if key.Hash != HashAPIKeySecret(secret) {
+		t.Errorf("Hash doesn't match the secret")
+	}
+	if !key.Allows(ScopeSign) {
+		t.Errorf("Key should allow granted scope")
+	}
+	if key.Allows(ScopeAudit) {
+		t.Errorf("Key should not allow scopes that were not granted")
+	}
+
+	key.Revoke()
+	if key.Allows(ScopeSign) {
+		t.Errorf("Revoked key should not allow any scope")
+	}
+}
+
+func TestNewAPIKeyInvalidScope(t *testing.T) {
+	_, _, err := NewAPIKey("key", "Test Key", []Scope{"devices:delete"})
+	if err == nil || !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("Expected invalid scope error")
+	}
+}
+
+func TestTenantKeyNeverAllowsPlatformScope(t *testing.T) {
+	key, _, err := NewAPIKey("key", "Test Key", []Scope{ScopeAdmin, ScopePlatform})
+	if err != nil {
+		t.Fatalf("Error creating API key: %v", err)
+	}
+	if !key.Allows(ScopePlatform) {
+		t.Errorf("Key without a tenant should allow the platform scope")
+	}
+
+	key.TenantId = "tenant"
+	if key.Allows(ScopePlatform) {
+		t.Errorf("Key of a tenant should not allow the platform scope")
+	}
+	if !key.Allows(ScopeAdmin) {
+		t.Errorf("Key of a tenant should allow its other scopes")
+	}
+}
@@ -0,0 +1,150 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentSignaturesChainWithoutGaps(t *testing.T) {
+	ctx := context.Background()
+	device, _ := NewSignatureDevice("test-device", "ECC", "Test Device")
+	device.SecuredDataFormat = SecuredDataV3
+
+	// Steps of a finished transaction fail without taking a counter.
+	started, _, _ := device.StartTransaction(ctx, "transaction", TextPayload("start"), time.Minute, nil)
+	fiscal, _, _ := device.FinishTransaction(ctx, loader(started), TextPayload("finish"), nil)
+
+	const signatures, failures = 40, 10
+	var mu sync.Mutex
+	var transactions []*Transaction
+	var wg sync.WaitGroup
+	for i := 0; i < signatures+failures; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%5 == 0 {
+				if _, _, err := device.UpdateTransaction(ctx, loader(fiscal), TextPayload("late"), time.Minute, nil); !errors.Is(err, ErrTransactionClosed) {
+					t.Errorf("Expected ErrTransactionClosed, got %v", err)
+				}
+				return
+			}
+			transaction, err := device.Sign(ctx, fmt.Sprintf("data %d", i))
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+			mu.Lock()
+			transactions = append(transactions, transaction)
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+
+	if device.SignatureCounter != signatures+2 {
+		t.Errorf("Expected counter %d, got %d", signatures+2, device.SignatureCounter)
+	}
+	sort.Slice(transactions, func(i, j int) bool { return transactions[i].Counter < transactions[j].Counter })
+	previous := device.LastSignature
+	for i, transaction := range transactions {
+		if transaction.Counter != i+2 {
+			t.Fatalf("Expected counter %d, got %d", i+2, transaction.Counter)
+		}
+		secured, err := ParseSecuredData(transaction)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if secured.Counter != transaction.Counter {
+			t.Errorf("Expected counter %d in the secured data, got %d", transaction.Counter, secured.Counter)
+		}
+		if i > 0 && secured.LastSignature != previous {
+			t.Errorf("Expected counter %d to chain to the previous signature", transaction.Counter)
+		}
+		if i > 0 && secured.SignedAt.Before(transactions[i-1].CreatedAt) {
+			t.Errorf("Expected counter %d to be signed after the previous one", transaction.Counter)
+		}
+		if !verifies(t, device, transaction.SignedData, transaction.Signature) {
+			t.Errorf("Expected the signature of counter %d to verify", transaction.Counter)
+		}
+		previous = transaction.Signature
+	}
+	if len(transactions) > 0 && device.LastSignature != previous {
+		t.Errorf("Expected the device to chain to the last signature")
+	}
+}
+
+func TestPayloadIsPreparedBeforeTheChainLock(t *testing.T) {
+	device, _ := NewSignatureDevice("test-device", "ECC", "Test Device")
+	device.chainLock.Lock()
+	defer device.chainLock.Unlock()
+
+	// An invalid payload fails while another signature holds the chain lock.
+	failed := make(chan error, 1)
+	go func() {
+		_, err := device.SignPayload(context.Background(), Payload{Encoding: PayloadSHA256, Data: []byte("short")}, nil)
+		failed <- err
+	}()
+	select {
+	case err := <-failed:
+		if !errors.Is(err, ErrInvalidDigest) {
+			t.Errorf("Expected ErrInvalidDigest, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the payload to be rejected without waiting for the chain lock")
+	}
+}
+
+// BenchmarkSignConcurrency reports the signatures per second of a single device
+// against the number of concurrent signers. The signatures of a device chain to
+// each other, so adding signers does not add throughput.
+func BenchmarkSignConcurrency(b *testing.B) {
+	for _, algorithm := range []string{"ECC", "RSA"} {
+		device, err := NewSignatureDevice("bench-device", algorithm, "Benchmark Device")
+		if err != nil {
+			b.Fatal(err)
+		}
+		device.SecuredDataFormat = SecuredDataV2
+
+		for _, size := range []int{64, 8 << 10} {
+			payload := TextPayload(strings.Repeat("x", size))
+			for _, concurrency := range []int{1, 4, 16, 64} {
+				name := fmt.Sprintf("%s/%dB/concurrency=%d", algorithm, size, concurrency)
+				b.Run(name, func(b *testing.B) {
+					benchmarkSign(b, device, payload, concurrency)
+				})
+			}
+		}
+	}
+}
+
+func benchmarkSign(b *testing.B, device *SignatureDevice, payload Payload, concurrency int) {
+	ctx := context.Background()
+	work := make(chan struct{}, b.N)
+	for i := 0; i < b.N; i++ {
+		work <- struct{}{}
+	}
+	close(work)
+
+	b.ResetTimer()
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range work {
+				if _, err := device.SignPayload(ctx, payload, nil); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "signatures/s")
+}
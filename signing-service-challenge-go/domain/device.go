@@ -1,34 +1,104 @@
 package domain
 
 import (
+	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
 )
 
+var tracer = otel.Tracer("github.com/fiskaly/coding-challenges/signing-service-challenge/domain")
+
 var (
 	ErrDeviceNotFound       = fmt.Errorf("signature device not found")
 	ErrUnsupportedAlgorithm = fmt.Errorf("unsupported algorithm")
+	ErrDeviceSuspended      = fmt.Errorf("signature device is suspended")
+	ErrAmbiguousData        = fmt.Errorf("data contains the separator %q of the secured data", SecuredDataSeparator)
+	ErrDeviceRotated        = fmt.Errorf("signature device is already rotated")
+)
+
+// SecuredDataSeparator separates the counter, the data and the last signature in
+// the secured data of SecuredDataV1. Data containing it would make the secured data
+// ambiguous, so Sign rejects such data with ErrAmbiguousData.
+const SecuredDataSeparator = "_"
+
+// DeviceStatus is the lifecycle state of a SignatureDevice.
+type DeviceStatus string
+
+const (
+	// DeviceStatusActive devices sign transactions.
+	DeviceStatusActive DeviceStatus = "ACTIVE"
+	// DeviceStatusSuspended devices refuse to sign transactions.
+	DeviceStatusSuspended DeviceStatus = "SUSPENDED"
 )
 
 type SignatureDevice struct {
 	Id               string
+	TenantId         string
 	Algorithm        string
 	Label            string
+	Status           DeviceStatus
 	SignatureCounter int
 	LastSignature    string
+	// SecuredDataFormat is the encoding of the secured data the device signs.
+	SecuredDataFormat SecuredDataFormat
+	// TransactionCounter is the number of fiscal transactions the device started.
+	TransactionCounter int
+	// PredecessorId and SuccessorId link the devices of a key rotation.
+	PredecessorId string `json:",omitempty"`
+	SuccessorId   string `json:",omitempty"`
 
+	// chainLock serializes the signatures of the device from reading the counter
+	// until the signature is committed, and the changes of its status. signerLock
+	// guards the state of the device, which the repository advances as well.
+	chainLock  sync.Mutex
 	signerLock sync.Mutex
 	signer     crypto.Signer
 }
 
+// Commit stores a signature before the chain of its device advances past it,
+// together with the FiscalTransaction as of the step it signs, nil for signatures
+// outside of a FiscalTransaction. A signature whose commit fails is discarded and
+// the next signature takes its counter. A nil Commit stores nothing.
+type Commit func(*Transaction, *FiscalTransaction) error
+
+// KeyParameters determine the key pairs generated for new signature devices.
+type KeyParameters struct {
+	// RSABits is the size of RSA keys, crypto.DefaultRSABits if zero.
+	RSABits int
+	// ECCCurve names the curve of ECC keys: P-256, P-384 (if empty) or P-521.
+	ECCCurve string
+}
+
+// DefaultKeyParameters are the KeyParameters of NewSignatureDevice.
+var DefaultKeyParameters = KeyParameters{
+	RSABits:  crypto.DefaultRSABits,
+	ECCCurve: "P-384",
+}
+
 func NewSignatureDevice(id, algorithm, label string) (*SignatureDevice, error) {
+	return NewSignatureDeviceWithKeys(context.Background(), id, algorithm, label, DefaultKeyParameters)
+}
+
+// NewSignatureDeviceWithKeys creates a SignatureDevice with a key pair generated as
+// described by keys. The time the generation took is reported to the
+// Instrumentation of ctx.
+func NewSignatureDeviceWithKeys(ctx context.Context, id, algorithm, label string, keys KeyParameters) (*SignatureDevice, error) {
+	start := time.Now()
+
 	var signer crypto.Signer
 	switch algorithm {
 	case "RSA":
-		rsaGenerator := crypto.RSAGenerator{}
+		rsaGenerator := crypto.RSAGenerator{Bits: keys.RSABits}
 		keyPair, err := rsaGenerator.Generate()
 		if err != nil {
 			return nil, err
@@ -36,6 +106,13 @@ func NewSignatureDevice(id, algorithm, label string) (*SignatureDevice, error) {
 		signer = crypto.NewRSASigner(keyPair.Private)
 	case "ECC":
 		eccGenerator := crypto.ECCGenerator{}
+		if keys.ECCCurve != "" {
+			curve, err := crypto.Curve(keys.ECCCurve)
+			if err != nil {
+				return nil, err
+			}
+			eccGenerator.Curve = curve
+		}
 		keyPair, err := eccGenerator.Generate()
 		if err != nil {
 			return nil, err
@@ -45,35 +122,261 @@ func NewSignatureDevice(id, algorithm, label string) (*SignatureDevice, error) {
 		return nil, ErrUnsupportedAlgorithm
 	}
 
+	instrumentation(ctx).ObserveKeyGeneration(algorithm, time.Since(start))
+
 	return &SignatureDevice{
-		Id:        id,
-		Algorithm: algorithm,
-		Label:     label,
-		signer:    signer,
+		Id:                id,
+		Algorithm:         algorithm,
+		Label:             label,
+		Status:            DeviceStatusActive,
+		SecuredDataFormat: DefaultSecuredDataFormat,
+		signer:            signer,
 	}, nil
 }
 
-func (d *SignatureDevice) SignTransaction(dataToBeSigned string) (string, string, error) {
+// lock acquires the chain lock, recording the time spent waiting for it.
+func (d *SignatureDevice) lock(ctx context.Context) {
+	_, span := tracer.Start(ctx, "SignatureDevice.lock")
+	defer span.End()
+
+	start := time.Now()
+	d.chainLock.Lock()
+	instrumentation(ctx).ObserveLockWait(d.Algorithm, time.Since(start))
+}
+
+// PublicKey returns the PEM encoded public key that verifies the signatures of the device.
+func (d *SignatureDevice) PublicKey() ([]byte, error) {
+	return crypto.EncodePublicKey(d.signer)
+}
+
+// SignDocument signs document, such as the manifest of an export, with the key of
+// the device outside of its signature chain: the counter does not advance and the
+// signature is not a Transaction. Documents must be distinguishable from secured
+// data, which is why signing is left to callers that control their format.
+func (d *SignatureDevice) SignDocument(ctx context.Context, document []byte) (string, error) {
+	signature, err := crypto.SignContext(ctx, d.signer, document)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// Suspend stops the device from signing further transactions. It waits for a
+// signature in progress and reports whether the device was active before.
+func (d *SignatureDevice) Suspend() bool {
+	d.chainLock.Lock()
+	defer d.chainLock.Unlock()
 	d.signerLock.Lock()
 	defer d.signerLock.Unlock()
 
-	securedDataToBeSigned := fmt.Sprintf("%d_%s_%s", d.SignatureCounter, dataToBeSigned, d.LastSignature)
-	signature, err := d.signer.Sign([]byte(securedDataToBeSigned))
+	if d.Status == DeviceStatusSuspended {
+		return false
+	}
+	d.Status = DeviceStatusSuspended
+	return true
+}
+
+// Rotate replaces the key of the device by its successor: a device with the id
+// successorId and a fresh key pair of the same algorithm, label, tenant and secured
+// data format. The device itself is suspended. A signature chain is verified with a
+// single public key, so the key of a device never changes; its successor starts a
+// new chain at counter 0.
+func (d *SignatureDevice) Rotate(ctx context.Context, successorId string, keys KeyParameters) (*SignatureDevice, error) {
+	successor, err := NewSignatureDeviceWithKeys(ctx, successorId, d.Algorithm, d.Label, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	d.chainLock.Lock()
+	defer d.chainLock.Unlock()
+	d.signerLock.Lock()
+	defer d.signerLock.Unlock()
+
+	if d.SuccessorId != "" {
+		return nil, ErrDeviceRotated
+	}
+	successor.TenantId = d.TenantId
+	successor.SecuredDataFormat = d.SecuredDataFormat
+	successor.PredecessorId = d.Id
+	d.Status = DeviceStatusSuspended
+	d.SuccessorId = successor.Id
+	return successor, nil
+}
+
+// Advance fast-forwards the chain of the device past transaction, a signature of
+// the device issued by another copy of it, such as one replayed from a journal or
+// signed by another server instance. It reports whether the device was behind.
+func (d *SignatureDevice) Advance(transaction *Transaction) bool {
+	d.signerLock.Lock()
+	defer d.signerLock.Unlock()
+
+	if transaction.Counter < d.SignatureCounter {
+		return false
+	}
+	d.SignatureCounter = transaction.Counter + 1
+	d.LastSignature = transaction.Signature
+	return true
+}
+
+// MarshalState returns the JSON encoded state of the device without its key. It
+// is taken under the signer lock, so the counter and the last signature of a
+// signature in progress are never stored apart.
+func (d *SignatureDevice) MarshalState() ([]byte, error) {
+	d.signerLock.Lock()
+	defer d.signerLock.Unlock()
+	return json.Marshal(d)
+}
+
+// PrivateKey returns the PEM encoded private key of the device. It is meant for
+// repositories that store devices outside of the process, never for clients.
+func (d *SignatureDevice) PrivateKey() ([]byte, error) {
+	switch signer := d.signer.(type) {
+	case crypto.RSASigner:
+		marshaler := crypto.NewRSAMarshaler()
+		_, private, err := marshaler.Marshal(crypto.RSAKeyPair{Private: signer.PrivateKey, Public: &signer.PrivateKey.PublicKey})
+		return private, err
+	case crypto.ECCSigner:
+		_, private, err := crypto.NewECCMarshaler().Encode(crypto.ECCKeyPair{Private: signer.PrivateKey, Public: &signer.PrivateKey.PublicKey})
+		return private, err
+	}
+	return nil, fmt.Errorf("signer %T does not disclose its private key", d.signer)
+}
+
+// RestoreSignatureDevice returns the device whose state MarshalState returned,
+// signing with privateKey as returned by PrivateKey.
+func RestoreSignatureDevice(state, privateKey []byte) (*SignatureDevice, error) {
+	device := &SignatureDevice{}
+	if err := json.Unmarshal(state, device); err != nil {
+		return nil, err
+	}
+
+	switch device.Algorithm {
+	case "RSA":
+		marshaler := crypto.NewRSAMarshaler()
+		keyPair, err := marshaler.Unmarshal(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		device.signer = crypto.NewRSASigner(keyPair.Private)
+	case "ECC":
+		keyPair, err := crypto.NewECCMarshaler().Decode(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		device.signer = crypto.NewECCSigner(keyPair.Private)
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+	return device, nil
+}
+
+// SignTransaction signs data and returns the base64 encoded signature and the secured data.
+func (d *SignatureDevice) SignTransaction(dataToBeSigned string) (string, string, error) {
+	transaction, err := d.Sign(context.Background(), dataToBeSigned)
 	if err != nil {
 		return "", "", err
 	}
+	return transaction.Signature, transaction.SignedData, nil
+}
+
+// Sign signs text data as the next link of the device's signature chain and returns
+// the resulting Transaction.
+func (d *SignatureDevice) Sign(ctx context.Context, dataToBeSigned string) (*Transaction, error) {
+	return d.SignPayload(ctx, TextPayload(dataToBeSigned), nil)
+}
+
+// SignPayload signs payload as the next link of the device's signature chain and
+// returns the resulting Transaction. The chain advances once commit stored it.
+func (d *SignatureDevice) SignPayload(ctx context.Context, payload Payload, commit Commit) (_ *Transaction, err error) {
+	ctx, end := d.trace(ctx, "SignatureDevice.SignTransaction")
+	defer end(&err)
 
-	var lastSignature string
-	if d.SignatureCounter == 0 {
-		lastSignature = base64.StdEncoding.EncodeToString([]byte(d.Id))
-	} else {
-		lastSignature = d.LastSignature
+	prepared, err := payload.prepare()
+	if err != nil {
+		return nil, err
 	}
 
-	signedData := fmt.Sprintf("%d_%s_%s", d.SignatureCounter, dataToBeSigned, lastSignature)
+	d.lock(ctx)
+	defer d.chainLock.Unlock()
 
-	d.SignatureCounter++
-	d.LastSignature = base64.StdEncoding.EncodeToString(signature)
+	transaction, _, err := d.sign(ctx, prepared, transactionStep{}, nil, commit)
+	return transaction, err
+}
+
+// trace starts the span of a device operation. The returned function ends it,
+// recording the error its argument points to.
+func (d *SignatureDevice) trace(ctx context.Context, name string) (context.Context, func(*error)) {
+	ctx, span := tracer.Start(ctx, name, trace.WithAttributes(
+		attribute.String("device.id", d.Id),
+		attribute.String("device.algorithm", d.Algorithm),
+	))
+	return ctx, func(err *error) {
+		if *err != nil {
+			span.RecordError(*err)
+			span.SetStatus(codes.Error, (*err).Error())
+		}
+		span.End()
+	}
+}
+
+// sign signs payload as the next link of the signature chain, as step of a
+// FiscalTransaction unless step is the zero step, and advances the chain once
+// commit stored the signature. advance returns the FiscalTransaction after the
+// step, it is nil outside of a FiscalTransaction. The caller holds the chain lock
+// and prepared the payload before taking it, so that the lock only covers what
+// depends on the chain.
+func (d *SignatureDevice) sign(ctx context.Context, payload preparedPayload, step transactionStep, advance func(*Transaction) *FiscalTransaction, commit Commit) (*Transaction, *FiscalTransaction, error) {
+	d.signerLock.Lock()
+	status, counter, lastSignature, format := d.Status, d.SignatureCounter, d.LastSignature, d.SecuredDataFormat
+	d.signerLock.Unlock()
+
+	if status == DeviceStatusSuspended {
+		return nil, nil, ErrDeviceSuspended
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("device.signature_counter", counter))
+
+	if format == "" {
+		format = SecuredDataV1
+	}
+	signedAt := time.Now().UTC()
+	securedDataToBeSigned, securedData, err := format.encode(d.Id, counter, payload, lastSignature, signedAt, step)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	start := time.Now()
+	signature, err := crypto.SignContext(ctx, d.signer, securedDataToBeSigned)
+	if err != nil {
+		return nil, nil, err
+	}
+	instrumentation(ctx).ObserveSigning(d.Algorithm, time.Since(start))
+
+	transaction := &Transaction{
+		TenantId:          d.TenantId,
+		DeviceId:          d.Id,
+		Counter:           counter,
+		Signature:         base64.StdEncoding.EncodeToString(signature),
+		SignedData:        securedData,
+		SecuredDataFormat: format,
+		DataEncoding:      payload.Encoding,
+		TransactionId:     step.id,
+		Operation:         step.operation,
+		CreatedAt:         signedAt,
+	}
+
+	var fiscal *FiscalTransaction
+	if advance != nil {
+		fiscal = advance(transaction)
+	}
+
+	if commit != nil {
+		if err := commit(transaction, fiscal); err != nil {
+			return nil, nil, err
+		}
+	}
+	// The repository may have advanced the device already when it stored the
+	// transaction.
+	d.Advance(transaction)
 
-	return base64.StdEncoding.EncodeToString(signature), signedData, nil
+	return transaction, fiscal, nil
 }
@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"context"
 	"errors"
 	"testing"
 )
@@ -87,3 +88,141 @@ func TestSignatureDeviceSignTransaction(t *testing.T) {
 		t.Errorf("Signature counter should increment")
 	}
 }
+
+func TestSignatureDeviceAdvancesOnlyOnCommit(t *testing.T) {
+	device, _ := NewSignatureDevice("test-device", "ECC", "Test Device")
+	errStore := errors.New("store unavailable")
+
+	_, err := device.SignPayload(context.Background(), TextPayload("lost"), func(*Transaction, *FiscalTransaction) error { return errStore })
+	if !errors.Is(err, errStore) {
+		t.Errorf("Expected the error of the commit, got %v", err)
+	}
+	if device.SignatureCounter != 0 || device.LastSignature != "" {
+		t.Errorf("Expected the chain to stay at counter 0, got %d", device.SignatureCounter)
+	}
+
+	var committed *Transaction
+	transaction, err := device.SignPayload(context.Background(), TextPayload("stored"), func(transaction *Transaction, _ *FiscalTransaction) error {
+		committed = transaction
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if committed != transaction || transaction.Counter != 0 {
+		t.Errorf("Expected counter 0 to be committed, got %+v", committed)
+	}
+	if device.SignatureCounter != 1 || device.LastSignature != transaction.Signature {
+		t.Errorf("Expected the chain to advance past the committed signature")
+	}
+}
+
+func TestSignatureDeviceSuspendedRefusesToSign(t *testing.T) {
+	device, _ := NewSignatureDevice("test-device", "ECC", "Test Device")
+	if !device.Suspend() {
+		t.Errorf("Expected the active device to be suspended")
+	}
+	if device.Suspend() {
+		t.Errorf("Expected the suspended device to stay suspended")
+	}
+
+	_, _, err := device.SignTransaction("data-to-be-signed")
+	if err == nil || !errors.Is(err, ErrDeviceSuspended) {
+		t.Errorf("Expected device suspended error")
+	}
+	if device.SignatureCounter != 0 {
+		t.Errorf("Signature counter should not increment")
+	}
+}
+
+func TestSignatureDeviceRejectsAmbiguousData(t *testing.T) {
+	device, _ := NewSignatureDevice("test-device", "ECC", "Test Device")
+	device.SecuredDataFormat = SecuredDataV1
+
+	_, _, err := device.SignTransaction("data_to_be_signed")
+	if !errors.Is(err, ErrAmbiguousData) {
+		t.Errorf("Expected ambiguous data error, got %v", err)
+	}
+	if device.SignatureCounter != 0 {
+		t.Errorf("Signature counter should not increment")
+	}
+}
+
+func TestNewSignatureDeviceWithKeys(t *testing.T) {
+	device, err := NewSignatureDeviceWithKeys(context.Background(), "test-device", "ECC", "Test Device", KeyParameters{ECCCurve: "P-256"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	publicKey, err := device.PublicKey()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(publicKey) == 0 {
+		t.Errorf("Expected a public key")
+	}
+
+	if _, err := NewSignatureDeviceWithKeys(context.Background(), "test-device", "ECC", "Test Device", KeyParameters{ECCCurve: "P-192"}); err == nil {
+		t.Errorf("Expected an error for an unsupported curve")
+	}
+}
+
+func TestSignatureDeviceRotate(t *testing.T) {
+	device, _ := NewSignatureDevice("test-device", "ECC", "Test Device")
+	device.TenantId = "tenant"
+	device.SecuredDataFormat = SecuredDataV2
+	device.SignTransaction("data")
+
+	successor, err := device.Rotate(context.Background(), "successor", KeyParameters{ECCCurve: "P-256"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if device.Status != DeviceStatusSuspended || device.SuccessorId != "successor" {
+		t.Errorf("Expected the device to be suspended and linked to its successor, got %s %q", device.Status, device.SuccessorId)
+	}
+	if successor.PredecessorId != device.Id || successor.TenantId != "tenant" || successor.SecuredDataFormat != SecuredDataV2 || successor.SignatureCounter != 0 {
+		t.Errorf("Expected a fresh successor of the device, got %+v", successor)
+	}
+	oldKey, _ := device.PublicKey()
+	newKey, _ := successor.PublicKey()
+	if string(oldKey) == string(newKey) {
+		t.Errorf("Expected the successor to have a new key")
+	}
+
+	if _, err := device.Rotate(context.Background(), "another", KeyParameters{}); !errors.Is(err, ErrDeviceRotated) {
+		t.Errorf("Expected ErrDeviceRotated, got %v", err)
+	}
+}
+
+func TestRestoreSignatureDevice(t *testing.T) {
+	for _, algorithm := range []string{"RSA", "ECC"} {
+		device, _ := NewSignatureDevice("test-device", algorithm, "Test Device")
+		device.SignTransaction("data")
+
+		state, err := device.MarshalState()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		privateKey, err := device.PrivateKey()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		restored, err := RestoreSignatureDevice(state, privateKey)
+		if err != nil {
+			t.Fatalf("Unexpected error restoring %s: %v", algorithm, err)
+		}
+		if restored.SignatureCounter != 1 || restored.LastSignature != device.LastSignature {
+			t.Errorf("Expected the %s device to keep its chain, got %+v", algorithm, restored)
+		}
+		publicKey, _ := device.PublicKey()
+		restoredKey, _ := restored.PublicKey()
+		if string(publicKey) != string(restoredKey) {
+			t.Errorf("Expected the %s device to keep its key", algorithm)
+		}
+	}
+
+	if _, err := RestoreSignatureDevice([]byte(`{"Algorithm":"ECC"}`), []byte("not a key")); err == nil {
+		t.Errorf("Expected an error for an invalid private key")
+	}
+}
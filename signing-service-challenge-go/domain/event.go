@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidEventType = fmt.Errorf("invalid event type")
+
+// EventType names a kind of Event.
+type EventType string
+
+const (
+	// EventDeviceCreated carries a signature device that was created.
+	EventDeviceCreated EventType = "device.created"
+	// EventDeviceStatusChanged carries a signature device whose status changed.
+	EventDeviceStatusChanged EventType = "device.status_changed"
+	// EventDeviceRotated carries a signature device that was rotated, whose
+	// SuccessorId names the device that replaces it.
+	EventDeviceRotated EventType = "device.rotated"
+	// EventTransactionSigned carries a Transaction that was signed.
+	EventTransactionSigned EventType = "transaction.signed"
+)
+
+// EventTypes lists every EventType.
+var EventTypes = []EventType{EventDeviceCreated, EventDeviceStatusChanged, EventDeviceRotated, EventTransactionSigned}
+
+// Event is a change of a signature device that downstream systems are notified
+// of. Events are recorded in the outbox of the repository together with the change
+// they describe, so that no change goes unnoticed and no event describes a change
+// that was not stored.
+type Event struct {
+	Id string `json:"id"`
+	// Sequence orders the events of the outbox. It is assigned when the event is
+	// stored.
+	Sequence   int64     `json:"sequence"`
+	Type       EventType `json:"type"`
+	TenantId   string    `json:"tenant_id,omitempty"`
+	DeviceId   string    `json:"device_id"`
+	OccurredAt time.Time `json:"occurred_at"`
+	// Data is the device or the transaction the event carries, encoded as the API
+	// returns it.
+	Data json.RawMessage `json:"data"`
+}
+
+// NewEvent creates an Event of device that carries data.
+func NewEvent(id string, eventType EventType, device *SignatureDevice, data interface{}) (*Event, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Event{
+		Id:         id,
+		Type:       eventType,
+		TenantId:   device.TenantId,
+		DeviceId:   device.Id,
+		OccurredAt: time.Now().UTC(),
+		Data:       encoded,
+	}, nil
+}
+
+func (t EventType) valid() bool {
+	for _, eventType := range EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,246 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+var (
+	ErrTransactionNotFound = fmt.Errorf("transaction not found")
+	ErrTransactionClosed   = fmt.Errorf("transaction is already finished")
+	ErrTransactionExpired  = fmt.Errorf("transaction has expired")
+)
+
+// DefaultTransactionTimeout is how long a FiscalTransaction stays open without
+// being updated or finished.
+const DefaultTransactionTimeout = 15 * time.Minute
+
+// FiscalTransactionState is the lifecycle state of a FiscalTransaction.
+type FiscalTransactionState string
+
+const (
+	// FiscalTransactionOpen transactions accept updates and the finish.
+	FiscalTransactionOpen FiscalTransactionState = "OPEN"
+	// FiscalTransactionFinished transactions were signed at their finish.
+	FiscalTransactionFinished FiscalTransactionState = "FINISHED"
+	// FiscalTransactionExpired transactions timed out before they were finished.
+	FiscalTransactionExpired FiscalTransactionState = "EXPIRED"
+)
+
+// FiscalTransactionStates lists every FiscalTransactionState.
+var FiscalTransactionStates = []FiscalTransactionState{FiscalTransactionOpen, FiscalTransactionFinished, FiscalTransactionExpired}
+
+// Operation is the step of a FiscalTransaction a signature is issued for.
+type Operation string
+
+const (
+	OperationStart  Operation = "start"
+	OperationUpdate Operation = "update"
+	OperationFinish Operation = "finish"
+)
+
+// transactionStep identifies the step of a FiscalTransaction a signature belongs to.
+// The zero transactionStep marks signatures outside of a FiscalTransaction.
+type transactionStep struct {
+	id        string
+	operation Operation
+	number    int
+}
+
+// FiscalTransaction is a transaction signed at its start, at every update and at
+// its finish, each step taking the next signature of the device's chain. It
+// expires if it is neither updated nor finished within a timeout.
+type FiscalTransaction struct {
+	Id       string `json:"id"`
+	TenantId string `json:"tenant_id,omitempty"`
+	DeviceId string `json:"device_id"`
+	// Number counts the transactions of the device, starting at 1.
+	Number int                    `json:"number"`
+	State  FiscalTransactionState `json:"state"`
+	// SignatureCounters are the counters of the signatures of every step in order.
+	SignatureCounters []int      `json:"signature_counters"`
+	StartedAt         time.Time  `json:"started_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+	FinishedAt        *time.Time `json:"finished_at,omitempty"`
+	// ExpiresAt is when the transaction expires unless it is updated or finished.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// FiscalTransactionLoader returns the FiscalTransaction as currently stored.
+type FiscalTransactionLoader func() (*FiscalTransaction, error)
+
+// StartTransaction signs payload as the start of a new FiscalTransaction with the
+// given id, which expires after timeout unless it is updated or finished.
+// Transactions require SecuredDataV2 or later. The chain advances and the
+// transaction is started once commit stored the signature with it.
+func (d *SignatureDevice) StartTransaction(ctx context.Context, id string, payload Payload, timeout time.Duration, commit Commit) (_ *FiscalTransaction, _ *Transaction, err error) {
+	ctx, end := d.trace(ctx, "SignatureDevice.StartTransaction")
+	defer end(&err)
+
+	prepared, err := payload.prepare()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	d.lock(ctx)
+	defer d.chainLock.Unlock()
+
+	d.signerLock.Lock()
+	number := d.TransactionCounter + 1
+	d.signerLock.Unlock()
+
+	transaction, fiscal, err := d.sign(ctx, prepared, transactionStep{id: id, operation: OperationStart, number: number}, func(transaction *Transaction) *FiscalTransaction {
+		fiscal := &FiscalTransaction{
+			Id:        id,
+			TenantId:  d.TenantId,
+			DeviceId:  d.Id,
+			Number:    number,
+			State:     FiscalTransactionOpen,
+			StartedAt: transaction.CreatedAt,
+		}
+		fiscal.record(transaction, timeout)
+		return fiscal
+	}, commit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	d.AdvanceTransactions(fiscal)
+	return fiscal, transaction, nil
+}
+
+// UpdateTransaction signs payload as an update of the open FiscalTransaction load
+// returns, which then expires after timeout unless it is updated again or
+// finished. Expired transactions are rejected with ErrTransactionExpired. The
+// transaction is loaded under the chain lock and left as it is, the updated copy
+// is returned once commit stored the signature with it.
+func (d *SignatureDevice) UpdateTransaction(ctx context.Context, load FiscalTransactionLoader, payload Payload, timeout time.Duration, commit Commit) (_ *FiscalTransaction, _ *Transaction, err error) {
+	ctx, end := d.trace(ctx, "SignatureDevice.UpdateTransaction")
+	defer end(&err)
+
+	return d.step(ctx, load, OperationUpdate, payload, timeout, commit)
+}
+
+// FinishTransaction signs payload as the finish of the open FiscalTransaction load
+// returns, like UpdateTransaction. The finished copy is returned once commit
+// stored the signature with it.
+func (d *SignatureDevice) FinishTransaction(ctx context.Context, load FiscalTransactionLoader, payload Payload, commit Commit) (_ *FiscalTransaction, _ *Transaction, err error) {
+	ctx, end := d.trace(ctx, "SignatureDevice.FinishTransaction")
+	defer end(&err)
+
+	return d.step(ctx, load, OperationFinish, payload, 0, commit)
+}
+
+// step signs payload as the operation of the transaction load returns.
+func (d *SignatureDevice) step(ctx context.Context, load FiscalTransactionLoader, operation Operation, payload Payload, timeout time.Duration, commit Commit) (*FiscalTransaction, *Transaction, error) {
+	prepared, err := payload.prepare()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	d.lock(ctx)
+	defer d.chainLock.Unlock()
+
+	fiscal, err := load()
+	if err != nil {
+		return nil, nil, err
+	}
+	if fiscal.DeviceId != d.Id {
+		return nil, nil, ErrTransactionNotFound
+	}
+
+	switch {
+	case fiscal.State == FiscalTransactionFinished:
+		return nil, nil, ErrTransactionClosed
+	case fiscal.State == FiscalTransactionExpired, fiscal.overdue(time.Now()):
+		return nil, nil, ErrTransactionExpired
+	}
+
+	transaction, next, err := d.sign(ctx, prepared, transactionStep{id: fiscal.Id, operation: operation, number: fiscal.Number}, func(transaction *Transaction) *FiscalTransaction {
+		next := fiscal.clone()
+		if operation == OperationFinish {
+			next.SignatureCounters = append(next.SignatureCounters, transaction.Counter)
+			next.UpdatedAt = transaction.CreatedAt
+			next.FinishedAt = &transaction.CreatedAt
+			next.State = FiscalTransactionFinished
+		} else {
+			next.record(transaction, timeout)
+		}
+		return next
+	}, commit)
+	if err != nil {
+		return nil, nil, err
+	}
+	return next, transaction, nil
+}
+
+// ExpireTransaction expires the transaction load returns if it is open and
+// overdue at now. It waits for a step in progress and passes the expired copy to
+// save under the chain lock, so that no step continues the transaction meanwhile.
+// It reports whether the transaction expired.
+func (d *SignatureDevice) ExpireTransaction(load FiscalTransactionLoader, now time.Time, save func(*FiscalTransaction) error) (bool, error) {
+	d.chainLock.Lock()
+	defer d.chainLock.Unlock()
+
+	fiscal, err := load()
+	if err != nil {
+		return false, err
+	}
+	if fiscal.DeviceId != d.Id || fiscal.State != FiscalTransactionOpen || !fiscal.overdue(now) {
+		return false, nil
+	}
+
+	expired := fiscal.clone()
+	expired.State = FiscalTransactionExpired
+	if err := save(expired); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// AdvanceTransactions fast-forwards the number of fiscal transactions the device
+// started past fiscal, started by another copy of the device like with Advance.
+func (d *SignatureDevice) AdvanceTransactions(fiscal *FiscalTransaction) bool {
+	d.signerLock.Lock()
+	defer d.signerLock.Unlock()
+
+	if fiscal.Number <= d.TransactionCounter {
+		return false
+	}
+	d.TransactionCounter = fiscal.Number
+	return true
+}
+
+// At returns the transaction as it stands at now: a copy marked as expired if it
+// is open and overdue, the transaction itself otherwise. Reads use it to report
+// the state before ExpireTransaction stored it.
+func (t *FiscalTransaction) At(now time.Time) *FiscalTransaction {
+	if t.State != FiscalTransactionOpen || !t.overdue(now) {
+		return t
+	}
+	expired := t.clone()
+	expired.State = FiscalTransactionExpired
+	return expired
+}
+
+// clone returns a copy of the transaction that shares no memory with it, stored
+// transactions are replaced rather than changed.
+func (t *FiscalTransaction) clone() *FiscalTransaction {
+	clone := *t
+	clone.SignatureCounters = slices.Clone(t.SignatureCounters)
+	return &clone
+}
+
+// record adds the signature of a step to the transaction and restarts its timeout.
+func (t *FiscalTransaction) record(transaction *Transaction, timeout time.Duration) {
+	t.SignatureCounters = append(t.SignatureCounters, transaction.Counter)
+	t.UpdatedAt = transaction.CreatedAt
+	t.ExpiresAt = transaction.CreatedAt.Add(timeout)
+}
+
+// overdue reports whether the timeout of the transaction has passed at now.
+func (t *FiscalTransaction) overdue(now time.Time) bool {
+	return !now.Before(t.ExpiresAt)
+}
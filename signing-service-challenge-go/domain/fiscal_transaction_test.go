@@ -0,0 +1,123 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFiscalTransactionLifecycle(t *testing.T) {
+	ctx := context.Background()
+	device, _ := NewSignatureDevice("test-device", "ECC", "Test Device")
+	device.SecuredDataFormat = SecuredDataV2
+	device.Sign(ctx, "before")
+
+	started, start, err := device.StartTransaction(ctx, "transaction", TextPayload("start"), time.Minute, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	updated, update, err := device.UpdateTransaction(ctx, loader(started), TextPayload("update"), time.Minute, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	fiscal, finish, err := device.FinishTransaction(ctx, loader(updated), TextPayload("finish"), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(started.SignatureCounters) != 1 || len(updated.SignatureCounters) != 2 || updated.State != FiscalTransactionOpen {
+		t.Errorf("Expected the steps to leave the loaded transactions unchanged, got %v and %v", started.SignatureCounters, updated.SignatureCounters)
+	}
+
+	if fiscal.Number != 1 || device.TransactionCounter != 1 {
+		t.Errorf("Expected transaction number 1, got %d", fiscal.Number)
+	}
+	if fiscal.State != FiscalTransactionFinished || fiscal.FinishedAt == nil {
+		t.Errorf("Expected a finished transaction, got %s", fiscal.State)
+	}
+	for i, step := range []struct {
+		transaction *Transaction
+		operation   Operation
+	}{{start, OperationStart}, {update, OperationUpdate}, {finish, OperationFinish}} {
+		if step.transaction.Counter != i+1 || fiscal.SignatureCounters[i] != i+1 {
+			t.Errorf("Expected step %s at counter %d, got %d", step.operation, i+1, step.transaction.Counter)
+		}
+		if step.transaction.TransactionId != "transaction" || step.transaction.Operation != step.operation {
+			t.Errorf("Expected step %s of the transaction, got %s of %q", step.operation, step.transaction.Operation, step.transaction.TransactionId)
+		}
+
+		var member securedData
+		if err := json.Unmarshal([]byte(step.transaction.SignedData), &member); err != nil {
+			t.Fatalf("Expected JSON secured data, got %s", step.transaction.SignedData)
+		}
+		if member.Operation != step.operation || member.TransactionNumber != 1 {
+			t.Errorf("Expected operation %s of transaction 1 in %s", step.operation, step.transaction.SignedData)
+		}
+		if !verifies(t, device, step.transaction.SignedData, step.transaction.Signature) {
+			t.Errorf("Expected the signature of %s to verify", step.operation)
+		}
+	}
+
+	if _, _, err := device.UpdateTransaction(ctx, loader(fiscal), TextPayload("late"), time.Minute, nil); !errors.Is(err, ErrTransactionClosed) {
+		t.Errorf("Expected ErrTransactionClosed, got %v", err)
+	}
+}
+
+func TestFiscalTransactionExpires(t *testing.T) {
+	ctx := context.Background()
+	device, _ := NewSignatureDevice("test-device", "ECC", "Test Device")
+	device.SecuredDataFormat = SecuredDataV2
+
+	fiscal, _, err := device.StartTransaction(ctx, "transaction", TextPayload("start"), time.Minute, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var stored *FiscalTransaction
+	save := func(expired *FiscalTransaction) error {
+		stored = expired
+		return nil
+	}
+	if expired, err := device.ExpireTransaction(loader(fiscal), time.Now(), save); expired || err != nil {
+		t.Errorf("Expected the transaction not to expire before its timeout, got %v", err)
+	}
+	if fiscal.At(time.Now()) != fiscal {
+		t.Errorf("Expected the transaction to be reported as it is before its timeout")
+	}
+	if fiscal.At(fiscal.ExpiresAt).State != FiscalTransactionExpired || fiscal.State != FiscalTransactionOpen {
+		t.Errorf("Expected a copy reported as expired at its timeout")
+	}
+	if expired, err := device.ExpireTransaction(loader(fiscal), fiscal.ExpiresAt, save); !expired || err != nil {
+		t.Errorf("Expected the transaction to expire at its timeout, got %v", err)
+	}
+	if stored == nil || stored.State != FiscalTransactionExpired || fiscal.State != FiscalTransactionOpen {
+		t.Errorf("Expected an expired copy to be saved")
+	}
+
+	counter := device.SignatureCounter
+	if _, _, err := device.FinishTransaction(ctx, loader(stored), TextPayload("finish"), nil); !errors.Is(err, ErrTransactionExpired) {
+		t.Errorf("Expected ErrTransactionExpired, got %v", err)
+	}
+	if device.SignatureCounter != counter {
+		t.Errorf("Expected no signature for an expired transaction")
+	}
+}
+
+func TestFiscalTransactionRequiresV2(t *testing.T) {
+	device, _ := NewSignatureDevice("test-device", "ECC", "Test Device")
+	device.SecuredDataFormat = SecuredDataV1
+
+	_, _, err := device.StartTransaction(context.Background(), "transaction", TextPayload("start"), time.Minute, nil)
+	if !errors.Is(err, ErrUnsupportedSecuredDataFormat) {
+		t.Errorf("Expected ErrUnsupportedSecuredDataFormat, got %v", err)
+	}
+	if device.SignatureCounter != 0 || device.TransactionCounter != 0 {
+		t.Errorf("Expected the counters not to advance")
+	}
+}
+
+// loader returns a FiscalTransactionLoader of fiscal.
+func loader(fiscal *FiscalTransaction) FiscalTransactionLoader {
+	return func() (*FiscalTransaction, error) { return fiscal, nil }
+}
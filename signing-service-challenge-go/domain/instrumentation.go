@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Instrumentation observes the timing of signature device operations, e.g. to export metrics.
+type Instrumentation interface {
+	// ObserveKeyGeneration reports how long generating the key pair of a device took.
+	ObserveKeyGeneration(algorithm string, duration time.Duration)
+	// ObserveLockWait reports how long a signature waited for the lock of its device.
+	ObserveLockWait(algorithm string, duration time.Duration)
+	// ObserveSigning reports how long creating a signature took, excluding the lock wait.
+	ObserveSigning(algorithm string, duration time.Duration)
+}
+
+type noInstrumentation struct{}
+
+func (noInstrumentation) ObserveKeyGeneration(string, time.Duration) {}
+func (noInstrumentation) ObserveLockWait(string, time.Duration)      {}
+func (noInstrumentation) ObserveSigning(string, time.Duration)       {}
+
+type instrumentationContextKey struct{}
+
+// WithInstrumentation returns a copy of ctx that has the device operations it is
+// passed to report their timing to i.
+func WithInstrumentation(ctx context.Context, i Instrumentation) context.Context {
+	return context.WithValue(ctx, instrumentationContextKey{}, i)
+}
+
+// instrumentation returns the Instrumentation of ctx, one that observes nothing if
+// there is none.
+func instrumentation(ctx context.Context) Instrumentation {
+	if i, ok := ctx.Value(instrumentationContextKey{}).(Instrumentation); ok && i != nil {
+		return i
+	}
+	return noInstrumentation{}
+}
@@ -0,0 +1,24 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+)
+
+var ErrOrganizationNotFound = fmt.Errorf("organization not found")
+
+// Organization is a tenant of the service. Every signature device and transaction
+// belongs to exactly one Organization and is invisible to all others.
+type Organization struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func NewOrganization(id, name string) *Organization {
+	return &Organization{
+		Id:        id,
+		Name:      name,
+		CreatedAt: time.Now().UTC(),
+	}
+}
@@ -0,0 +1,91 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// PayloadEncoding tells how the data of a transaction is represented in the secured data.
+type PayloadEncoding string
+
+const (
+	// PayloadText data is signed as is.
+	PayloadText PayloadEncoding = "text"
+	// PayloadBinary data is represented by its standard base64 encoding with padding.
+	PayloadBinary PayloadEncoding = "binary"
+	// PayloadSHA256 data is a SHA-256 digest, represented by its lowercase hex encoding.
+	PayloadSHA256 PayloadEncoding = "sha256"
+)
+
+// ErrInvalidDigest is returned for PayloadSHA256 data that is not a SHA-256 digest.
+var ErrInvalidDigest = fmt.Errorf("digest is not a SHA-256 digest")
+
+// Payload is the data a SignatureDevice signs in a transaction.
+type Payload struct {
+	Encoding PayloadEncoding
+	Data     []byte
+}
+
+// TextPayload returns the Payload of text data.
+func TextPayload(data string) Payload {
+	return Payload{Encoding: PayloadText, Data: []byte(data)}
+}
+
+// preparedPayload is a Payload along with its representation in the secured data,
+// which is computed before the chain lock of a device is taken.
+type preparedPayload struct {
+	Payload
+	data string
+}
+
+// prepare returns the preparedPayload of p, whose encoding defaults to PayloadText.
+func (p Payload) prepare() (preparedPayload, error) {
+	if p.Encoding == "" {
+		p.Encoding = PayloadText
+	}
+	data, err := p.securedData()
+	if err != nil {
+		return preparedPayload{}, err
+	}
+	return preparedPayload{Payload: p, data: data}, nil
+}
+
+// securedData returns the representation of the payload in the secured data.
+func (p Payload) securedData() (string, error) {
+	switch p.Encoding {
+	case PayloadText, "":
+		return string(p.Data), nil
+	case PayloadBinary:
+		return base64.StdEncoding.EncodeToString(p.Data), nil
+	case PayloadSHA256:
+		if len(p.Data) != sha256.Size {
+			return "", ErrInvalidDigest
+		}
+		return hex.EncodeToString(p.Data), nil
+	}
+	return "", fmt.Errorf("unknown payload encoding %q", p.Encoding)
+}
+
+// parsePayload is the inverse of securedData: it returns the Payload represented by
+// data in the secured data.
+func parsePayload(encoding PayloadEncoding, data string) (Payload, error) {
+	switch encoding {
+	case PayloadText, "":
+		return TextPayload(data), nil
+	case PayloadBinary:
+		decoded, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return Payload{}, fmt.Errorf("binary data is not base64 encoded: %w", err)
+		}
+		return Payload{Encoding: PayloadBinary, Data: decoded}, nil
+	case PayloadSHA256:
+		decoded, err := hex.DecodeString(data)
+		if err != nil {
+			return Payload{}, fmt.Errorf("digest is not hex encoded: %w", err)
+		}
+		return Payload{Encoding: PayloadSHA256, Data: decoded}, nil
+	}
+	return Payload{}, fmt.Errorf("unknown payload encoding %q", encoding)
+}
@@ -0,0 +1,208 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SecuredDataFormat is the version of the encoding of the secured data a device signs.
+type SecuredDataFormat string
+
+const (
+	// SecuredDataV1 is the legacy format <counter>_<data>_<last_signature>. It
+	// rejects data containing SecuredDataSeparator. At counter 0 the signature is
+	// created over an empty last signature, while the reported secured data carries
+	// the base64 encoded device id.
+	SecuredDataV1 SecuredDataFormat = "v1"
+	// SecuredDataV2 is canonical JSON: an object of the members counter, data,
+	// device_id, encoding, format, last_signature, operation and transaction_number
+	// in this order, without whitespace and without escaping HTML characters.
+	// encoding is omitted for text payloads, operation and transaction_number for
+	// signatures outside of a FiscalTransaction. At counter 0 the last signature is
+	// the base64 encoded device id. The signature is created over exactly the
+	// reported secured data.
+	SecuredDataV2 SecuredDataFormat = "v2"
+	// SecuredDataV3 is SecuredDataV2 with the additional member signed_at, the
+	// signing time in RFC 3339 format in UTC with up to nanosecond precision. It
+	// follows operation, keeping the members in alphabetical order.
+	SecuredDataV3 SecuredDataFormat = "v3"
+)
+
+// DefaultSecuredDataFormat is the format of new devices. It signs the signing
+// time, which a timestamp token over the signature can only confirm. Devices
+// stored without a format sign SecuredDataV1.
+const DefaultSecuredDataFormat = SecuredDataV3
+
+// SecuredDataFormats lists every supported SecuredDataFormat.
+var SecuredDataFormats = []SecuredDataFormat{SecuredDataV1, SecuredDataV2, SecuredDataV3}
+
+// ErrUnsupportedSecuredDataFormat is returned for unknown secured data formats.
+var ErrUnsupportedSecuredDataFormat = fmt.Errorf("unsupported secured data format")
+
+// ParseSecuredDataFormat returns the SecuredDataFormat named name,
+// DefaultSecuredDataFormat if name is empty.
+func ParseSecuredDataFormat(name string) (SecuredDataFormat, error) {
+	if name == "" {
+		return DefaultSecuredDataFormat, nil
+	}
+	for _, format := range SecuredDataFormats {
+		if string(format) == name {
+			return format, nil
+		}
+	}
+	return "", ErrUnsupportedSecuredDataFormat
+}
+
+// SecuredData is the content of the secured data of a Transaction.
+type SecuredData struct {
+	Format   SecuredDataFormat
+	DeviceId string
+	Counter  int
+	Payload  Payload
+	// LastSignature is the signature of the previous transaction, empty at counter 0.
+	LastSignature string
+	// SignedAt is only part of SecuredDataV3.
+	SignedAt time.Time
+	// Operation and TransactionNumber identify the step of a FiscalTransaction, if any.
+	Operation         Operation
+	TransactionNumber int
+}
+
+// Encode returns the bytes a device signs for the secured data and the secured data
+// reported to clients, exactly as Sign creates them.
+func (s SecuredData) Encode() (toBeSigned []byte, reported string, err error) {
+	payload, err := s.Payload.prepare()
+	if err != nil {
+		return nil, "", err
+	}
+	return s.Format.encode(s.DeviceId, s.Counter, payload, s.LastSignature, s.SignedAt, transactionStep{operation: s.Operation, number: s.TransactionNumber})
+}
+
+// ParseSecuredData reads the SecuredData of transaction. It is the inverse of Encode
+// for well-formed secured data; verifiers encode the result again and compare it
+// with the signed data to detect anything Encode would not produce. SecuredDataV1
+// does not carry the device id and the payload encoding, which are taken from the
+// transaction.
+func ParseSecuredData(transaction *Transaction) (SecuredData, error) {
+	format := transaction.SecuredDataFormat
+	if format == "" {
+		format = SecuredDataV1
+	}
+	secured := SecuredData{Format: format, DeviceId: transaction.DeviceId}
+
+	switch format {
+	case SecuredDataV1:
+		parts := strings.SplitN(transaction.SignedData, SecuredDataSeparator, 3)
+		if len(parts) != 3 {
+			return SecuredData{}, fmt.Errorf("secured data %q is not <counter>_<data>_<last_signature>", transaction.SignedData)
+		}
+		counter, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return SecuredData{}, fmt.Errorf("secured data counter %q is not a number", parts[0])
+		}
+		payload, err := parsePayload(transaction.DataEncoding, parts[1])
+		if err != nil {
+			return SecuredData{}, err
+		}
+		secured.Counter, secured.Payload, secured.LastSignature = counter, payload, parts[2]
+	case SecuredDataV2, SecuredDataV3:
+		decoder := json.NewDecoder(strings.NewReader(transaction.SignedData))
+		decoder.DisallowUnknownFields()
+		var member securedData
+		if err := decoder.Decode(&member); err != nil {
+			return SecuredData{}, fmt.Errorf("secured data is not a %s object: %w", format, err)
+		}
+		if member.Format != format {
+			return SecuredData{}, fmt.Errorf("secured data has format %q instead of %q", member.Format, format)
+		}
+		payload, err := parsePayload(member.Encoding, member.Data)
+		if err != nil {
+			return SecuredData{}, err
+		}
+		if member.SignedAt != "" {
+			signedAt, err := time.Parse(time.RFC3339Nano, member.SignedAt)
+			if err != nil {
+				return SecuredData{}, fmt.Errorf("secured data signed_at %q is not an RFC 3339 time", member.SignedAt)
+			}
+			secured.SignedAt = signedAt
+		}
+		secured.DeviceId, secured.Counter, secured.Payload, secured.LastSignature = member.DeviceId, member.Counter, payload, member.LastSignature
+		secured.Operation, secured.TransactionNumber = member.Operation, member.TransactionNumber
+	default:
+		return SecuredData{}, ErrUnsupportedSecuredDataFormat
+	}
+
+	// Counter 0 chains to the device id instead of a signature.
+	if secured.Counter == 0 {
+		secured.LastSignature = ""
+	}
+	return secured, nil
+}
+
+// securedData is the member order of SecuredDataV2.
+type securedData struct {
+	Counter       int               `json:"counter"`
+	Data          string            `json:"data"`
+	DeviceId      string            `json:"device_id"`
+	Encoding      PayloadEncoding   `json:"encoding,omitempty"`
+	Format        SecuredDataFormat `json:"format"`
+	LastSignature string            `json:"last_signature"`
+	Operation     Operation         `json:"operation,omitempty"`
+	SignedAt      string            `json:"signed_at,omitempty"`
+	// TransactionNumber starts at 1, so omitting 0 only drops it outside of a step.
+	TransactionNumber int `json:"transaction_number,omitempty"`
+}
+
+// encode returns the bytes to be signed and the secured data reported to clients.
+// lastSignature is the signature of the previous transaction, empty at counter 0.
+// step is the zero step for signatures outside of a FiscalTransaction.
+func (f SecuredDataFormat) encode(deviceId string, counter int, payload preparedPayload, lastSignature string, signedAt time.Time, step transactionStep) (toBeSigned []byte, reported string, err error) {
+	data := payload.data
+	chained := lastSignature
+	if counter == 0 {
+		chained = base64.StdEncoding.EncodeToString([]byte(deviceId))
+	}
+
+	switch f {
+	case SecuredDataV1:
+		if step != (transactionStep{}) {
+			return nil, "", fmt.Errorf("%w: transactions require %s or later", ErrUnsupportedSecuredDataFormat, SecuredDataV2)
+		}
+		if strings.Contains(data, SecuredDataSeparator) {
+			return nil, "", ErrAmbiguousData
+		}
+		toBeSigned = []byte(fmt.Sprintf("%d_%s_%s", counter, data, lastSignature))
+		return toBeSigned, fmt.Sprintf("%d_%s_%s", counter, data, chained), nil
+	case SecuredDataV2, SecuredDataV3:
+		member := securedData{
+			Counter:           counter,
+			Data:              data,
+			DeviceId:          deviceId,
+			Format:            f,
+			LastSignature:     chained,
+			Operation:         step.operation,
+			TransactionNumber: step.number,
+		}
+		if payload.Encoding != PayloadText {
+			member.Encoding = payload.Encoding
+		}
+		if f == SecuredDataV3 {
+			member.SignedAt = signedAt.UTC().Format(time.RFC3339Nano)
+		}
+
+		var buffer bytes.Buffer
+		encoder := json.NewEncoder(&buffer)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(member); err != nil {
+			return nil, "", err
+		}
+		toBeSigned = bytes.TrimSuffix(buffer.Bytes(), []byte("\n"))
+		return toBeSigned, string(toBeSigned), nil
+	}
+	return nil, "", ErrUnsupportedSecuredDataFormat
+}
@@ -0,0 +1,171 @@
+package domain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+)
+
+// verifies reports whether signature is a valid signature of the ECC device over data.
+func verifies(t *testing.T, device *SignatureDevice, data, signature string) bool {
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256([]byte(data))
+	return ecdsa.VerifyASN1(device.signer.(crypto.PublicSigner).Public().(*ecdsa.PublicKey), hash[:], decoded)
+}
+
+func TestSecuredDataV1KeepsLegacyEncoding(t *testing.T) {
+	device, _ := NewSignatureDevice("test-device", "ECC", "Test Device")
+	device.SecuredDataFormat = SecuredDataV1
+
+	first, err := device.Sign(context.Background(), "data")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if first.SecuredDataFormat != SecuredDataV1 {
+		t.Errorf("Expected format %s, got %s", SecuredDataV1, first.SecuredDataFormat)
+	}
+	if expected := "0_data_" + base64.StdEncoding.EncodeToString([]byte("test-device")); first.SignedData != expected {
+		t.Errorf("Expected signed data %s, got %s", expected, first.SignedData)
+	}
+	if !verifies(t, device, "0_data_", first.Signature) {
+		t.Errorf("Expected the first signature over an empty last signature")
+	}
+
+	second, _ := device.Sign(context.Background(), "data")
+	if expected := "1_data_" + first.Signature; second.SignedData != expected {
+		t.Errorf("Expected signed data %s, got %s", expected, second.SignedData)
+	}
+	if !verifies(t, device, second.SignedData, second.Signature) {
+		t.Errorf("Expected the second signature over the signed data")
+	}
+}
+
+func TestSecuredDataV2SignsReportedData(t *testing.T) {
+	device, _ := NewSignatureDevice("test-device", "ECC", "Test Device")
+	device.SecuredDataFormat = SecuredDataV2
+
+	first, err := device.Sign(context.Background(), "a_b<c>")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `{"counter":0,"data":"a_b<c>","device_id":"test-device","format":"v2","last_signature":"dGVzdC1kZXZpY2U="}`
+	if first.SignedData != expected {
+		t.Errorf("Expected signed data %s, got %s", expected, first.SignedData)
+	}
+	if first.SecuredDataFormat != SecuredDataV2 {
+		t.Errorf("Expected format %s, got %s", SecuredDataV2, first.SecuredDataFormat)
+	}
+	if !verifies(t, device, first.SignedData, first.Signature) {
+		t.Errorf("Expected the first signature over the signed data")
+	}
+
+	second, _ := device.Sign(context.Background(), "data")
+	if !verifies(t, device, second.SignedData, second.Signature) {
+		t.Errorf("Expected the second signature over the signed data")
+	}
+}
+
+func TestParseSecuredDataFormat(t *testing.T) {
+	if format, err := ParseSecuredDataFormat(""); err != nil || format != SecuredDataV3 {
+		t.Errorf("Expected %s by default, got %s, %v", SecuredDataV3, format, err)
+	}
+	if format, err := ParseSecuredDataFormat("v2"); err != nil || format != SecuredDataV2 {
+		t.Errorf("Expected %s, got %s, %v", SecuredDataV2, format, err)
+	}
+	if _, err := ParseSecuredDataFormat("v9"); !errors.Is(err, ErrUnsupportedSecuredDataFormat) {
+		t.Errorf("Expected unsupported format error, got %v", err)
+	}
+}
+
+func TestSecuredDataOfBinaryPayloads(t *testing.T) {
+	device, _ := NewSignatureDevice("test-device", "ECC", "Test Device")
+	device.SecuredDataFormat = SecuredDataV1
+
+	transaction, err := device.SignPayload(context.Background(), Payload{Encoding: PayloadBinary, Data: []byte{0xff, 0xfe}}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := "0_//4=_dGVzdC1kZXZpY2U="; transaction.SignedData != expected {
+		t.Errorf("Expected signed data %s, got %s", expected, transaction.SignedData)
+	}
+	if transaction.DataEncoding != PayloadBinary {
+		t.Errorf("Expected data encoding %s, got %s", PayloadBinary, transaction.DataEncoding)
+	}
+
+	device.SecuredDataFormat = SecuredDataV2
+	transaction, err = device.SignPayload(context.Background(), Payload{Encoding: PayloadSHA256, Data: make([]byte, 32)}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `{"counter":1,"data":"` + strings.Repeat("00", 32) + `","device_id":"test-device","encoding":"sha256","format":"v2","last_signature":"`
+	if !strings.HasPrefix(transaction.SignedData, expected) {
+		t.Errorf("Expected signed data to start with %s, got %s", expected, transaction.SignedData)
+	}
+
+	if _, err := device.SignPayload(context.Background(), Payload{Encoding: PayloadSHA256, Data: []byte{0x00}}, nil); !errors.Is(err, ErrInvalidDigest) {
+		t.Errorf("Expected invalid digest error, got %v", err)
+	}
+}
+
+func TestSecuredDataV3CarriesSigningTime(t *testing.T) {
+	device, _ := NewSignatureDevice("test-device", "ECC", "Test Device")
+	device.SecuredDataFormat = SecuredDataV3
+
+	transaction, err := device.Sign(context.Background(), "data")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var secured struct {
+		SignedAt time.Time `json:"signed_at"`
+	}
+	if err := json.Unmarshal([]byte(transaction.SignedData), &secured); err != nil {
+		t.Fatalf("Error unmarshaling signed data: %v", err)
+	}
+	if !secured.SignedAt.Equal(transaction.CreatedAt) {
+		t.Errorf("Expected signing time %s, got %s", transaction.CreatedAt, secured.SignedAt)
+	}
+	if !verifies(t, device, transaction.SignedData, transaction.Signature) {
+		t.Errorf("Expected the signature over the signed data")
+	}
+}
+
+func TestParseSecuredDataRebuildsSignedData(t *testing.T) {
+	for _, format := range SecuredDataFormats {
+		device, _ := NewSignatureDevice("test-device", "ECC", "Test Device")
+		device.SecuredDataFormat = format
+
+		for _, payload := range []Payload{TextPayload("first"), {Encoding: PayloadSHA256, Data: make([]byte, 32)}} {
+			transaction, err := device.SignPayload(context.Background(), payload, nil)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			secured, err := ParseSecuredData(transaction)
+			if err != nil {
+				t.Fatalf("Unexpected error parsing %s: %v", format, err)
+			}
+			toBeSigned, reported, err := secured.Encode()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if reported != transaction.SignedData {
+				t.Errorf("Expected %s to rebuild %s, got %s", format, transaction.SignedData, reported)
+			}
+			if !verifies(t, device, string(toBeSigned), transaction.Signature) {
+				t.Errorf("Expected the signature of counter %d in %s to verify over the rebuilt data", transaction.Counter, format)
+			}
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package domain
+
+import "time"
+
+// Transaction records a single signature created by a SignatureDevice.
+type Transaction struct {
+	TenantId   string `json:"tenant_id,omitempty"`
+	DeviceId   string `json:"device_id"`
+	Counter    int    `json:"counter"`
+	Signature  string `json:"signature"`
+	SignedData string `json:"signed_data"`
+	// SecuredDataFormat tells how SignedData is encoded, and so how verifiers rebuild
+	// the signed bytes from it.
+	SecuredDataFormat SecuredDataFormat `json:"secured_data_format"`
+	// DataEncoding tells how the data is represented in SignedData.
+	DataEncoding PayloadEncoding `json:"data_encoding"`
+	APIKeyId     string          `json:"api_key_id,omitempty"`
+	// TransactionId and Operation identify the step of the FiscalTransaction the
+	// signature was issued for, if any.
+	TransactionId string    `json:"transaction_id,omitempty"`
+	Operation     Operation `json:"operation,omitempty"`
+	// CreatedAt is the signing time, which SecuredDataV3 also signs.
+	CreatedAt time.Time `json:"created_at"`
+	// TimestampToken is the DER encoded RFC 3161 timestamp token a timestamp
+	// authority issued over the signature, if one was requested.
+	TimestampToken []byte     `json:"timestamp_token,omitempty"`
+	TimestampedAt  *time.Time `json:"timestamped_at,omitempty"`
+	// IdempotencyKey and RequestFingerprint identify the request that created
+	// the signature if it carried an idempotency key, so that a repetition is
+	// answered with this signature instead of a new one. They are never encoded.
+	IdempotencyKey     string `json:"-"`
+	RequestFingerprint string `json:"-"`
+}
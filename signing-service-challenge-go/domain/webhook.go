@@ -0,0 +1,165 @@
+package domain
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrWebhookNotFound  = fmt.Errorf("webhook not found")
+	ErrInvalidWebhook   = fmt.Errorf("invalid webhook")
+	ErrDeliveryNotFound = fmt.Errorf("webhook delivery not found")
+)
+
+const webhookSecretLength = 32
+
+// Webhook subscribes a URL to the events of the devices of a tenant. Every
+// delivery is signed with its secret, which is handed out once when the webhook is
+// created.
+type Webhook struct {
+	Id       string `json:"id"`
+	TenantId string `json:"tenant_id,omitempty"`
+	URL      string `json:"url"`
+	// Events are the types of the events delivered, every type if empty.
+	Events    []EventType `json:"events"`
+	Secret    string      `json:"-"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598, which is not
+// reachable from the internet either.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// PublicWebhookAddress reports whether a webhook may be delivered to addr. Loopback,
+// link-local, private and other addresses that are not reachable from the internet
+// are refused, so that tenants cannot make the service call into its own network.
+func PublicWebhookAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// NewWebhook creates a Webhook with a random secret for an absolute http or https
+// URL. A host given as an address must be a PublicWebhookAddress; host names are
+// checked when they are resolved for a delivery, since their addresses may change.
+func NewWebhook(id, rawURL string, events []EventType) (*Webhook, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("%w: %q is not an absolute http or https URL", ErrInvalidWebhook, rawURL)
+	}
+	host := strings.ToLower(strings.TrimSuffix(target.Hostname(), "."))
+	if addr, err := netip.ParseAddr(host); (err == nil && !PublicWebhookAddress(addr)) || host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return nil, fmt.Errorf("%w: %q is not a public address", ErrInvalidWebhook, rawURL)
+	}
+	for _, eventType := range events {
+		if !eventType.valid() {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidEventType, eventType)
+		}
+	}
+
+	secret := make([]byte, webhookSecretLength)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	if events == nil {
+		events = []EventType{}
+	}
+	return &Webhook{
+		Id:        id,
+		URL:       rawURL,
+		Events:    events,
+		Secret:    "whsec_" + base64.RawURLEncoding.EncodeToString(secret),
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+// Subscribes reports whether the Webhook receives events of eventType.
+func (w *Webhook) Subscribes(eventType EventType) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, subscribed := range w.Events {
+		if subscribed == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// DeliveryState is the progress of a WebhookDelivery.
+type DeliveryState string
+
+const (
+	// DeliveryPending deliveries are attempted until they succeed or run out of attempts.
+	DeliveryPending DeliveryState = "PENDING"
+	// DeliveryDelivered deliveries were acknowledged by the webhook.
+	DeliveryDelivered DeliveryState = "DELIVERED"
+	// DeliveryDead deliveries ran out of attempts. They stay for inspection until
+	// they are retried.
+	DeliveryDead DeliveryState = "DEAD"
+)
+
+// WebhookDelivery is the delivery of an Event to a Webhook.
+type WebhookDelivery struct {
+	Id        string        `json:"id"`
+	TenantId  string        `json:"tenant_id,omitempty"`
+	WebhookId string        `json:"webhook_id"`
+	Event     *Event        `json:"event"`
+	State     DeliveryState `json:"state"`
+	Attempts  int           `json:"attempts"`
+	// NextAttemptAt is when a pending delivery is attempted next.
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	LastAttemptAt *time.Time `json:"last_attempt_at,omitempty"`
+	// LastStatus is the HTTP status of the response to the last attempt, zero if
+	// there was none.
+	LastStatus  int        `json:"last_status,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+}
+
+// NewWebhookDelivery creates the pending delivery of event to webhook.
+func NewWebhookDelivery(id string, webhook *Webhook, event *Event) *WebhookDelivery {
+	return &WebhookDelivery{
+		Id:            id,
+		TenantId:      webhook.TenantId,
+		WebhookId:     webhook.Id,
+		Event:         event,
+		State:         DeliveryPending,
+		NextAttemptAt: event.OccurredAt,
+	}
+}
+
+// Succeed records an attempt at now that the webhook acknowledged with status.
+func (d *WebhookDelivery) Succeed(now time.Time, status int) {
+	d.Attempts++
+	d.LastAttemptAt, d.DeliveredAt = &now, &now
+	d.LastStatus, d.LastError = status, ""
+	d.State = DeliveryDelivered
+}
+
+// Fail records a failed attempt at now, with the status of the response if there
+// was one. The delivery is attempted again at next, or is dead if next is zero.
+func (d *WebhookDelivery) Fail(now time.Time, status int, reason string, next time.Time) {
+	d.Attempts++
+	d.LastAttemptAt = &now
+	d.LastStatus, d.LastError = status, reason
+	if next.IsZero() {
+		d.State = DeliveryDead
+		return
+	}
+	d.NextAttemptAt = next
+}
+
+// Retry makes the delivery pending again with a fresh budget of attempts, the
+// first one at now.
+func (d *WebhookDelivery) Retry(now time.Time) {
+	d.State = DeliveryPending
+	d.Attempts = 0
+	d.NextAttemptAt = now
+	d.DeliveredAt = nil
+}
@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewWebhookRejectsInternalAddresses(t *testing.T) {
+	for _, rawURL := range []string{
+		"http://127.0.0.1/hook",
+		"http://localhost:8080/hook",
+		"http://metrics.localhost/hook",
+		"http://10.0.0.1/hook",
+		"http://192.168.1.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://100.64.0.1/hook",
+		"http://0.0.0.0/hook",
+		"http://[::1]/hook",
+		"http://[fe80::1]/hook",
+		"http://[fd00::1]/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+	} {
+		if _, err := NewWebhook("webhook", rawURL, nil); !errors.Is(err, ErrInvalidWebhook) {
+			t.Errorf("Expected %s to be rejected, got %v", rawURL, err)
+		}
+	}
+
+	for _, rawURL := range []string{"https://example.com/hook", "http://93.184.216.34/hook", "https://[2606:2800:220:1::1]/hook"} {
+		if _, err := NewWebhook("webhook", rawURL, nil); err != nil {
+			t.Errorf("Expected %s to be accepted, got %v", rawURL, err)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+// Package export archives the signature log of a signature device for auditors.
+//
+// An export is a TAR archive of the files:
+//
+//   - device.json, the metadata of the device
+//   - public_key.pem, the public key that verifies every signature
+//   - transactions.csv and transactions.jsonl, the signed transactions in counter order
+//   - manifest.json, the size and SHA-256 digest of every file above
+//   - manifest.sig, the base64 encoded signature of the device over manifest.json
+//
+// TAR headers carry the size of a file before its content, so the transaction logs
+// are spooled to temporary files first. Memory use does not grow with the log.
+package export
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+// The files of an export.
+const (
+	DeviceFile            = "device.json"
+	PublicKeyFile         = "public_key.pem"
+	TransactionsCSVFile   = "transactions.csv"
+	TransactionsJSONFile  = "transactions.jsonl"
+	ManifestFile          = "manifest.json"
+	ManifestSignatureFile = "manifest.sig"
+)
+
+// ManifestFormat identifies manifests. It is the first member of every manifest, so
+// a manifest signature cannot be mistaken for the signature of secured data.
+const ManifestFormat = "signing-service-export/v1"
+
+// ContentType is the media type of an export.
+const ContentType = "application/x-tar"
+
+// csvHeader names the columns of transactions.csv.
+var csvHeader = []string{
+	"counter", "created_at", "transaction_id", "operation", "secured_data_format", "data_encoding",
+	"signed_data", "signature", "timestamped_at", "timestamp_token", "api_key_id",
+}
+
+// Range selects the transactions signed at or after From and before To. A zero
+// bound does not restrict the range.
+type Range struct {
+	From time.Time
+	To   time.Time
+}
+
+// contains reports whether t lies within the range.
+func (r Range) contains(t time.Time) bool {
+	return (r.From.IsZero() || !t.Before(r.From)) && (r.To.IsZero() || t.Before(r.To))
+}
+
+// Manifest lists every file of an export with its digest.
+type Manifest struct {
+	Format       string     `json:"format"`
+	DeviceId     string     `json:"device_id"`
+	TenantId     string     `json:"tenant_id,omitempty"`
+	From         *time.Time `json:"from,omitempty"`
+	To           *time.Time `json:"to,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	Transactions int        `json:"transactions"`
+	Files        []File     `json:"files"`
+}
+
+// File describes a file of an export.
+type File struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// entry is a file of the archive.
+type entry struct {
+	name    string
+	content *io.SectionReader
+}
+
+// Export is an archive prepared for writing. It must be closed to release its
+// temporary files.
+type Export struct {
+	Manifest Manifest
+	entries  []entry
+	spools   []*os.File
+}
+
+// Prepare reads the transactions of device within r from repo and signs the
+// manifest of the export. Errors of the repository surface here, before anything
+// is written.
+func Prepare(ctx context.Context, repo persistence.TransactionRepository, device *domain.SignatureDevice, r Range) (_ *Export, err error) {
+	e := &Export{Manifest: Manifest{
+		Format:    ManifestFormat,
+		DeviceId:  device.Id,
+		TenantId:  device.TenantId,
+		CreatedAt: time.Now().UTC(),
+	}}
+	if !r.From.IsZero() {
+		e.Manifest.From = &r.From
+	}
+	if !r.To.IsZero() {
+		e.Manifest.To = &r.To
+	}
+	defer func() {
+		if err != nil {
+			e.Close()
+		}
+	}()
+
+	metadata, err := json.MarshalIndent(device, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	e.add(DeviceFile, metadata)
+
+	publicKey, err := device.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	e.add(PublicKeyFile, publicKey)
+
+	if err := e.spoolTransactions(ctx, repo, device, r); err != nil {
+		return nil, err
+	}
+
+	manifest, err := json.MarshalIndent(e.Manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	signature, err := device.SignDocument(ctx, manifest)
+	if err != nil {
+		return nil, err
+	}
+	e.entries = append(e.entries,
+		entry{ManifestFile, io.NewSectionReader(bytes.NewReader(manifest), 0, int64(len(manifest)))},
+		entry{ManifestSignatureFile, io.NewSectionReader(bytes.NewReader([]byte(signature)), 0, int64(len(signature)))},
+	)
+	return e, nil
+}
+
+// add adds a file held in memory and lists it in the manifest.
+func (e *Export) add(name string, content []byte) {
+	digest := sha256.Sum256(content)
+	e.entries = append(e.entries, entry{name, io.NewSectionReader(bytes.NewReader(content), 0, int64(len(content)))})
+	e.Manifest.Files = append(e.Manifest.Files, File{Name: name, Size: int64(len(content)), SHA256: hex.EncodeToString(digest[:])})
+}
+
+// spoolTransactions writes both transaction logs to temporary files.
+func (e *Export) spoolTransactions(ctx context.Context, repo persistence.TransactionRepository, device *domain.SignatureDevice, r Range) error {
+	csvSpool, err := e.newSpool()
+	if err != nil {
+		return err
+	}
+	jsonSpool, err := e.newSpool()
+	if err != nil {
+		return err
+	}
+
+	table := csv.NewWriter(csvSpool)
+	table.Write(csvHeader)
+	lines := json.NewEncoder(jsonSpool)
+
+	err = repo.WalkTransactions(ctx, device.TenantId, device.Id, func(transaction *domain.Transaction) error {
+		if !r.contains(transaction.CreatedAt) {
+			return nil
+		}
+		e.Manifest.Transactions++
+		if err := table.Write(record(transaction)); err != nil {
+			return err
+		}
+		return lines.Encode(transaction)
+	})
+	if err != nil {
+		return err
+	}
+	table.Flush()
+	if err := table.Error(); err != nil {
+		return err
+	}
+
+	for _, spooled := range []struct {
+		name  string
+		spool *spool
+	}{{TransactionsCSVFile, csvSpool}, {TransactionsJSONFile, jsonSpool}} {
+		file, err := spooled.spool.finish(spooled.name)
+		if err != nil {
+			return err
+		}
+		e.entries = append(e.entries, entry{spooled.name, io.NewSectionReader(spooled.spool.file, 0, file.Size)})
+		e.Manifest.Files = append(e.Manifest.Files, file)
+	}
+	return nil
+}
+
+// record returns the CSV record of transaction.
+func record(transaction *domain.Transaction) []string {
+	var timestampedAt, timestampToken string
+	if transaction.TimestampedAt != nil {
+		timestampedAt = transaction.TimestampedAt.Format(time.RFC3339)
+	}
+	if transaction.TimestampToken != nil {
+		timestampToken = base64.StdEncoding.EncodeToString(transaction.TimestampToken)
+	}
+	return []string{
+		strconv.Itoa(transaction.Counter),
+		transaction.CreatedAt.Format(time.RFC3339Nano),
+		transaction.TransactionId,
+		string(transaction.Operation),
+		string(transaction.SecuredDataFormat),
+		string(transaction.DataEncoding),
+		transaction.SignedData,
+		transaction.Signature,
+		timestampedAt,
+		timestampToken,
+		transaction.APIKeyId,
+	}
+}
+
+// spool is a temporary file that digests everything written to it.
+type spool struct {
+	*bufio.Writer
+	file *os.File
+	hash hash.Hash
+}
+
+// newSpool creates a spool released by Close.
+func (e *Export) newSpool() (*spool, error) {
+	file, err := os.CreateTemp("", "signing-service-export-*")
+	if err != nil {
+		return nil, err
+	}
+	e.spools = append(e.spools, file)
+
+	digest := sha256.New()
+	return &spool{Writer: bufio.NewWriter(io.MultiWriter(file, digest)), file: file, hash: digest}, nil
+}
+
+// finish flushes the spool and describes its content as the file name.
+func (s *spool) finish(name string) (File, error) {
+	if err := s.Flush(); err != nil {
+		return File{}, err
+	}
+	info, err := s.file.Stat()
+	if err != nil {
+		return File{}, err
+	}
+	return File{Name: name, Size: info.Size(), SHA256: hex.EncodeToString(s.hash.Sum(nil))}, nil
+}
+
+// Write writes the export as a TAR archive to w.
+func (e *Export) Write(w io.Writer) error {
+	archive := tar.NewWriter(w)
+	for _, entry := range e.entries {
+		header := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     entry.name,
+			Mode:     0o644,
+			Size:     entry.content.Size(),
+			ModTime:  e.Manifest.CreatedAt,
+		}
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := io.Copy(archive, io.NewSectionReader(entry.content, 0, entry.content.Size())); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// Close removes the temporary files of the export.
+func (e *Export) Close() error {
+	var errs []error
+	for _, file := range e.spools {
+		errs = append(errs, file.Close(), os.Remove(file.Name()))
+	}
+	e.spools = nil
+	return errors.Join(errs...)
+}
@@ -0,0 +1,144 @@
+package export_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/export"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+// signedDevice returns a repository holding an ECC device that signed count transactions.
+func signedDevice(t *testing.T, count int) (*persistence.InMemoryPersistence, *domain.SignatureDevice) {
+	repo := persistence.NewInMemoryPersistence()
+	device, err := domain.NewSignatureDevice("device", "ECC", "Device")
+	if err != nil {
+		t.Fatal(err)
+	}
+	device.SecuredDataFormat = domain.SecuredDataV2
+	repo.SaveSignatureDevice(context.Background(), device)
+
+	for i := 0; i < count; i++ {
+		transaction, err := device.Sign(context.Background(), "receipt, \"quoted\"")
+		if err != nil {
+			t.Fatal(err)
+		}
+		repo.SaveTransaction(context.Background(), persistence.NoFence, transaction, nil)
+	}
+	return repo, device
+}
+
+// unpack returns the files of a TAR archive in order.
+func unpack(t *testing.T, archive []byte) ([]string, map[string][]byte) {
+	var names []string
+	files := make(map[string][]byte)
+	reader := tar.NewReader(bytes.NewReader(archive))
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return names, files
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error reading the archive: %v", err)
+		}
+		content, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+		files[header.Name] = content
+	}
+}
+
+func TestExport(t *testing.T) {
+	repo, device := signedDevice(t, 3)
+
+	archive, err := export.Prepare(context.Background(), repo, device, export.Range{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer archive.Close()
+
+	var buffer bytes.Buffer
+	if err := archive.Write(&buffer); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	names, files := unpack(t, buffer.Bytes())
+
+	expected := []string{export.DeviceFile, export.PublicKeyFile, export.TransactionsCSVFile, export.TransactionsJSONFile, export.ManifestFile, export.ManifestSignatureFile}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Expected files %v, got %v", expected, names)
+	}
+
+	var manifest export.Manifest
+	if err := json.Unmarshal(files[export.ManifestFile], &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Format != export.ManifestFormat || manifest.DeviceId != device.Id || manifest.Transactions != 3 {
+		t.Errorf("Unexpected manifest %+v", manifest)
+	}
+	for _, file := range manifest.Files {
+		digest := sha256.Sum256(files[file.Name])
+		if hex.EncodeToString(digest[:]) != file.SHA256 || int64(len(files[file.Name])) != file.Size {
+			t.Errorf("Expected the manifest to describe %s", file.Name)
+		}
+	}
+
+	block, _ := pem.Decode(files[export.PublicKeyFile])
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, _ := base64.StdEncoding.DecodeString(string(files[export.ManifestSignatureFile]))
+	digest := sha256.Sum256(files[export.ManifestFile])
+	if !ecdsa.VerifyASN1(publicKey.(*ecdsa.PublicKey), digest[:], signature) {
+		t.Errorf("Expected the manifest signature to verify with the exported public key")
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(files[export.TransactionsCSVFile])).ReadAll()
+	if err != nil {
+		t.Fatalf("Expected valid CSV: %v", err)
+	}
+	if len(records) != 4 || records[1][0] != "0" || records[3][0] != "2" {
+		t.Errorf("Expected a header and three transactions in counter order, got %v", records)
+	}
+	if lines := strings.Count(string(files[export.TransactionsJSONFile]), "\n"); lines != 3 {
+		t.Errorf("Expected %d JSON lines, got %d", 3, lines)
+	}
+}
+
+func TestExportRange(t *testing.T) {
+	repo, device := signedDevice(t, 3)
+	transactions, _ := repo.ListTransactions(context.Background(), "", device.Id)
+	transactions[0].CreatedAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	transactions[1].CreatedAt = time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	transactions[2].CreatedAt = time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	archive, err := export.Prepare(context.Background(), repo, device, export.Range{
+		From: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer archive.Close()
+
+	if archive.Manifest.Transactions != 1 {
+		t.Errorf("Expected only the transaction of February, got %d", archive.Manifest.Transactions)
+	}
+}
@@ -0,0 +1,206 @@
+// Package health evaluates the health of the components of the service and reports
+// it in the health check response format for HTTP APIs (draft-inadarei-api-health-check).
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ContentType is the media type of a Response.
+const ContentType = "application/health+json"
+
+// DefaultTimeout bounds the probes of checks without a Timeout.
+const DefaultTimeout = 2 * time.Second
+
+// Status is the health of the service or of one of its components.
+type Status string
+
+const (
+	// Pass means healthy.
+	Pass Status = "pass"
+	// Warn means healthy, with some concerns.
+	Warn Status = "warn"
+	// Fail means unhealthy.
+	Fail Status = "fail"
+)
+
+// worse returns the worse of two statuses.
+func worse(a, b Status) Status {
+	rank := map[Status]int{Pass: 0, Warn: 1, Fail: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+// Response describes the health of the service.
+type Response struct {
+	Status    Status              `json:"status"`
+	Version   string              `json:"version,omitempty"`
+	ReleaseId string              `json:"releaseId,omitempty"`
+	Output    string              `json:"output,omitempty"`
+	Checks    map[string][]Result `json:"checks,omitempty"`
+}
+
+// Result is the outcome of a single check.
+type Result struct {
+	ComponentId   string    `json:"componentId"`
+	ComponentType string    `json:"componentType,omitempty"`
+	ObservedValue float64   `json:"observedValue"`
+	ObservedUnit  string    `json:"observedUnit"`
+	Status        Status    `json:"status"`
+	Time          time.Time `json:"time"`
+	Output        string    `json:"output,omitempty"`
+}
+
+// Probe checks a component and returns an error if it is unhealthy, or a Warning if
+// it is degraded but still serves its purpose.
+type Probe func(ctx context.Context) error
+
+type warning struct {
+	err error
+}
+
+func (w warning) Error() string { return w.err.Error() }
+func (w warning) Unwrap() error { return w.err }
+
+// Warning marks err as a concern that does not make its component unhealthy.
+func Warning(err error) error {
+	return warning{err: err}
+}
+
+// Cached returns a probe that runs probe at most once per interval and reports the
+// result of the last run in between, for probes too expensive to run on every
+// evaluation. Concurrent evaluations share a run. A run cut short by its context is
+// not kept.
+func Cached(probe Probe, interval time.Duration) Probe {
+	var mu sync.Mutex
+	var ran time.Time
+	var last error
+	return func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if !ran.IsZero() && time.Since(ran) < interval {
+			return last
+		}
+		err := probe(ctx)
+		if ctx.Err() == nil {
+			ran, last = time.Now(), err
+		}
+		return err
+	}
+}
+
+// Check is a probe of a component, reported as <Component>:responseTime.
+type Check struct {
+	// Component names the checked component, e.g. repository.
+	Component string
+	// ComponentType is component, datastore or system.
+	ComponentType string
+	Probe         Probe
+	// Timeout fails the check if the probe takes longer, DefaultTimeout if zero.
+	Timeout time.Duration
+	// WarnAfter warns if the probe takes longer. Zero disables the warning.
+	WarnAfter time.Duration
+}
+
+// Registry holds the checks of all components.
+type Registry struct {
+	mu     sync.Mutex
+	checks []Check
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a check that is run on every evaluation.
+func (r *Registry) Register(check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, check)
+}
+
+// Evaluate runs all checks concurrently and returns the overall status and the result
+// of every check. The overall status is the worst status of all checks.
+func (r *Registry) Evaluate(ctx context.Context) (Status, map[string][]Result) {
+	r.mu.Lock()
+	checks := append([]Check(nil), r.checks...)
+	r.mu.Unlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	status := Pass
+	byName := map[string][]Result{}
+	for i, result := range results {
+		status = worse(status, result.Status)
+		name := checks[i].Component + ":responseTime"
+		byName[name] = append(byName[name], result)
+	}
+	for _, results := range byName {
+		sort.Slice(results, func(i, j int) bool { return results[i].ComponentId < results[j].ComponentId })
+	}
+	return status, byName
+}
+
+// run runs the probe of a check within its timeout.
+func run(ctx context.Context, check Check) Result {
+	timeout := check.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- check.Probe(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("probe timed out after %s", timeout)
+	}
+	elapsed := time.Since(start)
+
+	result := Result{
+		ComponentId:   check.Component,
+		ComponentType: check.ComponentType,
+		ObservedValue: float64(elapsed.Microseconds()) / 1000,
+		ObservedUnit:  "ms",
+		Status:        Pass,
+		Time:          start.UTC(),
+	}
+
+	var w warning
+	switch {
+	case errors.As(err, &w):
+		result.Status = Warn
+		result.Output = err.Error()
+	case err != nil:
+		result.Status = Fail
+		result.Output = err.Error()
+	case check.WarnAfter > 0 && elapsed > check.WarnAfter:
+		result.Status = Warn
+		result.Output = fmt.Sprintf("responded after %s, expected within %s", elapsed.Round(time.Millisecond), check.WarnAfter)
+	}
+	return result
+}
@@ -0,0 +1,91 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEvaluate(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(Check{Component: "healthy", Probe: func(context.Context) error { return nil }})
+	registry.Register(Check{Component: "degraded", Probe: func(context.Context) error { return Warning(errors.New("slow")) }})
+
+	status, checks := registry.Evaluate(context.Background())
+	if status != Warn {
+		t.Errorf("Expected status %s, got %s", Warn, status)
+	}
+	if result := checks["healthy:responseTime"][0]; result.Status != Pass || result.ObservedUnit != "ms" {
+		t.Errorf("Expected a passing check in ms, got %+v", result)
+	}
+	if result := checks["degraded:responseTime"][0]; result.Status != Warn || result.Output != "slow" {
+		t.Errorf("Expected a warning with output, got %+v", result)
+	}
+
+	registry.Register(Check{Component: "broken", Probe: func(context.Context) error { return errors.New("down") }})
+	if status, _ := registry.Evaluate(context.Background()); status != Fail {
+		t.Errorf("Expected status %s, got %s", Fail, status)
+	}
+}
+
+func TestEvaluateTimesOut(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(Check{
+		Component: "hanging",
+		Timeout:   10 * time.Millisecond,
+		Probe: func(ctx context.Context) error {
+			time.Sleep(time.Second)
+			return nil
+		},
+	})
+
+	start := time.Now()
+	status, _ := registry.Evaluate(context.Background())
+	if status != Fail {
+		t.Errorf("Expected status %s, got %s", Fail, status)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected evaluation to stop at the timeout, took %s", elapsed)
+	}
+}
+
+func TestEvaluateWarnsWhenSlow(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(Check{
+		Component: "slow",
+		WarnAfter: time.Millisecond,
+		Probe: func(ctx context.Context) error {
+			time.Sleep(5 * time.Millisecond)
+			return nil
+		},
+	})
+
+	if status, _ := registry.Evaluate(context.Background()); status != Warn {
+		t.Errorf("Expected status %s, got %s", Warn, status)
+	}
+}
+
+func TestCachedRunsOncePerInterval(t *testing.T) {
+	runs := 0
+	failure := errors.New("broken")
+	probe := Cached(func(context.Context) error {
+		runs++
+		return failure
+	}, 50*time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		if err := probe(context.Background()); !errors.Is(err, failure) {
+			t.Errorf("Expected the cached failure, got %v", err)
+		}
+	}
+	if runs != 1 {
+		t.Errorf("Expected 1 run, got %d", runs)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	probe(context.Background())
+	if runs != 2 {
+		t.Errorf("Expected a run once the interval passed, got %d runs", runs)
+	}
+}
@@ -1,21 +1,436 @@
 package main
 
 import (
-	"log"
+	"context"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/redis/go-redis/v9"
 
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/audit"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/certs"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/config"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/devicelock"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/health"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/metrics"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/ratelimit"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/stream"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/tracing"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/tsa"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/version"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/webhook"
 )
 
-const (
-	ListenAddress = ":8080"
-)
+const ServiceName = "signing-service"
+
+const usage = `Usage:
+  signing-service [flags]               run the server
+  signing-service config print [flags]  print the effective configuration, secrets redacted
+
+Settings are read from the config file, the environment and the flags, each taking
+precedence over the former. Run with -h to list the flags.
+`
+
+// exitCode is the exit code of the process once main returns.
+var exitCode int
+
+// failure is an error that ends the process, logged with its message.
+type failure struct {
+	message string
+	err     error
+}
+
+func (f *failure) Error() string { return f.message + ": " + f.err.Error() }
+func (f *failure) Unwrap() error { return f.err }
+
+// fatal returns err as a failure that ends the process, logged with message.
+func fatal(message string, err error) error {
+	return &failure{message: message, err: err}
+}
+
+// exit logs err and sets exitCode, so that the process exits once main returns,
+// after the deferred functions ran.
+func exit(err error) {
+	var f *failure
+	if errors.As(err, &f) {
+		slog.Error(f.message, slog.String("error", f.err.Error()))
+	} else {
+		slog.Error(err.Error())
+	}
+	exitCode = 1
+}
+
+// load loads the configuration. It reports whether it succeeded, and sets exitCode
+// otherwise.
+func load(name string, args []string) (*config.Config, bool) {
+	cfg, err := config.Load(name, args, os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil, false
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid configuration:")
+		fmt.Fprintln(os.Stderr, err)
+		exitCode = 2
+		return nil, false
+	}
+	return cfg, true
+}
 
 func main() {
-	repository := persistence.NewInMemoryPersistence()
-	server := api.NewServer(ListenAddress, repository)
+	defer func() {
+		os.Exit(exitCode)
+	}()
+
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "config" {
+		if len(args) < 2 || args[1] != "print" {
+			fmt.Fprint(os.Stderr, usage)
+			exitCode = 2
+			return
+		}
+		cfg, ok := load("config print", args[2:])
+		if !ok {
+			return
+		}
+		if err := cfg.Print(os.Stdout); err != nil {
+			exit(fatal("Could not print configuration", err))
+		}
+		return
+	}
+
+	cfg, ok := load(ServiceName, args)
+	if !ok {
+		return
+	}
+	if err := run(cfg); err != nil {
+		exit(err)
+	}
+}
+
+// run starts the server as configured by cfg and serves until the process is
+// signaled to stop.
+func run(cfg *config.Config) error {
+	level, _ := cfg.Log.SlogLevel()
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
+	slog.SetDefault(logger)
+	slog.Info("Starting", slog.String("version", version.Version), slog.String("commit", version.Commit))
+
+	auditLog := audit.New(os.Stderr)
+	if cfg.Log.AuditFile != "" {
+		var closer io.Closer
+		var err error
+		auditLog, closer, err = audit.Open(cfg.Log.AuditFile)
+		if err != nil {
+			return fatal("Could not open audit log", err)
+		}
+		defer closer.Close()
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		ServiceName: ServiceName,
+	})
+	if err != nil {
+		return fatal("Could not set up tracing", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	telemetry := metrics.New()
+
+	storage, closeStorage, err := openRepository(cfg.Storage)
+	if err != nil {
+		return fatal("Could not open storage", err)
+	}
+	defer closeStorage()
+	repository := telemetry.InstrumentRepository(
+		tracing.InstrumentRepository(storage, cfg.Storage.Backend),
+	)
+	telemetry.CountDevices(repository)
+
+	if cfg.Auth.AdminKey != "" {
+		key, err := domain.NewAPIKeyWithSecret("bootstrap", "bootstrap", cfg.Auth.AdminKey, []domain.Scope{domain.ScopeAdmin, domain.ScopePlatform})
+		if err != nil {
+			return fatal("Could not create bootstrap API key", err)
+		}
+		if err := repository.SaveAPIKey(context.Background(), key); err != nil {
+			return fatal("Could not store bootstrap API key", err)
+		}
+	} else {
+		slog.Warn("No bootstrap API key set, API keys cannot be issued")
+	}
+
+	var store ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.RateLimits.RedisAddress != "" {
+		store = ratelimit.NewRedisStore(redis.NewClient(&redis.Options{Addr: cfg.RateLimits.RedisAddress}), "signing-service:ratelimit:")
+	}
+	limiter := ratelimit.NewLimiter(store, ratelimit.Limits{
+		Device: ratelimit.Limit(cfg.RateLimits.Device),
+		APIKey: ratelimit.Limit(cfg.RateLimits.APIKey),
+		Tenant: ratelimit.Limit(cfg.RateLimits.Tenant),
+	})
+
+	checks := health.NewRegistry()
+	checks.Register(health.Check{
+		Component:     "repository",
+		ComponentType: "datastore",
+		WarnAfter:     100 * time.Millisecond,
+		Probe: func(ctx context.Context) error {
+			return persistence.Ping(ctx, repository)
+		},
+	})
+	checks.Register(health.Check{
+		Component:     "signer",
+		ComponentType: "component",
+		// Signing with RSA is too expensive for every probe of a load balancer.
+		Probe: health.Cached(func(context.Context) error {
+			return crypto.SelfTest()
+		}, time.Minute),
+	})
+	if cfg.RateLimits.RedisAddress != "" {
+		checks.Register(health.Check{
+			Component:     "ratelimit",
+			ComponentType: "datastore",
+			WarnAfter:     50 * time.Millisecond,
+			// The limiter admits requests if its store fails, which degrades but does not break the service.
+			Probe: func(ctx context.Context) error {
+				if err := limiter.Ping(ctx); err != nil {
+					return health.Warning(err)
+				}
+				return nil
+			},
+		})
+	}
+
+	var forwarder *stream.Forwarder
+	if cfg.Stream.NATSURL != "" {
+		conn, err := nats.Connect(cfg.Stream.NATSURL, nats.Name(ServiceName), nats.MaxReconnects(-1))
+		if err != nil {
+			return fatal("Could not connect to NATS", err)
+		}
+		defer conn.Close()
+		publisher, err := stream.NewNATSPublisher(conn, cfg.Stream.Subject)
+		if err != nil {
+			return fatal("Could not publish signatures", err)
+		}
+		forwarder = stream.NewForwarder(repository, publisher)
+		checks.Register(health.Check{
+			Component:     "stream",
+			ComponentType: "component",
+			// Signatures wait in the outbox while NATS is unreachable, which delays but does not lose them.
+			Probe: func(context.Context) error {
+				if status := conn.Status(); status != nats.CONNECTED {
+					return health.Warning(errors.New("NATS connection is " + status.String()))
+				}
+				return nil
+			},
+		})
+	}
+
+	options := []api.Option{
+		api.WithAuthentication(),
+		api.WithRateLimiter(limiter),
+		api.WithHealthChecks(checks),
+		api.WithLogger(logger),
+		api.WithAuditLog(auditLog),
+		api.WithMaxBodySize(int64(cfg.Server.MaxBodyBytes)),
+		api.WithTransactionTimeout(cfg.Transactions.Timeout),
+		api.WithKeyParameters(domain.KeyParameters{RSABits: cfg.Keys.RSABits, ECCCurve: cfg.Keys.ECCCurve}),
+	}
+	if cfg.Server.LegacyErrors {
+		options = append(options, api.WithLegacyErrors())
+	}
+	if cfg.Metrics.Enabled {
+		options = append(options, api.WithMetrics(telemetry))
+	}
+	if cfg.DeviceLocks.RedisAddress != "" {
+		client := redis.NewClient(&redis.Options{Addr: cfg.DeviceLocks.RedisAddress})
+		options = append(options, api.WithDeviceLocker(devicelock.NewRedisLocker(client, "signing-service:lock:", cfg.DeviceLocks.TTL)))
+		checks.Register(health.Check{
+			Component:     "devicelock",
+			ComponentType: "datastore",
+			WarnAfter:     50 * time.Millisecond,
+			// Without leases no device can sign.
+			Probe: func(ctx context.Context) error {
+				return client.Ping(ctx).Err()
+			},
+		})
+	}
+	if cfg.TSA.URL != "" {
+		client := &tsa.Client{URL: cfg.TSA.URL, HTTPClient: &http.Client{Timeout: cfg.TSA.Timeout}}
+		if cfg.TSA.CAFile != "" {
+			pem, err := os.ReadFile(cfg.TSA.CAFile)
+			if err != nil {
+				return fatal("Could not read the CA certificates of the timestamp authority", err)
+			}
+			client.Roots = x509.NewCertPool()
+			if !client.Roots.AppendCertsFromPEM(pem) {
+				return fatal("Could not read the CA certificates of the timestamp authority", errors.New("no certificates in "+cfg.TSA.CAFile))
+			}
+		}
+		options = append(options, api.WithTimestampAuthority(client))
+	}
+	if cfg.TLS.CertFile != "" {
+		reloader, err := certs.NewReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile, cfg.TLS.ReloadInterval)
+		if err != nil {
+			return fatal("Could not load TLS certificate", err)
+		}
+		tlsConfig, err := certs.ServerConfig(reloader, certs.ClientAuth(cfg.TLS.ClientAuth), cfg.TLS.ClientCAFile)
+		if err != nil {
+			return fatal("Could not configure TLS", err)
+		}
+		options = append(options, api.WithTLS(tlsConfig))
+
+		identities := make(map[string]api.ClientIdentity)
+		for _, identity := range cfg.TLS.ClientIdentities {
+			scopes := make([]domain.Scope, 0, len(identity.Scopes))
+			for _, scope := range identity.Scopes {
+				scopes = append(scopes, domain.Scope(scope))
+			}
+			identities[identity.CommonName] = api.ClientIdentity{TenantId: identity.TenantId, Scopes: scopes}
+		}
+		options = append(options, api.WithClientCertificates(identities))
+	} else {
+		slog.Warn("Serving plain HTTP, signing payloads cross the network in cleartext unless a proxy terminates TLS")
+	}
+
+	server := api.NewServer(cfg.Server.ListenAddress, repository, options...)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	failed := make(chan error, 1)
+	go func() {
+		failed <- server.Run()
+	}()
+
+	// The background work writes to the repository, so it is stopped and waited for
+	// before the deferred closeStorage runs.
+	var background sync.WaitGroup
+	backgroundCtx, stopBackground := context.WithCancel(ctx)
+	defer func() {
+		stopBackground()
+		background.Wait()
+	}()
+	spawn := func(work func(ctx context.Context)) {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			work(backgroundCtx)
+		}()
+	}
+
+	spawn(func(ctx context.Context) { expireTransactions(ctx, server, cfg.Transactions.ExpiryInterval) })
+	dispatcher := webhook.NewDispatcher(repository,
+		webhook.WithTimeout(cfg.Webhooks.Timeout),
+		webhook.WithRetries(cfg.Webhooks.MaxAttempts, cfg.Webhooks.MinBackoff, cfg.Webhooks.MaxBackoff),
+	)
+	spawn(func(ctx context.Context) { dispatchWebhooks(ctx, dispatcher, cfg.Webhooks.Interval) })
+	if forwarder != nil {
+		spawn(func(ctx context.Context) { publishSignatures(ctx, forwarder, cfg.Stream.Interval) })
+	}
+
+	select {
+	case err := <-failed:
+		if err != nil {
+			return fatal("Could not start server on "+cfg.Server.ListenAddress, err)
+		}
+	case <-ctx.Done():
+		stop()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			return fatal("Could not drain before the shutdown timeout", err)
+		}
+	}
+	return nil
+}
+
+// openRepository opens the storage backend described by storage. The returned
+// function releases it.
+func openRepository(storage config.Storage) (persistence.Repository, func(), error) {
+	switch storage.Backend {
+	case config.BackendFile:
+		store, err := persistence.OpenFilePersistence(storage.DSN)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, func() { store.Close() }, nil
+	case config.BackendSharedFile:
+		store, err := persistence.OpenSharedFilePersistence(storage.DSN)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, func() { store.Close() }, nil
+	}
+	return persistence.NewInMemoryPersistence(), func() {}, nil
+}
+
+// expireTransactions expires abandoned transactions every interval until ctx is done.
+func expireTransactions(ctx context.Context, server *api.Server, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := server.ExpireTransactions(ctx); err != nil {
+				slog.Error("Could not expire transactions", slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// dispatchWebhooks delivers the recorded events to their webhooks every interval
+// until ctx is done.
+func dispatchWebhooks(ctx context.Context, dispatcher *webhook.Dispatcher, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := dispatcher.Dispatch(ctx); err != nil {
+				slog.Error("Could not dispatch webhooks", slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// publishSignatures publishes the recorded signatures every interval until ctx is
+// done.
+func publishSignatures(ctx context.Context, forwarder *stream.Forwarder, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-	if err := server.Run(); err != nil {
-		log.Fatal("Could not start server on ", ListenAddress, ":", err)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := forwarder.Forward(ctx); err != nil {
+				slog.Error("Could not publish signatures", slog.String("error", err.Error()))
+			}
+		}
 	}
 }
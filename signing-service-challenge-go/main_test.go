@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/client"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/config"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+// serveEnv makes the test binary run the service instead of the tests, so the
+// tests can start instances of it as processes of their own.
+const serveEnv = "SIGNING_SERVICE_TEST_SERVE"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(serveEnv) != "" {
+		main()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+const adminKey = "integration-admin-key"
+
+// startInstance runs the service in a process of its own with the environment env
+// and returns its base URL once it is ready. The process is stopped when the test
+// ends.
+func startInstance(t *testing.T, env ...string) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(executable)
+	cmd.Env = append(os.Environ(), append(env,
+		serveEnv+"=1",
+		"SIGNING_SERVICE_LISTEN_ADDRESS="+address,
+		"SIGNING_SERVICE_ADMIN_KEY="+adminKey,
+		"SIGNING_SERVICE_LOG_LEVEL=error",
+	)...)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Signal(os.Interrupt)
+		cmd.Wait()
+	})
+
+	url := "http://" + address
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		response, err := http.Get(url + "/api/v0/health/ready")
+		if err == nil {
+			response.Body.Close()
+			if response.StatusCode == http.StatusOK {
+				return url
+			}
+		}
+	}
+	t.Fatalf("Instance on %s did not get ready", address)
+	return ""
+}
+
+func TestRunReturnsStartupFailures(t *testing.T) {
+	blocked := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(blocked, nil, 0o600)
+	cfg := config.Default()
+	cfg.Log.Level = "error"
+	cfg.Storage.Backend = config.BackendFile
+	cfg.Storage.DSN = blocked
+
+	// The test only gets to check the error if run returns instead of exiting.
+	var f *failure
+	if err := run(cfg); !errors.As(err, &f) || f.message != "Could not open storage" {
+		t.Errorf("Expected the storage to fail, got %v", err)
+	}
+}
+
+func TestInstancesSharingAFileStoreKeepCountersGapFree(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts several processes")
+	}
+	ctx := context.Background()
+	locks := miniredis.RunT(t)
+	dir := t.TempDir()
+
+	var instances []string
+	for i := 0; i < 3; i++ {
+		instances = append(instances, startInstance(t,
+			"SIGNING_SERVICE_STORAGE_BACKEND=shared-file",
+			"SIGNING_SERVICE_STORAGE_DSN="+dir,
+			"SIGNING_SERVICE_DEVICE_LOCK_REDIS_ADDRESS="+locks.Addr(),
+		))
+	}
+
+	admin := client.New(instances[0], client.WithAPIKey(adminKey))
+	key, err := admin.CreateAPIKey(ctx, api.CreateAPIKeyRequest{
+		Name:   "integration",
+		Scopes: []domain.Scope{domain.ScopeDevicesCreate, domain.ScopeDevicesRead, domain.ScopeSign, domain.ScopeAudit},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The key issued by one instance authenticates at all of them.
+	var clients []*client.Client
+	for _, instance := range instances {
+		clients = append(clients, client.New(instance, client.WithAPIKey(key.Key), client.WithVerification()))
+	}
+
+	device, err := clients[1].CreateDevice(ctx, api.CreateSignatureDeviceRequest{Algorithm: "ECC", Label: "Till", SecuredDataFormat: string(domain.SecuredDataV2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const signatures, transactions = 30, 5
+	var wg sync.WaitGroup
+	for i := 0; i < signatures; i++ {
+		wg.Add(1)
+		go func(c *client.Client, i int) {
+			defer wg.Done()
+			if _, err := c.Sign(ctx, api.SignTransactionRequest{DeviceId: device.Id, Data: fmt.Sprint("receipt ", i)}); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}(clients[i%len(clients)], i)
+	}
+	for i := 0; i < transactions; i++ {
+		wg.Add(1)
+		// Every transaction starts on one instance and finishes on another.
+		go func(start, finish *client.Client) {
+			defer wg.Done()
+			started, err := start.StartTransaction(ctx, api.SignTransactionRequest{DeviceId: device.Id, Data: "start"})
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+			if _, err := finish.FinishTransaction(ctx, started.Transaction.Id, api.TransactionStepRequest{Data: "finish"}); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}(clients[i%len(clients)], clients[(i+1)%len(clients)])
+	}
+	wg.Wait()
+
+	stored, err := clients[2].ListDeviceTransactions(ctx, device.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != signatures+2*transactions {
+		t.Fatalf("Expected %d transactions, got %d", signatures+2*transactions, len(stored))
+	}
+	for i, transaction := range stored {
+		if transaction.Counter != i {
+			t.Fatalf("Expected counter %d, got %d", i, transaction.Counter)
+		}
+	}
+
+	// Every instance continues the chain where the others left it.
+	for i, c := range clients {
+		report, err := c.VerifyDevice(ctx, device.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !report.Valid || report.Transactions != len(stored) {
+			t.Errorf("Expected instance %d to report a valid chain of %d transactions, got %+v", i, len(stored), report)
+		}
+	}
+}
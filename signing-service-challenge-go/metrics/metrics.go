@@ -0,0 +1,155 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+const namespace = "signing_service"
+
+// Metrics collects the Prometheus metrics of the service.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests           *prometheus.CounterVec
+	requestDuration    *prometheus.HistogramVec
+	signingDuration    *prometheus.HistogramVec
+	keyGeneration      *prometheus.HistogramVec
+	lockWait           *prometheus.HistogramVec
+	repositoryDuration *prometheus.HistogramVec
+}
+
+// New creates Metrics registered with a dedicated registry, along with the Go runtime
+// and process collectors.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests by route, method and status code.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests by route, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		signingDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "signing_duration_seconds",
+			Help:      "Latency of creating a signature by algorithm, excluding the wait for the device lock.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 16),
+		}, []string{"algorithm"}),
+		keyGeneration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "key_generation_duration_seconds",
+			Help:      "Latency of generating the key pair of a device by algorithm.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+		}, []string{"algorithm"}),
+		lockWait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "device_lock_wait_seconds",
+			Help:      "Time signatures waited for the lock of their device by algorithm.",
+			Buckets:   prometheus.ExponentialBuckets(0.00001, 4, 12),
+		}, []string{"algorithm"}),
+		repositoryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "repository_operation_duration_seconds",
+			Help:      "Latency of repository operations by operation and outcome.",
+			Buckets:   prometheus.ExponentialBuckets(0.00001, 4, 12),
+		}, []string{"operation", "outcome"}),
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.signingDuration,
+		m.keyGeneration,
+		m.lockWait,
+		m.repositoryDuration,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest records a served HTTP request.
+func (m *Metrics) ObserveRequest(route, method string, status int, duration time.Duration) {
+	code := strconv.Itoa(status)
+	m.requests.WithLabelValues(route, method, code).Inc()
+	m.requestDuration.WithLabelValues(route, method, code).Observe(duration.Seconds())
+}
+
+// ObserveKeyGeneration implements domain.Instrumentation.
+func (m *Metrics) ObserveKeyGeneration(algorithm string, duration time.Duration) {
+	m.keyGeneration.WithLabelValues(algorithm).Observe(duration.Seconds())
+}
+
+// ObserveLockWait implements domain.Instrumentation.
+func (m *Metrics) ObserveLockWait(algorithm string, duration time.Duration) {
+	m.lockWait.WithLabelValues(algorithm).Observe(duration.Seconds())
+}
+
+// ObserveSigning implements domain.Instrumentation.
+func (m *Metrics) ObserveSigning(algorithm string, duration time.Duration) {
+	m.signingDuration.WithLabelValues(algorithm).Observe(duration.Seconds())
+}
+
+// observeRepository records a repository operation that started at start. It is
+// meant to be deferred with a pointer to the named error result of the operation.
+func (m *Metrics) observeRepository(operation string, start time.Time, err *error) {
+	outcome := "success"
+	if *err != nil {
+		outcome = "error"
+	}
+	m.repositoryDuration.WithLabelValues(operation, outcome).Observe(time.Since(start).Seconds())
+}
+
+// CountDevices registers a gauge of the signature devices by algorithm and status,
+// which is computed from statistics on every scrape.
+func (m *Metrics) CountDevices(statistics persistence.SignatureDeviceStatistics) {
+	m.registry.MustRegister(&deviceCollector{statistics: statistics})
+}
+
+var devicesDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "", "devices"),
+	"Number of signature devices by algorithm and status.",
+	[]string{"algorithm", "status"}, nil,
+)
+
+type deviceCollector struct {
+	statistics persistence.SignatureDeviceStatistics
+}
+
+func (c *deviceCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- devicesDesc
+}
+
+func (c *deviceCollector) Collect(metrics chan<- prometheus.Metric) {
+	counts, err := c.statistics.CountSignatureDevices(context.Background())
+	if err != nil {
+		slog.Warn("Could not count signature devices", slog.String("error", err.Error()))
+		return
+	}
+
+	for _, count := range counts {
+		metrics <- prometheus.MustNewConstMetric(devicesDesc, prometheus.GaugeValue,
+			float64(count.Count), count.Algorithm, string(count.Status))
+	}
+}
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+func TestInstrumentRepository(t *testing.T) {
+	ctx := context.Background()
+	m := New()
+	repo := m.InstrumentRepository(persistence.NewInMemoryPersistence())
+
+	if err := repo.SaveSignatureDevice(ctx, &domain.SignatureDevice{Id: "device"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := repo.GetSignatureDevice(ctx, "", "unknown")
+	if !errors.Is(err, domain.ErrDeviceNotFound) {
+		t.Fatalf("Expected device not found error, got %v", err)
+	}
+
+	if n := testutil.CollectAndCount(m.repositoryDuration); n != 2 {
+		t.Errorf("Expected %d observed operations, got %d", 2, n)
+	}
+
+	failed := m.repositoryDuration.WithLabelValues("get_signature_device", "error").(prometheus.Histogram)
+	if n := testutil.CollectAndCount(failed); n != 1 {
+		t.Errorf("Expected the failed lookup to be recorded as error")
+	}
+}
+
+func TestCountDevices(t *testing.T) {
+	ctx := context.Background()
+	m := New()
+	repo := persistence.NewInMemoryPersistence()
+	m.CountDevices(repo)
+
+	repo.SaveSignatureDevice(ctx, &domain.SignatureDevice{Id: "a", Algorithm: "RSA", Status: domain.DeviceStatusActive})
+	repo.SaveSignatureDevice(ctx, &domain.SignatureDevice{Id: "b", Algorithm: "RSA", Status: domain.DeviceStatusActive})
+	repo.SaveSignatureDevice(ctx, &domain.SignatureDevice{Id: "c", Algorithm: "ECC", Status: domain.DeviceStatusSuspended})
+
+	expected := `
+# HELP signing_service_devices Number of signature devices by algorithm and status.
+# TYPE signing_service_devices gauge
+signing_service_devices{algorithm="ECC",status="SUSPENDED"} 1
+signing_service_devices{algorithm="RSA",status="ACTIVE"} 2
+`
+	if err := testutil.GatherAndCompare(m.registry, strings.NewReader(expected), "signing_service_devices"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDomainInstrumentation(t *testing.T) {
+	m := New()
+	ctx := domain.WithInstrumentation(context.Background(), m)
+
+	device, err := domain.NewSignatureDeviceWithKeys(ctx, "device", "ECC", "Device", domain.DefaultKeyParameters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := device.Sign(ctx, "data"); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, histogram := range map[string]*prometheus.HistogramVec{
+		"key generation": m.keyGeneration,
+		"lock wait":      m.lockWait,
+		"signing":        m.signingDuration,
+	} {
+		if n := testutil.CollectAndCount(histogram); n != 1 {
+			t.Errorf("Expected %s to be observed for one algorithm, got %d", name, n)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	m := New()
+	m.ObserveRequest("/api/v0/health", "GET", 200, time.Millisecond)
+
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	expected := `signing_service_http_requests_total{method="GET",route="/api/v0/health",status="200"} 1`
+	if !strings.Contains(recorder.Body.String(), expected) {
+		t.Errorf("Expected exposition to contain %s", expected)
+	}
+}
@@ -0,0 +1,186 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+// Repository is a persistence.Repository that records the latency of every operation.
+type Repository struct {
+	persistence.Repository
+	metrics *Metrics
+}
+
+// InstrumentRepository wraps repo to record the latency of its operations.
+func (m *Metrics) InstrumentRepository(repo persistence.Repository) *Repository {
+	return &Repository{Repository: repo, metrics: m}
+}
+
+func (r *Repository) SaveSignatureDevice(ctx context.Context, device *domain.SignatureDevice, events ...*domain.Event) (err error) {
+	defer r.metrics.observeRepository("save_signature_device", time.Now(), &err)
+	return r.Repository.SaveSignatureDevice(ctx, device, events...)
+}
+
+func (r *Repository) SaveSignatureDevices(ctx context.Context, fence persistence.Fence, devices []*domain.SignatureDevice, events ...*domain.Event) (err error) {
+	defer r.metrics.observeRepository("save_signature_devices", time.Now(), &err)
+	return r.Repository.SaveSignatureDevices(ctx, fence, devices, events...)
+}
+
+func (r *Repository) GetSignatureDevice(ctx context.Context, tenantId, id string) (device *domain.SignatureDevice, err error) {
+	defer r.metrics.observeRepository("get_signature_device", time.Now(), &err)
+	return r.Repository.GetSignatureDevice(ctx, tenantId, id)
+}
+
+func (r *Repository) ListSignatureDevices(ctx context.Context, tenantId string) (devices []*domain.SignatureDevice, err error) {
+	defer r.metrics.observeRepository("list_signature_devices", time.Now(), &err)
+	return r.Repository.ListSignatureDevices(ctx, tenantId)
+}
+
+func (r *Repository) CountSignatureDevices(ctx context.Context) (counts []persistence.DeviceCount, err error) {
+	defer r.metrics.observeRepository("count_signature_devices", time.Now(), &err)
+	return r.Repository.CountSignatureDevices(ctx)
+}
+
+func (r *Repository) SaveTransaction(ctx context.Context, fence persistence.Fence, transaction *domain.Transaction, fiscal *domain.FiscalTransaction, events ...*domain.Event) (err error) {
+	defer r.metrics.observeRepository("save_transaction", time.Now(), &err)
+	return r.Repository.SaveTransaction(ctx, fence, transaction, fiscal, events...)
+}
+
+func (r *Repository) SaveTransactionTimestamp(ctx context.Context, transaction *domain.Transaction) (err error) {
+	defer r.metrics.observeRepository("save_transaction_timestamp", time.Now(), &err)
+	return r.Repository.SaveTransactionTimestamp(ctx, transaction)
+}
+
+func (r *Repository) ListTransactions(ctx context.Context, tenantId, deviceId string) (transactions []*domain.Transaction, err error) {
+	defer r.metrics.observeRepository("list_transactions", time.Now(), &err)
+	return r.Repository.ListTransactions(ctx, tenantId, deviceId)
+}
+
+func (r *Repository) WalkTransactions(ctx context.Context, tenantId, deviceId string, fn func(*domain.Transaction) error) (err error) {
+	defer r.metrics.observeRepository("walk_transactions", time.Now(), &err)
+	return r.Repository.WalkTransactions(ctx, tenantId, deviceId, fn)
+}
+
+func (r *Repository) GetTransactionByIdempotencyKey(ctx context.Context, tenantId, key string) (transaction *domain.Transaction, err error) {
+	defer r.metrics.observeRepository("get_transaction_by_idempotency_key", time.Now(), &err)
+	return r.Repository.GetTransactionByIdempotencyKey(ctx, tenantId, key)
+}
+
+func (r *Repository) SaveFiscalTransaction(ctx context.Context, fence persistence.Fence, transaction *domain.FiscalTransaction) (err error) {
+	defer r.metrics.observeRepository("save_fiscal_transaction", time.Now(), &err)
+	return r.Repository.SaveFiscalTransaction(ctx, fence, transaction)
+}
+
+func (r *Repository) GetFiscalTransaction(ctx context.Context, tenantId, id string) (transaction *domain.FiscalTransaction, err error) {
+	defer r.metrics.observeRepository("get_fiscal_transaction", time.Now(), &err)
+	return r.Repository.GetFiscalTransaction(ctx, tenantId, id)
+}
+
+func (r *Repository) ListFiscalTransactions(ctx context.Context, tenantId string, state domain.FiscalTransactionState) (transactions []*domain.FiscalTransaction, err error) {
+	defer r.metrics.observeRepository("list_fiscal_transactions", time.Now(), &err)
+	return r.Repository.ListFiscalTransactions(ctx, tenantId, state)
+}
+
+func (r *Repository) ListOverdueFiscalTransactions(ctx context.Context, now time.Time) (transactions []*domain.FiscalTransaction, err error) {
+	defer r.metrics.observeRepository("list_overdue_fiscal_transactions", time.Now(), &err)
+	return r.Repository.ListOverdueFiscalTransactions(ctx, now)
+}
+
+func (r *Repository) SaveAPIKey(ctx context.Context, key *domain.APIKey) (err error) {
+	defer r.metrics.observeRepository("save_api_key", time.Now(), &err)
+	return r.Repository.SaveAPIKey(ctx, key)
+}
+
+func (r *Repository) GetAPIKey(ctx context.Context, id string) (key *domain.APIKey, err error) {
+	defer r.metrics.observeRepository("get_api_key", time.Now(), &err)
+	return r.Repository.GetAPIKey(ctx, id)
+}
+
+func (r *Repository) GetAPIKeyByHash(ctx context.Context, hash string) (key *domain.APIKey, err error) {
+	defer r.metrics.observeRepository("get_api_key_by_hash", time.Now(), &err)
+	return r.Repository.GetAPIKeyByHash(ctx, hash)
+}
+
+func (r *Repository) ListAPIKeys(ctx context.Context) (keys []*domain.APIKey, err error) {
+	defer r.metrics.observeRepository("list_api_keys", time.Now(), &err)
+	return r.Repository.ListAPIKeys(ctx)
+}
+
+func (r *Repository) SaveOrganization(ctx context.Context, organization *domain.Organization) (err error) {
+	defer r.metrics.observeRepository("save_organization", time.Now(), &err)
+	return r.Repository.SaveOrganization(ctx, organization)
+}
+
+func (r *Repository) GetOrganization(ctx context.Context, id string) (organization *domain.Organization, err error) {
+	defer r.metrics.observeRepository("get_organization", time.Now(), &err)
+	return r.Repository.GetOrganization(ctx, id)
+}
+
+func (r *Repository) ListOrganizations(ctx context.Context) (organizations []*domain.Organization, err error) {
+	defer r.metrics.observeRepository("list_organizations", time.Now(), &err)
+	return r.Repository.ListOrganizations(ctx)
+}
+
+func (r *Repository) ListEvents(ctx context.Context, after int64, limit int) (events []*domain.Event, err error) {
+	defer r.metrics.observeRepository("list_events", time.Now(), &err)
+	return r.Repository.ListEvents(ctx, after, limit)
+}
+
+func (r *Repository) GetEventCursor(ctx context.Context, consumer string) (sequence int64, err error) {
+	defer r.metrics.observeRepository("get_event_cursor", time.Now(), &err)
+	return r.Repository.GetEventCursor(ctx, consumer)
+}
+
+func (r *Repository) SaveEventCursor(ctx context.Context, consumer string, sequence int64) (err error) {
+	defer r.metrics.observeRepository("save_event_cursor", time.Now(), &err)
+	return r.Repository.SaveEventCursor(ctx, consumer, sequence)
+}
+
+func (r *Repository) SaveWebhook(ctx context.Context, webhook *domain.Webhook) (err error) {
+	defer r.metrics.observeRepository("save_webhook", time.Now(), &err)
+	return r.Repository.SaveWebhook(ctx, webhook)
+}
+
+func (r *Repository) GetWebhook(ctx context.Context, tenantId, id string) (webhook *domain.Webhook, err error) {
+	defer r.metrics.observeRepository("get_webhook", time.Now(), &err)
+	return r.Repository.GetWebhook(ctx, tenantId, id)
+}
+
+func (r *Repository) ListWebhooks(ctx context.Context, tenantId string) (webhooks []*domain.Webhook, err error) {
+	defer r.metrics.observeRepository("list_webhooks", time.Now(), &err)
+	return r.Repository.ListWebhooks(ctx, tenantId)
+}
+
+func (r *Repository) DeleteWebhook(ctx context.Context, tenantId, id string) (err error) {
+	defer r.metrics.observeRepository("delete_webhook", time.Now(), &err)
+	return r.Repository.DeleteWebhook(ctx, tenantId, id)
+}
+
+func (r *Repository) SaveWebhookDelivery(ctx context.Context, delivery *domain.WebhookDelivery) (err error) {
+	defer r.metrics.observeRepository("save_webhook_delivery", time.Now(), &err)
+	return r.Repository.SaveWebhookDelivery(ctx, delivery)
+}
+
+func (r *Repository) GetWebhookDelivery(ctx context.Context, tenantId, id string) (delivery *domain.WebhookDelivery, err error) {
+	defer r.metrics.observeRepository("get_webhook_delivery", time.Now(), &err)
+	return r.Repository.GetWebhookDelivery(ctx, tenantId, id)
+}
+
+func (r *Repository) ListWebhookDeliveries(ctx context.Context, tenantId, webhookId string, state domain.DeliveryState) (deliveries []*domain.WebhookDelivery, err error) {
+	defer r.metrics.observeRepository("list_webhook_deliveries", time.Now(), &err)
+	return r.Repository.ListWebhookDeliveries(ctx, tenantId, webhookId, state)
+}
+
+func (r *Repository) ListDueWebhookDeliveries(ctx context.Context, now time.Time) (deliveries []*domain.WebhookDelivery, err error) {
+	defer r.metrics.observeRepository("list_due_webhook_deliveries", time.Now(), &err)
+	return r.Repository.ListDueWebhookDeliveries(ctx, now)
+}
+
+// Flush flushes the decorated repository if it buffers writes.
+func (r *Repository) Flush(ctx context.Context) (err error) {
+	defer r.metrics.observeRepository("flush", time.Now(), &err)
+	return persistence.Flush(ctx, r.Repository)
+}
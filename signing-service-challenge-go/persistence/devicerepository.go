@@ -1,9 +1,219 @@
 package persistence
 
-import "github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
 
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+// Repository bundles every repository the service depends on.
+type Repository interface {
+	SignatureDeviceRepository
+	TransactionRepository
+	FiscalTransactionRepository
+	APIKeyRepository
+	OrganizationRepository
+	EventRepository
+	WebhookRepository
+	SignatureDeviceStatistics
+}
+
+// ErrStaleFence is returned by a write whose Fence is smaller than one the device
+// was written with before: its lease was taken over, and another holder may have
+// signed meanwhile.
+var ErrStaleFence = errors.New("write is fenced off by a later device lease")
+
+// Fence is the fencing token of a write made under the lease of a device, see
+// devicelock.Lease. A store remembers the greatest fence every device was written
+// with and rejects writes with a smaller one with ErrStaleFence.
+type Fence int64
+
+// NoFence marks writes made without a lease, which are never rejected.
+const NoFence Fence = 0
+
+// SignatureDeviceRepository stores signature devices. Every method is scoped by
+// tenant id, a device of another tenant is reported as domain.ErrDeviceNotFound.
 type SignatureDeviceRepository interface {
-	SaveSignatureDevice(device *domain.SignatureDevice) error
-	GetSignatureDevice(id string) (*domain.SignatureDevice, error)
-	ListSignatureDevices() ([]*domain.SignatureDevice, error)
+	// SaveSignatureDevice stores a device and records events in the outbox, both
+	// or neither.
+	SaveSignatureDevice(ctx context.Context, device *domain.SignatureDevice, events ...*domain.Event) error
+	// SaveSignatureDevices stores several devices and records events in the
+	// outbox, all or none, e.g. a rotated device together with its successor. It
+	// is the write of devices held under a lease, fenced by fence.
+	SaveSignatureDevices(ctx context.Context, fence Fence, devices []*domain.SignatureDevice, events ...*domain.Event) error
+	GetSignatureDevice(ctx context.Context, tenantId, id string) (*domain.SignatureDevice, error)
+	ListSignatureDevices(ctx context.Context, tenantId string) ([]*domain.SignatureDevice, error)
+}
+
+// TransactionRepository stores signed transactions, scoped by tenant id.
+type TransactionRepository interface {
+	// SaveTransaction stores a transaction and advances the chain of the stored
+	// device past it, so that the device as stored continues the chain even if
+	// another copy of it signed. The fiscal transaction whose step it signs, if
+	// not nil, and the events are stored with the transaction, all or nothing.
+	// The write is fenced by fence.
+	SaveTransaction(ctx context.Context, fence Fence, transaction *domain.Transaction, fiscal *domain.FiscalTransaction, events ...*domain.Event) error
+	// SaveTransactionTimestamp stores the timestamp token and time of transaction
+	// with the transaction stored before under its device and counter, which is
+	// replaced by a timestamped copy. A transaction that was not stored is
+	// reported as domain.ErrTransactionNotFound.
+	SaveTransactionTimestamp(ctx context.Context, transaction *domain.Transaction) error
+	ListTransactions(ctx context.Context, tenantId, deviceId string) ([]*domain.Transaction, error)
+	// WalkTransactions calls fn for every transaction of the device in counter
+	// order, without holding all of them in memory at once where the store allows.
+	// It stops at the first error of fn and returns it.
+	WalkTransactions(ctx context.Context, tenantId, deviceId string, fn func(*domain.Transaction) error) error
+	// GetTransactionByIdempotencyKey returns the transaction stored with the
+	// idempotency key, domain.ErrTransactionNotFound if there is none.
+	GetTransactionByIdempotencyKey(ctx context.Context, tenantId, key string) (*domain.Transaction, error)
+}
+
+// FiscalTransactionRepository stores fiscal transactions, scoped by tenant id. A
+// transaction of another tenant is reported as domain.ErrTransactionNotFound.
+type FiscalTransactionRepository interface {
+	// SaveFiscalTransaction stores a transaction, fenced by fence like the writes
+	// of its device. Stored transactions are replaced, never changed in place, so
+	// that the transactions returned by reads can be used without locking.
+	SaveFiscalTransaction(ctx context.Context, fence Fence, transaction *domain.FiscalTransaction) error
+	GetFiscalTransaction(ctx context.Context, tenantId, id string) (*domain.FiscalTransaction, error)
+	// ListFiscalTransactions lists the transactions of the tenant in the given
+	// state, or in any state if state is empty, ordered by start.
+	ListFiscalTransactions(ctx context.Context, tenantId string, state domain.FiscalTransactionState) ([]*domain.FiscalTransaction, error)
+	// ListOverdueFiscalTransactions lists the open transactions of all tenants whose
+	// timeout has passed at now. It serves the expiry of transactions and must not
+	// be exposed to tenants.
+	ListOverdueFiscalTransactions(ctx context.Context, now time.Time) ([]*domain.FiscalTransaction, error)
+}
+
+// filterFiscalTransactions returns the transactions matching keep ordered by start.
+func filterFiscalTransactions(transactions map[string]*domain.FiscalTransaction, keep func(*domain.FiscalTransaction) bool) []*domain.FiscalTransaction {
+	result := make([]*domain.FiscalTransaction, 0)
+	for _, transaction := range transactions {
+		if keep(transaction) {
+			result = append(result, transaction)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].StartedAt.Equal(result[j].StartedAt) {
+			return result[i].StartedAt.Before(result[j].StartedAt)
+		}
+		return result[i].Id < result[j].Id
+	})
+	return result
+}
+
+type APIKeyRepository interface {
+	SaveAPIKey(ctx context.Context, key *domain.APIKey) error
+	GetAPIKey(ctx context.Context, id string) (*domain.APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, hash string) (*domain.APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]*domain.APIKey, error)
+}
+
+type OrganizationRepository interface {
+	SaveOrganization(ctx context.Context, organization *domain.Organization) error
+	GetOrganization(ctx context.Context, id string) (*domain.Organization, error)
+	ListOrganizations(ctx context.Context) ([]*domain.Organization, error)
+}
+
+// EventRepository is the outbox of the domain events. Events are recorded by the
+// writes they are passed to, such as SaveTransaction, and read by the consumers of
+// the outbox, such as the webhook dispatcher. It serves the consumers across all
+// tenants and must not be exposed to tenants.
+type EventRepository interface {
+	// ListEvents lists at most limit events in the order they were recorded,
+	// starting after the sequence number after.
+	ListEvents(ctx context.Context, after int64, limit int) ([]*domain.Event, error)
+	// GetEventCursor returns the sequence number of the last event a consumer
+	// processed, 0 if it processed none.
+	GetEventCursor(ctx context.Context, consumer string) (int64, error)
+	SaveEventCursor(ctx context.Context, consumer string, sequence int64) error
+}
+
+// WebhookRepository stores webhooks and their deliveries, scoped by tenant id. A
+// webhook of another tenant is reported as domain.ErrWebhookNotFound.
+type WebhookRepository interface {
+	SaveWebhook(ctx context.Context, webhook *domain.Webhook) error
+	GetWebhook(ctx context.Context, tenantId, id string) (*domain.Webhook, error)
+	// ListWebhooks lists the webhooks of the tenant ordered by creation.
+	ListWebhooks(ctx context.Context, tenantId string) ([]*domain.Webhook, error)
+	// DeleteWebhook deletes a webhook together with its deliveries.
+	DeleteWebhook(ctx context.Context, tenantId, id string) error
+	SaveWebhookDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error
+	GetWebhookDelivery(ctx context.Context, tenantId, id string) (*domain.WebhookDelivery, error)
+	// ListWebhookDeliveries lists the deliveries of a webhook in the given state,
+	// or in any state if state is empty, ordered by event.
+	ListWebhookDeliveries(ctx context.Context, tenantId, webhookId string, state domain.DeliveryState) ([]*domain.WebhookDelivery, error)
+	// ListDueWebhookDeliveries lists the pending deliveries of all tenants whose
+	// next attempt is due at now, ordered by event. It serves the dispatcher and
+	// must not be exposed to tenants.
+	ListDueWebhookDeliveries(ctx context.Context, now time.Time) ([]*domain.WebhookDelivery, error)
+}
+
+// deviceIds returns the ids of devices.
+func deviceIds(devices []*domain.SignatureDevice) []string {
+	ids := make([]string, 0, len(devices))
+	for _, device := range devices {
+		ids = append(ids, device.Id)
+	}
+	return ids
+}
+
+// DeviceCount is the number of signature devices with an algorithm and status.
+type DeviceCount struct {
+	Algorithm string
+	Status    domain.DeviceStatus
+	Count     int
+}
+
+// SignatureDeviceStatistics aggregates signature devices across all tenants. It
+// serves operators, e.g. for metrics, and must not be exposed to tenants.
+type SignatureDeviceStatistics interface {
+	CountSignatureDevices(ctx context.Context) ([]DeviceCount, error)
+}
+
+// countDevices groups devices by algorithm and status.
+func countDevices(devices map[string]*domain.SignatureDevice) []DeviceCount {
+	counts := make(map[DeviceCount]int)
+	for _, device := range devices {
+		counts[DeviceCount{Algorithm: device.Algorithm, Status: device.Status}]++
+	}
+
+	result := make([]DeviceCount, 0, len(counts))
+	for count, n := range counts {
+		count.Count = n
+		result = append(result, count)
+	}
+	return result
+}
+
+// Flusher is a Repository that buffers writes.
+type Flusher interface {
+	// Flush writes all buffered data to the underlying store.
+	Flush(ctx context.Context) error
+}
+
+// Flush flushes repo if it buffers writes.
+func Flush(ctx context.Context, repo Repository) error {
+	if flusher, ok := repo.(Flusher); ok {
+		return flusher.Flush(ctx)
+	}
+	return nil
+}
+
+// Pinger is a Repository that can check its connection to the underlying store.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Ping checks that repo is able to serve requests. Repositories that are not a
+// Pinger are checked by counting their devices.
+func Ping(ctx context.Context, repo Repository) error {
+	if pinger, ok := repo.(Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	_, err := repo.CountSignatureDevices(ctx)
+	return err
 }
@@ -0,0 +1,679 @@
+package persistence
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+// The files of a FilePersistence directory.
+const (
+	journalFileName = "journal.jsonl"
+	lockFileName    = "LOCK"
+)
+
+// snapshotEventsPerRecord bounds the length of the lines of a compacted journal.
+const snapshotEventsPerRecord = 1000
+
+// ErrStoreLocked is returned by OpenFilePersistence if another process, such as a
+// running server, uses the directory, and by OpenSharedFilePersistence if a
+// process has it open exclusively.
+var ErrStoreLocked = errors.New("storage directory is in use by another process")
+
+// FilePersistence serves reads from memory like InMemoryPersistence and journals
+// every write to a file before it takes effect, so that the data survives restarts
+// and can be opened by tools while the server is down. A process holds an exclusive
+// lock on the directory for as long as it is open.
+//
+// The journal holds the private keys of the devices in PEM, the directory must be
+// protected like a key store. Every write is synced before it returns, so a signed
+// transaction is durable before its signature reaches the client. Flush compacts
+// the journal.
+type FilePersistence struct {
+	*InMemoryPersistence
+	dir  string
+	lock *os.File
+	// shared is set if other processes append to the journal as well.
+	shared bool
+
+	// mutex serializes writes, covering both the journal and the memory, so a
+	// compaction never misses a write.
+	mutex   sync.Mutex
+	journal *os.File
+	// offset is the end of the records of the journal restored to the memory.
+	offset int64
+	// keys lists the devices whose private key is in the journal.
+	keys map[string]bool
+}
+
+// journalRecord is a line of the journal. Exactly one of its members is set, the
+// private key only with the first record of a device, the fiscal transaction with
+// the transaction signing its step, besides the events recorded with the write. A
+// record of events alone appends them to the outbox.
+type journalRecord struct {
+	Device     json.RawMessage `json:"device,omitempty"`
+	PrivateKey string          `json:"private_key,omitempty"`
+	// Devices are the records of several devices written at once.
+	Devices     []*journalRecord    `json:"devices,omitempty"`
+	Transaction *domain.Transaction `json:"transaction,omitempty"`
+	// IdempotencyKey and RequestFingerprint are kept apart since Transaction never
+	// encodes them.
+	IdempotencyKey     string                    `json:"idempotency_key,omitempty"`
+	RequestFingerprint string                    `json:"request_fingerprint,omitempty"`
+	Timestamp          *transactionTimestamp     `json:"timestamp,omitempty"`
+	FiscalTransaction  *domain.FiscalTransaction `json:"fiscal_transaction,omitempty"`
+	APIKey             *domain.APIKey            `json:"api_key,omitempty"`
+	// APIKeyHash is kept apart since APIKey never encodes its hash.
+	APIKeyHash   string               `json:"api_key_hash,omitempty"`
+	Organization *domain.Organization `json:"organization,omitempty"`
+	EventCursor  *eventCursor         `json:"event_cursor,omitempty"`
+	Webhook      *domain.Webhook      `json:"webhook,omitempty"`
+	// WebhookSecret is kept apart since Webhook never encodes its secret.
+	WebhookSecret   string                  `json:"webhook_secret,omitempty"`
+	DeletedWebhook  *deletedWebhook         `json:"deleted_webhook,omitempty"`
+	WebhookDelivery *domain.WebhookDelivery `json:"webhook_delivery,omitempty"`
+	// Events are recorded in the outbox in order, their sequence numbers follow
+	// from that order.
+	Events []*domain.Event `json:"events,omitempty"`
+	// Fence is the fence of a write under a device lease.
+	Fence Fence `json:"fence,omitempty"`
+}
+
+// eventCursor is the position of a consumer of the outbox.
+type eventCursor struct {
+	Consumer string `json:"consumer"`
+	Sequence int64  `json:"sequence"`
+}
+
+// transactionTimestamp is the timestamp token of a transaction journaled before.
+type transactionTimestamp struct {
+	TenantId      string     `json:"tenant_id,omitempty"`
+	DeviceId      string     `json:"device_id"`
+	Counter       int        `json:"counter"`
+	Token         []byte     `json:"token"`
+	TimestampedAt *time.Time `json:"timestamped_at"`
+}
+
+// deletedWebhook names a webhook that was deleted.
+type deletedWebhook struct {
+	TenantId string `json:"tenant_id,omitempty"`
+	Id       string `json:"id"`
+}
+
+// OpenFilePersistence opens the store in dir, creating it if it does not exist,
+// and restores its data. It fails with ErrStoreLocked if another process has it
+// open.
+func OpenFilePersistence(dir string) (*FilePersistence, error) {
+	return openFilePersistence(dir, false)
+}
+
+func openFilePersistence(dir string, shared bool) (_ *FilePersistence, err error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	lock, err := os.OpenFile(filepath.Join(dir, lockFileName), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if shared {
+		err = shareFile(lock)
+	} else {
+		err = lockFile(lock)
+	}
+	if err != nil {
+		lock.Close()
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			lock.Close()
+		}
+	}()
+
+	p := &FilePersistence{
+		InMemoryPersistence: NewInMemoryPersistence(),
+		dir:                 dir,
+		lock:                lock,
+		shared:              shared,
+		keys:                make(map[string]bool),
+	}
+	flags := os.O_RDWR | os.O_CREATE
+	if shared {
+		// Appending moves to the end of the journal under the lock of the
+		// journal, wherever the other processes left it.
+		flags |= os.O_APPEND
+	}
+	p.journal, err = os.OpenFile(filepath.Join(dir, journalFileName), flags, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockJournal(p.journal, true); err != nil {
+		p.journal.Close()
+		return nil, err
+	}
+	err = p.replay()
+	unlockJournal(p.journal)
+	if err != nil {
+		p.journal.Close()
+		return nil, fmt.Errorf("restoring %s: %w", filepath.Join(dir, journalFileName), err)
+	}
+	return p, nil
+}
+
+// replay restores the records of the journal and positions it for appending. A
+// last line without a newline is the remainder of an interrupted write and is cut
+// off. The caller holds the lock of the journal exclusively.
+func (p *FilePersistence) replay() error {
+	if err := p.catchUp(); err != nil {
+		return err
+	}
+	if err := p.journal.Truncate(p.offset); err != nil {
+		return err
+	}
+	_, err := p.journal.Seek(p.offset, io.SeekStart)
+	return err
+}
+
+// catchUp restores the records of the journal after offset. A last line without a
+// newline is left for later, it is still being written or was interrupted.
+func (p *FilePersistence) catchUp() error {
+	reader := bufio.NewReader(io.NewSectionReader(p.journal, p.offset, math.MaxInt64-p.offset))
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var record journalRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return fmt.Errorf("record at offset %d: %w", p.offset, err)
+		}
+		if err := p.restore(&record); err != nil {
+			return fmt.Errorf("record at offset %d: %w", p.offset, err)
+		}
+		p.offset += int64(len(line))
+	}
+}
+
+// restore applies a record of the journal to the memory.
+func (p *FilePersistence) restore(record *journalRecord) error {
+	ctx := context.Background()
+	switch {
+	case record.Device != nil:
+		device, err := p.restoreDevice(record)
+		if err != nil {
+			return err
+		}
+		if record.Fence != NoFence {
+			// A compacted journal keeps the fence of a device with its record.
+			return p.InMemoryPersistence.SaveSignatureDevices(ctx, record.Fence, []*domain.SignatureDevice{device}, record.Events...)
+		}
+		return p.InMemoryPersistence.SaveSignatureDevice(ctx, device, record.Events...)
+	case record.Devices != nil:
+		devices := make([]*domain.SignatureDevice, 0, len(record.Devices))
+		for _, deviceRecord := range record.Devices {
+			device, err := p.restoreDevice(deviceRecord)
+			if err != nil {
+				return err
+			}
+			devices = append(devices, device)
+		}
+		return p.InMemoryPersistence.SaveSignatureDevices(ctx, record.Fence, devices, record.Events...)
+	case record.Transaction != nil:
+		record.Transaction.IdempotencyKey = record.IdempotencyKey
+		record.Transaction.RequestFingerprint = record.RequestFingerprint
+		// The device is only stored when it changes otherwise, the memory store
+		// advances its chain with every transaction.
+		return p.InMemoryPersistence.SaveTransaction(ctx, record.Fence, record.Transaction, record.FiscalTransaction, record.Events...)
+	case record.Timestamp != nil:
+		return p.InMemoryPersistence.SaveTransactionTimestamp(ctx, &domain.Transaction{
+			TenantId:       record.Timestamp.TenantId,
+			DeviceId:       record.Timestamp.DeviceId,
+			Counter:        record.Timestamp.Counter,
+			TimestampToken: record.Timestamp.Token,
+			TimestampedAt:  record.Timestamp.TimestampedAt,
+		})
+	case record.FiscalTransaction != nil:
+		return p.InMemoryPersistence.SaveFiscalTransaction(ctx, record.Fence, record.FiscalTransaction)
+	case record.APIKey != nil:
+		record.APIKey.Hash = record.APIKeyHash
+		return p.InMemoryPersistence.SaveAPIKey(ctx, record.APIKey)
+	case record.Organization != nil:
+		return p.InMemoryPersistence.SaveOrganization(ctx, record.Organization)
+	case record.EventCursor != nil:
+		return p.InMemoryPersistence.SaveEventCursor(ctx, record.EventCursor.Consumer, record.EventCursor.Sequence)
+	case record.Webhook != nil:
+		record.Webhook.Secret = record.WebhookSecret
+		return p.InMemoryPersistence.SaveWebhook(ctx, record.Webhook)
+	case record.DeletedWebhook != nil:
+		return p.InMemoryPersistence.DeleteWebhook(ctx, record.DeletedWebhook.TenantId, record.DeletedWebhook.Id)
+	case record.WebhookDelivery != nil:
+		return p.InMemoryPersistence.SaveWebhookDelivery(ctx, record.WebhookDelivery)
+	case len(record.Events) > 0:
+		p.InMemoryPersistence.mutex.Lock()
+		defer p.InMemoryPersistence.mutex.Unlock()
+		p.appendEvents(record.Events)
+		return nil
+	}
+	return errors.New("empty record")
+}
+
+// restoreDevice restores the device of a record.
+func (p *FilePersistence) restoreDevice(record *journalRecord) (*domain.SignatureDevice, error) {
+	var state struct{ Id string }
+	if err := json.Unmarshal(record.Device, &state); err != nil {
+		return nil, err
+	}
+	privateKey := []byte(record.PrivateKey)
+	if record.PrivateKey == "" {
+		// Later records of a device carry its state only, the key is the one of
+		// the device restored before.
+		previous, ok := p.devices[state.Id]
+		if !ok {
+			return nil, fmt.Errorf("device %s has no private key", state.Id)
+		}
+		var err error
+		if privateKey, err = previous.PrivateKey(); err != nil {
+			return nil, err
+		}
+	}
+	device, err := domain.RestoreSignatureDevice(record.Device, privateKey)
+	if err != nil {
+		return nil, err
+	}
+	p.keys[device.Id] = true
+	return device, nil
+}
+
+// deviceRecord returns the record of device, with its private key unless the
+// journal holds it already.
+func (p *FilePersistence) deviceRecord(device *domain.SignatureDevice, withKey bool) (*journalRecord, error) {
+	state, err := device.MarshalState()
+	if err != nil {
+		return nil, err
+	}
+	record := &journalRecord{Device: state}
+	if withKey {
+		privateKey, err := device.PrivateKey()
+		if err != nil {
+			return nil, err
+		}
+		record.PrivateKey = string(privateKey)
+	}
+	return record, nil
+}
+
+// transactionRecord returns the record of transaction.
+func transactionRecord(transaction *domain.Transaction) *journalRecord {
+	return &journalRecord{
+		Transaction:        transaction,
+		IdempotencyKey:     transaction.IdempotencyKey,
+		RequestFingerprint: transaction.RequestFingerprint,
+	}
+}
+
+// appendRecords writes records to w as JSON lines.
+func appendRecords(w io.Writer, records ...*journalRecord) error {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write(buffer.Bytes())
+	return err
+}
+
+// lockWrite takes the mutex. If the journal is shared, it takes the lock of the journal
+// as well and restores what other processes appended meanwhile, so a write is
+// checked and numbered against everything journaled before it. The returned
+// function releases both.
+func (p *FilePersistence) lockWrite() (func(), error) {
+	p.mutex.Lock()
+	journal := p.journal
+	if !p.shared || journal == nil {
+		return p.mutex.Unlock, nil
+	}
+	if err := lockJournal(journal, true); err != nil {
+		p.mutex.Unlock()
+		return nil, err
+	}
+	unlock := func() {
+		unlockJournal(journal)
+		p.mutex.Unlock()
+	}
+	if err := p.replay(); err != nil {
+		unlock()
+		return nil, err
+	}
+	return unlock, nil
+}
+
+// rejectStale returns ErrStaleFence before a write with a stale fence is journaled.
+// The caller holds the mutex.
+func (p *FilePersistence) rejectStale(fence Fence, deviceIds ...string) error {
+	p.InMemoryPersistence.mutex.RLock()
+	defer p.InMemoryPersistence.mutex.RUnlock()
+	return p.InMemoryPersistence.checkFence(fence, deviceIds...)
+}
+
+// write journals record and syncs it, then applies it to the memory. The caller
+// holds the lock.
+func (p *FilePersistence) write(record *journalRecord, apply func() error) error {
+	if p.journal == nil {
+		return os.ErrClosed
+	}
+	if err := appendRecords(p.journal, record); err != nil {
+		return err
+	}
+	if err := p.journal.Sync(); err != nil {
+		return err
+	}
+	offset, err := p.journal.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	p.offset = offset
+	return apply()
+}
+
+func (p *FilePersistence) SaveSignatureDevice(ctx context.Context, device *domain.SignatureDevice, events ...*domain.Event) error {
+	unlock, err := p.lockWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	record, err := p.deviceRecord(device, !p.keys[device.Id])
+	if err != nil {
+		return err
+	}
+	record.Events = events
+	return p.write(record, func() error {
+		p.keys[device.Id] = true
+		return p.InMemoryPersistence.SaveSignatureDevice(ctx, device, events...)
+	})
+}
+
+func (p *FilePersistence) SaveSignatureDevices(ctx context.Context, fence Fence, devices []*domain.SignatureDevice, events ...*domain.Event) error {
+	unlock, err := p.lockWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := p.rejectStale(fence, deviceIds(devices)...); err != nil {
+		return err
+	}
+	record := &journalRecord{Devices: make([]*journalRecord, 0, len(devices)), Events: events, Fence: fence}
+	for _, device := range devices {
+		deviceRecord, err := p.deviceRecord(device, !p.keys[device.Id])
+		if err != nil {
+			return err
+		}
+		record.Devices = append(record.Devices, deviceRecord)
+	}
+	return p.write(record, func() error {
+		for _, device := range devices {
+			p.keys[device.Id] = true
+		}
+		return p.InMemoryPersistence.SaveSignatureDevices(ctx, fence, devices, events...)
+	})
+}
+
+func (p *FilePersistence) SaveTransaction(ctx context.Context, fence Fence, transaction *domain.Transaction, fiscal *domain.FiscalTransaction, events ...*domain.Event) error {
+	unlock, err := p.lockWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := p.rejectStale(fence, transaction.DeviceId); err != nil {
+		return err
+	}
+	record := transactionRecord(transaction)
+	record.FiscalTransaction, record.Events, record.Fence = fiscal, events, fence
+	return p.write(record, func() error {
+		return p.InMemoryPersistence.SaveTransaction(ctx, fence, transaction, fiscal, events...)
+	})
+}
+
+func (p *FilePersistence) SaveTransactionTimestamp(ctx context.Context, transaction *domain.Transaction) error {
+	unlock, err := p.lockWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// Only timestamps of journaled transactions are journaled.
+	p.InMemoryPersistence.mutex.RLock()
+	stored := p.InMemoryPersistence.storedTransaction(transaction)
+	p.InMemoryPersistence.mutex.RUnlock()
+	if stored < 0 {
+		return domain.ErrTransactionNotFound
+	}
+
+	record := &journalRecord{Timestamp: &transactionTimestamp{
+		TenantId:      transaction.TenantId,
+		DeviceId:      transaction.DeviceId,
+		Counter:       transaction.Counter,
+		Token:         transaction.TimestampToken,
+		TimestampedAt: transaction.TimestampedAt,
+	}}
+	return p.write(record, func() error {
+		return p.InMemoryPersistence.SaveTransactionTimestamp(ctx, transaction)
+	})
+}
+
+func (p *FilePersistence) SaveFiscalTransaction(ctx context.Context, fence Fence, transaction *domain.FiscalTransaction) error {
+	unlock, err := p.lockWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := p.rejectStale(fence, transaction.DeviceId); err != nil {
+		return err
+	}
+	return p.write(&journalRecord{FiscalTransaction: transaction, Fence: fence}, func() error {
+		return p.InMemoryPersistence.SaveFiscalTransaction(ctx, fence, transaction)
+	})
+}
+
+func (p *FilePersistence) SaveAPIKey(ctx context.Context, key *domain.APIKey) error {
+	unlock, err := p.lockWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return p.write(&journalRecord{APIKey: key, APIKeyHash: key.Hash}, func() error {
+		return p.InMemoryPersistence.SaveAPIKey(ctx, key)
+	})
+}
+
+func (p *FilePersistence) SaveOrganization(ctx context.Context, organization *domain.Organization) error {
+	unlock, err := p.lockWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return p.write(&journalRecord{Organization: organization}, func() error {
+		return p.InMemoryPersistence.SaveOrganization(ctx, organization)
+	})
+}
+
+func (p *FilePersistence) SaveEventCursor(ctx context.Context, consumer string, sequence int64) error {
+	unlock, err := p.lockWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return p.write(&journalRecord{EventCursor: &eventCursor{Consumer: consumer, Sequence: sequence}}, func() error {
+		return p.InMemoryPersistence.SaveEventCursor(ctx, consumer, sequence)
+	})
+}
+
+func (p *FilePersistence) SaveWebhook(ctx context.Context, webhook *domain.Webhook) error {
+	unlock, err := p.lockWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return p.write(&journalRecord{Webhook: webhook, WebhookSecret: webhook.Secret}, func() error {
+		return p.InMemoryPersistence.SaveWebhook(ctx, webhook)
+	})
+}
+
+func (p *FilePersistence) DeleteWebhook(ctx context.Context, tenantId, id string) error {
+	unlock, err := p.lockWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := p.InMemoryPersistence.GetWebhook(ctx, tenantId, id); err != nil {
+		return err
+	}
+	return p.write(&journalRecord{DeletedWebhook: &deletedWebhook{TenantId: tenantId, Id: id}}, func() error {
+		return p.InMemoryPersistence.DeleteWebhook(ctx, tenantId, id)
+	})
+}
+
+func (p *FilePersistence) SaveWebhookDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	unlock, err := p.lockWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return p.write(&journalRecord{WebhookDelivery: delivery}, func() error {
+		return p.InMemoryPersistence.SaveWebhookDelivery(ctx, delivery)
+	})
+}
+
+// Flush compacts the journal to a single record per device, fiscal transaction,
+// API key, organization, webhook, delivery and cursor plus the transactions and
+// the events. The compacted journal replaces
+// the old one atomically.
+func (p *FilePersistence) Flush(ctx context.Context) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.journal == nil {
+		return os.ErrClosed
+	}
+
+	name := filepath.Join(p.dir, journalFileName)
+	compacted, err := os.OpenFile(name+".tmp", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(compacted)
+	if err := p.snapshot(writer); err != nil {
+		compacted.Close()
+		os.Remove(compacted.Name())
+		return err
+	}
+	if err := errors.Join(writer.Flush(), compacted.Sync()); err != nil {
+		compacted.Close()
+		os.Remove(compacted.Name())
+		return err
+	}
+	if err := os.Rename(compacted.Name(), name); err != nil {
+		compacted.Close()
+		os.Remove(compacted.Name())
+		return err
+	}
+	syncDir(p.dir)
+
+	p.journal.Close()
+	p.journal = compacted
+	p.offset, err = p.journal.Seek(0, io.SeekEnd)
+	return err
+}
+
+// snapshot writes the records of everything in memory to w.
+func (p *FilePersistence) snapshot(w io.Writer) error {
+	// The references are copied so that the devices are marshaled under their own
+	// lock only.
+	p.InMemoryPersistence.mutex.RLock()
+	var devices []*domain.SignatureDevice
+	fences := make(map[string]Fence, len(p.fences))
+	var records []*journalRecord
+	for _, device := range p.devices {
+		devices = append(devices, device)
+		fences[device.Id] = p.fences[device.Id]
+		for _, transaction := range p.transactions[device.Id] {
+			records = append(records, transactionRecord(transaction))
+		}
+	}
+	for _, transaction := range p.fiscalTransactions {
+		records = append(records, &journalRecord{FiscalTransaction: transaction})
+	}
+	for _, key := range p.apiKeys {
+		records = append(records, &journalRecord{APIKey: key, APIKeyHash: key.Hash})
+	}
+	for _, organization := range p.organizations {
+		records = append(records, &journalRecord{Organization: organization})
+	}
+	for consumer, sequence := range p.cursors {
+		records = append(records, &journalRecord{EventCursor: &eventCursor{Consumer: consumer, Sequence: sequence}})
+	}
+	for _, webhook := range p.webhooks {
+		records = append(records, &journalRecord{Webhook: webhook, WebhookSecret: webhook.Secret})
+	}
+	for _, delivery := range p.deliveries {
+		records = append(records, &journalRecord{WebhookDelivery: delivery})
+	}
+	for start := 0; start < len(p.events); start += snapshotEventsPerRecord {
+		end := start + snapshotEventsPerRecord
+		if end > len(p.events) {
+			end = len(p.events)
+		}
+		records = append(records, &journalRecord{Events: p.events[start:end]})
+	}
+	p.InMemoryPersistence.mutex.RUnlock()
+
+	for _, device := range devices {
+		record, err := p.deviceRecord(device, true)
+		if err != nil {
+			return err
+		}
+		record.Fence = fences[device.Id]
+		if err := appendRecords(w, record); err != nil {
+			return err
+		}
+	}
+	return appendRecords(w, records...)
+}
+
+// Close closes the journal and releases the lock of the directory.
+func (p *FilePersistence) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.journal == nil {
+		return nil
+	}
+
+	err := p.journal.Close()
+	p.journal = nil
+	return errors.Join(err, p.lock.Close())
+}
@@ -0,0 +1,331 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+// populate stores a device with two transactions and their events, a fiscal
+// transaction, an API key, an organization and a webhook with a delivery in p.
+func populate(t *testing.T, p *FilePersistence) *domain.SignatureDevice {
+	ctx := context.Background()
+	device, err := domain.NewSignatureDevice("device", "ECC", "Device")
+	if err != nil {
+		t.Fatal(err)
+	}
+	device.SecuredDataFormat = domain.SecuredDataV2
+	if err := p.SaveSignatureDevice(ctx, device); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		transaction, _ := device.Sign(ctx, "data")
+		event, _ := domain.NewEvent(fmt.Sprint("event", i), domain.EventTransactionSigned, device, transaction)
+		if err := p.SaveTransaction(ctx, NoFence, transaction, nil, event); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	fiscal, start, err := device.StartTransaction(ctx, "fiscal", domain.TextPayload("start"), time.Minute, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SaveTransaction(ctx, NoFence, start, fiscal)
+
+	key, _, _ := domain.NewAPIKey("key", "Key", []domain.Scope{domain.ScopeAdmin})
+	p.SaveAPIKey(ctx, key)
+	p.SaveOrganization(ctx, domain.NewOrganization("organization", "Organization"))
+
+	webhook, _ := domain.NewWebhook("webhook", "https://example.com/hook", nil)
+	p.SaveWebhook(ctx, webhook)
+	events, _ := p.ListEvents(ctx, 0, 10)
+	p.SaveWebhookDelivery(ctx, domain.NewWebhookDelivery("delivery", webhook, events[1]))
+	p.SaveEventCursor(ctx, "consumer", 2)
+	return device
+}
+
+// assertRestored checks that p holds what populate stored.
+func assertRestored(t *testing.T, p *FilePersistence, original *domain.SignatureDevice) {
+	ctx := context.Background()
+	device, err := p.GetSignatureDevice(ctx, "", original.Id)
+	if err != nil {
+		t.Fatalf("Expected the device to be restored: %v", err)
+	}
+	if device.SignatureCounter != 3 || device.LastSignature != original.LastSignature || device.TransactionCounter != 1 {
+		t.Errorf("Expected the chain of the device to be restored, got %+v", device)
+	}
+	publicKey, _ := original.PublicKey()
+	restoredKey, _ := device.PublicKey()
+	if string(publicKey) != string(restoredKey) {
+		t.Errorf("Expected the key of the device to be restored")
+	}
+	if transactions, _ := p.ListTransactions(ctx, "", device.Id); len(transactions) != 3 {
+		t.Errorf("Expected 3 transactions, got %d", len(transactions))
+	}
+	if _, err := p.GetFiscalTransaction(ctx, "", "fiscal"); err != nil {
+		t.Errorf("Expected the fiscal transaction to be restored: %v", err)
+	}
+	if key, err := p.GetAPIKey(ctx, "key"); err != nil || key.Hash == "" {
+		t.Errorf("Expected the API key to be restored with its hash, got %+v: %v", key, err)
+	}
+	if _, err := p.GetOrganization(ctx, "organization"); err != nil {
+		t.Errorf("Expected the organization to be restored: %v", err)
+	}
+	if events, _ := p.ListEvents(ctx, 0, 10); len(events) != 2 || events[1].Id != "event1" || events[1].Sequence != 2 {
+		t.Errorf("Expected 2 events in order, got %+v", events)
+	}
+	if cursor, _ := p.GetEventCursor(ctx, "consumer"); cursor != 2 {
+		t.Errorf("Expected cursor 2, got %d", cursor)
+	}
+	if webhook, err := p.GetWebhook(ctx, "", "webhook"); err != nil || webhook.Secret == "" {
+		t.Errorf("Expected the webhook to be restored with its secret, got %+v: %v", webhook, err)
+	}
+	if delivery, err := p.GetWebhookDelivery(ctx, "", "delivery"); err != nil || delivery.Event.Id != "event1" {
+		t.Errorf("Expected the delivery to be restored, got %+v: %v", delivery, err)
+	}
+}
+
+func TestFilePersistenceRestores(t *testing.T) {
+	dir := t.TempDir()
+	p, err := OpenFilePersistence(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	original := populate(t, p)
+	p.Close()
+
+	p, err = OpenFilePersistence(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer p.Close()
+	assertRestored(t, p, original)
+
+	// The restored device continues the chain of the original.
+	device, _ := p.GetSignatureDevice(context.Background(), "", original.Id)
+	transaction, err := device.Sign(context.Background(), "data")
+	if err != nil || transaction.Counter != 3 {
+		t.Errorf("Expected the next signature at counter 3, got %d: %v", transaction.Counter, err)
+	}
+}
+
+func TestFilePersistenceFlushCompacts(t *testing.T) {
+	dir := t.TempDir()
+	p, err := OpenFilePersistence(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	original := populate(t, p)
+	device, _ := p.GetSignatureDevice(context.Background(), "", original.Id)
+	device.Suspend()
+	p.SaveSignatureDevice(context.Background(), device)
+
+	if err := p.Flush(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	p.SaveOrganization(context.Background(), domain.NewOrganization("late", "Written after compaction"))
+	p.Close()
+
+	p, err = OpenFilePersistence(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer p.Close()
+	assertRestored(t, p, original)
+	if device, _ := p.GetSignatureDevice(context.Background(), "", original.Id); device.Status != domain.DeviceStatusSuspended {
+		t.Errorf("Expected the suspended device to be restored, got %s", device.Status)
+	}
+	if _, err := p.GetOrganization(context.Background(), "late"); err != nil {
+		t.Errorf("Expected writes after the compaction to be restored: %v", err)
+	}
+}
+
+func TestFilePersistenceRestoresRotation(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	p, err := OpenFilePersistence(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	device, _ := domain.NewSignatureDevice("device", "ECC", "Device")
+	p.SaveSignatureDevice(ctx, device)
+	successor, err := device.Rotate(context.Background(), "successor", domain.DefaultKeyParameters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, _ := domain.NewEvent("created", domain.EventDeviceCreated, successor, successor)
+	rotated, _ := domain.NewEvent("rotated", domain.EventDeviceRotated, device, device)
+	if err := p.SaveSignatureDevices(ctx, NoFence, []*domain.SignatureDevice{successor, device}, created, rotated); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	p.Close()
+
+	p, err = OpenFilePersistence(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer p.Close()
+	if restored, err := p.GetSignatureDevice(ctx, "", device.Id); err != nil || restored.SuccessorId != successor.Id {
+		t.Errorf("Expected the rotated device to be restored, got %+v: %v", restored, err)
+	}
+	if _, err := p.GetSignatureDevice(ctx, "", successor.Id); err != nil {
+		t.Errorf("Expected the successor to be restored: %v", err)
+	}
+	if events, _ := p.ListEvents(ctx, 0, 10); len(events) != 2 || events[0].Id != "created" || events[1].Id != "rotated" {
+		t.Errorf("Expected both events in order, got %+v", events)
+	}
+}
+
+func TestFilePersistenceRejectsStaleFence(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	p, err := OpenFilePersistence(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	device, _ := domain.NewSignatureDevice("device", "ECC", "Device")
+	p.SaveSignatureDevice(ctx, device)
+	transaction, _ := device.Sign(ctx, "data")
+	if err := p.SaveTransaction(ctx, 2, transaction, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	p.Flush(ctx)
+	p.Close()
+
+	p, err = OpenFilePersistence(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer p.Close()
+	late, _ := device.Sign(ctx, "late")
+	if err := p.SaveTransaction(ctx, 1, late, nil); !errors.Is(err, ErrStaleFence) {
+		t.Errorf("Expected ErrStaleFence, got %v", err)
+	}
+	if err := p.SaveTransaction(ctx, 3, late, nil); err != nil {
+		t.Errorf("Expected a later fence to be accepted: %v", err)
+	}
+	if transactions, _ := p.ListTransactions(ctx, "", device.Id); len(transactions) != 2 {
+		t.Errorf("Expected 2 transactions, got %d", len(transactions))
+	}
+}
+
+func TestFilePersistenceRestoresIdempotencyKeys(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	p, err := OpenFilePersistence(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	device, _ := domain.NewSignatureDevice("device", "ECC", "Device")
+	p.SaveSignatureDevice(ctx, device)
+	transaction, _ := device.Sign(ctx, "data")
+	transaction.IdempotencyKey, transaction.RequestFingerprint = "key", "fingerprint"
+	p.SaveTransaction(ctx, NoFence, transaction, nil)
+
+	for _, flush := range []bool{false, true} {
+		if flush {
+			p.Flush(ctx)
+		}
+		p.Close()
+		if p, err = OpenFilePersistence(dir); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		restored, err := p.GetTransactionByIdempotencyKey(ctx, "", "key")
+		if err != nil || restored.Counter != transaction.Counter || restored.RequestFingerprint != "fingerprint" {
+			t.Errorf("Expected the transaction by its idempotency key, got %+v: %v", restored, err)
+		}
+	}
+	p.Close()
+}
+
+func TestFilePersistenceRestoresTimestamps(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	p, err := OpenFilePersistence(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	device, _ := domain.NewSignatureDevice("device", "ECC", "Device")
+	p.SaveSignatureDevice(ctx, device)
+	transaction, _ := device.Sign(ctx, "data")
+	transaction.IdempotencyKey = "key"
+	p.SaveTransaction(ctx, NoFence, transaction, nil)
+
+	timestampedAt := time.Now().UTC().Truncate(time.Second)
+	timestamped := *transaction
+	timestamped.TimestampToken, timestamped.TimestampedAt = []byte("token"), &timestampedAt
+	if err := p.SaveTransactionTimestamp(ctx, &timestamped); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if transaction.TimestampToken != nil {
+		t.Errorf("Expected the stored transaction to be replaced rather than changed")
+	}
+	unknown := timestamped
+	unknown.Counter++
+	if err := p.SaveTransactionTimestamp(ctx, &unknown); !errors.Is(err, domain.ErrTransactionNotFound) {
+		t.Errorf("Expected ErrTransactionNotFound, got %v", err)
+	}
+
+	for _, flush := range []bool{false, true} {
+		if flush {
+			p.Flush(ctx)
+		}
+		p.Close()
+		if p, err = OpenFilePersistence(dir); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		restored, err := p.GetTransactionByIdempotencyKey(ctx, "", "key")
+		if err != nil || string(restored.TimestampToken) != "token" || !restored.TimestampedAt.Equal(timestampedAt) {
+			t.Errorf("Expected the timestamp to be restored, got %+v: %v", restored, err)
+		}
+	}
+	p.Close()
+}
+
+func TestFilePersistenceCutsInterruptedWrite(t *testing.T) {
+	dir := t.TempDir()
+	p, _ := OpenFilePersistence(dir)
+	p.SaveOrganization(context.Background(), domain.NewOrganization("organization", "Organization"))
+	p.Close()
+
+	journal, _ := os.OpenFile(filepath.Join(dir, journalFileName), os.O_WRONLY|os.O_APPEND, 0)
+	journal.WriteString(`{"organization":{"id":"inter`)
+	journal.Close()
+
+	p, err := OpenFilePersistence(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer p.Close()
+	if organizations, _ := p.ListOrganizations(context.Background()); len(organizations) != 1 {
+		t.Errorf("Expected the complete record only, got %d organizations", len(organizations))
+	}
+	p.SaveOrganization(context.Background(), domain.NewOrganization("next", "Next"))
+	if _, err := p.GetOrganization(context.Background(), "next"); err != nil {
+		t.Errorf("Expected writes after the cut: %v", err)
+	}
+}
+
+func TestFilePersistenceIsExclusive(t *testing.T) {
+	dir := t.TempDir()
+	p, err := OpenFilePersistence(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := OpenFilePersistence(dir); !errors.Is(err, ErrStoreLocked) {
+		t.Errorf("Expected ErrStoreLocked, got %v", err)
+	}
+	p.Close()
+
+	p, err = OpenFilePersistence(dir)
+	if err != nil {
+		t.Errorf("Expected the store to open once released: %v", err)
+	}
+	p.Close()
+}
@@ -1,48 +1,459 @@
 package persistence
 
 import (
+	"context"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
 )
 
 type InMemoryPersistence struct {
-	devices map[string]*domain.SignatureDevice
-	mutex   sync.RWMutex
+	devices      map[string]*domain.SignatureDevice
+	transactions map[string][]*domain.Transaction
+	// idempotencyKeys indexes the transactions by their idempotency key.
+	idempotencyKeys    map[string]*domain.Transaction
+	fiscalTransactions map[string]*domain.FiscalTransaction
+	apiKeys            map[string]*domain.APIKey
+	organizations      map[string]*domain.Organization
+	// events is the outbox, where the sequence number of an event is its index plus one.
+	events     []*domain.Event
+	cursors    map[string]int64
+	webhooks   map[string]*domain.Webhook
+	deliveries map[string]*domain.WebhookDelivery
+	// fences are the greatest fences the devices were written with.
+	fences map[string]Fence
+	mutex  sync.RWMutex
 }
 
 func NewInMemoryPersistence() *InMemoryPersistence {
 	return &InMemoryPersistence{
-		devices: make(map[string]*domain.SignatureDevice),
+		devices:            make(map[string]*domain.SignatureDevice),
+		transactions:       make(map[string][]*domain.Transaction),
+		idempotencyKeys:    make(map[string]*domain.Transaction),
+		fiscalTransactions: make(map[string]*domain.FiscalTransaction),
+		apiKeys:            make(map[string]*domain.APIKey),
+		organizations:      make(map[string]*domain.Organization),
+		cursors:            make(map[string]int64),
+		webhooks:           make(map[string]*domain.Webhook),
+		deliveries:         make(map[string]*domain.WebhookDelivery),
+		fences:             make(map[string]Fence),
 	}
 }
 
-func (p *InMemoryPersistence) SaveSignatureDevice(device *domain.SignatureDevice) error {
+// checkFence returns ErrStaleFence if one of the devices was written with a
+// greater fence than fence. The caller holds the mutex.
+func (p *InMemoryPersistence) checkFence(fence Fence, deviceIds ...string) error {
+	if fence == NoFence {
+		return nil
+	}
+	for _, id := range deviceIds {
+		if fence < p.fences[id] {
+			return ErrStaleFence
+		}
+	}
+	return nil
+}
+
+// fence checks fence like checkFence and records it for the devices. The caller
+// holds the mutex.
+func (p *InMemoryPersistence) fence(fence Fence, deviceIds ...string) error {
+	if err := p.checkFence(fence, deviceIds...); err != nil || fence == NoFence {
+		return err
+	}
+	for _, id := range deviceIds {
+		p.fences[id] = fence
+	}
+	return nil
+}
+
+// appendEvents appends events to the outbox, assigning their sequence numbers. The
+// caller holds the mutex.
+func (p *InMemoryPersistence) appendEvents(events []*domain.Event) {
+	for _, event := range events {
+		event.Sequence = int64(len(p.events)) + 1
+		p.events = append(p.events, event)
+	}
+}
+
+func (p *InMemoryPersistence) SaveSignatureDevice(ctx context.Context, device *domain.SignatureDevice, events ...*domain.Event) error {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
 	p.devices[device.Id] = device
+	p.appendEvents(events)
 	return nil
 }
 
-func (p *InMemoryPersistence) GetSignatureDevice(id string) (*domain.SignatureDevice, error) {
+func (p *InMemoryPersistence) SaveSignatureDevices(ctx context.Context, fence Fence, devices []*domain.SignatureDevice, events ...*domain.Event) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if err := p.fence(fence, deviceIds(devices)...); err != nil {
+		return err
+	}
+	for _, device := range devices {
+		p.devices[device.Id] = device
+	}
+	p.appendEvents(events)
+	return nil
+}
+
+func (p *InMemoryPersistence) GetSignatureDevice(ctx context.Context, tenantId, id string) (*domain.SignatureDevice, error) {
 	p.mutex.RLock()
 	defer p.mutex.RUnlock()
 
 	device, ok := p.devices[id]
-	if !ok {
+	if !ok || device.TenantId != tenantId {
 		return nil, domain.ErrDeviceNotFound
 	}
 	return device, nil
 }
 
-func (p *InMemoryPersistence) ListSignatureDevices() ([]*domain.SignatureDevice, error) {
+func (p *InMemoryPersistence) ListSignatureDevices(ctx context.Context, tenantId string) ([]*domain.SignatureDevice, error) {
 	p.mutex.RLock()
 	defer p.mutex.RUnlock()
 
-	var devices []*domain.SignatureDevice
+	devices := make([]*domain.SignatureDevice, 0)
 	for _, device := range p.devices {
-		devices = append(devices, device)
+		if device.TenantId == tenantId {
+			devices = append(devices, device)
+		}
 	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Id < devices[j].Id })
 	return devices, nil
 }
+
+func (p *InMemoryPersistence) CountSignatureDevices(ctx context.Context) ([]DeviceCount, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return countDevices(p.devices), nil
+}
+
+func (p *InMemoryPersistence) SaveTransaction(ctx context.Context, fence Fence, transaction *domain.Transaction, fiscal *domain.FiscalTransaction, events ...*domain.Event) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if err := p.fence(fence, transaction.DeviceId); err != nil {
+		return err
+	}
+	p.transactions[transaction.DeviceId] = append(p.transactions[transaction.DeviceId], transaction)
+	if transaction.IdempotencyKey != "" {
+		p.idempotencyKeys[transaction.IdempotencyKey] = transaction
+	}
+	// The stored device may be a copy other than the one that signed, its chain
+	// advances with every transaction.
+	if device, ok := p.devices[transaction.DeviceId]; ok {
+		device.Advance(transaction)
+	}
+	if fiscal != nil {
+		p.saveFiscalTransaction(fiscal)
+	}
+	p.appendEvents(events)
+	return nil
+}
+
+func (p *InMemoryPersistence) SaveTransactionTimestamp(ctx context.Context, transaction *domain.Transaction) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	i := p.storedTransaction(transaction)
+	if i < 0 {
+		return domain.ErrTransactionNotFound
+	}
+	// Readers may hold the stored transaction, it is replaced rather than changed.
+	stored := p.transactions[transaction.DeviceId][i]
+	timestamped := *stored
+	timestamped.TimestampToken, timestamped.TimestampedAt = transaction.TimestampToken, transaction.TimestampedAt
+	p.transactions[transaction.DeviceId][i] = &timestamped
+	if stored.IdempotencyKey != "" && p.idempotencyKeys[stored.IdempotencyKey] == stored {
+		p.idempotencyKeys[stored.IdempotencyKey] = &timestamped
+	}
+	return nil
+}
+
+// storedTransaction returns the index of the transaction stored with the tenant,
+// device and counter of transaction, -1 if there is none. The caller holds the
+// mutex.
+func (p *InMemoryPersistence) storedTransaction(transaction *domain.Transaction) int {
+	transactions := p.transactions[transaction.DeviceId]
+	for i := len(transactions) - 1; i >= 0; i-- {
+		if transactions[i].Counter == transaction.Counter && transactions[i].TenantId == transaction.TenantId {
+			return i
+		}
+	}
+	return -1
+}
+
+func (p *InMemoryPersistence) ListTransactions(ctx context.Context, tenantId, deviceId string) ([]*domain.Transaction, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	transactions := make([]*domain.Transaction, 0, len(p.transactions[deviceId]))
+	for _, transaction := range p.transactions[deviceId] {
+		if transaction.TenantId == tenantId {
+			transactions = append(transactions, transaction)
+		}
+	}
+	sort.Slice(transactions, func(i, j int) bool { return transactions[i].Counter < transactions[j].Counter })
+	return transactions, nil
+}
+
+func (p *InMemoryPersistence) WalkTransactions(ctx context.Context, tenantId, deviceId string, fn func(*domain.Transaction) error) error {
+	// The transactions live in memory anyway, only the references are copied so
+	// that fn runs without holding the lock.
+	transactions, err := p.ListTransactions(ctx, tenantId, deviceId)
+	if err != nil {
+		return err
+	}
+	for _, transaction := range transactions {
+		if err := fn(transaction); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *InMemoryPersistence) SaveFiscalTransaction(ctx context.Context, fence Fence, transaction *domain.FiscalTransaction) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if err := p.fence(fence, transaction.DeviceId); err != nil {
+		return err
+	}
+	p.saveFiscalTransaction(transaction)
+	return nil
+}
+
+// saveFiscalTransaction stores a fiscal transaction and advances the number of
+// transactions of its stored device. The caller holds the mutex.
+func (p *InMemoryPersistence) saveFiscalTransaction(transaction *domain.FiscalTransaction) {
+	p.fiscalTransactions[transaction.Id] = transaction
+	if device, ok := p.devices[transaction.DeviceId]; ok {
+		device.AdvanceTransactions(transaction)
+	}
+}
+
+func (p *InMemoryPersistence) GetTransactionByIdempotencyKey(ctx context.Context, tenantId, key string) (*domain.Transaction, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	transaction, ok := p.idempotencyKeys[key]
+	if !ok || transaction.TenantId != tenantId {
+		return nil, domain.ErrTransactionNotFound
+	}
+	return transaction, nil
+}
+
+func (p *InMemoryPersistence) GetFiscalTransaction(ctx context.Context, tenantId, id string) (*domain.FiscalTransaction, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	transaction, ok := p.fiscalTransactions[id]
+	if !ok || transaction.TenantId != tenantId {
+		return nil, domain.ErrTransactionNotFound
+	}
+	return transaction, nil
+}
+
+func (p *InMemoryPersistence) ListFiscalTransactions(ctx context.Context, tenantId string, state domain.FiscalTransactionState) ([]*domain.FiscalTransaction, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return filterFiscalTransactions(p.fiscalTransactions, func(transaction *domain.FiscalTransaction) bool {
+		return transaction.TenantId == tenantId && (state == "" || transaction.State == state)
+	}), nil
+}
+
+func (p *InMemoryPersistence) ListOverdueFiscalTransactions(ctx context.Context, now time.Time) ([]*domain.FiscalTransaction, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return filterFiscalTransactions(p.fiscalTransactions, func(transaction *domain.FiscalTransaction) bool {
+		return transaction.State == domain.FiscalTransactionOpen && !now.Before(transaction.ExpiresAt)
+	}), nil
+}
+
+func (p *InMemoryPersistence) SaveAPIKey(ctx context.Context, key *domain.APIKey) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.apiKeys[key.Id] = key
+	return nil
+}
+
+func (p *InMemoryPersistence) GetAPIKey(ctx context.Context, id string) (*domain.APIKey, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	key, ok := p.apiKeys[id]
+	if !ok {
+		return nil, domain.ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+func (p *InMemoryPersistence) GetAPIKeyByHash(ctx context.Context, hash string) (*domain.APIKey, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	for _, key := range p.apiKeys {
+		if key.Hash == hash {
+			return key, nil
+		}
+	}
+	return nil, domain.ErrAPIKeyNotFound
+}
+
+func (p *InMemoryPersistence) ListAPIKeys(ctx context.Context) ([]*domain.APIKey, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	var keys []*domain.APIKey
+	for _, key := range p.apiKeys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+func (p *InMemoryPersistence) SaveOrganization(ctx context.Context, organization *domain.Organization) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.organizations[organization.Id] = organization
+	return nil
+}
+
+func (p *InMemoryPersistence) GetOrganization(ctx context.Context, id string) (*domain.Organization, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	organization, ok := p.organizations[id]
+	if !ok {
+		return nil, domain.ErrOrganizationNotFound
+	}
+	return organization, nil
+}
+
+func (p *InMemoryPersistence) ListOrganizations(ctx context.Context) ([]*domain.Organization, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	organizations := make([]*domain.Organization, 0, len(p.organizations))
+	for _, organization := range p.organizations {
+		organizations = append(organizations, organization)
+	}
+	sort.Slice(organizations, func(i, j int) bool { return organizations[i].Id < organizations[j].Id })
+	return organizations, nil
+}
+
+func (p *InMemoryPersistence) ListEvents(ctx context.Context, after int64, limit int) ([]*domain.Event, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return listEvents(p.events, after, limit), nil
+}
+
+func (p *InMemoryPersistence) GetEventCursor(ctx context.Context, consumer string) (int64, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.cursors[consumer], nil
+}
+
+func (p *InMemoryPersistence) SaveEventCursor(ctx context.Context, consumer string, sequence int64) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.cursors[consumer] = sequence
+	return nil
+}
+
+func (p *InMemoryPersistence) SaveWebhook(ctx context.Context, webhook *domain.Webhook) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.webhooks[webhook.Id] = webhook
+	return nil
+}
+
+func (p *InMemoryPersistence) GetWebhook(ctx context.Context, tenantId, id string) (*domain.Webhook, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	webhook, ok := p.webhooks[id]
+	if !ok || webhook.TenantId != tenantId {
+		return nil, domain.ErrWebhookNotFound
+	}
+	return webhook, nil
+}
+
+func (p *InMemoryPersistence) ListWebhooks(ctx context.Context, tenantId string) ([]*domain.Webhook, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	webhooks := make([]*domain.Webhook, 0)
+	for _, webhook := range p.webhooks {
+		if webhook.TenantId == tenantId {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	sortWebhooks(webhooks)
+	return webhooks, nil
+}
+
+func (p *InMemoryPersistence) DeleteWebhook(ctx context.Context, tenantId, id string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if webhook, ok := p.webhooks[id]; !ok || webhook.TenantId != tenantId {
+		return domain.ErrWebhookNotFound
+	}
+	delete(p.webhooks, id)
+	for deliveryId, delivery := range p.deliveries {
+		if delivery.WebhookId == id {
+			delete(p.deliveries, deliveryId)
+		}
+	}
+	return nil
+}
+
+func (p *InMemoryPersistence) SaveWebhookDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.deliveries[delivery.Id] = delivery
+	return nil
+}
+
+func (p *InMemoryPersistence) GetWebhookDelivery(ctx context.Context, tenantId, id string) (*domain.WebhookDelivery, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	delivery, ok := p.deliveries[id]
+	if !ok || delivery.TenantId != tenantId {
+		return nil, domain.ErrDeliveryNotFound
+	}
+	return delivery, nil
+}
+
+func (p *InMemoryPersistence) ListWebhookDeliveries(ctx context.Context, tenantId, webhookId string, state domain.DeliveryState) ([]*domain.WebhookDelivery, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return filterWebhookDeliveries(p.deliveries, func(delivery *domain.WebhookDelivery) bool {
+		return delivery.TenantId == tenantId && delivery.WebhookId == webhookId && (state == "" || delivery.State == state)
+	}), nil
+}
+
+func (p *InMemoryPersistence) ListDueWebhookDeliveries(ctx context.Context, now time.Time) ([]*domain.WebhookDelivery, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return filterWebhookDeliveries(p.deliveries, func(delivery *domain.WebhookDelivery) bool {
+		return delivery.State == domain.DeliveryPending && !now.Before(delivery.NextAttemptAt)
+	}), nil
+}
@@ -1,13 +1,16 @@
 package persistence
 
 import (
+	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
 )
 
 func TestInMemoryPersistence(t *testing.T) {
+	ctx := context.Background()
 	persistence := NewInMemoryPersistence()
 
 	deviceID := "test-device"
@@ -18,13 +21,13 @@ func TestInMemoryPersistence(t *testing.T) {
 	}
 
 	// Save a device
-	err := persistence.SaveSignatureDevice(device)
+	err := persistence.SaveSignatureDevice(ctx, device)
 	if err != nil {
 		t.Errorf("Error saving device: %v", err)
 	}
 
 	// Get the saved device
-	savedDevice, err := persistence.GetSignatureDevice(deviceID)
+	savedDevice, err := persistence.GetSignatureDevice(ctx, "", deviceID)
 	if err != nil {
 		t.Errorf("Error getting device: %v", err)
 	}
@@ -34,7 +37,7 @@ func TestInMemoryPersistence(t *testing.T) {
 	}
 
 	// List devices
-	devices, err := persistence.ListSignatureDevices()
+	devices, err := persistence.ListSignatureDevices(ctx, "")
 	if err != nil {
 		t.Errorf("Error listing devices: %v", err)
 	}
@@ -45,8 +48,122 @@ func TestInMemoryPersistence(t *testing.T) {
 
 	// Get a non-existing device
 	nonExistingDeviceID := "non-existing-device"
-	_, err = persistence.GetSignatureDevice(nonExistingDeviceID)
+	_, err = persistence.GetSignatureDevice(ctx, "", nonExistingDeviceID)
 	if err == nil || !errors.Is(err, domain.ErrDeviceNotFound) {
 		t.Errorf("Expected device not found error")
 	}
 }
+
+func TestInMemoryPersistenceTransactions(t *testing.T) {
+	ctx := context.Background()
+	persistence := NewInMemoryPersistence()
+
+	for _, counter := range []int{1, 0} {
+		err := persistence.SaveTransaction(ctx, NoFence, &domain.Transaction{DeviceId: "test-device", Counter: counter}, nil)
+		if err != nil {
+			t.Errorf("Error saving transaction: %v", err)
+		}
+	}
+
+	transactions, err := persistence.ListTransactions(ctx, "", "test-device")
+	if err != nil {
+		t.Errorf("Error listing transactions: %v", err)
+	}
+	if len(transactions) != 2 || transactions[0].Counter != 0 || transactions[1].Counter != 1 {
+		t.Errorf("Listed transactions are not ordered by counter")
+	}
+
+	transactions, err = persistence.ListTransactions(ctx, "", "other-device")
+	if err != nil || len(transactions) != 0 {
+		t.Errorf("Expected no transactions for other device")
+	}
+}
+
+func TestInMemoryPersistenceFiscalTransactions(t *testing.T) {
+	ctx := context.Background()
+	persistence := NewInMemoryPersistence()
+
+	now := time.Now()
+	for _, transaction := range []*domain.FiscalTransaction{
+		{Id: "finished", TenantId: "tenant-a", State: domain.FiscalTransactionFinished, StartedAt: now, ExpiresAt: now},
+		{Id: "overdue", TenantId: "tenant-a", State: domain.FiscalTransactionOpen, StartedAt: now.Add(-time.Hour), ExpiresAt: now.Add(-time.Minute)},
+		{Id: "open", TenantId: "tenant-b", State: domain.FiscalTransactionOpen, StartedAt: now, ExpiresAt: now.Add(time.Minute)},
+	} {
+		if err := persistence.SaveFiscalTransaction(ctx, NoFence, transaction); err != nil {
+			t.Errorf("Error saving transaction: %v", err)
+		}
+	}
+
+	if _, err := persistence.GetFiscalTransaction(ctx, "tenant-b", "finished"); !errors.Is(err, domain.ErrTransactionNotFound) {
+		t.Errorf("Expected transaction not found error for other tenant")
+	}
+
+	transactions, err := persistence.ListFiscalTransactions(ctx, "tenant-a", "")
+	if err != nil || len(transactions) != 2 || transactions[0].Id != "overdue" {
+		t.Errorf("Expected the transactions of the tenant ordered by start, got %v", transactions)
+	}
+	transactions, err = persistence.ListFiscalTransactions(ctx, "tenant-a", domain.FiscalTransactionOpen)
+	if err != nil || len(transactions) != 1 || transactions[0].Id != "overdue" {
+		t.Errorf("Expected the open transaction of the tenant, got %v", transactions)
+	}
+
+	transactions, err = persistence.ListOverdueFiscalTransactions(ctx, now)
+	if err != nil || len(transactions) != 1 || transactions[0].Id != "overdue" {
+		t.Errorf("Expected the overdue transaction of all tenants, got %v", transactions)
+	}
+}
+
+func TestInMemoryPersistenceAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	persistence := NewInMemoryPersistence()
+
+	key, secret, err := domain.NewAPIKey("test-key", "Test Key", []domain.Scope{domain.ScopeSign})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := persistence.SaveAPIKey(ctx, key); err != nil {
+		t.Errorf("Error saving API key: %v", err)
+	}
+
+	found, err := persistence.GetAPIKeyByHash(ctx, domain.HashAPIKeySecret(secret))
+	if err != nil || found.Id != key.Id {
+		t.Errorf("Expected to find API key by hash")
+	}
+
+	_, err = persistence.GetAPIKey(ctx, "non-existing-key")
+	if err == nil || !errors.Is(err, domain.ErrAPIKeyNotFound) {
+		t.Errorf("Expected API key not found error")
+	}
+}
+
+func TestInMemoryPersistenceTenantIsolation(t *testing.T) {
+	ctx := context.Background()
+	persistence := NewInMemoryPersistence()
+
+	device := &domain.SignatureDevice{Id: "test-device", TenantId: "tenant-a"}
+	if err := persistence.SaveSignatureDevice(ctx, device); err != nil {
+		t.Errorf("Error saving device: %v", err)
+	}
+	if err := persistence.SaveTransaction(ctx, NoFence, &domain.Transaction{TenantId: "tenant-a", DeviceId: device.Id}, nil); err != nil {
+		t.Errorf("Error saving transaction: %v", err)
+	}
+
+	if _, err := persistence.GetSignatureDevice(ctx, "tenant-a", device.Id); err != nil {
+		t.Errorf("Error getting device of own tenant: %v", err)
+	}
+
+	_, err := persistence.GetSignatureDevice(ctx, "tenant-b", device.Id)
+	if err == nil || !errors.Is(err, domain.ErrDeviceNotFound) {
+		t.Errorf("Expected device not found error for other tenant")
+	}
+
+	devices, err := persistence.ListSignatureDevices(ctx, "tenant-b")
+	if err != nil || len(devices) != 0 {
+		t.Errorf("Expected no devices for other tenant")
+	}
+
+	transactions, err := persistence.ListTransactions(ctx, "tenant-b", device.Id)
+	if err != nil || len(transactions) != 0 {
+		t.Errorf("Expected no transactions for other tenant")
+	}
+}
@@ -0,0 +1,31 @@
+//go:build !unix
+
+package persistence
+
+import (
+	"errors"
+	"os"
+)
+
+// lockFile does not lock on platforms without flock; operators must not open a
+// store from two processes there.
+func lockFile(file *os.File) error {
+	return nil
+}
+
+// shareFile fails on platforms without flock, which cannot coordinate the
+// processes sharing a store.
+func shareFile(file *os.File) error {
+	return errors.New("sharing a storage directory is not supported on this platform")
+}
+
+// lockJournal does nothing on platforms without flock, where a journal is never
+// shared.
+func lockJournal(file *os.File, exclusive bool) error {
+	return nil
+}
+
+func unlockJournal(file *os.File) {}
+
+// syncDir does nothing on platforms that cannot sync directories.
+func syncDir(dir string) {}
@@ -0,0 +1,59 @@
+//go:build unix
+
+package persistence
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive advisory lock on file. The lock is released when the
+// file is closed or the process exits, so a crashed server never leaves it behind.
+func lockFile(file *os.File) error {
+	return flock(file, syscall.LOCK_EX|syscall.LOCK_NB)
+}
+
+// shareFile takes a shared advisory lock on file like lockFile, which fails while
+// another process holds the exclusive one.
+func shareFile(file *os.File) error {
+	return flock(file, syscall.LOCK_SH|syscall.LOCK_NB)
+}
+
+func flock(file *os.File, how int) error {
+	err := syscall.Flock(int(file.Fd()), how)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return ErrStoreLocked
+	}
+	return err
+}
+
+// lockJournal waits for an advisory lock on the journal, exclusive for writing or
+// shared for reading.
+func lockJournal(file *os.File, exclusive bool) error {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	for {
+		err := syscall.Flock(int(file.Fd()), how)
+		if !errors.Is(err, syscall.EINTR) {
+			return err
+		}
+	}
+}
+
+// unlockJournal releases the lock of lockJournal.
+func unlockJournal(file *os.File) {
+	syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
+
+// syncDir syncs the directory entries of dir, making a rename durable. Errors are
+// ignored: the rename itself succeeded and is at worst lost in a crash, leaving the
+// previous journal.
+func syncDir(dir string) {
+	if directory, err := os.Open(dir); err == nil {
+		directory.Sync()
+		directory.Close()
+	}
+}
@@ -1,35 +1,275 @@
 package persistence
 
 import (
+	"context"
+	"sort"
+	"time"
+
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
 )
 
 type MockRepository struct {
-	Devices map[string]*domain.SignatureDevice
+	Devices            map[string]*domain.SignatureDevice
+	Transactions       []*domain.Transaction
+	FiscalTransactions map[string]*domain.FiscalTransaction
+	APIKeys            map[string]*domain.APIKey
+	Organizations      map[string]*domain.Organization
+	Events             []*domain.Event
+	EventCursors       map[string]int64
+	Webhooks           map[string]*domain.Webhook
+	WebhookDeliveries  map[string]*domain.WebhookDelivery
 }
 
 func NewMockRepository() *MockRepository {
 	return &MockRepository{
-		Devices: make(map[string]*domain.SignatureDevice),
+		Devices:            make(map[string]*domain.SignatureDevice),
+		FiscalTransactions: make(map[string]*domain.FiscalTransaction),
+		APIKeys:            make(map[string]*domain.APIKey),
+		Organizations:      make(map[string]*domain.Organization),
+		EventCursors:       make(map[string]int64),
+		Webhooks:           make(map[string]*domain.Webhook),
+		WebhookDeliveries:  make(map[string]*domain.WebhookDelivery),
+	}
+}
+
+// recordEvents appends events to the outbox.
+func (r *MockRepository) recordEvents(events []*domain.Event) {
+	for _, event := range events {
+		event.Sequence = int64(len(r.Events)) + 1
+		r.Events = append(r.Events, event)
 	}
 }
 
-func (r *MockRepository) SaveSignatureDevice(device *domain.SignatureDevice) error {
+func (r *MockRepository) SaveSignatureDevice(ctx context.Context, device *domain.SignatureDevice, events ...*domain.Event) error {
 	r.Devices[device.Id] = device
+	r.recordEvents(events)
+	return nil
+}
+
+func (r *MockRepository) SaveSignatureDevices(ctx context.Context, fence Fence, devices []*domain.SignatureDevice, events ...*domain.Event) error {
+	for _, device := range devices {
+		r.Devices[device.Id] = device
+	}
+	r.recordEvents(events)
 	return nil
 }
 
-func (r *MockRepository) GetSignatureDevice(deviceId string) (*domain.SignatureDevice, error) {
-	if device, ok := r.Devices[deviceId]; ok {
+func (r *MockRepository) GetSignatureDevice(ctx context.Context, tenantId, deviceId string) (*domain.SignatureDevice, error) {
+	if device, ok := r.Devices[deviceId]; ok && device.TenantId == tenantId {
 		return device, nil
 	}
 	return nil, domain.ErrDeviceNotFound
 }
 
-func (r *MockRepository) ListSignatureDevices() ([]*domain.SignatureDevice, error) {
+func (r *MockRepository) ListSignatureDevices(ctx context.Context, tenantId string) ([]*domain.SignatureDevice, error) {
 	devices := make([]*domain.SignatureDevice, 0, len(r.Devices))
 	for _, device := range r.Devices {
-		devices = append(devices, device)
+		if device.TenantId == tenantId {
+			devices = append(devices, device)
+		}
 	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Id < devices[j].Id })
 	return devices, nil
 }
+
+func (r *MockRepository) CountSignatureDevices(ctx context.Context) ([]DeviceCount, error) {
+	return countDevices(r.Devices), nil
+}
+
+func (r *MockRepository) SaveTransaction(ctx context.Context, fence Fence, transaction *domain.Transaction, fiscal *domain.FiscalTransaction, events ...*domain.Event) error {
+	r.Transactions = append(r.Transactions, transaction)
+	if fiscal != nil {
+		r.FiscalTransactions[fiscal.Id] = fiscal
+	}
+	r.recordEvents(events)
+	return nil
+}
+
+func (r *MockRepository) SaveTransactionTimestamp(ctx context.Context, transaction *domain.Transaction) error {
+	for i, stored := range r.Transactions {
+		if stored.DeviceId == transaction.DeviceId && stored.Counter == transaction.Counter && stored.TenantId == transaction.TenantId {
+			timestamped := *stored
+			timestamped.TimestampToken, timestamped.TimestampedAt = transaction.TimestampToken, transaction.TimestampedAt
+			r.Transactions[i] = &timestamped
+			return nil
+		}
+	}
+	return domain.ErrTransactionNotFound
+}
+
+func (r *MockRepository) ListTransactions(ctx context.Context, tenantId, deviceId string) ([]*domain.Transaction, error) {
+	transactions := make([]*domain.Transaction, 0)
+	for _, transaction := range r.Transactions {
+		if transaction.TenantId == tenantId && transaction.DeviceId == deviceId {
+			transactions = append(transactions, transaction)
+		}
+	}
+	return transactions, nil
+}
+
+func (r *MockRepository) WalkTransactions(ctx context.Context, tenantId, deviceId string, fn func(*domain.Transaction) error) error {
+	transactions, _ := r.ListTransactions(ctx, tenantId, deviceId)
+	for _, transaction := range transactions {
+		if err := fn(transaction); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MockRepository) GetTransactionByIdempotencyKey(ctx context.Context, tenantId, key string) (*domain.Transaction, error) {
+	for _, transaction := range r.Transactions {
+		if transaction.IdempotencyKey == key && transaction.TenantId == tenantId {
+			return transaction, nil
+		}
+	}
+	return nil, domain.ErrTransactionNotFound
+}
+
+func (r *MockRepository) SaveFiscalTransaction(ctx context.Context, fence Fence, transaction *domain.FiscalTransaction) error {
+	r.FiscalTransactions[transaction.Id] = transaction
+	return nil
+}
+
+func (r *MockRepository) GetFiscalTransaction(ctx context.Context, tenantId, id string) (*domain.FiscalTransaction, error) {
+	if transaction, ok := r.FiscalTransactions[id]; ok && transaction.TenantId == tenantId {
+		return transaction, nil
+	}
+	return nil, domain.ErrTransactionNotFound
+}
+
+func (r *MockRepository) ListFiscalTransactions(ctx context.Context, tenantId string, state domain.FiscalTransactionState) ([]*domain.FiscalTransaction, error) {
+	return filterFiscalTransactions(r.FiscalTransactions, func(transaction *domain.FiscalTransaction) bool {
+		return transaction.TenantId == tenantId && (state == "" || transaction.State == state)
+	}), nil
+}
+
+func (r *MockRepository) ListOverdueFiscalTransactions(ctx context.Context, now time.Time) ([]*domain.FiscalTransaction, error) {
+	return filterFiscalTransactions(r.FiscalTransactions, func(transaction *domain.FiscalTransaction) bool {
+		return transaction.State == domain.FiscalTransactionOpen && !now.Before(transaction.ExpiresAt)
+	}), nil
+}
+
+func (r *MockRepository) SaveAPIKey(ctx context.Context, key *domain.APIKey) error {
+	r.APIKeys[key.Id] = key
+	return nil
+}
+
+func (r *MockRepository) GetAPIKey(ctx context.Context, id string) (*domain.APIKey, error) {
+	if key, ok := r.APIKeys[id]; ok {
+		return key, nil
+	}
+	return nil, domain.ErrAPIKeyNotFound
+}
+
+func (r *MockRepository) GetAPIKeyByHash(ctx context.Context, hash string) (*domain.APIKey, error) {
+	for _, key := range r.APIKeys {
+		if key.Hash == hash {
+			return key, nil
+		}
+	}
+	return nil, domain.ErrAPIKeyNotFound
+}
+
+func (r *MockRepository) ListAPIKeys(ctx context.Context) ([]*domain.APIKey, error) {
+	keys := make([]*domain.APIKey, 0, len(r.APIKeys))
+	for _, key := range r.APIKeys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Id < keys[j].Id })
+	return keys, nil
+}
+
+func (r *MockRepository) SaveOrganization(ctx context.Context, organization *domain.Organization) error {
+	r.Organizations[organization.Id] = organization
+	return nil
+}
+
+func (r *MockRepository) GetOrganization(ctx context.Context, id string) (*domain.Organization, error) {
+	if organization, ok := r.Organizations[id]; ok {
+		return organization, nil
+	}
+	return nil, domain.ErrOrganizationNotFound
+}
+
+func (r *MockRepository) ListOrganizations(ctx context.Context) ([]*domain.Organization, error) {
+	organizations := make([]*domain.Organization, 0, len(r.Organizations))
+	for _, organization := range r.Organizations {
+		organizations = append(organizations, organization)
+	}
+	sort.Slice(organizations, func(i, j int) bool { return organizations[i].Id < organizations[j].Id })
+	return organizations, nil
+}
+
+func (r *MockRepository) ListEvents(ctx context.Context, after int64, limit int) ([]*domain.Event, error) {
+	return listEvents(r.Events, after, limit), nil
+}
+
+func (r *MockRepository) GetEventCursor(ctx context.Context, consumer string) (int64, error) {
+	return r.EventCursors[consumer], nil
+}
+
+func (r *MockRepository) SaveEventCursor(ctx context.Context, consumer string, sequence int64) error {
+	r.EventCursors[consumer] = sequence
+	return nil
+}
+
+func (r *MockRepository) SaveWebhook(ctx context.Context, webhook *domain.Webhook) error {
+	r.Webhooks[webhook.Id] = webhook
+	return nil
+}
+
+func (r *MockRepository) GetWebhook(ctx context.Context, tenantId, id string) (*domain.Webhook, error) {
+	if webhook, ok := r.Webhooks[id]; ok && webhook.TenantId == tenantId {
+		return webhook, nil
+	}
+	return nil, domain.ErrWebhookNotFound
+}
+
+func (r *MockRepository) ListWebhooks(ctx context.Context, tenantId string) ([]*domain.Webhook, error) {
+	webhooks := make([]*domain.Webhook, 0)
+	for _, webhook := range r.Webhooks {
+		if webhook.TenantId == tenantId {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	sortWebhooks(webhooks)
+	return webhooks, nil
+}
+
+func (r *MockRepository) DeleteWebhook(ctx context.Context, tenantId, id string) error {
+	if _, err := r.GetWebhook(ctx, tenantId, id); err != nil {
+		return err
+	}
+	delete(r.Webhooks, id)
+	for deliveryId, delivery := range r.WebhookDeliveries {
+		if delivery.WebhookId == id {
+			delete(r.WebhookDeliveries, deliveryId)
+		}
+	}
+	return nil
+}
+
+func (r *MockRepository) SaveWebhookDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	r.WebhookDeliveries[delivery.Id] = delivery
+	return nil
+}
+
+func (r *MockRepository) GetWebhookDelivery(ctx context.Context, tenantId, id string) (*domain.WebhookDelivery, error) {
+	if delivery, ok := r.WebhookDeliveries[id]; ok && delivery.TenantId == tenantId {
+		return delivery, nil
+	}
+	return nil, domain.ErrDeliveryNotFound
+}
+
+func (r *MockRepository) ListWebhookDeliveries(ctx context.Context, tenantId, webhookId string, state domain.DeliveryState) ([]*domain.WebhookDelivery, error) {
+	return filterWebhookDeliveries(r.WebhookDeliveries, func(delivery *domain.WebhookDelivery) bool {
+		return delivery.TenantId == tenantId && delivery.WebhookId == webhookId && (state == "" || delivery.State == state)
+	}), nil
+}
+
+func (r *MockRepository) ListDueWebhookDeliveries(ctx context.Context, now time.Time) ([]*domain.WebhookDelivery, error) {
+	return filterWebhookDeliveries(r.WebhookDeliveries, func(delivery *domain.WebhookDelivery) bool {
+		return delivery.State == domain.DeliveryPending && !now.Before(delivery.NextAttemptAt)
+	}), nil
+}
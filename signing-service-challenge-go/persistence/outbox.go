@@ -0,0 +1,45 @@
+package persistence
+
+import (
+	"sort"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+// listEvents returns at most limit events of an outbox ordered by sequence number
+// that follow after.
+func listEvents(events []*domain.Event, after int64, limit int) []*domain.Event {
+	events = events[sort.Search(len(events), func(i int) bool { return events[i].Sequence > after }):]
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return append([]*domain.Event{}, events...)
+}
+
+// filterWebhookDeliveries returns the deliveries matching keep ordered by the
+// sequence number of their event.
+func filterWebhookDeliveries(deliveries map[string]*domain.WebhookDelivery, keep func(*domain.WebhookDelivery) bool) []*domain.WebhookDelivery {
+	result := make([]*domain.WebhookDelivery, 0)
+	for _, delivery := range deliveries {
+		if keep(delivery) {
+			result = append(result, delivery)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Event.Sequence != result[j].Event.Sequence {
+			return result[i].Event.Sequence < result[j].Event.Sequence
+		}
+		return result[i].WebhookId < result[j].WebhookId
+	})
+	return result
+}
+
+// sortWebhooks orders webhooks by creation.
+func sortWebhooks(webhooks []*domain.Webhook) {
+	sort.Slice(webhooks, func(i, j int) bool {
+		if !webhooks[i].CreatedAt.Equal(webhooks[j].CreatedAt) {
+			return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+		}
+		return webhooks[i].Id < webhooks[j].Id
+	})
+}
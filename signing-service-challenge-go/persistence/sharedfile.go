@@ -0,0 +1,201 @@
+package persistence
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+// SharedFilePersistence is a FilePersistence whose directory several processes,
+// such as the instances of a scaled-out service, open at the same time. They
+// append to a single journal, taking turns under an advisory lock of the journal,
+// and every read first restores the records the other processes appended since.
+// The directory must be on a file system with working flock, i.e. a local one.
+//
+// Every process keeps all data in memory. Devices must be leased across the
+// processes (see devicelock) so that they sign with the counter the previous
+// holder stored; writes under a stale lease are rejected as usual.
+type SharedFilePersistence struct {
+	*FilePersistence
+}
+
+// OpenSharedFilePersistence opens the store in dir for sharing with other
+// processes, creating it if it does not exist, and restores its data. It fails
+// with ErrStoreLocked if a process has it open with OpenFilePersistence.
+func OpenSharedFilePersistence(dir string) (*SharedFilePersistence, error) {
+	p, err := openFilePersistence(dir, true)
+	if err != nil {
+		return nil, err
+	}
+	return &SharedFilePersistence{p}, nil
+}
+
+// refresh restores the records the other processes appended to the journal since
+// the last read or write.
+func (p *SharedFilePersistence) refresh() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.journal == nil {
+		return os.ErrClosed
+	}
+	if err := lockJournal(p.journal, false); err != nil {
+		return err
+	}
+	defer unlockJournal(p.journal)
+	return p.catchUp()
+}
+
+// Flush does not compact the journal, the other processes read it at their own
+// offsets. Every write is synced already.
+func (p *SharedFilePersistence) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (p *SharedFilePersistence) GetSignatureDevice(ctx context.Context, tenantId, id string) (*domain.SignatureDevice, error) {
+	if err := p.refresh(); err != nil {
+		return nil, err
+	}
+	return p.FilePersistence.GetSignatureDevice(ctx, tenantId, id)
+}
+
+func (p *SharedFilePersistence) ListSignatureDevices(ctx context.Context, tenantId string) ([]*domain.SignatureDevice, error) {
+	if err := p.refresh(); err != nil {
+		return nil, err
+	}
+	return p.FilePersistence.ListSignatureDevices(ctx, tenantId)
+}
+
+func (p *SharedFilePersistence) CountSignatureDevices(ctx context.Context) ([]DeviceCount, error) {
+	if err := p.refresh(); err != nil {
+		return nil, err
+	}
+	return p.FilePersistence.CountSignatureDevices(ctx)
+}
+
+func (p *SharedFilePersistence) ListTransactions(ctx context.Context, tenantId, deviceId string) ([]*domain.Transaction, error) {
+	if err := p.refresh(); err != nil {
+		return nil, err
+	}
+	return p.FilePersistence.ListTransactions(ctx, tenantId, deviceId)
+}
+
+func (p *SharedFilePersistence) WalkTransactions(ctx context.Context, tenantId, deviceId string, fn func(*domain.Transaction) error) error {
+	if err := p.refresh(); err != nil {
+		return err
+	}
+	return p.FilePersistence.WalkTransactions(ctx, tenantId, deviceId, fn)
+}
+
+func (p *SharedFilePersistence) GetTransactionByIdempotencyKey(ctx context.Context, tenantId, key string) (*domain.Transaction, error) {
+	if err := p.refresh(); err != nil {
+		return nil, err
+	}
+	return p.FilePersistence.GetTransactionByIdempotencyKey(ctx, tenantId, key)
+}
+
+func (p *SharedFilePersistence) GetFiscalTransaction(ctx context.Context, tenantId, id string) (*domain.FiscalTransaction, error) {
+	if err := p.refresh(); err != nil {
+		return nil, err
+	}
+	return p.FilePersistence.GetFiscalTransaction(ctx, tenantId, id)
+}
+
+func (p *SharedFilePersistence) ListFiscalTransactions(ctx context.Context, tenantId string, state domain.FiscalTransactionState) ([]*domain.FiscalTransaction, error) {
+	if err := p.refresh(); err != nil {
+		return nil, err
+	}
+	return p.FilePersistence.ListFiscalTransactions(ctx, tenantId, state)
+}
+
+func (p *SharedFilePersistence) ListOverdueFiscalTransactions(ctx context.Context, now time.Time) ([]*domain.FiscalTransaction, error) {
+	if err := p.refresh(); err != nil {
+		return nil, err
+	}
+	return p.FilePersistence.ListOverdueFiscalTransactions(ctx, now)
+}
+
+func (p *SharedFilePersistence) GetAPIKey(ctx context.Context, id string) (*domain.APIKey, error) {
+	if err := p.refresh(); err != nil {
+		return nil, err
+	}
+	return p.FilePersistence.GetAPIKey(ctx, id)
+}
+
+func (p *SharedFilePersistence) GetAPIKeyByHash(ctx context.Context, hash string) (*domain.APIKey, error) {
+	if err := p.refresh(); err != nil {
+		return nil, err
+	}
+	return p.FilePersistence.GetAPIKeyByHash(ctx, hash)
+}
+
+func (p *SharedFilePersistence) ListAPIKeys(ctx context.Context) ([]*domain.APIKey, error) {
+	if err := p.refresh(); err != nil {
+		return nil, err
+	}
+	return p.FilePersistence.ListAPIKeys(ctx)
+}
+
+func (p *SharedFilePersistence) GetOrganization(ctx context.Context, id string) (*domain.Organization, error) {
+	if err := p.refresh(); err != nil {
+		return nil, err
+	}
+	return p.FilePersistence.GetOrganization(ctx, id)
+}
+
+func (p *SharedFilePersistence) ListOrganizations(ctx context.Context) ([]*domain.Organization, error) {
+	if err := p.refresh(); err != nil {
+		return nil, err
+	}
+	return p.FilePersistence.ListOrganizations(ctx)
+}
+
+func (p *SharedFilePersistence) ListEvents(ctx context.Context, after int64, limit int) ([]*domain.Event, error) {
+	if err := p.refresh(); err != nil {
+		return nil, err
+	}
+	return p.FilePersistence.ListEvents(ctx, after, limit)
+}
+
+func (p *SharedFilePersistence) GetEventCursor(ctx context.Context, consumer string) (int64, error) {
+	if err := p.refresh(); err != nil {
+		return 0, err
+	}
+	return p.FilePersistence.GetEventCursor(ctx, consumer)
+}
+
+func (p *SharedFilePersistence) GetWebhook(ctx context.Context, tenantId, id string) (*domain.Webhook, error) {
+	if err := p.refresh(); err != nil {
+		return nil, err
+	}
+	return p.FilePersistence.GetWebhook(ctx, tenantId, id)
+}
+
+func (p *SharedFilePersistence) ListWebhooks(ctx context.Context, tenantId string) ([]*domain.Webhook, error) {
+	if err := p.refresh(); err != nil {
+		return nil, err
+	}
+	return p.FilePersistence.ListWebhooks(ctx, tenantId)
+}
+
+func (p *SharedFilePersistence) GetWebhookDelivery(ctx context.Context, tenantId, id string) (*domain.WebhookDelivery, error) {
+	if err := p.refresh(); err != nil {
+		return nil, err
+	}
+	return p.FilePersistence.GetWebhookDelivery(ctx, tenantId, id)
+}
+
+func (p *SharedFilePersistence) ListWebhookDeliveries(ctx context.Context, tenantId, webhookId string, state domain.DeliveryState) ([]*domain.WebhookDelivery, error) {
+	if err := p.refresh(); err != nil {
+		return nil, err
+	}
+	return p.FilePersistence.ListWebhookDeliveries(ctx, tenantId, webhookId, state)
+}
+
+func (p *SharedFilePersistence) ListDueWebhookDeliveries(ctx context.Context, now time.Time) ([]*domain.WebhookDelivery, error) {
+	if err := p.refresh(); err != nil {
+		return nil, err
+	}
+	return p.FilePersistence.ListDueWebhookDeliveries(ctx, now)
+}
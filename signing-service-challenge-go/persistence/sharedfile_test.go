@@ -0,0 +1,102 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+func openShared(t *testing.T, dir string) *SharedFilePersistence {
+	t.Helper()
+	p, err := OpenSharedFilePersistence(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+func TestSharedFilePersistenceReadsWritesOfOthers(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	a, b := openShared(t, dir), openShared(t, dir)
+
+	device, _ := domain.NewSignatureDevice("device", "ECC", "Device")
+	if err := a.SaveSignatureDevice(ctx, device); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Each store signs with its own copy of the device, taking turns like the
+	// holders of successive leases.
+	for i, store := range []*SharedFilePersistence{b, a, b} {
+		copied, err := store.GetSignatureDevice(ctx, "", device.Id)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		transaction, _ := copied.Sign(ctx, "data")
+		if transaction.Counter != i {
+			t.Errorf("Expected counter %d, got %d", i, transaction.Counter)
+		}
+		if err := store.SaveTransaction(ctx, Fence(i+1), transaction, nil); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	transactions, _ := a.ListTransactions(ctx, "", device.Id)
+	if len(transactions) != 3 {
+		t.Fatalf("Expected 3 transactions, got %d", len(transactions))
+	}
+	for i, transaction := range transactions {
+		if transaction.Counter != i {
+			t.Errorf("Expected counter %d, got %d", i, transaction.Counter)
+		}
+	}
+
+	// The fence of b's last write reaches a before a writes.
+	late, _ := device.Sign(ctx, "late")
+	if err := a.SaveTransaction(ctx, 2, late, nil); !errors.Is(err, ErrStaleFence) {
+		t.Errorf("Expected ErrStaleFence, got %v", err)
+	}
+}
+
+func TestSharedFilePersistenceCutsInterruptedWrite(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	a, b := openShared(t, dir), openShared(t, dir)
+
+	journal, _ := os.OpenFile(filepath.Join(dir, journalFileName), os.O_WRONLY|os.O_APPEND, 0)
+	journal.WriteString(`{"organization":{"id":"inter`)
+	journal.Close()
+	if _, err := b.ListOrganizations(ctx); err != nil {
+		t.Fatalf("Expected a read to skip the interrupted write, got %v", err)
+	}
+
+	if err := a.SaveOrganization(ctx, domain.NewOrganization("organization", "Organization")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := b.GetOrganization(ctx, "organization"); err != nil {
+		t.Errorf("Expected the write after the interrupted one to be read, got %v", err)
+	}
+}
+
+func TestSharedFilePersistenceExcludesExclusiveOpen(t *testing.T) {
+	dir := t.TempDir()
+	shared := openShared(t, dir)
+	if _, err := OpenFilePersistence(dir); !errors.Is(err, ErrStoreLocked) {
+		t.Errorf("Expected ErrStoreLocked, got %v", err)
+	}
+	shared.Close()
+
+	exclusive, err := OpenFilePersistence(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer exclusive.Close()
+	if _, err := OpenSharedFilePersistence(dir); !errors.Is(err, ErrStoreLocked) {
+		t.Errorf("Expected ErrStoreLocked, got %v", err)
+	}
+}
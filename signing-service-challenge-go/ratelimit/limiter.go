@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit configures a token bucket that refills Rate tokens per second up to Burst tokens.
+// A Limit with a zero Rate does not limit at all.
+type Limit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// Unlimited reports whether the Limit admits every request.
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0 || l.Burst <= 0
+}
+
+// Result describes the state of a bucket after an attempt to take a token from it.
+type Result struct {
+	Allowed    bool
+	Remaining  float64
+	RetryAfter time.Duration
+}
+
+// Store keeps token buckets. Implementations must take tokens atomically, so that a
+// Store shared by several service instances enforces a single limit across all of them.
+type Store interface {
+	// Take refills the bucket of key up to now and takes cost tokens from it if enough
+	// are available. A cost of zero reports the state of the bucket without modifying it.
+	Take(ctx context.Context, key string, limit Limit, cost float64, now time.Time) (Result, error)
+}
+
+// Subject is a single bucket a request is charged against.
+type Subject struct {
+	Key   string
+	Limit Limit
+}
+
+// Limits configures the buckets of the service.
+type Limits struct {
+	Device Limit `json:"device"`
+	APIKey Limit `json:"api_key"`
+	Tenant Limit `json:"tenant"`
+}
+
+// Limiter charges requests against per-device, per-API key and per-tenant buckets.
+type Limiter struct {
+	store  Store
+	limits Limits
+	now    func() time.Time
+}
+
+// NewLimiter creates a Limiter keeping its buckets in store.
+func NewLimiter(store Store, limits Limits) *Limiter {
+	return &Limiter{
+		store:  store,
+		limits: limits,
+		now:    time.Now,
+	}
+}
+
+// Device is the bucket of a signature device.
+func (l *Limiter) Device(tenantId, deviceId string) Subject {
+	return Subject{Key: "device:" + tenantId + "/" + deviceId, Limit: l.limits.Device}
+}
+
+// APIKey is the bucket of an API key.
+func (l *Limiter) APIKey(keyId string) Subject {
+	return Subject{Key: "api_key:" + keyId, Limit: l.limits.APIKey}
+}
+
+// Tenant is the bucket of a tenant.
+func (l *Limiter) Tenant(tenantId string) Subject {
+	return Subject{Key: "tenant:" + tenantId, Limit: l.limits.Tenant}
+}
+
+// Allow takes a token from the bucket of every subject. It stops at the first bucket
+// that is exhausted, tokens already taken from the preceding buckets are not refunded.
+func (l *Limiter) Allow(ctx context.Context, subjects ...Subject) (Result, error) {
+	allowed := Result{Allowed: true, Remaining: math.Inf(1)}
+
+	for _, subject := range subjects {
+		if subject.Limit.Unlimited() {
+			continue
+		}
+
+		result, err := l.store.Take(ctx, subject.Key, subject.Limit, 1, l.now())
+		if err != nil {
+			return Result{}, err
+		}
+		if !result.Allowed {
+			return result, nil
+		}
+		allowed.Remaining = math.Min(allowed.Remaining, result.Remaining)
+	}
+
+	return allowed, nil
+}
+
+// Usage reports the state of the bucket of a subject without taking a token.
+func (l *Limiter) Usage(ctx context.Context, subject Subject) (Result, error) {
+	if subject.Limit.Unlimited() {
+		return Result{Allowed: true, Remaining: math.Inf(1)}, nil
+	}
+	return l.store.Take(ctx, subject.Key, subject.Limit, 0, l.now())
+}
+
+// refill computes the tokens of a bucket that held tokens at last after it refilled until now.
+func refill(limit Limit, tokens float64, last, now time.Time) float64 {
+	elapsed := now.Sub(last).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(float64(limit.Burst), tokens+elapsed*limit.Rate)
+}
+
+// take computes the Result of taking cost tokens from a bucket holding tokens and
+// returns the tokens left in the bucket.
+func take(limit Limit, tokens, cost float64) (Result, float64) {
+	if tokens >= cost {
+		return Result{Allowed: true, Remaining: tokens - cost}, tokens - cost
+	}
+
+	missing := cost - tokens
+	return Result{
+		Allowed:    false,
+		Remaining:  tokens,
+		RetryAfter: time.Duration(missing / limit.Rate * float64(time.Second)),
+	}, tokens
+}
+
+// Ping checks that the store of the limiter is reachable, without charging any bucket.
+func (l *Limiter) Ping(ctx context.Context) error {
+	_, err := l.store.Take(ctx, "ping", Limit{Rate: 1, Burst: 1}, 0, l.now())
+	return err
+}
@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func stores(t *testing.T) map[string]Store {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return map[string]Store{
+		"memory": NewMemoryStore(),
+		"redis":  NewRedisStore(client, "ratelimit:"),
+	}
+}
+
+func TestStoreTokenBucket(t *testing.T) {
+	limit := Limit{Rate: 2, Burst: 3}
+	start := time.Unix(1700000000, 0)
+
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			for i := 0; i < limit.Burst; i++ {
+				result, err := store.Take(ctx, "bucket", limit, 1, start)
+				if err != nil {
+					t.Fatalf("Error taking token: %v", err)
+				}
+				if !result.Allowed {
+					t.Fatalf("Expected token %d of the burst to be allowed", i)
+				}
+			}
+
+			result, err := store.Take(ctx, "bucket", limit, 1, start)
+			if err != nil {
+				t.Fatalf("Error taking token: %v", err)
+			}
+			if result.Allowed {
+				t.Errorf("Expected exhausted bucket to deny")
+			}
+			if result.RetryAfter != 500*time.Millisecond {
+				t.Errorf("Expected retry after %v, got %v", 500*time.Millisecond, result.RetryAfter)
+			}
+
+			result, err = store.Take(ctx, "bucket", limit, 1, start.Add(500*time.Millisecond))
+			if err != nil {
+				t.Fatalf("Error taking token: %v", err)
+			}
+			if !result.Allowed {
+				t.Errorf("Expected refilled bucket to allow")
+			}
+
+			result, err = store.Take(ctx, "other", limit, 0, start)
+			if err != nil {
+				t.Fatalf("Error peeking bucket: %v", err)
+			}
+			if result.Remaining != float64(limit.Burst) {
+				t.Errorf("Expected untouched bucket to be full, got %v", result.Remaining)
+			}
+		})
+	}
+}
+
+func TestLimiterAllow(t *testing.T) {
+	limiter := NewLimiter(NewMemoryStore(), Limits{
+		Device: Limit{Rate: 1, Burst: 1},
+		Tenant: Limit{Rate: 1, Burst: 10},
+	})
+	now := time.Unix(1700000000, 0)
+	limiter.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	result, err := limiter.Allow(ctx, limiter.Tenant("tenant"), limiter.APIKey("key"), limiter.Device("tenant", "device"))
+	if err != nil || !result.Allowed {
+		t.Fatalf("Expected first request to be allowed")
+	}
+
+	result, err = limiter.Allow(ctx, limiter.Tenant("tenant"), limiter.APIKey("key"), limiter.Device("tenant", "device"))
+	if err != nil || result.Allowed {
+		t.Errorf("Expected second request to exceed the device limit")
+	}
+
+	result, err = limiter.Allow(ctx, limiter.Tenant("tenant"), limiter.APIKey("key"), limiter.Device("tenant", "other"))
+	if err != nil || !result.Allowed {
+		t.Errorf("Expected request for another device to be allowed")
+	}
+
+	usage, err := limiter.Usage(ctx, limiter.Tenant("tenant"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Remaining != 7 {
+		t.Errorf("Expected %d remaining tenant tokens, got %v", 7, usage.Remaining)
+	}
+}
+
+func TestLimiterPing(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	limiter := NewLimiter(NewRedisStore(client, "ratelimit:"), Limits{})
+
+	if err := limiter.Ping(context.Background()); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	server.Close()
+	if err := limiter.Ping(context.Background()); err == nil {
+		t.Errorf("Expected an error for an unreachable store")
+	}
+}
@@ -0,0 +1,45 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// MemoryStore keeps token buckets in memory. Its limits apply to a single service instance.
+type MemoryStore struct {
+	buckets map[string]*bucket
+	mutex   sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*bucket),
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit, cost float64, now time.Time) (Result, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+	}
+
+	tokens := refill(limit, b.tokens, b.last, now)
+	result, left := take(limit, tokens, cost)
+
+	if cost > 0 {
+		b.tokens = left
+		b.last = now
+		s.buckets[key] = b
+	}
+
+	return result, nil
+}
@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript refills and takes from a bucket stored as a hash of its tokens and the
+// time of its last refill in milliseconds. Buckets expire once they would be full again.
+var takeScript = redis.NewScript(`
+local burst = tonumber(ARGV[2])
+local rate = tonumber(ARGV[1])
+local now = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4])
+
+local state = redis.call("HMGET", KEYS[1], "tokens", "last")
+local tokens = tonumber(state[1])
+local last = tonumber(state[2])
+if tokens == nil or last == nil then
+	tokens = burst
+	last = now
+end
+
+tokens = math.min(burst, tokens + math.max(0, now - last) / 1000 * rate)
+
+local allowed = 0
+if tokens >= cost then
+	tokens = tokens - cost
+	allowed = 1
+end
+
+if cost > 0 then
+	redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "last", tostring(now))
+	redis.call("PEXPIRE", KEYS[1], math.ceil((burst - tokens) / rate * 1000) + 1000)
+end
+
+return {allowed, tostring(tokens)}
+`)
+
+// RedisStore keeps token buckets in Redis, so that several service instances share their limits.
+// Instances are expected to have synchronized clocks.
+type RedisStore struct {
+	client redis.Scripter
+	prefix string
+}
+
+// NewRedisStore creates a RedisStore whose bucket keys start with prefix.
+func NewRedisStore(client redis.Scripter, prefix string) *RedisStore {
+	return &RedisStore{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit, cost float64, now time.Time) (Result, error) {
+	args := []interface{}{
+		strconv.FormatFloat(limit.Rate, 'f', -1, 64),
+		limit.Burst,
+		now.UnixMilli(),
+		strconv.FormatFloat(cost, 'f', -1, 64),
+	}
+
+	values, err := takeScript.Run(ctx, s.client, []string{s.prefix + key}, args...).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	allowed, _ := values[0].(int64)
+	remaining, err := strconv.ParseFloat(values[1].(string), 64)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if allowed == 1 {
+		return Result{Allowed: true, Remaining: remaining}, nil
+	}
+	result, _ := take(limit, remaining, cost)
+	return result, nil
+}
@@ -0,0 +1,95 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+// Consumer is the name under which the Forwarder keeps its cursor in the outbox.
+const Consumer = "stream"
+
+// forwardBatch is the number of events read from the outbox at once.
+const forwardBatch = 100
+
+// Forwarder publishes the transaction.signed events of the outbox of a repository.
+// The events are recorded in the same write as the signature, so every stored
+// signature is published, and none that was not stored.
+//
+// Messages are published one after the other, each once its predecessor was
+// acknowledged, and the cursor only advances past acknowledged messages. A
+// message whose acknowledgement is lost is therefore published again, but never
+// after a later signature of the same device.
+type Forwarder struct {
+	repo      persistence.Repository
+	publisher Publisher
+}
+
+// NewForwarder creates a Forwarder of the outbox of repo to publisher.
+func NewForwarder(repo persistence.Repository, publisher Publisher) *Forwarder {
+	return &Forwarder{repo: repo, publisher: publisher}
+}
+
+// Forward publishes the signatures recorded since its last call. If publishing
+// fails, the signatures from the failed one on are published by the next call.
+func (f *Forwarder) Forward(ctx context.Context) (err error) {
+	cursor, err := f.repo.GetEventCursor(ctx, Consumer)
+	if err != nil {
+		return err
+	}
+
+	published := cursor
+	defer func() {
+		if published != cursor {
+			if saveErr := f.repo.SaveEventCursor(ctx, Consumer, published); err == nil {
+				err = saveErr
+			}
+		}
+	}()
+
+	for {
+		events, err := f.repo.ListEvents(ctx, published, forwardBatch)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+
+		for _, event := range events {
+			if event.Type == domain.EventTransactionSigned {
+				message, err := signatureMessage(event)
+				if err != nil {
+					return err
+				}
+				if err := f.publisher.Publish(ctx, message); err != nil {
+					return fmt.Errorf("could not publish event %d: %w", event.Sequence, err)
+				}
+			}
+			published = event.Sequence
+		}
+	}
+}
+
+// signatureMessage returns the message of a transaction.signed event.
+func signatureMessage(event *domain.Event) (Message, error) {
+	var transaction domain.Transaction
+	if err := json.Unmarshal(event.Data, &transaction); err != nil {
+		return Message{}, fmt.Errorf("could not decode event %d: %w", event.Sequence, err)
+	}
+
+	data, err := json.Marshal(Signature{
+		EventId:           event.Id,
+		TenantId:          transaction.TenantId,
+		DeviceId:          transaction.DeviceId,
+		Counter:           transaction.Counter,
+		Signature:         transaction.Signature,
+		SignedData:        transaction.SignedData,
+		SecuredDataFormat: transaction.SecuredDataFormat,
+		SignedAt:          transaction.CreatedAt,
+	})
+	if err != nil {
+		return Message{}, err
+	}
+	return Message{Id: event.Id, Key: transaction.DeviceId, Data: data}, nil
+}
@@ -0,0 +1,137 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+// flakyPublisher fails every publish after the first ok ones until it is fixed.
+type flakyPublisher struct {
+	*MemoryPublisher
+	ok int
+}
+
+func (p *flakyPublisher) Publish(ctx context.Context, message Message) error {
+	if p.ok == 0 {
+		return errors.New("bus unavailable")
+	}
+	p.ok--
+	return p.MemoryPublisher.Publish(ctx, message)
+}
+
+// signAll signs count times with each device, interleaving the devices, and
+// records the events as the API does.
+func signAll(t *testing.T, repo persistence.Repository, count int, devices ...*domain.SignatureDevice) {
+	ctx := context.Background()
+	for _, device := range devices {
+		created, _ := domain.NewEvent(device.Id+"/created", domain.EventDeviceCreated, device, device)
+		if err := repo.SaveSignatureDevice(ctx, device, created); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < count; i++ {
+		for _, device := range devices {
+			transaction, err := device.Sign(ctx, fmt.Sprint("receipt ", i))
+			if err != nil {
+				t.Fatal(err)
+			}
+			event, _ := domain.NewEvent(fmt.Sprint(device.Id, "/", i), domain.EventTransactionSigned, device, transaction)
+			if err := repo.SaveTransaction(ctx, persistence.NoFence, transaction, nil, event); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func newDevices(t *testing.T, ids ...string) []*domain.SignatureDevice {
+	devices := make([]*domain.SignatureDevice, 0, len(ids))
+	for _, id := range ids {
+		device, err := domain.NewSignatureDevice(id, "ECC", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		devices = append(devices, device)
+	}
+	return devices
+}
+
+// assertOrdered checks that every signature of messages follows the previous
+// one of its device, and returns the number of distinct signatures per device.
+func assertOrdered(t *testing.T, messages []Message) map[string]int {
+	seen := make(map[string]int)
+	for _, message := range messages {
+		var signature Signature
+		if err := json.Unmarshal(message.Data, &signature); err != nil {
+			t.Fatalf("Error unmarshaling message: %v", err)
+		}
+		if message.Key != signature.DeviceId || message.Id != signature.EventId {
+			t.Errorf("Expected the key %s and the id %s, got %s and %s", signature.DeviceId, signature.EventId, message.Key, message.Id)
+		}
+		if signature.Signature == "" || signature.SignedData == "" {
+			t.Errorf("Expected the signature and the signed data, got %+v", signature)
+		}
+		if signature.Counter > seen[message.Key] {
+			t.Errorf("Expected counter at most %d of %s, got %d", seen[message.Key], message.Key, signature.Counter)
+		}
+		if signature.Counter == seen[message.Key] {
+			seen[message.Key]++
+		}
+	}
+	return seen
+}
+
+func TestForwarderPublishesSignatures(t *testing.T) {
+	repo := persistence.NewInMemoryPersistence()
+	signAll(t, repo, 3, newDevices(t, "a", "b")...)
+
+	publisher := NewMemoryPublisher()
+	forwarder := NewForwarder(repo, publisher)
+	for i := 0; i < 2; i++ {
+		if err := forwarder.Forward(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	messages := publisher.Messages()
+	if len(messages) != 6 {
+		t.Fatalf("Expected 6 messages, got %d", len(messages))
+	}
+	if seen := assertOrdered(t, messages); seen["a"] != 3 || seen["b"] != 3 {
+		t.Errorf("Expected 3 signatures of each device, got %v", seen)
+	}
+	if cursor, _ := repo.GetEventCursor(context.Background(), Consumer); cursor != 8 {
+		t.Errorf("Expected cursor 8, got %d", cursor)
+	}
+}
+
+func TestForwarderRepublishesAfterFailure(t *testing.T) {
+	repo := persistence.NewInMemoryPersistence()
+	signAll(t, repo, 5, newDevices(t, "a", "b")...)
+
+	publisher := &flakyPublisher{MemoryPublisher: NewMemoryPublisher(), ok: 3}
+	forwarder := NewForwarder(repo, publisher)
+	if err := forwarder.Forward(context.Background()); err == nil {
+		t.Fatal("Expected an error")
+	}
+	if messages := publisher.Messages(); len(messages) != 3 {
+		t.Fatalf("Expected 3 messages before the failure, got %d", len(messages))
+	}
+
+	publisher.ok = 100
+	if err := forwarder.Forward(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	messages := publisher.Messages()
+	if len(messages) != 10 {
+		t.Errorf("Expected every signature to be published once, got %d messages", len(messages))
+	}
+	if seen := assertOrdered(t, messages); seen["a"] != 5 || seen["b"] != 5 {
+		t.Errorf("Expected 5 signatures of each device, got %v", seen)
+	}
+}
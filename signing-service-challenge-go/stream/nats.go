@@ -0,0 +1,42 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+)
+
+// DeviceHeader carries the Key of a message published to NATS.
+const DeviceHeader = "Signing-Device-Id"
+
+// NATSPublisher publishes messages to NATS JetStream, the messages of a key on
+// the subject <subject>.<key>. JetStream orders the messages of a subject and
+// drops duplicates by their Nats-Msg-Id within the duplicate window of the stream.
+type NATSPublisher struct {
+	js      nats.JetStreamContext
+	subject string
+}
+
+// NewNATSPublisher creates a NATSPublisher of conn. A JetStream stream must
+// capture the subjects <subject>.>, otherwise no message could be stored.
+func NewNATSPublisher(conn *nats.Conn, subject string) (*NATSPublisher, error) {
+	js, err := conn.JetStream()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := js.StreamNameBySubject(subject + ".>"); err != nil {
+		return nil, fmt.Errorf("no JetStream stream captures %s.>: %w", subject, err)
+	}
+	return &NATSPublisher{js: js, subject: subject}, nil
+}
+
+func (p *NATSPublisher) Publish(ctx context.Context, message Message) error {
+	msg := nats.NewMsg(p.subject + "." + message.Key)
+	msg.Header.Set(nats.MsgIdHdr, message.Id)
+	msg.Header.Set(DeviceHeader, message.Key)
+	msg.Data = message.Data
+
+	_, err := p.js.PublishMsg(msg, nats.Context(ctx))
+	return err
+}
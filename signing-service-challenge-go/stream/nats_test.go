@@ -0,0 +1,83 @@
+package stream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+// runNATS starts a NATS server with JetStream and a stream capturing signatures.>.
+func runNATS(t *testing.T) *nats.Conn {
+	srv, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, JetStream: true, StoreDir: t.TempDir(), NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Start()
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server did not start")
+	}
+	t.Cleanup(srv.Shutdown)
+
+	conn, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(conn.Close)
+
+	js, _ := conn.JetStream()
+	if _, err := js.AddStream(&nats.StreamConfig{Name: "SIGNATURES", Subjects: []string{"signatures.>"}}); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestNATSPublisher(t *testing.T) {
+	conn := runNATS(t)
+	if _, err := NewNATSPublisher(conn, "receipts"); err == nil {
+		t.Error("Expected an error for subjects without a stream")
+	}
+	publisher, err := NewNATSPublisher(conn, "signatures")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := persistence.NewInMemoryPersistence()
+	signAll(t, repo, 3, newDevices(t, "a", "b")...)
+	if err := NewForwarder(repo, publisher).Forward(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// A message whose acknowledgement was lost is published again.
+	repo.SaveEventCursor(context.Background(), Consumer, 0)
+	if err := NewForwarder(repo, publisher).Forward(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	js, _ := conn.JetStream()
+	subscription, err := js.SubscribeSync("signatures.a", nats.OrderedConsumer())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []Message
+	for {
+		msg, err := subscription.NextMsg(500 * time.Millisecond)
+		if err == nats.ErrTimeout {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, Message{Id: msg.Header.Get(nats.MsgIdHdr), Key: msg.Header.Get(DeviceHeader), Data: msg.Data})
+	}
+
+	if len(messages) != 3 {
+		t.Fatalf("Expected the 3 signatures of device a without duplicates, got %d", len(messages))
+	}
+	if seen := assertOrdered(t, messages); seen["a"] != 3 {
+		t.Errorf("Expected 3 signatures of device a in order, got %v", seen)
+	}
+}
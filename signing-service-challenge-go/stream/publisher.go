@@ -0,0 +1,71 @@
+// Package stream publishes the signatures recorded in the outbox of a repository
+// to a message bus, for systems that consume every signature rather than being
+// notified of them.
+package stream
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+// Message is a message published to a bus.
+type Message struct {
+	// Id identifies the message across its redeliveries, so that the bus and its
+	// consumers can drop duplicates. It is the id of the event.
+	Id string
+	// Key orders the messages: messages of the same key are published in the order
+	// they were recorded. It is the id of the signing device.
+	Key  string
+	Data []byte
+}
+
+// Publisher publishes messages to a bus.
+type Publisher interface {
+	// Publish returns once the bus has stored message. Messages that are not
+	// acknowledged are published again, so the bus sees every message at least once.
+	Publish(ctx context.Context, message Message) error
+}
+
+// Signature is the Data of the message of a signature, encoded as JSON.
+type Signature struct {
+	// EventId is the id of the event that recorded the signature.
+	EventId           string                   `json:"event_id"`
+	TenantId          string                   `json:"tenant_id,omitempty"`
+	DeviceId          string                   `json:"device_id"`
+	Counter           int                      `json:"counter"`
+	Signature         string                   `json:"signature"`
+	SignedData        string                   `json:"signed_data"`
+	SecuredDataFormat domain.SecuredDataFormat `json:"secured_data_format"`
+	SignedAt          time.Time                `json:"signed_at"`
+}
+
+// MemoryPublisher is a Publisher that keeps the messages in memory, for tests and
+// for consumers in the same process.
+type MemoryPublisher struct {
+	mutex    sync.Mutex
+	messages []Message
+}
+
+// NewMemoryPublisher creates an empty MemoryPublisher.
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+func (p *MemoryPublisher) Publish(ctx context.Context, message Message) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.messages = append(p.messages, message)
+	return nil
+}
+
+// Messages returns the published messages in order, including duplicates.
+func (p *MemoryPublisher) Messages() []Message {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return append([]Message{}, p.messages...)
+}
@@ -0,0 +1,247 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+var tracer = otel.Tracer("github.com/fiskaly/coding-challenges/signing-service-challenge/persistence")
+
+// Repository is a persistence.Repository that runs every operation in a client span.
+type Repository struct {
+	persistence.Repository
+	backend string
+}
+
+// InstrumentRepository wraps repo to trace its operations. The backend names the
+// kind of store, e.g. memory, and is recorded on every span.
+func InstrumentRepository(repo persistence.Repository, backend string) *Repository {
+	return &Repository{Repository: repo, backend: backend}
+}
+
+// start starts the span of an operation. end must be deferred with a pointer to
+// the named error result of the operation.
+func (r *Repository) start(ctx context.Context, operation string) (context.Context, func(*error)) {
+	ctx, span := tracer.Start(ctx, "Repository."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", r.backend),
+			attribute.String("db.operation", operation),
+		),
+	)
+
+	return ctx, func(err *error) {
+		if *err != nil {
+			span.RecordError(*err)
+			span.SetStatus(codes.Error, (*err).Error())
+		}
+		span.End()
+	}
+}
+
+func (r *Repository) SaveSignatureDevice(ctx context.Context, device *domain.SignatureDevice, events ...*domain.Event) (err error) {
+	ctx, end := r.start(ctx, "SaveSignatureDevice")
+	defer end(&err)
+	return r.Repository.SaveSignatureDevice(ctx, device, events...)
+}
+
+func (r *Repository) SaveSignatureDevices(ctx context.Context, fence persistence.Fence, devices []*domain.SignatureDevice, events ...*domain.Event) (err error) {
+	ctx, end := r.start(ctx, "SaveSignatureDevices")
+	defer end(&err)
+	return r.Repository.SaveSignatureDevices(ctx, fence, devices, events...)
+}
+
+func (r *Repository) GetSignatureDevice(ctx context.Context, tenantId, id string) (device *domain.SignatureDevice, err error) {
+	ctx, end := r.start(ctx, "GetSignatureDevice")
+	defer end(&err)
+	return r.Repository.GetSignatureDevice(ctx, tenantId, id)
+}
+
+func (r *Repository) ListSignatureDevices(ctx context.Context, tenantId string) (devices []*domain.SignatureDevice, err error) {
+	ctx, end := r.start(ctx, "ListSignatureDevices")
+	defer end(&err)
+	return r.Repository.ListSignatureDevices(ctx, tenantId)
+}
+
+func (r *Repository) CountSignatureDevices(ctx context.Context) (counts []persistence.DeviceCount, err error) {
+	ctx, end := r.start(ctx, "CountSignatureDevices")
+	defer end(&err)
+	return r.Repository.CountSignatureDevices(ctx)
+}
+
+func (r *Repository) SaveTransaction(ctx context.Context, fence persistence.Fence, transaction *domain.Transaction, fiscal *domain.FiscalTransaction, events ...*domain.Event) (err error) {
+	ctx, end := r.start(ctx, "SaveTransaction")
+	defer end(&err)
+	return r.Repository.SaveTransaction(ctx, fence, transaction, fiscal, events...)
+}
+
+func (r *Repository) SaveTransactionTimestamp(ctx context.Context, transaction *domain.Transaction) (err error) {
+	ctx, end := r.start(ctx, "SaveTransactionTimestamp")
+	defer end(&err)
+	return r.Repository.SaveTransactionTimestamp(ctx, transaction)
+}
+
+func (r *Repository) ListTransactions(ctx context.Context, tenantId, deviceId string) (transactions []*domain.Transaction, err error) {
+	ctx, end := r.start(ctx, "ListTransactions")
+	defer end(&err)
+	return r.Repository.ListTransactions(ctx, tenantId, deviceId)
+}
+
+func (r *Repository) WalkTransactions(ctx context.Context, tenantId, deviceId string, fn func(*domain.Transaction) error) (err error) {
+	ctx, end := r.start(ctx, "WalkTransactions")
+	defer end(&err)
+	return r.Repository.WalkTransactions(ctx, tenantId, deviceId, fn)
+}
+
+func (r *Repository) GetTransactionByIdempotencyKey(ctx context.Context, tenantId, key string) (transaction *domain.Transaction, err error) {
+	ctx, end := r.start(ctx, "GetTransactionByIdempotencyKey")
+	defer end(&err)
+	return r.Repository.GetTransactionByIdempotencyKey(ctx, tenantId, key)
+}
+
+func (r *Repository) SaveFiscalTransaction(ctx context.Context, fence persistence.Fence, transaction *domain.FiscalTransaction) (err error) {
+	ctx, end := r.start(ctx, "SaveFiscalTransaction")
+	defer end(&err)
+	return r.Repository.SaveFiscalTransaction(ctx, fence, transaction)
+}
+
+func (r *Repository) GetFiscalTransaction(ctx context.Context, tenantId, id string) (transaction *domain.FiscalTransaction, err error) {
+	ctx, end := r.start(ctx, "GetFiscalTransaction")
+	defer end(&err)
+	return r.Repository.GetFiscalTransaction(ctx, tenantId, id)
+}
+
+func (r *Repository) ListFiscalTransactions(ctx context.Context, tenantId string, state domain.FiscalTransactionState) (transactions []*domain.FiscalTransaction, err error) {
+	ctx, end := r.start(ctx, "ListFiscalTransactions")
+	defer end(&err)
+	return r.Repository.ListFiscalTransactions(ctx, tenantId, state)
+}
+
+func (r *Repository) ListOverdueFiscalTransactions(ctx context.Context, now time.Time) (transactions []*domain.FiscalTransaction, err error) {
+	ctx, end := r.start(ctx, "ListOverdueFiscalTransactions")
+	defer end(&err)
+	return r.Repository.ListOverdueFiscalTransactions(ctx, now)
+}
+
+func (r *Repository) SaveAPIKey(ctx context.Context, key *domain.APIKey) (err error) {
+	ctx, end := r.start(ctx, "SaveAPIKey")
+	defer end(&err)
+	return r.Repository.SaveAPIKey(ctx, key)
+}
+
+func (r *Repository) GetAPIKey(ctx context.Context, id string) (key *domain.APIKey, err error) {
+	ctx, end := r.start(ctx, "GetAPIKey")
+	defer end(&err)
+	return r.Repository.GetAPIKey(ctx, id)
+}
+
+func (r *Repository) GetAPIKeyByHash(ctx context.Context, hash string) (key *domain.APIKey, err error) {
+	ctx, end := r.start(ctx, "GetAPIKeyByHash")
+	defer end(&err)
+	return r.Repository.GetAPIKeyByHash(ctx, hash)
+}
+
+func (r *Repository) ListAPIKeys(ctx context.Context) (keys []*domain.APIKey, err error) {
+	ctx, end := r.start(ctx, "ListAPIKeys")
+	defer end(&err)
+	return r.Repository.ListAPIKeys(ctx)
+}
+
+func (r *Repository) SaveOrganization(ctx context.Context, organization *domain.Organization) (err error) {
+	ctx, end := r.start(ctx, "SaveOrganization")
+	defer end(&err)
+	return r.Repository.SaveOrganization(ctx, organization)
+}
+
+func (r *Repository) GetOrganization(ctx context.Context, id string) (organization *domain.Organization, err error) {
+	ctx, end := r.start(ctx, "GetOrganization")
+	defer end(&err)
+	return r.Repository.GetOrganization(ctx, id)
+}
+
+func (r *Repository) ListOrganizations(ctx context.Context) (organizations []*domain.Organization, err error) {
+	ctx, end := r.start(ctx, "ListOrganizations")
+	defer end(&err)
+	return r.Repository.ListOrganizations(ctx)
+}
+
+func (r *Repository) ListEvents(ctx context.Context, after int64, limit int) (events []*domain.Event, err error) {
+	ctx, end := r.start(ctx, "ListEvents")
+	defer end(&err)
+	return r.Repository.ListEvents(ctx, after, limit)
+}
+
+func (r *Repository) GetEventCursor(ctx context.Context, consumer string) (sequence int64, err error) {
+	ctx, end := r.start(ctx, "GetEventCursor")
+	defer end(&err)
+	return r.Repository.GetEventCursor(ctx, consumer)
+}
+
+func (r *Repository) SaveEventCursor(ctx context.Context, consumer string, sequence int64) (err error) {
+	ctx, end := r.start(ctx, "SaveEventCursor")
+	defer end(&err)
+	return r.Repository.SaveEventCursor(ctx, consumer, sequence)
+}
+
+func (r *Repository) SaveWebhook(ctx context.Context, webhook *domain.Webhook) (err error) {
+	ctx, end := r.start(ctx, "SaveWebhook")
+	defer end(&err)
+	return r.Repository.SaveWebhook(ctx, webhook)
+}
+
+func (r *Repository) GetWebhook(ctx context.Context, tenantId, id string) (webhook *domain.Webhook, err error) {
+	ctx, end := r.start(ctx, "GetWebhook")
+	defer end(&err)
+	return r.Repository.GetWebhook(ctx, tenantId, id)
+}
+
+func (r *Repository) ListWebhooks(ctx context.Context, tenantId string) (webhooks []*domain.Webhook, err error) {
+	ctx, end := r.start(ctx, "ListWebhooks")
+	defer end(&err)
+	return r.Repository.ListWebhooks(ctx, tenantId)
+}
+
+func (r *Repository) DeleteWebhook(ctx context.Context, tenantId, id string) (err error) {
+	ctx, end := r.start(ctx, "DeleteWebhook")
+	defer end(&err)
+	return r.Repository.DeleteWebhook(ctx, tenantId, id)
+}
+
+func (r *Repository) SaveWebhookDelivery(ctx context.Context, delivery *domain.WebhookDelivery) (err error) {
+	ctx, end := r.start(ctx, "SaveWebhookDelivery")
+	defer end(&err)
+	return r.Repository.SaveWebhookDelivery(ctx, delivery)
+}
+
+func (r *Repository) GetWebhookDelivery(ctx context.Context, tenantId, id string) (delivery *domain.WebhookDelivery, err error) {
+	ctx, end := r.start(ctx, "GetWebhookDelivery")
+	defer end(&err)
+	return r.Repository.GetWebhookDelivery(ctx, tenantId, id)
+}
+
+func (r *Repository) ListWebhookDeliveries(ctx context.Context, tenantId, webhookId string, state domain.DeliveryState) (deliveries []*domain.WebhookDelivery, err error) {
+	ctx, end := r.start(ctx, "ListWebhookDeliveries")
+	defer end(&err)
+	return r.Repository.ListWebhookDeliveries(ctx, tenantId, webhookId, state)
+}
+
+func (r *Repository) ListDueWebhookDeliveries(ctx context.Context, now time.Time) (deliveries []*domain.WebhookDelivery, err error) {
+	ctx, end := r.start(ctx, "ListDueWebhookDeliveries")
+	defer end(&err)
+	return r.Repository.ListDueWebhookDeliveries(ctx, now)
+}
+
+// Flush flushes the decorated repository if it buffers writes.
+func (r *Repository) Flush(ctx context.Context) (err error) {
+	ctx, end := r.start(ctx, "Flush")
+	defer end(&err)
+	return persistence.Flush(ctx, r.Repository)
+}
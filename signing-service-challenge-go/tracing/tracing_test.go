@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+func record(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func TestRepositoryTracesOperations(t *testing.T) {
+	recorder := record(t)
+	repo := InstrumentRepository(persistence.NewInMemoryPersistence(), "memory")
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+	_, err := repo.GetSignatureDevice(ctx, "", "unknown")
+	parent.End()
+	if err == nil {
+		t.Fatal("Expected an error for an unknown device")
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected %d spans, got %d", 2, len(spans))
+	}
+
+	span := spans[0]
+	if span.Name() != "Repository.GetSignatureDevice" {
+		t.Errorf("Expected span Repository.GetSignatureDevice, got %s", span.Name())
+	}
+	if span.Parent().SpanID() != spans[1].SpanContext().SpanID() {
+		t.Errorf("Expected the repository span to be a child of the parent span")
+	}
+	if span.Status().Code != codes.Error {
+		t.Errorf("Expected status %v, got %v", codes.Error, span.Status().Code)
+	}
+}
+
+func TestSetupWithoutExporter(t *testing.T) {
+	shutdown, err := Setup(context.Background(), Config{Exporter: ExporterNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestSetupRejectsUnknownExporter(t *testing.T) {
+	if _, err := Setup(context.Background(), Config{Exporter: "carrier-pigeon"}); err == nil {
+		t.Errorf("Expected an error for an unknown exporter")
+	}
+}
@@ -0,0 +1,429 @@
+// Package tsa requests and verifies RFC 3161 timestamp tokens, which prove that
+// data existed at the time attested by a trusted timestamp authority.
+package tsa
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// QueryContentType is the media type of timestamp requests.
+	QueryContentType = "application/timestamp-query"
+	// ReplyContentType is the media type of timestamp responses.
+	ReplyContentType = "application/timestamp-reply"
+)
+
+// maxReplySize bounds the size of the responses read from a TSA.
+const maxReplySize = 1 << 20
+
+// Object identifiers of the algorithms and content types in timestamp tokens.
+var (
+	OIDSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	OIDSHA384        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	OIDSHA512        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	OIDSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	OIDTSTInfo       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	OIDContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	OIDMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSHA384WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSHA512WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidECPublicKey     = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+)
+
+var (
+	errMalformedToken        = errors.New("malformed timestamp token")
+	errUnsupportedAlgorithms = errors.New("unsupported timestamp token algorithms")
+)
+
+// ErrRejected is returned if the TSA does not grant a timestamp.
+var ErrRejected = errors.New("timestamp request rejected")
+
+// The ASN.1 structures of RFC 3161 and RFC 5652 that are exchanged with a TSA.
+type (
+	MessageImprint struct {
+		HashAlgorithm pkix.AlgorithmIdentifier
+		HashedMessage []byte
+	}
+
+	Request struct {
+		Version        int
+		MessageImprint MessageImprint
+		Nonce          *big.Int `asn1:"optional"`
+		CertReq        bool     `asn1:"optional"`
+	}
+
+	StatusInfo struct {
+		Status     int
+		StatusText []asn1.RawValue `asn1:"optional"`
+		FailInfo   asn1.BitString  `asn1:"optional"`
+	}
+
+	Response struct {
+		Status StatusInfo
+		Token  asn1.RawValue `asn1:"optional"`
+	}
+
+	// ContentInfo holds its content in an explicit [0] tag, which encoding/asn1
+	// does not apply to raw values, so Content is the tagged element.
+	ContentInfo struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue
+	}
+
+	SignedData struct {
+		Version          int
+		DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+		EncapContentInfo EncapsulatedContentInfo
+		Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+		CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+		SignerInfos      []SignerInfo  `asn1:"set"`
+	}
+
+	EncapsulatedContentInfo struct {
+		EContentType asn1.ObjectIdentifier
+		EContent     []byte `asn1:"explicit,optional,tag:0"`
+	}
+
+	SignerInfo struct {
+		Version            int
+		SID                asn1.RawValue
+		DigestAlgorithm    pkix.AlgorithmIdentifier
+		SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		Signature          []byte
+		UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+	}
+
+	IssuerAndSerialNumber struct {
+		Issuer       asn1.RawValue
+		SerialNumber *big.Int
+	}
+
+	Attribute struct {
+		Type   asn1.ObjectIdentifier
+		Values []asn1.RawValue `asn1:"set"`
+	}
+
+	Accuracy struct {
+		Seconds int `asn1:"optional"`
+		Millis  int `asn1:"optional,tag:0"`
+		Micros  int `asn1:"optional,tag:1"`
+	}
+
+	TSTInfo struct {
+		Version        int
+		Policy         asn1.ObjectIdentifier
+		MessageImprint MessageImprint
+		SerialNumber   *big.Int
+		GenTime        time.Time     `asn1:"generalized"`
+		Accuracy       Accuracy      `asn1:"optional"`
+		Ordering       bool          `asn1:"optional"`
+		Nonce          *big.Int      `asn1:"optional"`
+		TSA            asn1.RawValue `asn1:"optional,tag:0"`
+		Extensions     asn1.RawValue `asn1:"optional,tag:1"`
+	}
+)
+
+// Token is a verified timestamp token.
+type Token struct {
+	// Raw is the DER encoded token, a CMS ContentInfo.
+	Raw []byte
+	// Time is the time the TSA attests.
+	Time         time.Time
+	SerialNumber *big.Int
+	// Certificate is the certificate the token is signed with.
+	Certificate *x509.Certificate
+	imprint     MessageImprint
+	nonce       *big.Int
+}
+
+// Client requests timestamp tokens from a TSA.
+type Client struct {
+	// URL is the endpoint of the TSA.
+	URL string
+	// HTTPClient sends the requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+	// Roots verifies the certificate of the TSA, the system roots if nil.
+	Roots *x509.CertPool
+}
+
+// Timestamp requests a timestamp token over the SHA-256 digest of data and verifies it.
+func (c *Client) Timestamp(ctx context.Context, data []byte) (*Token, error) {
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	digest := crypto.SHA256.New()
+	digest.Write(data)
+	imprint := MessageImprint{HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: OIDSHA256}, HashedMessage: digest.Sum(nil)}
+
+	query, err := asn1.Marshal(Request{Version: 1, MessageImprint: imprint, Nonce: nonce, CertReq: true})
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", QueryContentType)
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("timestamp authority responded %s", response.Status)
+	}
+	reply, err := io.ReadAll(io.LimitReader(response.Body, maxReplySize))
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed Response
+	if _, err := asn1.Unmarshal(reply, &parsed); err != nil {
+		return nil, fmt.Errorf("malformed timestamp response: %w", err)
+	}
+	// 0 is granted, 1 granted with modifications.
+	if parsed.Status.Status > 1 {
+		return nil, fmt.Errorf("%w: status %d%s", ErrRejected, parsed.Status.Status, statusText(parsed.Status))
+	}
+
+	token, err := Parse(parsed.Token.FullBytes, c.Roots)
+	if err != nil {
+		return nil, err
+	}
+	if !token.imprint.equal(imprint) {
+		return nil, errors.New("timestamp token covers other data")
+	}
+	if token.nonce == nil || token.nonce.Cmp(nonce) != 0 {
+		return nil, errors.New("timestamp token does not answer the request")
+	}
+	return token, nil
+}
+
+// Parse parses a DER encoded timestamp token and verifies its signature. The
+// signing certificate must chain up to roots, the system roots if nil, and be valid
+// for timestamping at the time of the token.
+func Parse(raw []byte, roots *x509.CertPool) (*Token, error) {
+	var content ContentInfo
+	if rest, err := asn1.Unmarshal(raw, &content); err != nil || len(rest) > 0 || !content.ContentType.Equal(OIDSignedData) {
+		return nil, errMalformedToken
+	}
+	if content.Content.Class != asn1.ClassContextSpecific || content.Content.Tag != 0 {
+		return nil, errMalformedToken
+	}
+	var signed SignedData
+	if _, err := asn1.Unmarshal(content.Content.Bytes, &signed); err != nil {
+		return nil, errMalformedToken
+	}
+	if !signed.EncapContentInfo.EContentType.Equal(OIDTSTInfo) || len(signed.SignerInfos) != 1 {
+		return nil, errMalformedToken
+	}
+	var info TSTInfo
+	if _, err := asn1.Unmarshal(signed.EncapContentInfo.EContent, &info); err != nil {
+		return nil, errMalformedToken
+	}
+
+	certificates, err := x509.ParseCertificates(signed.Certificates.Bytes)
+	if err != nil {
+		return nil, errMalformedToken
+	}
+	signer := signed.SignerInfos[0]
+	certificate := signerCertificate(signer, certificates)
+	if certificate == nil {
+		return nil, errors.New("timestamp token does not carry the certificate of its signer")
+	}
+	if err := verifySignature(signer, signed.EncapContentInfo.EContent, certificate); err != nil {
+		return nil, err
+	}
+
+	// A token whose certificate is not trusted only proves its own integrity, so it
+	// is rejected rather than accepted unverified.
+	intermediates := x509.NewCertPool()
+	for _, c := range certificates {
+		intermediates.AddCert(c)
+	}
+	_, err = certificate.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   info.GenTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("untrusted timestamp authority: %w", err)
+	}
+
+	return &Token{
+		Raw:          raw,
+		Time:         info.GenTime,
+		SerialNumber: info.SerialNumber,
+		Certificate:  certificate,
+		imprint:      info.MessageImprint,
+		nonce:        info.Nonce,
+	}, nil
+}
+
+// Covers reports whether the token was issued over data.
+func (t *Token) Covers(data []byte) bool {
+	hash, ok := hashOf(t.imprint.HashAlgorithm.Algorithm)
+	if !ok {
+		return false
+	}
+	digest := hash.New()
+	digest.Write(data)
+	return bytes.Equal(digest.Sum(nil), t.imprint.HashedMessage)
+}
+
+func (m MessageImprint) equal(other MessageImprint) bool {
+	return m.HashAlgorithm.Algorithm.Equal(other.HashAlgorithm.Algorithm) && bytes.Equal(m.HashedMessage, other.HashedMessage)
+}
+
+func signerCertificate(signer SignerInfo, certificates []*x509.Certificate) *x509.Certificate {
+	var id IssuerAndSerialNumber
+	if _, err := asn1.Unmarshal(signer.SID.FullBytes, &id); err == nil {
+		for _, c := range certificates {
+			if c.SerialNumber.Cmp(id.SerialNumber) == 0 && bytes.Equal(c.RawIssuer, id.Issuer.FullBytes) {
+				return c
+			}
+		}
+		return nil
+	}
+	// [0] SubjectKeyIdentifier
+	for _, c := range certificates {
+		if signer.SID.Class == asn1.ClassContextSpecific && signer.SID.Tag == 0 && bytes.Equal(c.SubjectKeyId, signer.SID.Bytes) {
+			return c
+		}
+	}
+	return nil
+}
+
+// verifySignature verifies the signed attributes of signer and that they bind content.
+func verifySignature(signer SignerInfo, content []byte, certificate *x509.Certificate) error {
+	if len(signer.SignedAttrs.FullBytes) == 0 {
+		return errors.New("timestamp token lacks signed attributes")
+	}
+	hash, ok := hashOf(signer.DigestAlgorithm.Algorithm)
+	if !ok {
+		return errUnsupportedAlgorithms
+	}
+	algorithm, ok := signatureAlgorithm(signer.SignatureAlgorithm.Algorithm, hash)
+	if !ok {
+		return errUnsupportedAlgorithms
+	}
+
+	// The signature covers the attributes encoded as a SET rather than as [0].
+	attributes := append([]byte{0x31}, signer.SignedAttrs.FullBytes[1:]...)
+	var parsed []Attribute
+	if _, err := asn1.UnmarshalWithParams(attributes, &parsed, "set"); err != nil {
+		return errMalformedToken
+	}
+
+	digest := hash.New()
+	digest.Write(content)
+	var digested, typed bool
+	for _, attribute := range parsed {
+		if len(attribute.Values) != 1 {
+			continue
+		}
+		switch {
+		case attribute.Type.Equal(OIDMessageDigest):
+			var value []byte
+			if _, err := asn1.Unmarshal(attribute.Values[0].FullBytes, &value); err != nil || !bytes.Equal(value, digest.Sum(nil)) {
+				return errors.New("timestamp token signature does not cover its content")
+			}
+			digested = true
+		case attribute.Type.Equal(OIDContentType):
+			var value asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(attribute.Values[0].FullBytes, &value); err != nil || !value.Equal(OIDTSTInfo) {
+				return errMalformedToken
+			}
+			typed = true
+		}
+	}
+	if !digested || !typed {
+		return errMalformedToken
+	}
+
+	if err := certificate.CheckSignature(algorithm, attributes, signer.Signature); err != nil {
+		return fmt.Errorf("invalid timestamp token signature: %w", err)
+	}
+	return nil
+}
+
+func hashOf(oid asn1.ObjectIdentifier) (crypto.Hash, bool) {
+	switch {
+	case oid.Equal(OIDSHA256):
+		return crypto.SHA256, true
+	case oid.Equal(OIDSHA384):
+		return crypto.SHA384, true
+	case oid.Equal(OIDSHA512):
+		return crypto.SHA512, true
+	}
+	return 0, false
+}
+
+func signatureAlgorithm(oid asn1.ObjectIdentifier, hash crypto.Hash) (x509.SignatureAlgorithm, bool) {
+	switch {
+	case oid.Equal(oidSHA256WithRSA):
+		return x509.SHA256WithRSA, true
+	case oid.Equal(oidSHA384WithRSA):
+		return x509.SHA384WithRSA, true
+	case oid.Equal(oidSHA512WithRSA):
+		return x509.SHA512WithRSA, true
+	case oid.Equal(oidECDSAWithSHA256):
+		return x509.ECDSAWithSHA256, true
+	case oid.Equal(oidECDSAWithSHA384):
+		return x509.ECDSAWithSHA384, true
+	case oid.Equal(oidECDSAWithSHA512):
+		return x509.ECDSAWithSHA512, true
+	case oid.Equal(oidRSAEncryption):
+		algorithm, ok := map[crypto.Hash]x509.SignatureAlgorithm{crypto.SHA256: x509.SHA256WithRSA, crypto.SHA384: x509.SHA384WithRSA, crypto.SHA512: x509.SHA512WithRSA}[hash]
+		return algorithm, ok
+	case oid.Equal(oidECPublicKey):
+		algorithm, ok := map[crypto.Hash]x509.SignatureAlgorithm{crypto.SHA256: x509.ECDSAWithSHA256, crypto.SHA384: x509.ECDSAWithSHA384, crypto.SHA512: x509.ECDSAWithSHA512}[hash]
+		return algorithm, ok
+	}
+	return 0, false
+}
+
+func statusText(status StatusInfo) string {
+	var texts []string
+	for _, value := range status.StatusText {
+		var text string
+		if _, err := asn1.UnmarshalWithParams(value.FullBytes, &text, "utf8"); err == nil {
+			texts = append(texts, text)
+		}
+	}
+	if len(texts) == 0 {
+		return ""
+	}
+	return ": " + strings.Join(texts, "; ")
+}
@@ -0,0 +1,80 @@
+package tsa_test
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/tsa"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/tsa/tsatest"
+)
+
+func TestTimestamp(t *testing.T) {
+	authority := tsatest.NewTSA(t)
+	attested := time.Now().UTC().Add(-time.Minute).Truncate(time.Second)
+	authority.SetClock(func() time.Time { return attested })
+	client := &tsa.Client{URL: authority.URL, Roots: authority.Roots}
+
+	token, err := client.Timestamp(context.Background(), []byte("signature"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !token.Time.Equal(attested) {
+		t.Errorf("Expected time %s, got %s", attested, token.Time)
+	}
+	if !token.Covers([]byte("signature")) || token.Covers([]byte("other")) {
+		t.Errorf("Expected the token to cover exactly the timestamped data")
+	}
+
+	parsed, err := tsa.Parse(token.Raw, authority.Roots)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing the token: %v", err)
+	}
+	if parsed.SerialNumber.Cmp(token.SerialNumber) != 0 {
+		t.Errorf("Expected serial number %s, got %s", token.SerialNumber, parsed.SerialNumber)
+	}
+}
+
+func TestTimestampRejectsUntrustedAuthority(t *testing.T) {
+	authority := tsatest.NewTSA(t)
+	client := &tsa.Client{URL: authority.URL, Roots: x509.NewCertPool()}
+
+	if _, err := client.Timestamp(context.Background(), []byte("signature")); err == nil {
+		t.Errorf("Expected an error for an untrusted authority")
+	}
+}
+
+func TestTimestampVerifiesAgainstSystemRootsByDefault(t *testing.T) {
+	authority := tsatest.NewTSA(t)
+	client := &tsa.Client{URL: authority.URL}
+
+	if _, err := client.Timestamp(context.Background(), []byte("signature")); err == nil {
+		t.Errorf("Expected an error for an authority the system roots do not trust")
+	}
+}
+
+func TestParseRejectsTamperedToken(t *testing.T) {
+	authority := tsatest.NewTSA(t)
+	token, err := (&tsa.Client{URL: authority.URL, Roots: authority.Roots}).Timestamp(context.Background(), []byte("signature"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tampered := append([]byte(nil), token.Raw...)
+	tampered[len(tampered)/2] ^= 0xff
+	if _, err := tsa.Parse(tampered, authority.Roots); err == nil {
+		t.Errorf("Expected an error for a tampered token")
+	}
+}
+
+func TestTimestampRejected(t *testing.T) {
+	authority := tsatest.NewTSA(t)
+	authority.Reject()
+
+	_, err := (&tsa.Client{URL: authority.URL}).Timestamp(context.Background(), []byte("signature"))
+	if !errors.Is(err, tsa.ErrRejected) {
+		t.Errorf("Expected a rejection, got %v", err)
+	}
+}
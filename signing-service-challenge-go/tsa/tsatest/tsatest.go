@@ -0,0 +1,193 @@
+// Package tsatest provides a local RFC 3161 timestamp authority for tests.
+package tsatest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/tsa"
+)
+
+var (
+	oidPolicy          = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+// TSA is a timestamp authority serving RFC 3161 requests over HTTP.
+type TSA struct {
+	// URL is the endpoint of the TSA.
+	URL string
+	// Roots holds the self-signed certificate of the TSA.
+	Roots *x509.CertPool
+
+	key         *ecdsa.PrivateKey
+	certificate *x509.Certificate
+
+	mu       sync.Mutex
+	serial   int64
+	rejected bool
+	now      func() time.Time
+}
+
+// NewTSA starts a TSA that is stopped when the test ends.
+func NewTSA(t testing.TB) *TSA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "tsatest"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authority := &TSA{Roots: x509.NewCertPool(), key: key, certificate: certificate, now: time.Now}
+	authority.Roots.AddCert(certificate)
+
+	server := httptest.NewServer(http.HandlerFunc(authority.serve))
+	t.Cleanup(server.Close)
+	authority.URL = server.URL
+	return authority
+}
+
+// Reject makes the TSA reject every further request.
+func (a *TSA) Reject() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rejected = true
+}
+
+// SetClock makes the TSA attest the times returned by now.
+func (a *TSA) SetClock(now func() time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.now = now
+}
+
+func (a *TSA) serve(response http.ResponseWriter, request *http.Request) {
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var query tsa.Request
+	if _, err := asn1.Unmarshal(body, &query); err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	a.mu.Lock()
+	a.serial++
+	serial, rejected, now := a.serial, a.rejected, a.now()
+	a.mu.Unlock()
+
+	reply := tsa.Response{Status: tsa.StatusInfo{Status: 2}}
+	if !rejected {
+		token, err := a.token(query, serial, now)
+		if err != nil {
+			http.Error(response, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		reply = tsa.Response{Status: tsa.StatusInfo{Status: 0}, Token: asn1.RawValue{FullBytes: token}}
+	}
+
+	encoded, err := asn1.Marshal(reply)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response.Header().Set("Content-Type", tsa.ReplyContentType)
+	response.Write(encoded)
+}
+
+// token creates a timestamp token answering query.
+func (a *TSA) token(query tsa.Request, serial int64, now time.Time) ([]byte, error) {
+	info, err := asn1.Marshal(tsa.TSTInfo{
+		Version:        1,
+		Policy:         oidPolicy,
+		MessageImprint: query.MessageImprint,
+		SerialNumber:   big.NewInt(serial),
+		GenTime:        now.UTC().Truncate(time.Second),
+		Nonce:          query.Nonce,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	contentType, err := asn1.Marshal(tsa.OIDTSTInfo)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(info)
+	messageDigest, err := asn1.Marshal(digest[:])
+	if err != nil {
+		return nil, err
+	}
+	attributes, err := asn1.MarshalWithParams([]tsa.Attribute{
+		{Type: tsa.OIDContentType, Values: []asn1.RawValue{{FullBytes: contentType}}},
+		{Type: tsa.OIDMessageDigest, Values: []asn1.RawValue{{FullBytes: messageDigest}}},
+	}, "set")
+	if err != nil {
+		return nil, err
+	}
+	attributesDigest := sha256.Sum256(attributes)
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, attributesDigest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	sid, err := asn1.Marshal(tsa.IssuerAndSerialNumber{Issuer: asn1.RawValue{FullBytes: a.certificate.RawIssuer}, SerialNumber: a.certificate.SerialNumber})
+	if err != nil {
+		return nil, err
+	}
+	// The signed attributes are embedded as [0] IMPLICIT instead of as a SET.
+	signedAttrs := append([]byte{0xa0}, attributes[1:]...)
+
+	signed, err := asn1.Marshal(tsa.SignedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: tsa.OIDSHA256}},
+		EncapContentInfo: tsa.EncapsulatedContentInfo{EContentType: tsa.OIDTSTInfo, EContent: info},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: a.certificate.Raw},
+		SignerInfos: []tsa.SignerInfo{{
+			Version:            1,
+			SID:                asn1.RawValue{FullBytes: sid},
+			DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: tsa.OIDSHA256},
+			SignedAttrs:        asn1.RawValue{FullBytes: signedAttrs},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256},
+			Signature:          signature,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(tsa.ContentInfo{
+		ContentType: tsa.OIDSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signed},
+	})
+}
@@ -0,0 +1,187 @@
+package verify
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/export"
+)
+
+// maxDocumentSize limits the files of an export held in memory: the device
+// metadata, the public key, the manifest and its signature.
+const maxDocumentSize = 1 << 20
+
+// IsExport reports whether header, the first bytes of a file, starts a TAR archive.
+func IsExport(header []byte) bool {
+	return len(header) >= 262 && string(header[257:262]) == "ustar"
+}
+
+// digest describes a file of an export as it was read.
+type digest struct {
+	size   int64
+	sha256 string
+}
+
+// Export verifies an export read from r: every transaction of transactions.jsonl,
+// the signature of the manifest and the size and digest of every file it lists.
+// The archive is read in a single pass, so it may be streamed.
+//
+// key verifies the signatures. If key is nil, the public key of the export is used,
+// which only proves that the export is consistent in itself; auditors pass the key
+// they obtained from the operator of the device. A key that differs from the key of
+// the export is a failure.
+func Export(r io.Reader, key crypto.PublicKey) (*Report, error) {
+	var (
+		verifier          = NewVerifier("", key)
+		digests           = make(map[string]digest)
+		manifest          []byte
+		manifestSignature []byte
+	)
+
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading export: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		hash := sha256.New()
+		counted := &countingReader{r: io.TeeReader(archive, hash)}
+
+		switch header.Name {
+		case export.DeviceFile:
+			var device struct{ Id string }
+			if err := json.NewDecoder(io.LimitReader(counted, maxDocumentSize)).Decode(&device); err != nil {
+				return nil, fmt.Errorf("reading %s: %w", header.Name, err)
+			}
+			if verifier.report.DeviceId == "" {
+				verifier.report.DeviceId = device.Id
+			}
+		case export.PublicKeyFile:
+			content, err := io.ReadAll(io.LimitReader(counted, maxDocumentSize))
+			if err != nil {
+				return nil, fmt.Errorf("reading %s: %w", header.Name, err)
+			}
+			exported, err := ParsePublicKey(content)
+			if err != nil {
+				return nil, fmt.Errorf("reading %s: %w", header.Name, err)
+			}
+			if verifier.key == nil {
+				verifier.key = exported
+			} else if !equalKeys(verifier.key, exported) {
+				verifier.failFile(header.Name, "differs from the public key verifying the export")
+			}
+		case export.TransactionsJSONFile:
+			if verifier.key == nil {
+				return nil, fmt.Errorf("%s precedes %s and no public key was given", header.Name, export.PublicKeyFile)
+			}
+			if err := verifier.decode(counted); err != nil {
+				return nil, fmt.Errorf("reading %s: %w", header.Name, err)
+			}
+		case export.ManifestFile, export.ManifestSignatureFile:
+			content, err := io.ReadAll(io.LimitReader(counted, maxDocumentSize))
+			if err != nil {
+				return nil, fmt.Errorf("reading %s: %w", header.Name, err)
+			}
+			if header.Name == export.ManifestFile {
+				manifest = content
+			} else {
+				manifestSignature = content
+			}
+		}
+
+		// Digest what the cases above left unread, and files they do not read.
+		if _, err := io.Copy(io.Discard, counted); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", header.Name, err)
+		}
+		digests[header.Name] = digest{size: counted.n, sha256: hex.EncodeToString(hash.Sum(nil))}
+	}
+
+	if verifier.key == nil {
+		return nil, fmt.Errorf("export contains no %s and no public key was given", export.PublicKeyFile)
+	}
+	verifier.checkManifest(manifest, manifestSignature, digests)
+	return verifier.Report(), nil
+}
+
+// checkManifest verifies the manifest of an export against the files read.
+func (v *Verifier) checkManifest(content, signature []byte, digests map[string]digest) {
+	if content == nil {
+		v.failFile(export.ManifestFile, "missing")
+		return
+	}
+	if signature == nil {
+		v.failFile(export.ManifestSignatureFile, "missing")
+	} else if !Signature(v.key, content, string(bytes.TrimSpace(signature))) {
+		v.failFile(export.ManifestSignatureFile, "signature of the manifest does not verify")
+	}
+
+	var manifest export.Manifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		v.failFile(export.ManifestFile, "not a manifest: %v", err)
+		return
+	}
+	if manifest.Format != export.ManifestFormat {
+		v.failFile(export.ManifestFile, "unsupported format %q", manifest.Format)
+	}
+	if manifest.DeviceId != v.report.DeviceId {
+		v.failFile(export.ManifestFile, "describes device %q", manifest.DeviceId)
+	}
+	if manifest.Transactions != v.report.Transactions {
+		v.failFile(export.ManifestFile, "lists %d transactions, the export contains %d", manifest.Transactions, v.report.Transactions)
+	}
+
+	listed := map[string]bool{export.ManifestFile: true, export.ManifestSignatureFile: true}
+	for _, file := range manifest.Files {
+		listed[file.Name] = true
+		read, ok := digests[file.Name]
+		switch {
+		case !ok:
+			v.failFile(file.Name, "listed in the manifest but missing")
+		case read.size != file.Size || read.sha256 != file.SHA256:
+			v.failFile(file.Name, "does not match its digest in the manifest")
+		}
+	}
+	var unlisted []string
+	for name := range digests {
+		if !listed[name] {
+			unlisted = append(unlisted, name)
+		}
+	}
+	sort.Strings(unlisted)
+	for _, name := range unlisted {
+		v.failFile(name, "not listed in the manifest")
+	}
+}
+
+// equalKeys reports whether a and b are the same public key.
+func equalKeys(a, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
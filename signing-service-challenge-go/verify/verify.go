@@ -0,0 +1,252 @@
+// Package verify checks the signature log of a signature device without access to
+// the device or the service: it rebuilds the secured data of every transaction
+// exactly as the device signed it, verifies every signature with the public key of
+// the device and follows the chain of last signatures from counter to counter.
+//
+// The service verifies stored logs with the same Verifier that cmd/verify uses for
+// exports, so auditors and operators reach the same verdict.
+package verify
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+// ParsePublicKey parses a PEM encoded public key or certificate and returns the RSA
+// or ECDSA public key it contains.
+func ParsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var key crypto.PublicKey
+	switch block.Type {
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key = parsed
+	case "CERTIFICATE":
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key = certificate.PublicKey
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported public key %T", key)
+}
+
+// Signature reports whether signature, base64 encoded, is a signature of key over
+// data as created by the RSA and ECC signers of the service.
+func Signature(key crypto.PublicKey, data []byte, signature string) bool {
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	digest := sha256.Sum256(data)
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], decoded) == nil
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(key, digest[:], decoded)
+	}
+	return false
+}
+
+// Failure is a check that did not pass. Counter is set for failures of a
+// transaction, File for failures of an export.
+type Failure struct {
+	Counter *int   `json:"counter,omitempty"`
+	File    string `json:"file,omitempty"`
+	Reason  string `json:"reason"`
+}
+
+func (f Failure) String() string {
+	switch {
+	case f.Counter != nil:
+		return fmt.Sprintf("counter %d: %s", *f.Counter, f.Reason)
+	case f.File != "":
+		return fmt.Sprintf("%s: %s", f.File, f.Reason)
+	}
+	return f.Reason
+}
+
+// Report is the result of a verification.
+type Report struct {
+	Valid        bool   `json:"valid"`
+	DeviceId     string `json:"device_id"`
+	Transactions int    `json:"transactions"`
+	// FirstCounter and LastCounter are the counters of the first and the last
+	// transaction verified. A log that does not start at counter 0 cannot prove the
+	// link of its first transaction to its predecessor.
+	FirstCounter int       `json:"first_counter"`
+	LastCounter  int       `json:"last_counter"`
+	Failures     []Failure `json:"failures"`
+}
+
+// Verifier checks the transactions of a device in counter order.
+type Verifier struct {
+	key      crypto.PublicKey
+	report   Report
+	previous *domain.Transaction
+}
+
+// NewVerifier returns a Verifier of the device deviceId with the public key key. If
+// deviceId is empty, the device of the first transaction is verified.
+func NewVerifier(deviceId string, key crypto.PublicKey) *Verifier {
+	return &Verifier{key: key, report: Report{DeviceId: deviceId, Failures: []Failure{}}}
+}
+
+// fail records a failure of transaction.
+func (v *Verifier) fail(transaction *domain.Transaction, format string, args ...any) {
+	counter := transaction.Counter
+	v.report.Failures = append(v.report.Failures, Failure{Counter: &counter, Reason: fmt.Sprintf(format, args...)})
+}
+
+// failFile records a failure of the file name.
+func (v *Verifier) failFile(name, format string, args ...any) {
+	v.report.Failures = append(v.report.Failures, Failure{File: name, Reason: fmt.Sprintf(format, args...)})
+}
+
+// Add verifies the next transaction of the log. Failures are recorded in the
+// report; verification continues with the next transaction.
+func (v *Verifier) Add(transaction *domain.Transaction) {
+	if v.report.Transactions == 0 {
+		v.report.FirstCounter = transaction.Counter
+		if v.report.DeviceId == "" {
+			v.report.DeviceId = transaction.DeviceId
+		}
+	}
+	v.report.Transactions++
+	v.report.LastCounter = transaction.Counter
+	previous := v.previous
+	v.previous = transaction
+
+	if transaction.DeviceId != v.report.DeviceId {
+		v.fail(transaction, "belongs to device %q", transaction.DeviceId)
+	}
+	if previous != nil && transaction.Counter != previous.Counter+1 {
+		v.fail(transaction, "expected counter %d after %d", previous.Counter+1, previous.Counter)
+	}
+
+	secured, err := domain.ParseSecuredData(transaction)
+	if err != nil {
+		v.fail(transaction, "%v", err)
+		return
+	}
+	// The device id of SecuredDataV1 is only part of the secured data at counter 0,
+	// where the rebuild compares it.
+	if secured.DeviceId != v.report.DeviceId {
+		v.fail(transaction, "secured data belongs to device %q", secured.DeviceId)
+	}
+	if secured.Counter != transaction.Counter {
+		v.fail(transaction, "secured data has counter %d", secured.Counter)
+	}
+	if secured.Operation != transaction.Operation {
+		v.fail(transaction, "secured data signs operation %q", secured.Operation)
+	}
+	if secured.Format == domain.SecuredDataV3 && !secured.SignedAt.Equal(transaction.CreatedAt) {
+		v.fail(transaction, "secured data was signed at %s, not at %s", secured.SignedAt, transaction.CreatedAt)
+	}
+	if previous != nil && previous.Counter == secured.Counter-1 && secured.LastSignature != previous.Signature {
+		v.fail(transaction, "does not chain to the signature of counter %d", previous.Counter)
+	}
+
+	toBeSigned, reported, err := secured.Encode()
+	if err != nil {
+		v.fail(transaction, "secured data cannot be rebuilt: %v", err)
+		return
+	}
+	if reported != transaction.SignedData {
+		v.fail(transaction, "secured data is not in canonical %s encoding", secured.Format)
+	}
+	if !Signature(v.key, toBeSigned, transaction.Signature) {
+		v.fail(transaction, "signature does not verify")
+	}
+}
+
+// Report returns the report of the transactions added so far.
+func (v *Verifier) Report() *Report {
+	report := v.report
+	report.Valid = len(report.Failures) == 0
+	return &report
+}
+
+// Transactions verifies a log of transactions of the device deviceId read from r:
+// a JSON array, a stream of JSON objects such as JSON lines, or the response of the
+// API listing the transactions of a device. If deviceId is empty, the device of the
+// first transaction is verified. Malformed input is an error, failed checks are part
+// of the report.
+func Transactions(r io.Reader, deviceId string, key crypto.PublicKey) (*Report, error) {
+	verifier := NewVerifier(deviceId, key)
+	if err := verifier.decode(r); err != nil {
+		return nil, err
+	}
+	return verifier.Report(), nil
+}
+
+// decode adds the transactions read from r.
+func (v *Verifier) decode(r io.Reader) error {
+	decoder := json.NewDecoder(r)
+	for {
+		var value json.RawMessage
+		err := decoder.Decode(&value)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading transactions: %w", err)
+		}
+
+		transactions, err := unmarshalTransactions(value)
+		if err != nil {
+			return fmt.Errorf("reading transactions: %w", err)
+		}
+		for _, transaction := range transactions {
+			v.Add(transaction)
+		}
+	}
+}
+
+// unmarshalTransactions returns the transactions of a JSON array, a transaction
+// object or a response envelope.
+func unmarshalTransactions(value json.RawMessage) ([]*domain.Transaction, error) {
+	var transactions []*domain.Transaction
+	if len(value) > 0 && value[0] == '[' {
+		err := json.Unmarshal(value, &transactions)
+		return transactions, err
+	}
+
+	var envelope struct {
+		Data []*domain.Transaction `json:"data"`
+	}
+	if err := json.Unmarshal(value, &envelope); err == nil && envelope.Data != nil {
+		return envelope.Data, nil
+	}
+
+	var transaction domain.Transaction
+	if err := json.Unmarshal(value, &transaction); err != nil {
+		return nil, err
+	}
+	return []*domain.Transaction{&transaction}, nil
+}
@@ -0,0 +1,261 @@
+package verify_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/export"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/verify"
+)
+
+// signedLog returns a device of algorithm and format with the transactions it signed
+// and its public key.
+func signedLog(t *testing.T, algorithm string, format domain.SecuredDataFormat) (*domain.SignatureDevice, []*domain.Transaction, crypto.PublicKey) {
+	ctx := context.Background()
+	device, err := domain.NewSignatureDevice("device", algorithm, "Device")
+	if err != nil {
+		t.Fatal(err)
+	}
+	device.SecuredDataFormat = format
+
+	var transactions []*domain.Transaction
+	for _, payload := range []domain.Payload{
+		domain.TextPayload("receipt"),
+		{Encoding: domain.PayloadBinary, Data: []byte{0x00, 0xff}},
+		domain.TextPayload("another receipt"),
+	} {
+		transaction, err := device.SignPayload(ctx, payload, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		transactions = append(transactions, transaction)
+	}
+	if format != domain.SecuredDataV1 {
+		fiscal, start, err := device.StartTransaction(ctx, "fiscal", domain.TextPayload("start"), time.Minute, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		load := func() (*domain.FiscalTransaction, error) { return fiscal, nil }
+		_, finish, err := device.FinishTransaction(ctx, load, domain.TextPayload("finish"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		transactions = append(transactions, start, finish)
+	}
+
+	publicKey, _ := device.PublicKey()
+	key, err := verify.ParsePublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return device, transactions, key
+}
+
+func check(deviceId string, key crypto.PublicKey, transactions []*domain.Transaction) *verify.Report {
+	verifier := verify.NewVerifier(deviceId, key)
+	for _, transaction := range transactions {
+		verifier.Add(transaction)
+	}
+	return verifier.Report()
+}
+
+func TestVerifierAcceptsEveryFormat(t *testing.T) {
+	for _, algorithm := range []string{"ECC", "RSA"} {
+		for _, format := range domain.SecuredDataFormats {
+			_, transactions, key := signedLog(t, algorithm, format)
+
+			report := check("device", key, transactions)
+			if !report.Valid || report.Transactions != len(transactions) {
+				t.Errorf("Expected a valid %s log in format %s, got %+v", algorithm, format, report)
+			}
+		}
+	}
+}
+
+func TestVerifierDetectsTampering(t *testing.T) {
+	for name, tamper := range map[string]func(transactions []*domain.Transaction) []*domain.Transaction{
+		"data": func(transactions []*domain.Transaction) []*domain.Transaction {
+			transactions[1].SignedData = strings.Replace(transactions[1].SignedData, "AP8=", "AP4=", 1)
+			return transactions
+		},
+		"counter gap": func(transactions []*domain.Transaction) []*domain.Transaction {
+			return append(transactions[:1], transactions[2:]...)
+		},
+		"signature": func(transactions []*domain.Transaction) []*domain.Transaction {
+			transactions[2].Signature = transactions[0].Signature
+			return transactions
+		},
+		"whitespace": func(transactions []*domain.Transaction) []*domain.Transaction {
+			transactions[0].SignedData = transactions[0].SignedData + " "
+			return transactions
+		},
+		"operation": func(transactions []*domain.Transaction) []*domain.Transaction {
+			transactions[4].Operation = domain.OperationUpdate
+			return transactions
+		},
+	} {
+		_, transactions, key := signedLog(t, "ECC", domain.SecuredDataV3)
+
+		report := check("device", key, tamper(transactions))
+		if report.Valid || len(report.Failures) == 0 {
+			t.Errorf("Expected tampered %s to fail verification", name)
+		}
+	}
+}
+
+func TestVerifierDetectsBrokenChain(t *testing.T) {
+	_, transactions, key := signedLog(t, "ECC", domain.SecuredDataV1)
+	// A log of another device with the same id does not chain to this one.
+	_, other, _ := signedLog(t, "ECC", domain.SecuredDataV1)
+
+	report := check("device", key, []*domain.Transaction{transactions[0], other[1]})
+	if report.Valid {
+		t.Fatalf("Expected a broken chain to fail verification")
+	}
+	found := false
+	for _, failure := range report.Failures {
+		found = found || strings.Contains(failure.Reason, "does not chain")
+	}
+	if !found {
+		t.Errorf("Expected a chain failure, got %v", report.Failures)
+	}
+}
+
+func TestVerifierRejectsOtherKey(t *testing.T) {
+	_, transactions, _ := signedLog(t, "ECC", domain.SecuredDataV2)
+	_, _, other := signedLog(t, "ECC", domain.SecuredDataV2)
+
+	if report := check("device", other, transactions); report.Valid {
+		t.Errorf("Expected signatures to fail with another key")
+	}
+}
+
+func TestTransactionsReadsStreamsAndArrays(t *testing.T) {
+	_, transactions, key := signedLog(t, "ECC", domain.SecuredDataV2)
+
+	var lines bytes.Buffer
+	encoder := json.NewEncoder(&lines)
+	for _, transaction := range transactions {
+		encoder.Encode(transaction)
+	}
+	array, _ := json.Marshal(transactions)
+	envelope, _ := json.Marshal(map[string]any{"data": transactions})
+
+	for name, input := range map[string][]byte{"lines": lines.Bytes(), "array": array, "envelope": envelope} {
+		report, err := verify.Transactions(bytes.NewReader(input), "", key)
+		if err != nil {
+			t.Fatalf("Unexpected error reading %s: %v", name, err)
+		}
+		if !report.Valid || report.DeviceId != "device" || report.Transactions != len(transactions) {
+			t.Errorf("Expected a valid log from %s, got %+v", name, report)
+		}
+	}
+
+	if _, err := verify.Transactions(strings.NewReader("{"), "", key); err == nil {
+		t.Errorf("Expected an error for malformed input")
+	}
+}
+
+// exported returns the export of a device with the transactions it signed.
+func exported(t *testing.T) ([]byte, crypto.PublicKey) {
+	device, transactions, key := signedLog(t, "ECC", domain.SecuredDataV2)
+	repo := persistence.NewInMemoryPersistence()
+	repo.SaveSignatureDevice(context.Background(), device)
+	for _, transaction := range transactions {
+		repo.SaveTransaction(context.Background(), persistence.NoFence, transaction, nil)
+	}
+
+	archive, err := export.Prepare(context.Background(), repo, device, export.Range{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	var buffer bytes.Buffer
+	if err := archive.Write(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes(), key
+}
+
+// rewrite returns archive with the content of the file name changed by change.
+func rewrite(t *testing.T, archive []byte, name string, change func([]byte) []byte) []byte {
+	var buffer bytes.Buffer
+	writer := tar.NewWriter(&buffer)
+	reader := tar.NewReader(bytes.NewReader(archive))
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(reader)
+		if header.Name == name {
+			content = change(content)
+			header.Size = int64(len(content))
+		}
+		writer.WriteHeader(header)
+		writer.Write(content)
+	}
+	writer.Close()
+	return buffer.Bytes()
+}
+
+func TestExport(t *testing.T) {
+	archive, key := exported(t)
+	if !verify.IsExport(archive) {
+		t.Errorf("Expected the export to be recognized")
+	}
+
+	for name, given := range map[string]crypto.PublicKey{"given key": key, "exported key": nil} {
+		report, err := verify.Export(bytes.NewReader(archive), given)
+		if err != nil {
+			t.Fatalf("Unexpected error with the %s: %v", name, err)
+		}
+		if !report.Valid || report.DeviceId != "device" || report.Transactions != 5 {
+			t.Errorf("Expected a valid export with the %s, got %+v", name, report)
+		}
+	}
+}
+
+func TestExportDetectsTampering(t *testing.T) {
+	archive, key := exported(t)
+	_, _, other := signedLog(t, "ECC", domain.SecuredDataV2)
+
+	for name, test := range map[string]struct {
+		archive []byte
+		key     crypto.PublicKey
+		file    string
+	}{
+		"csv": {rewrite(t, archive, export.TransactionsCSVFile, func(content []byte) []byte {
+			return bytes.Replace(content, []byte("receipt"), []byte("RECEIPT"), 1)
+		}), key, export.TransactionsCSVFile},
+		"manifest": {rewrite(t, archive, export.ManifestFile, func(content []byte) []byte {
+			return bytes.Replace(content, []byte(`"transactions": 5`), []byte(`"transactions": 6`), 1)
+		}), key, export.ManifestSignatureFile},
+		"key": {archive, other, export.PublicKeyFile},
+	} {
+		report, err := verify.Export(bytes.NewReader(test.archive), test.key)
+		if err != nil {
+			t.Fatalf("Unexpected error for tampered %s: %v", name, err)
+		}
+		found := false
+		for _, failure := range report.Failures {
+			found = found || failure.File == test.file
+		}
+		if report.Valid || !found {
+			t.Errorf("Expected tampered %s to fail on %s, got %v", name, test.file, report.Failures)
+		}
+	}
+}
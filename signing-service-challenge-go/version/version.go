@@ -0,0 +1,18 @@
+// Package version holds the build version and commit of the service. Both are
+// injected at build time:
+//
+//	go build -ldflags "-X github.com/fiskaly/coding-challenges/signing-service-challenge/version.Version=1.2.0 \
+//	  -X github.com/fiskaly/coding-challenges/signing-service-challenge/version.Commit=$(git rev-parse --short HEAD)"
+package version
+
+var (
+	// Version is the released version of the build, dev for local builds.
+	Version = "dev"
+	// Commit is the commit the build was made from.
+	Commit = "unknown"
+)
+
+// Release identifies the build as its version with the commit as build metadata, e.g. 1.2.0+3f2c1ab.
+func Release() string {
+	return Version + "+" + Commit
+}
@@ -0,0 +1,302 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+// Consumer is the name under which the Dispatcher keeps its cursor in the outbox.
+const Consumer = "webhooks"
+
+// fanOutBatch is the number of events read from the outbox at once.
+const fanOutBatch = 100
+
+// deliveryConcurrency is the number of webhooks delivered to at once.
+const deliveryConcurrency = 16
+
+// errInternalAddress is the error of a delivery to an address that is not a
+// domain.PublicWebhookAddress.
+var errInternalAddress = errors.New("webhook address is not public")
+
+// deliveryNamespace derives the ids of the deliveries from their webhook and event.
+var deliveryNamespace = uuid.MustParse("5b0c7c6e-2f4a-4d59-9a43-3c1a54e0c0d1")
+
+// Dispatcher delivers the events of the outbox of a repository to the webhooks
+// subscribed to them. Deliveries that fail are retried with exponential backoff
+// until they run out of attempts and are dead.
+//
+// Events are delivered at least once: a delivery whose response is lost is
+// attempted again, and receivers drop duplicates by the IdHeader. The deliveries
+// of a webhook are attempted in order, those of different webhooks concurrently.
+type Dispatcher struct {
+	repo        persistence.Repository
+	client      *http.Client
+	timeout     time.Duration
+	maxAttempts int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	now         func() time.Time
+}
+
+// Option configures optional behavior of a Dispatcher.
+type Option func(*Dispatcher)
+
+// WithHTTPClient sends the deliveries with client instead of one that only dials
+// public addresses. Tests use it to deliver to receivers on the loopback interface.
+func WithHTTPClient(client *http.Client) Option {
+	return func(d *Dispatcher) {
+		d.client = client
+	}
+}
+
+// WithTimeout bounds every attempt of a delivery, 10 seconds by default.
+func WithTimeout(timeout time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.timeout = timeout
+	}
+}
+
+// WithRetries gives every delivery maxAttempts attempts. The delay after the
+// first failed attempt is minBackoff and doubles with every further one up to
+// maxBackoff.
+func WithRetries(maxAttempts int, minBackoff, maxBackoff time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.maxAttempts, d.minBackoff, d.maxBackoff = maxAttempts, minBackoff, maxBackoff
+	}
+}
+
+// NewDispatcher creates a Dispatcher of the outbox of repo.
+func NewDispatcher(repo persistence.Repository, options ...Option) *Dispatcher {
+	dispatcher := &Dispatcher{
+		repo:        repo,
+		timeout:     10 * time.Second,
+		maxAttempts: 10,
+		minBackoff:  10 * time.Second,
+		maxBackoff:  time.Hour,
+		now:         time.Now,
+	}
+
+	for _, option := range options {
+		option(dispatcher)
+	}
+	if dispatcher.client == nil {
+		dispatcher.client = publicClient(dispatcher.timeout)
+	}
+
+	return dispatcher
+}
+
+// publicClient returns an http.Client that only connects to public addresses. They
+// are checked as they are dialed, after the host name of a webhook is resolved and
+// for every redirect, so that a name resolving to an internal address is refused
+// as well.
+func publicClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: dialPublic}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would be dialed instead of the webhook.
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// dialPublic is the net.Dialer Control of publicClient, which refuses addresses
+// that are not a domain.PublicWebhookAddress.
+func dialPublic(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !domain.PublicWebhookAddress(addr) {
+		return fmt.Errorf("%w: %s", errInternalAddress, addr)
+	}
+	return nil
+}
+
+// Dispatch turns the events recorded since its last call into deliveries and
+// attempts every delivery that is due.
+func (d *Dispatcher) Dispatch(ctx context.Context) error {
+	if err := d.fanOut(ctx); err != nil {
+		return err
+	}
+	return d.deliver(ctx)
+}
+
+// fanOut creates a delivery of every new event for every webhook subscribed to it.
+// The cursor advances after the deliveries of a batch are stored, and deliveries
+// are identified by their webhook and event, so a batch interrupted midway is
+// completed without duplicates.
+func (d *Dispatcher) fanOut(ctx context.Context) error {
+	cursor, err := d.repo.GetEventCursor(ctx, Consumer)
+	if err != nil {
+		return err
+	}
+
+	for {
+		events, err := d.repo.ListEvents(ctx, cursor, fanOutBatch)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+
+		for _, event := range events {
+			webhooks, err := d.repo.ListWebhooks(ctx, event.TenantId)
+			if err != nil {
+				return err
+			}
+			for _, webhook := range webhooks {
+				// Webhooks receive the events that occur after they are created.
+				if !webhook.Subscribes(event.Type) || webhook.CreatedAt.After(event.OccurredAt) {
+					continue
+				}
+				id := uuid.NewSHA1(deliveryNamespace, []byte(webhook.Id+"/"+event.Id)).String()
+				if _, err := d.repo.GetWebhookDelivery(ctx, webhook.TenantId, id); err == nil {
+					continue
+				}
+				if err := d.repo.SaveWebhookDelivery(ctx, domain.NewWebhookDelivery(id, webhook, event)); err != nil {
+					return err
+				}
+			}
+		}
+
+		cursor = events[len(events)-1].Sequence
+		if err := d.repo.SaveEventCursor(ctx, Consumer, cursor); err != nil {
+			return err
+		}
+	}
+}
+
+// deliver attempts the deliveries that are due. The deliveries of every webhook
+// are attempted in order, and up to deliveryConcurrency webhooks at once, so that
+// a slow or unreachable endpoint only delays its own deliveries.
+func (d *Dispatcher) deliver(ctx context.Context) error {
+	due, err := d.repo.ListDueWebhookDeliveries(ctx, d.now())
+	if err != nil {
+		return err
+	}
+
+	var webhooks []string
+	deliveries := make(map[string][]*domain.WebhookDelivery)
+	for _, pending := range due {
+		key := pending.TenantId + "/" + pending.WebhookId
+		if _, ok := deliveries[key]; !ok {
+			webhooks = append(webhooks, key)
+		}
+		deliveries[key] = append(deliveries[key], pending)
+	}
+
+	var mutex sync.Mutex
+	var errs []error
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, deliveryConcurrency)
+	for _, key := range webhooks {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(due []*domain.WebhookDelivery) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			err := d.deliverTo(ctx, due)
+			mutex.Lock()
+			errs = append(errs, err)
+			mutex.Unlock()
+		}(deliveries[key])
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// deliverTo attempts the due deliveries of a webhook in order.
+func (d *Dispatcher) deliverTo(ctx context.Context, due []*domain.WebhookDelivery) error {
+	webhook, err := d.repo.GetWebhook(ctx, due[0].TenantId, due[0].WebhookId)
+	if errors.Is(err, domain.ErrWebhookNotFound) {
+		// The webhook was deleted since the deliveries were listed.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, pending := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		// The delivery is copied, since the repository may share it with readers.
+		delivery := *pending
+		d.attempt(ctx, webhook, &delivery)
+		errs = append(errs, d.repo.SaveWebhookDelivery(ctx, &delivery))
+	}
+	return errors.Join(errs...)
+}
+
+// attempt posts the event of delivery to the webhook and records the outcome. The
+// attempt is bounded by the timeout of the Dispatcher, whatever client sends it.
+func (d *Dispatcher) attempt(ctx context.Context, webhook *domain.Webhook, delivery *domain.WebhookDelivery) {
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	now := d.now()
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		delivery.Fail(now, 0, err.Error(), time.Time{})
+		return
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		delivery.Fail(now, 0, err.Error(), time.Time{})
+		return
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(IdHeader, delivery.Event.Id)
+	request.Header.Set(EventHeader, string(delivery.Event.Type))
+	request.Header.Set(SignatureHeader, Sign(webhook.Secret, now, body))
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		delivery.Fail(now, 0, err.Error(), d.next(delivery.Attempts+1, now))
+		return
+	}
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+	response.Body.Close()
+
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		delivery.Succeed(now, response.StatusCode)
+		return
+	}
+	delivery.Fail(now, response.StatusCode, fmt.Sprintf("webhook responded with status %d", response.StatusCode), d.next(delivery.Attempts+1, now))
+}
+
+// next returns when a delivery is attempted again after its attempts-th failed
+// attempt at now, or the zero time if it ran out of attempts.
+func (d *Dispatcher) next(attempts int, now time.Time) time.Time {
+	if attempts >= d.maxAttempts {
+		return time.Time{}
+	}
+	backoff := d.minBackoff
+	for i := 1; i < attempts && backoff < d.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > d.maxBackoff {
+		backoff = d.maxBackoff
+	}
+	return now.Add(backoff)
+}
@@ -0,0 +1,259 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+// receiver records the events delivered to it, responding with status.
+type receiver struct {
+	t      *testing.T
+	secret string
+	// now is the time deliveries are received at, the current time if nil.
+	now    func() time.Time
+	mutex  sync.Mutex
+	status int
+	events []domain.Event
+}
+
+func (r *receiver) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	body, _ := io.ReadAll(request.Body)
+	now := time.Now()
+	if r.now != nil {
+		now = r.now()
+	}
+	if err := Verify(r.secret, request.Header.Get(SignatureHeader), body, now, time.Minute); err != nil {
+		r.t.Errorf("Expected a valid signature, got %v", err)
+	}
+
+	var event domain.Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		r.t.Errorf("Error unmarshaling delivery: %v", err)
+	}
+	if request.Header.Get(IdHeader) != event.Id || request.Header.Get(EventHeader) != string(event.Type) {
+		r.t.Errorf("Expected the headers of event %s, got %s and %s", event.Id, request.Header.Get(IdHeader), request.Header.Get(EventHeader))
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.events = append(r.events, event)
+	response.WriteHeader(r.status)
+}
+
+func (r *receiver) received() []domain.Event {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]domain.Event{}, r.events...)
+}
+
+// newWebhook stores a webhook of url subscribed to events. NewWebhook refuses the
+// loopback addresses httptest serves on, so the url is set after it is created.
+func newWebhook(t *testing.T, repo persistence.Repository, url string, events ...domain.EventType) *domain.Webhook {
+	webhook, err := domain.NewWebhook(url, "https://example.com/hook", events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	webhook.URL = url
+	webhook.CreatedAt = webhook.CreatedAt.Add(-time.Minute)
+	if err := repo.SaveWebhook(context.Background(), webhook); err != nil {
+		t.Fatal(err)
+	}
+	return webhook
+}
+
+// sign records the events of a device that is created and signs once.
+func sign(t *testing.T, repo persistence.Repository) *domain.SignatureDevice {
+	device, err := domain.NewSignatureDevice("device", "ECC", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, _ := domain.NewEvent("created", domain.EventDeviceCreated, device, device)
+	if err := repo.SaveSignatureDevice(context.Background(), device, created); err != nil {
+		t.Fatal(err)
+	}
+
+	transaction := &domain.Transaction{DeviceId: device.Id, Signature: "signature"}
+	signed, _ := domain.NewEvent("signed", domain.EventTransactionSigned, device, transaction)
+	if err := repo.SaveTransaction(context.Background(), persistence.NoFence, transaction, nil, signed); err != nil {
+		t.Fatal(err)
+	}
+	return device
+}
+
+func TestDispatcherDeliversSubscribedEvents(t *testing.T) {
+	repo := persistence.NewInMemoryPersistence()
+	all := &receiver{t: t, status: http.StatusOK}
+	signed := &receiver{t: t, status: http.StatusNoContent}
+	allServer, signedServer := httptest.NewServer(all), httptest.NewServer(signed)
+	defer allServer.Close()
+	defer signedServer.Close()
+	all.secret = newWebhook(t, repo, allServer.URL).Secret
+	signed.secret = newWebhook(t, repo, signedServer.URL, domain.EventTransactionSigned).Secret
+
+	sign(t, repo)
+	dispatcher := NewDispatcher(repo, WithHTTPClient(http.DefaultClient))
+	for i := 0; i < 2; i++ {
+		if err := dispatcher.Dispatch(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if events := all.received(); len(events) != 2 || events[0].Id != "created" || events[1].Id != "signed" {
+		t.Errorf("Expected both events once in order, got %+v", events)
+	}
+	if events := signed.received(); len(events) != 1 || events[0].Type != domain.EventTransactionSigned {
+		t.Errorf("Expected the signed event once, got %+v", events)
+	}
+
+	deliveries, _ := repo.ListWebhookDeliveries(context.Background(), "", allServer.URL, domain.DeliveryDelivered)
+	if len(deliveries) != 2 || deliveries[0].Attempts != 1 || deliveries[0].LastStatus != http.StatusOK {
+		t.Errorf("Expected 2 deliveries after one attempt each, got %+v", deliveries)
+	}
+}
+
+func TestDispatcherRetriesUntilDead(t *testing.T) {
+	repo := persistence.NewInMemoryPersistence()
+	failing := &receiver{t: t, status: http.StatusServiceUnavailable}
+	server := httptest.NewServer(failing)
+	defer server.Close()
+	failing.secret = newWebhook(t, repo, server.URL, domain.EventDeviceCreated).Secret
+	sign(t, repo)
+
+	now := time.Now()
+	dispatcher := NewDispatcher(repo, WithHTTPClient(http.DefaultClient), WithRetries(3, time.Minute, 90*time.Second))
+	dispatcher.now = func() time.Time { return now }
+	failing.now = dispatcher.now
+
+	// The deliveries are attempted after 0, 1 and 2.5 minutes.
+	expected := []time.Duration{time.Minute, 90 * time.Second}
+	for attempt := 1; attempt <= 3; attempt++ {
+		if err := dispatcher.Dispatch(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if err := dispatcher.Dispatch(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if received := len(failing.received()); received != attempt {
+			t.Fatalf("Expected %d attempts, got %d", attempt, received)
+		}
+
+		delivery := deliveries(t, repo, server.URL)[0]
+		if attempt < 3 {
+			if delivery.State != domain.DeliveryPending || !delivery.NextAttemptAt.Equal(now.Add(expected[attempt-1])) {
+				t.Errorf("Expected attempt %d to be retried at %s, got %s at %s", attempt, now.Add(expected[attempt-1]), delivery.State, delivery.NextAttemptAt)
+			}
+			now = delivery.NextAttemptAt
+		} else if delivery.State != domain.DeliveryDead || delivery.LastStatus != http.StatusServiceUnavailable {
+			t.Errorf("Expected a dead delivery after %d attempts, got %s with status %d", attempt, delivery.State, delivery.LastStatus)
+		}
+	}
+
+	now = now.Add(24 * time.Hour)
+	dispatcher.Dispatch(context.Background())
+	if received := len(failing.received()); received != 3 {
+		t.Errorf("Expected dead deliveries not to be attempted, got %d attempts", received)
+	}
+
+	failing.mutex.Lock()
+	failing.status = http.StatusOK
+	failing.mutex.Unlock()
+	retried := *deliveries(t, repo, server.URL)[0]
+	retried.Retry(now)
+	repo.SaveWebhookDelivery(context.Background(), &retried)
+	dispatcher.Dispatch(context.Background())
+	if delivery := deliveries(t, repo, server.URL)[0]; delivery.State != domain.DeliveryDelivered || delivery.Attempts != 1 {
+		t.Errorf("Expected the retried delivery to be delivered, got %s after %d attempts", delivery.State, delivery.Attempts)
+	}
+}
+
+func TestDispatcherSkipsEventsBeforeWebhook(t *testing.T) {
+	repo := persistence.NewInMemoryPersistence()
+	sign(t, repo)
+
+	webhook, _ := domain.NewWebhook("late", "https://example.com/late", nil)
+	repo.SaveWebhook(context.Background(), webhook)
+	if err := NewDispatcher(repo).Dispatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if found := deliveries(t, repo, "late"); len(found) != 0 {
+		t.Errorf("Expected no deliveries of earlier events, got %d", len(found))
+	}
+	if cursor, _ := repo.GetEventCursor(context.Background(), Consumer); cursor != 2 {
+		t.Errorf("Expected cursor 2, got %d", cursor)
+	}
+}
+
+func TestDispatcherRefusesInternalAddresses(t *testing.T) {
+	repo := persistence.NewInMemoryPersistence()
+	internal := &receiver{t: t, status: http.StatusOK}
+	server := httptest.NewServer(internal)
+	defer server.Close()
+	newWebhook(t, repo, server.URL, domain.EventDeviceCreated)
+	sign(t, repo)
+
+	if err := NewDispatcher(repo).Dispatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if received := len(internal.received()); received != 0 {
+		t.Errorf("Expected no deliveries to the loopback interface, got %d", received)
+	}
+	delivery := deliveries(t, repo, server.URL)[0]
+	if delivery.State != domain.DeliveryPending || !strings.Contains(delivery.LastError, errInternalAddress.Error()) {
+		t.Errorf("Expected the delivery to fail on the address, got %s: %s", delivery.State, delivery.LastError)
+	}
+}
+
+func TestSlowWebhookDoesNotDelayOthers(t *testing.T) {
+	repo := persistence.NewInMemoryPersistence()
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		select {
+		case <-release:
+		case <-request.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+	fast := &receiver{t: t, status: http.StatusOK}
+	fastServer := httptest.NewServer(fast)
+	defer fastServer.Close()
+	newWebhook(t, repo, slow.URL, domain.EventDeviceCreated)
+	fast.secret = newWebhook(t, repo, fastServer.URL, domain.EventDeviceCreated).Secret
+	sign(t, repo)
+
+	dispatcher := NewDispatcher(repo, WithHTTPClient(http.DefaultClient), WithTimeout(time.Second))
+	start := time.Now()
+	if err := dispatcher.Dispatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the slow webhook to time out after a second, took %s", elapsed)
+	}
+	if received := len(fast.received()); received != 1 {
+		t.Errorf("Expected the fast webhook to receive the event, got %d deliveries", received)
+	}
+	if delivery := deliveries(t, repo, slow.URL)[0]; delivery.State != domain.DeliveryPending || delivery.LastError == "" {
+		t.Errorf("Expected the slow delivery to be retried after timing out, got %s: %s", delivery.State, delivery.LastError)
+	}
+}
+
+func deliveries(t *testing.T, repo persistence.Repository, webhookId string) []*domain.WebhookDelivery {
+	found, err := repo.ListWebhookDeliveries(context.Background(), "", webhookId, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
@@ -0,0 +1,79 @@
+// Package webhook delivers the events of the outbox of a repository to the
+// webhooks subscribed to them, and signs their deliveries so that receivers can
+// tell them from forgeries.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The headers of a delivery.
+const (
+	// SignatureHeader carries t=<unix time>,v1=<signature>, where the signature
+	// is the hex encoded HMAC-SHA256 of "<unix time>.<body>" keyed with the secret
+	// of the webhook.
+	SignatureHeader = "Webhook-Signature"
+	// IdHeader carries the id of the event, which stays the same across the
+	// attempts of a delivery so that receivers can drop duplicates.
+	IdHeader = "Webhook-Id"
+	// EventHeader carries the type of the event.
+	EventHeader = "Webhook-Event"
+)
+
+// ErrInvalidSignature is returned by Verify for deliveries that were not signed
+// with the secret of the webhook, or not recently enough.
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Sign returns the SignatureHeader of a delivery of body sent at timestamp.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + unix + ",v1=" + hex.EncodeToString(mac(secret, unix, body))
+}
+
+// Verify checks the SignatureHeader header of a delivery of body received at now.
+// Signatures older than tolerance are rejected, so that a captured delivery
+// cannot be replayed later.
+func Verify(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var unix string
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch name {
+		case "t":
+			unix = value
+		case "v1":
+			if signature, err := hex.DecodeString(value); err == nil {
+				signatures = append(signatures, signature)
+			}
+		}
+	}
+
+	seconds, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > tolerance || age < -tolerance {
+		return ErrInvalidSignature
+	}
+	expected := mac(secret, unix, body)
+	for _, signature := range signatures {
+		if hmac.Equal(signature, expected) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// mac returns the HMAC-SHA256 of a body sent at the unix time.
+func mac(secret, unix string, body []byte) []byte {
+	hash := hmac.New(sha256.New, []byte(secret))
+	hash.Write([]byte(unix + "."))
+	hash.Write(body)
+	return hash.Sum(nil)
+}
@@ -0,0 +1,36 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"id":"event"}`)
+	header := Sign("secret", now, body)
+
+	if err := Verify("secret", header, body, now.Add(time.Minute), 5*time.Minute); err != nil {
+		t.Errorf("Expected the signature to verify, got %v", err)
+	}
+
+	cases := map[string]struct {
+		secret string
+		header string
+		body   string
+		now    time.Time
+	}{
+		"other secret":  {"other", header, string(body), now},
+		"other body":    {"secret", header, `{"id":"other"}`, now},
+		"replayed":      {"secret", header, string(body), now.Add(time.Hour)},
+		"no timestamp":  {"secret", header[len("t=1700000000,"):], string(body), now},
+		"no signature":  {"secret", "t=1700000000", string(body), now},
+		"empty header":  {"secret", "", string(body), now},
+		"bad signature": {"secret", "t=1700000000,v1=zz", string(body), now},
+	}
+	for name, c := range cases {
+		if err := Verify(c.secret, c.header, []byte(c.body), c.now, 5*time.Minute); err != ErrInvalidSignature {
+			t.Errorf("Expected %v for %s, got %v", ErrInvalidSignature, name, err)
+		}
+	}
+}